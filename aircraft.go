@@ -0,0 +1,204 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// aircraftDefaultAddress is where the Export.lua hook sends the aircraft name
+const aircraftDefaultAddress = "127.0.0.1:5011"
+
+// exportScriptName is the Export.lua hook installed into Saved Games\DCS\Scripts
+const exportScriptName = "GOMFDExport.lua"
+
+//go:embed scripts/GOMFDExport.lua
+var exportScript []byte
+
+// AircraftSettings is where GOMFD listens for the Export.lua hook
+type AircraftSettings struct {
+	Address string `json:"address,omitempty"`
+}
+
+// AircraftDetector receives the name of the flown aircraft from the Export.lua hook, the name is empty outside a mission
+type AircraftDetector struct {
+	conn    *net.UDPConn
+	mu      sync.Mutex
+	current string
+	known   bool
+	changes chan string
+}
+
+// listenAircraft starts listening for the Export.lua hook
+func listenAircraft(address string) (*AircraftDetector, error) {
+	if address == "" {
+		address = aircraftDefaultAddress
+	}
+	local, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, classify(ErrConfiguration, fmt.Errorf("invalid aircraft detection address %s: %w", address, err))
+	}
+	conn, err := net.ListenUDP("udp4", local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the aircraft on %s: %w", address, err)
+	}
+	detector := &AircraftDetector{conn: conn, changes: make(chan string, 1)}
+	go detector.receive()
+	return detector, nil
+}
+
+func (d *AircraftDetector) receive() {
+	buffer := make([]byte, 1024)
+	for {
+		n, _, err := d.conn.ReadFromUDP(buffer)
+		if err != nil {
+			close(d.changes)
+			return
+		}
+		name, ok := strings.CutPrefix(strings.TrimSpace(string(buffer[:n])), "aircraft=")
+		if !ok {
+			continue
+		}
+		d.mu.Lock()
+		changed := !d.known || name != d.current
+		d.current, d.known = name, true
+		d.mu.Unlock()
+		if changed {
+			instance.Infof("Detected aircraft %q", name)
+			// Only the latest change matters to a slow reader
+			select {
+			case <-d.changes:
+			default:
+			}
+			d.changes <- name
+		}
+	}
+}
+
+// Current returns the aircraft last reported and whether the hook reported one yet
+func (d *AircraftDetector) Current() (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.current, d.known
+}
+
+// Changes receives the aircraft name every time it changes
+func (d *AircraftDetector) Changes() <-chan string {
+	return d.changes
+}
+
+func (d *AircraftDetector) Close() error {
+	return d.conn.Close()
+}
+
+// detectAircraft waits up to timeout for the Export.lua hook to report an aircraft
+func detectAircraft(timeout time.Duration) (string, error) {
+	address := ""
+	if settings := currentSettings(); settings != nil {
+		address = settings.Aircraft.Address
+	}
+	detector, err := listenAircraft(address)
+	if err != nil {
+		return "", err
+	}
+	defer detector.Close()
+	instance.Log("Waiting for DCS to report the aircraft")
+	deadline := time.After(timeout)
+	for {
+		select {
+		case name, ok := <-detector.Changes():
+			if ok && name != "" {
+				return name, nil
+			}
+		case <-deadline:
+			return "", errors.New("no aircraft was reported, is DCS running a mission with the GOMFD Export.lua hook installed")
+		}
+	}
+}
+
+// moduleFlies is true when the module is made for the DCS aircraft, by its tag or one of its aircraftIds
+func moduleFlies(module *Module, aircraft string) bool {
+	if strings.EqualFold(module.Tag, aircraft) {
+		return true
+	}
+	for _, id := range module.AircraftIDs {
+		if strings.EqualFold(id, aircraft) {
+			return true
+		}
+	}
+	return false
+}
+
+// dcsScriptsFolder is the Scripts folder of the DCS saved games
+func dcsScriptsFolder(settings *MfdConfig) string {
+	return filepath.Join(dcsSavedGamesFolder(settings), "Scripts")
+}
+
+// installExportScript writes the hook into the Scripts folder and loads it from Export.lua unless it already does
+func installExportScript(folder string) error {
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(folder, exportScriptName), exportScript, 0644); err != nil {
+		return err
+	}
+	exportFile := filepath.Join(folder, "Export.lua")
+	existing, err := os.ReadFile(exportFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if strings.Contains(string(existing), exportScriptName) {
+		return nil
+	}
+	line := fmt.Sprintf("dofile(lfs.writedir() .. [[Scripts\\%s]])\n", exportScriptName)
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		line = "\n" + line
+	}
+	file, err := os.OpenFile(exportFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(line)
+	return err
+}
+
+func newInstallExportCommand() *Command {
+	cmd := newCommand("install-export", "", "Install the Export.lua hook that tells GOMFD which aircraft is flown")
+	cmd.Run = func(args []string) error {
+		folder := dcsScriptsFolder(currentSettings())
+		if err := installExportScript(folder); err != nil {
+			return fmt.Errorf("failed to install the Export.lua hook into %s: %w", folder, err)
+		}
+		instance.Infof("Installed %s into %s", exportScriptName, folder)
+		return nil
+	}
+	return cmd
+}
+
+func newAircraftCommand() *Command {
+	cmd := newCommand("aircraft", "", "Wait for DCS to report the flown aircraft and print it with the matching modules")
+	timeout := cmd.Flags.Duration("timeout", time.Minute, "How long to wait for DCS")
+	cmd.Run = func(args []string) error {
+		name, err := detectAircraft(*timeout)
+		if err != nil {
+			return err
+		}
+		fmt.Println(name)
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		for _, module := range filterModules(env.Modules, Selection{Aircraft: name}) {
+			fmt.Printf("  %s (%s)\n", module.Name, module.DisplayName)
+		}
+		return nil
+	}
+	return cmd
+}
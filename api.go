@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// displayControl lets the API change the pages of the displays this process shows
+type displayControl struct {
+	mu      sync.Mutex
+	windows []*DisplayWindow
+	apply   func(action PageAction)
+}
+
+// shownDisplays are the displays of this process, apply is nil while none are shown
+var shownDisplays displayControl
+
+// Attach makes the windows selectable, apply runs an action on the thread owning them
+func (c *displayControl) Attach(windows []*DisplayWindow, apply func(action PageAction)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.windows, c.apply = windows, apply
+}
+
+func (c *displayControl) Detach() {
+	c.Attach(nil, nil)
+}
+
+// Select checks the action against the shown displays and hands it to their thread, it only reads the names so it never races the windows
+func (c *displayControl) Select(action PageAction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.apply == nil {
+		return errNoDisplays
+	}
+	if err := action.validate("the request"); err != nil {
+		return err
+	}
+	window := findDisplayWindow(c.windows, action.Display)
+	if window == nil {
+		return classify(ErrConfiguration, fmt.Errorf("display %s is not shown", action.Display))
+	}
+	if action.Step() != 0 && !window.Switch {
+		return classify(ErrConfiguration, fmt.Errorf("%s is not a switch, set useAsSwitch to turn it", action.Display))
+	}
+	if action.Step() == 0 && !hasPage(window, action.Configuration) {
+		return classify(ErrConfiguration, fmt.Errorf("%s has no configuration %s", action.Display, action.Configuration))
+	}
+	c.apply(action)
+	return nil
+}
+
+// Displays lists the shown displays with their pages
+func (c *displayControl) Displays() []displayInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	displays := []displayInfo{}
+	for _, window := range c.windows {
+		info := displayInfo{Name: window.Display, Module: window.Module, Switch: window.Switch}
+		for _, page := range window.Pages {
+			info.Pages = append(info.Pages, page.Configuration)
+		}
+		displays = append(displays, info)
+	}
+	return displays
+}
+
+// Resolve finds the display of a select request, with only a configuration it is the display that has it as a page
+func (c *displayControl) Resolve(module string, display string, configuration string) (PageAction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.apply == nil {
+		return PageAction{}, errNoDisplays
+	}
+	if module != "" && len(c.windows) > 0 && !strings.EqualFold(c.windows[0].Module, module) {
+		return PageAction{}, classify(ErrConfiguration, fmt.Errorf("module %s is not shown, the displays show %s", module, c.windows[0].Module))
+	}
+	if display != "" {
+		return PageAction{Display: display, Configuration: configuration}, nil
+	}
+	displays := displayOfConfiguration(c.windows, module, configuration)
+	switch len(displays) {
+	case 0:
+		return PageAction{}, classify(ErrConfiguration, fmt.Errorf("no display shows configuration %s", configuration))
+	case 1:
+		return PageAction{Display: displays[0], Configuration: configuration}, nil
+	}
+	return PageAction{}, classify(ErrConfiguration, fmt.Errorf("configuration %s is on %s, pick one with -display", configuration, strings.Join(displays, " and ")))
+}
+
+var errNoDisplays = errors.New("no displays are shown by this gomfd, they are shown by gomfd display")
+
+func hasPage(window *DisplayWindow, configurationName string) bool {
+	for _, page := range window.Pages {
+		if strings.EqualFold(page.Configuration, configurationName) {
+			return true
+		}
+	}
+	return false
+}
+
+// displayInfo is a shown display in the API responses
+type displayInfo struct {
+	Name   string   `json:"name"`
+	Module string   `json:"module"`
+	Switch bool     `json:"switch"`
+	Pages  []string `json:"pages"`
+}
+
+// generateResult is the response of a generate request
+type generateResult struct {
+	Module   string   `json:"module"`
+	Rendered int      `json:"rendered"`
+	Skipped  int      `json:"skipped"`
+	Failures []string `json:"failures,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		instance.Debugf("Failed to write the API response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, errNoDisplays):
+		status = http.StatusConflict
+	case errors.Is(err, ErrConfiguration):
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// apiResource splits /<collection>/<name>/<verb> into the name and verb
+func apiResource(path string, collection string) (string, string, bool) {
+	name, verb, ok := strings.Cut(strings.TrimPrefix(path, "/"+collection+"/"), "/")
+	return name, verb, ok && name != "" && !strings.Contains(verb, "/")
+}
+
+// generateModule renders a module, or one of its configurations, for the control APIs, the report is nil when the settings could not be loaded
+func generateModule(ctx context.Context, name string, configuration string, force bool) (*RunReport, error) {
+	env, err := loadEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	report := NewRunReport(RunOptions{ContinueOnError: true, Force: force})
+	renderMu.Lock()
+	defer renderMu.Unlock()
+	_, _, err = generateModules(ctx, env, Selection{ModuleName: name, ConfigurationName: configuration}, report)
+	return report, err
+}
+
+// serveModulesAPI lists the modules on GET /modules and renders one on POST /modules/{name}/generate, ?sub= and ?force=true narrow and force it
+func serveModulesAPI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/modules" || r.URL.Path == "/modules/" {
+		env, err := loadEnvironment()
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+		var names []string
+		for _, module := range env.Modules {
+			names = append(names, module.Name)
+		}
+		writeJSON(w, http.StatusOK, names)
+		return
+	}
+	name, verb, ok := apiResource(r.URL.Path, "modules")
+	if !ok || verb != "generate" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	report, err := generateModule(r.Context(), name, r.URL.Query().Get("sub"), r.URL.Query().Get("force") == "true")
+	if err != nil && (report == nil || report.Rendered == 0 && len(report.Failures) == 0) {
+		writeAPIError(w, err)
+		return
+	}
+	result := generateResult{Module: name, Rendered: report.Rendered, Skipped: report.Skipped}
+	for _, failure := range report.Failures {
+		result.Failures = append(result.Failures, failure.String())
+	}
+	status := http.StatusOK
+	if err != nil {
+		result.Error = err.Error()
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, result)
+}
+
+// serveDisplaysAPI lists the shown displays on GET /displays and changes a page on POST /displays/{name}/select
+// with a JSON body or query of {"configuration": "..."} or {"action": "next"}
+func serveDisplaysAPI(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/displays" || r.URL.Path == "/displays/" {
+		writeJSON(w, http.StatusOK, shownDisplays.Displays())
+		return
+	}
+	name, verb, ok := apiResource(r.URL.Path, "displays")
+	if !ok || verb != "select" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	action := PageAction{Configuration: r.URL.Query().Get("configuration"), Action: r.URL.Query().Get("action")}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&action); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	action.Display = name
+	if action.Configuration == "" && action.Action == "" {
+		http.Error(w, "select needs a configuration or an action", http.StatusBadRequest)
+		return
+	}
+	if err := shownDisplays.Select(action); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, action)
+}
+
+// addControlAPI routes the module and display endpoints external tools drive GOMFD with
+func addControlAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/modules", serveModulesAPI)
+	mux.HandleFunc("/modules/", serveModulesAPI)
+	mux.HandleFunc("/displays", serveDisplaysAPI)
+	mux.HandleFunc("/displays/", serveDisplaysAPI)
+}
+
+// startControlAPI serves the control API in the background, a failure to listen is only logged so the displays still show
+func startControlAPI(address string) {
+	mux := http.NewServeMux()
+	addControlAPI(mux)
+	instance.Infof("Serving the control API on http://%s/", address)
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			instance.Errorf("The control API stopped: %v", err)
+		}
+	}()
+}
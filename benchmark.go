@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Stage is one step of rendering a configuration
+type Stage int
+
+const (
+	StageDecode Stage = iota
+	StageCropResize
+	StageComposite
+	StageEncode
+	stageCount
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageDecode:
+		return "Decode"
+	case StageCropResize:
+		return "Crop/resize"
+	case StageComposite:
+		return "Composite"
+	default:
+		return "Encode"
+	}
+}
+
+// key names the stage in the JSON log and the metrics
+func (s Stage) key() string {
+	return [stageCount]string{"decode", "cropResize", "composite", "encode"}[s]
+}
+
+// StageDurations is the time spent in every Stage
+type StageDurations [stageCount]time.Duration
+
+// Total is the time spent in all stages
+func (d StageDurations) Total() time.Duration {
+	var total time.Duration
+	for _, duration := range d {
+		total += duration
+	}
+	return total
+}
+
+// Milliseconds maps the key of every stage to its time in milliseconds, nil when nothing was timed
+func (d StageDurations) Milliseconds() map[string]float64 {
+	if d == (StageDurations{}) {
+		return nil
+	}
+	result := make(map[string]float64, stageCount)
+	for stage, duration := range d {
+		result[Stage(stage).key()] = milliseconds(duration)
+	}
+	return result
+}
+
+func (d StageDurations) String() string {
+	parts := make([]string, 0, stageCount)
+	for stage, duration := range d {
+		parts = append(parts, fmt.Sprintf("%s %s", strings.ToLower(Stage(stage).String()), duration.Round(time.Millisecond)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// StageTimings accumulates the time spent in every Stage, across all workers
+type StageTimings struct {
+	mu    sync.Mutex
+	total StageDurations
+}
+
+func (t *StageTimings) Add(stage Stage, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total[stage] += duration
+}
+
+// Durations is the time accumulated so far
+func (t *StageTimings) Durations() StageDurations {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// stageTimings collects the stage timings while benchmarking, it is nil otherwise
+var stageTimings *StageTimings
+
+type stageTimingsKey struct{}
+
+// withStageTimings times the stages run with the returned context into timings, a render uses it for the timings of
+// its configuration
+func withStageTimings(ctx context.Context, timings *StageTimings) context.Context {
+	return context.WithValue(ctx, stageTimingsKey{}, timings)
+}
+
+// timeStage records the time since start against stage in the timings of ctx and, when benchmarking, of the run
+func timeStage(ctx context.Context, stage Stage, start time.Time) {
+	duration := time.Since(start)
+	if timings, ok := ctx.Value(stageTimingsKey{}).(*StageTimings); ok {
+		timings.Add(stage, duration)
+	}
+	if stageTimings != nil {
+		stageTimings.Add(stage, duration)
+	}
+}
+
+// BenchmarkResult is the outcome of rendering a module several times
+type BenchmarkResult struct {
+	Module     string
+	Images     int
+	Iterations []time.Duration
+	Stages     StageDurations
+}
+
+// representativeModule picks the module with the most configurations, it exercises the most of the pipeline
+func representativeModule(modules []Module) string {
+	best, bestCount := "", -1
+	for _, module := range modules {
+		count := 0
+		var countConfigurations func(configs []Configuration)
+		countConfigurations = func(configs []Configuration) {
+			for _, config := range configs {
+				count++
+				countConfigurations(config.Configurations)
+			}
+		}
+		countConfigurations(module.Configurations)
+		if count > bestCount {
+			best, bestCount = module.Name, count
+		}
+	}
+	return best
+}
+
+// runBenchmark renders the selection iterations times, every image is rendered each time regardless of the cache
+func runBenchmark(ctx context.Context, selection Selection, iterations int, options RunOptions) (*BenchmarkResult, error) {
+	options.Force = true
+	result := &BenchmarkResult{Module: selection.ModuleName}
+	stageTimings = &StageTimings{}
+	defer func() { stageTimings = nil }()
+	instance.Mute(true)
+	defer instance.Mute(false)
+
+	for i := 0; i < iterations; i++ {
+		env, err := loadEnvironment()
+		if err != nil {
+			return nil, err
+		}
+		report := NewRunReport(options)
+		start := time.Now()
+		_, rendered, err := generateModules(ctx, env, selection, report)
+		if err != nil {
+			return nil, err
+		}
+		result.Iterations = append(result.Iterations, time.Since(start))
+		result.Images = rendered
+	}
+	result.Stages = stageTimings.Durations()
+	return result, nil
+}
+
+// writeBenchmark prints the wall time of every iteration and the time spent per stage
+func writeBenchmark(out io.Writer, result *BenchmarkResult, workers int) {
+	var wall, fastest, slowest time.Duration
+	for i, duration := range result.Iterations {
+		wall += duration
+		if i == 0 || duration < fastest {
+			fastest = duration
+		}
+		if duration > slowest {
+			slowest = duration
+		}
+	}
+	iterations := len(result.Iterations)
+	mean := wall / time.Duration(iterations)
+	fmt.Fprintf(out, "%s: %d iterations of %d configurations with %d workers\n", result.Module, iterations, result.Images, workers)
+	fmt.Fprintf(out, "Wall time per iteration: mean %s, fastest %s, slowest %s\n", mean.Round(time.Millisecond), fastest.Round(time.Millisecond), slowest.Round(time.Millisecond))
+	if mean > 0 {
+		fmt.Fprintf(out, "Throughput: %.1f configurations/s\n", float64(result.Images)/mean.Seconds())
+	}
+	fmt.Fprintln(out)
+
+	stagesTotal := result.Stages.Total()
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "Stage\tTotal\tPer iteration\tPer configuration\tShare\t")
+	for stage := Stage(0); stage < stageCount; stage++ {
+		duration := result.Stages[stage]
+		perImage := time.Duration(0)
+		if result.Images > 0 {
+			perImage = duration / time.Duration(iterations*result.Images)
+		}
+		share := 0.0
+		if stagesTotal > 0 {
+			share = 100 * float64(duration) / float64(stagesTotal)
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%.1f%%\t\n", stage, duration.Round(time.Millisecond), (duration / time.Duration(iterations)).Round(time.Microsecond), perImage.Round(time.Microsecond), share)
+	}
+	writer.Flush()
+	fmt.Fprintf(out, "\nStage times are summed across workers, %s of stage time in %s of wall time is a %.1fx speedup\n", stagesTotal.Round(time.Millisecond), wall.Round(time.Millisecond), float64(stagesTotal)/float64(wall))
+}
+
+func newBenchmarkCommand() *Command {
+	cmd := newCommand("benchmark", "", "Render a module several times and report the time spent decoding, cropping and resizing, compositing and encoding")
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	moduleName := cmd.Flags.String("mod", "", "Module to render, defaults to the module with the most configurations")
+	iterations := cmd.Flags.Int("n", 5, "How many times the module is rendered")
+	cmd.Run = func(args []string) error {
+		if *iterations < 1 {
+			return errors.New("-n must be at least 1")
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		selection := Selection{ModuleName: *moduleName}
+		if selection.ModuleName == "" {
+			selection.ModuleName = representativeModule(env.Modules)
+		}
+		if len(filterModules(env.Modules, selection)) == 0 {
+			return classify(ErrConfiguration, fmt.Errorf("module %s was not found in %s", selection.ModuleName, env.Config.Modules))
+		}
+		useOutputDirectory(*output)
+		instance.Infof("Benchmarking %s with %d iterations", selection.ModuleName, *iterations)
+		ctx, stop := interruptContext()
+		defer stop()
+		result, err := runBenchmark(ctx, selection, *iterations, *runOptions)
+		if err != nil {
+			return err
+		}
+		workers := runOptions.Workers
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		writeBenchmark(os.Stdout, result, workers)
+		return nil
+	}
+	return cmd
+}
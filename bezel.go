@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// bezels are the frames a configuration can draw around its image with "bezel", mfd has the 20 option select buttons
+var bezels = map[string]bool{"mfd": true, "frame": false}
+
+// bezelOf is the bezel of config or its nearest parent with one, empty without one
+func bezelOf(config *Configuration) (string, error) {
+	for ; config != nil; config = config.Parent {
+		if config.Bezel == "" {
+			continue
+		}
+		name := strings.ToLower(config.Bezel)
+		if _, ok := bezels[name]; !ok {
+			return "", classify(ErrConfiguration, fmt.Errorf("bezel of %s: unknown bezel %q, use mfd or frame", config.Name, config.Bezel))
+		}
+		return name, nil
+	}
+	return "", nil
+}
+
+// bezelWidth is how far a bezel reaches into an image of size, a twelfth of its shorter side
+func bezelWidth(size image.Point) int {
+	return min(size.X, size.Y) / 12
+}
+
+// drawOverlays draws the bezel and then the OSB labels of config over its composite
+func drawOverlays(img draw.Image, config *Configuration) error {
+	name, err := bezelOf(config)
+	if err != nil {
+		return err
+	}
+	inset := 0
+	if name != "" {
+		drawBezel(img, bezels[name])
+		inset = bezelWidth(img.Bounds().Size())
+	}
+	return drawOSBLabels(img, config, inset)
+}
+
+// drawBezel draws a dark frame with rounded inner corners around the edges of img, with the five buttons along each
+// side at the positions the OSB labels use when buttons is set
+func drawBezel(img draw.Image, buttons bool) {
+	bounds := img.Bounds()
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	band := float64(bezelWidth(bounds.Size()))
+	dc := gg.NewContext(bounds.Dx(), bounds.Dy())
+	dc.SetFillRuleEvenOdd()
+	dc.DrawRectangle(0, 0, width, height)
+	dc.DrawRoundedRectangle(band, band, width-2*band, height-2*band, band/4)
+	dc.SetHexColor("#262626")
+	dc.Fill()
+	// A lighter lip where the frame meets the screen
+	dc.DrawRoundedRectangle(band, band, width-2*band, height-2*band, band/4)
+	dc.SetHexColor("#484848")
+	dc.SetLineWidth(max(1, band/12))
+	dc.Stroke()
+	if buttons {
+		key := band * 0.6
+		for i := 0; i < maxOSBLabels; i++ {
+			center, _, _ := osbAnchor(i, bounds.Size(), int(band/2))
+			x, y := float64(center.X), float64(center.Y)
+			dc.DrawRoundedRectangle(x-key/2, y-key/2, key, key, key/6)
+			dc.SetHexColor("#4a4a4a")
+			dc.FillPreserve()
+			dc.SetHexColor("#111111")
+			dc.SetLineWidth(max(1, band/24))
+			dc.Stroke()
+		}
+	}
+	draw.Draw(img, bounds, dc.Image(), image.Point{}, draw.Over)
+}
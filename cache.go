@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// CacheEntry is a file found in the cache directory
+type CacheEntry struct {
+	Path    string
+	Module  string
+	Size    int64
+	ModTime time.Time
+}
+
+// ModuleCacheStats summarises the cache entries of one module folder
+type ModuleCacheStats struct {
+	Module  string
+	Files   int
+	Size    int64
+	Oldest  time.Time
+	Newest  time.Time
+	Orphans int
+}
+
+// readCacheEntries walks the cache directory and returns every file in it, the module is the first folder below the cache root
+func readCacheEntries(cacheDirectory string) ([]CacheEntry, error) {
+	var entries []CacheEntry
+	err := filepath.WalkDir(cacheDirectory, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filePath == cacheDirectory {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relativePath, err := filepath.Rel(cacheDirectory, filePath)
+		if err != nil {
+			return err
+		}
+		moduleName := ""
+		if parts := strings.SplitN(relativePath, string(filepath.Separator), 2); len(parts) == 2 {
+			moduleName = parts[0]
+		}
+		entries = append(entries, CacheEntry{Path: filePath, Module: moduleName, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return entries, err
+}
+
+// expectedCacheFiles returns every file the modules can write to the cache
+func expectedCacheFiles(settings *MfdConfig, modules []Module) map[string]bool {
+	expected := make(map[string]bool)
+	for _, module := range modules {
+		for _, filePath := range generateConfigToFileMap(settings, module) {
+			for _, extension := range []string{".jpg", ".png"} {
+				expected[filePath+extension] = true
+				expected[filePath+"-crop"+extension] = true
+			}
+			expected[filePath+overlaySuffix] = true
+		}
+	}
+	return expected
+}
+
+// summarizeCache groups the cache entries per module and lists the orphaned files no configuration maps to
+func summarizeCache(entries []CacheEntry, expected map[string]bool) ([]ModuleCacheStats, []CacheEntry) {
+	statsByModule := make(map[string]*ModuleCacheStats)
+	var orphans []CacheEntry
+	for _, entry := range entries {
+		stats, ok := statsByModule[entry.Module]
+		if !ok {
+			stats = &ModuleCacheStats{Module: entry.Module, Oldest: entry.ModTime, Newest: entry.ModTime}
+			statsByModule[entry.Module] = stats
+		}
+		stats.Files++
+		stats.Size += entry.Size
+		if entry.ModTime.Before(stats.Oldest) {
+			stats.Oldest = entry.ModTime
+		}
+		if entry.ModTime.After(stats.Newest) {
+			stats.Newest = entry.ModTime
+		}
+		if !expected[entry.Path] {
+			stats.Orphans++
+			orphans = append(orphans, entry)
+		}
+	}
+
+	var summary []ModuleCacheStats
+	for _, stats := range statsByModule {
+		summary = append(summary, *stats)
+	}
+	sort.Slice(summary, func(i, j int) bool { return summary[i].Module < summary[j].Module })
+	return summary, orphans
+}
+
+// writeCacheStats prints the per module table, the totals and the orphaned files
+func writeCacheStats(out io.Writer, cacheDirectory string, summary []ModuleCacheStats, orphans []CacheEntry) {
+	const timeFormat = "2006-01-02 15:04"
+	var totalFiles int
+	var totalSize int64
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Module\tFiles\tSize\tOldest\tNewest\tOrphans")
+	for _, stats := range summary {
+		name := stats.Module
+		if name == "" {
+			name = "(cache root)"
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%s\t%d\n", name, stats.Files, formatBytes(stats.Size), stats.Oldest.Format(timeFormat), stats.Newest.Format(timeFormat), stats.Orphans)
+		totalFiles += stats.Files
+		totalSize += stats.Size
+	}
+	writer.Flush()
+
+	fmt.Fprintf(out, "\n%d files, %s in %s\n", totalFiles, formatBytes(totalSize), cacheDirectory)
+	if len(orphans) > 0 {
+		fmt.Fprintf(out, "\n%d orphaned files no configuration maps to:\n", len(orphans))
+		for _, orphan := range orphans {
+			fmt.Fprintf(out, "  %s\n", orphan.Path)
+		}
+	}
+}
+
+// parseAge reads an age such as 30d, 2w or any time.ParseDuration value
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			var amount float64
+			if _, err := fmt.Sscanf(number, "%g", &amount); err != nil || amount < 0 {
+				return 0, fmt.Errorf("invalid age %q", value)
+			}
+			return time.Duration(amount * float64(unit)), nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return age, nil
+}
+
+// parseSize reads a size such as 2GB, 500MB or 1024 using binary units
+func parseSize(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	upper := strings.ToUpper(strings.TrimSpace(value))
+	multipliers := []struct {
+		suffix string
+		factor int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	}
+	factor := int64(1)
+	for _, multiplier := range multipliers {
+		if number, ok := strings.CutSuffix(upper, multiplier.suffix); ok {
+			upper = number
+			factor = multiplier.factor
+			break
+		}
+	}
+	var amount float64
+	if _, err := fmt.Sscanf(strings.TrimSpace(upper), "%g", &amount); err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(amount * float64(factor)), nil
+}
+
+// selectPruneEntries picks the entries to delete, everything older than maxAge and then the oldest files until the cache fits in maxSize
+func selectPruneEntries(entries []CacheEntry, maxAge time.Duration, maxSize int64, now time.Time) []CacheEntry {
+	sorted := append([]CacheEntry(nil), entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ModTime.Before(sorted[j].ModTime) })
+
+	var totalSize int64
+	for _, entry := range sorted {
+		totalSize += entry.Size
+	}
+
+	var selected []CacheEntry
+	for _, entry := range sorted {
+		tooOld := maxAge > 0 && now.Sub(entry.ModTime) > maxAge
+		tooBig := maxSize > 0 && totalSize > maxSize
+		if !tooOld && !tooBig {
+			break
+		}
+		selected = append(selected, entry)
+		totalSize -= entry.Size
+	}
+	return selected
+}
+
+// removeEmptyDirectories deletes the empty folders below root, deepest first
+func removeEmptyDirectories(root string) {
+	var directories []string
+	filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() && filePath != root {
+			directories = append(directories, filePath)
+		}
+		return nil
+	})
+	sort.Slice(directories, func(i, j int) bool { return len(directories[i]) > len(directories[j]) })
+	for _, directory := range directories {
+		os.Remove(longPath(directory))
+	}
+}
+
+// pruneCache removes the selected entries and returns how many files and bytes were removed
+func pruneCache(cacheDirectory string, entries []CacheEntry, dryRun bool) (int, int64, error) {
+	removed := 0
+	var freed int64
+	for _, entry := range entries {
+		if dryRun {
+			instance.Infof("Would remove %s", entry.Path)
+		} else {
+			if err := os.Remove(longPath(entry.Path)); err != nil {
+				return removed, freed, err
+			}
+			instance.Debugf("Removed %s", entry.Path)
+		}
+		removed++
+		freed += entry.Size
+	}
+	if !dryRun {
+		removeEmptyDirectories(cacheDirectory)
+	}
+	return removed, freed, nil
+}
+
+// moduleNamesInCategory returns the names of the modules whose category is category or lies below it
+func moduleNamesInCategory(modules []Module, category string) []string {
+	category = filepath.Clean(filepath.FromSlash(category))
+	var names []string
+	for _, module := range modules {
+		moduleCategory := filepath.Clean(filepath.FromSlash(module.Category))
+		if strings.EqualFold(moduleCategory, category) || strings.HasPrefix(strings.ToLower(moduleCategory), strings.ToLower(category)+string(filepath.Separator)) {
+			names = append(names, module.Name)
+		}
+	}
+	return names
+}
+
+// clearModuleCaches moves the cache folders of the named modules into one trash folder, or deletes them with purge,
+// and returns the folders cleared
+func clearModuleCaches(cacheDirectory string, moduleNames []string, purge bool) ([]string, error) {
+	entries, err := os.ReadDir(cacheDirectory)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var cleared, names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		for _, name := range moduleNames {
+			if strings.EqualFold(entry.Name(), name) {
+				folder := filepath.Join(cacheDirectory, entry.Name())
+				if purge {
+					if err := removeContents(folder); err != nil {
+						return cleared, err
+					}
+				}
+				names = append(names, entry.Name())
+				cleared = append(cleared, folder)
+				break
+			}
+		}
+	}
+	if !purge && len(names) > 0 {
+		trash, err := trashCacheEntries(cacheDirectory, names)
+		if err != nil {
+			return nil, err
+		}
+		instance.Infof("Moved the cleared images to %s, clear-cache -undo-last-clear restores them", trash)
+	}
+	return cleared, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// namedColors are the colors a configuration can name instead of writing them as #RRGGBB
+var namedColors = map[string]color.NRGBA{
+	"black":       {A: 0xff},
+	"white":       {R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	"transparent": {},
+}
+
+// parseColor reads black, white, transparent, #RGB, #RRGGBB or #RRGGBBAA
+func parseColor(value string) (color.NRGBA, error) {
+	if named, ok := namedColors[strings.ToLower(value)]; ok {
+		return named, nil
+	}
+	digits := strings.TrimPrefix(value, "#")
+	if len(digits) == 3 {
+		digits = string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]})
+	}
+	if len(digits) == 6 {
+		digits += "ff"
+	}
+	channels, err := hex.DecodeString(digits)
+	if !strings.HasPrefix(value, "#") || err != nil || len(channels) != 4 {
+		return color.NRGBA{}, fmt.Errorf("unknown color %q, use black, white, transparent, #RRGGBB or #RRGGBBAA", value)
+	}
+	return color.NRGBA{R: channels[0], G: channels[1], B: channels[2], A: channels[3]}, nil
+}
+
+// backgroundColor is the backgroundColor of a configuration, ok is false without one
+func backgroundColor(config *Configuration) (color.NRGBA, bool, error) {
+	if config.BackgroundColor == "" {
+		return color.NRGBA{}, false, nil
+	}
+	fill, err := parseColor(config.BackgroundColor)
+	if err != nil {
+		return fill, false, classify(ErrConfiguration, fmt.Errorf("backgroundColor of %s: %v", config.Name, err))
+	}
+	return fill, true, nil
+}
+
+// fillCanvas paints the whole canvas in a color
+func fillCanvas(canvas draw.Image, fill color.Color) {
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(fill), image.Point{}, draw.Src)
+}
+
+// Padding insets the image of a configuration from the sides of its area, the inset is transparent
+type Padding struct {
+	Left   int `json:"left,omitempty"`
+	Top    int `json:"top,omitempty"`
+	Right  int `json:"right,omitempty"`
+	Bottom int `json:"bottom,omitempty"`
+}
+
+// UnmarshalJSON accepts one number for every side in place of the sides
+func (p *Padding) UnmarshalJSON(data []byte) error {
+	var all int
+	if err := json.Unmarshal(data, &all); err == nil {
+		*p = Padding{Left: all, Top: all, Right: all, Bottom: all}
+		return nil
+	}
+	type plainPadding Padding
+	return json.Unmarshal(data, (*plainPadding)(p))
+}
+
+// paddedArea is the part of a canvas of size the image of a configuration is resized into, all of it without padding
+func paddedArea(config *Configuration, size image.Point, scale int) (image.Rectangle, error) {
+	area := image.Rectangle{Max: size}
+	padding := config.Padding
+	if padding == nil {
+		return area, nil
+	}
+	if padding.Left < 0 || padding.Top < 0 || padding.Right < 0 || padding.Bottom < 0 {
+		return area, classify(ErrConfiguration, fmt.Errorf("the padding of %s is negative", config.Name))
+	}
+	// Not image.Rect, which would swap the sides of padding wider than the area
+	area = image.Rectangle{Min: image.Pt(padding.Left*scale, padding.Top*scale), Max: image.Pt(size.X-padding.Right*scale, size.Y-padding.Bottom*scale)}
+	if area.Dx() <= 0 || area.Dy() <= 0 {
+		return area, classify(ErrConfiguration, fmt.Errorf("the padding of %s leaves no room in its %dx%d area", config.Name, size.X/scale, size.Y/scale))
+	}
+	return area, nil
+}
+
+// autoTrimTolerance is how far an 8 bit channel of a border pixel may differ from the color of the border
+const autoTrimTolerance = 8
+
+// trimmedBounds is the part of an image inside the rows and columns along its sides that are transparent or the color
+// of its top left pixel, an image that is one color all over keeps its bounds
+func trimmedBounds(img image.Image) image.Rectangle {
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return bounds
+	}
+	border := img.At(bounds.Min.X, bounds.Min.Y)
+	plain := func(x, y int) bool {
+		pixel := img.At(x, y)
+		_, _, _, alpha := pixel.RGBA()
+		return alpha == 0 || similarColor(pixel, border, autoTrimTolerance)
+	}
+	plainRow := func(y, minX, maxX int) bool {
+		for x := minX; x < maxX; x++ {
+			if !plain(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	plainColumn := func(x, minY, maxY int) bool {
+		for y := minY; y < maxY; y++ {
+			if !plain(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	trimmed := bounds
+	for trimmed.Min.Y < trimmed.Max.Y && plainRow(trimmed.Min.Y, trimmed.Min.X, trimmed.Max.X) {
+		trimmed.Min.Y++
+	}
+	if trimmed.Empty() {
+		return bounds
+	}
+	for plainRow(trimmed.Max.Y-1, trimmed.Min.X, trimmed.Max.X) {
+		trimmed.Max.Y--
+	}
+	for plainColumn(trimmed.Min.X, trimmed.Min.Y, trimmed.Max.Y) {
+		trimmed.Min.X++
+	}
+	for plainColumn(trimmed.Max.X-1, trimmed.Min.Y, trimmed.Max.Y) {
+		trimmed.Max.X--
+	}
+	return trimmed
+}
+
+// ScaleMode is how the cropped image of a configuration is resized into its area
+type ScaleMode string
+
+const (
+	// ScaleStretch resizes the image to the area, changing its aspect ratio when the crop has another one
+	ScaleStretch ScaleMode = "stretch"
+	// ScaleFit resizes the image to fit inside the area and leaves the rest transparent
+	ScaleFit ScaleMode = "fit"
+	// ScaleFill resizes the image to cover the area and cuts off what is outside
+	ScaleFill ScaleMode = "fill"
+	// ScaleNone keeps the size of the image, cutting it off or leaving the rest transparent
+	ScaleNone ScaleMode = "none"
+)
+
+// parseScaleMode accepts stretch, fit, fill and none, empty is stretch
+func parseScaleMode(name string) (ScaleMode, error) {
+	switch mode := ScaleMode(strings.ToLower(name)); mode {
+	case "":
+		return ScaleStretch, nil
+	case ScaleStretch, ScaleFit, ScaleFill, ScaleNone:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown scale mode %q, use stretch, fit, fill or none", name)
+}
+
+// parseAlignment reads center or a side or corner such as top, left or bottom-right as the fractions of the space
+// left over that go before the image horizontally and vertically
+func parseAlignment(name string) (float64, float64, error) {
+	x, y := 0.5, 0.5
+	if name == "" || strings.EqualFold(name, "center") {
+		return x, y, nil
+	}
+	for _, part := range strings.Split(strings.ToLower(name), "-") {
+		switch part {
+		case "top":
+			y = 0
+		case "bottom":
+			y = 1
+		case "left":
+			x = 0
+		case "right":
+			x = 1
+		default:
+			return 0, 0, fmt.Errorf("unknown alignment %q, use center, top, bottom, left, right or a corner such as top-left", name)
+		}
+	}
+	return x, y, nil
+}
+
+// scaleImage resizes img into an image of size as the scaleMode of config says, aligned by its align, or repeats it at
+// its size with tile, a source pixel is scale pixels of a supersampled render
+func scaleImage(config *Configuration, img image.Image, size image.Point, scale int, filter imaging.ResampleFilter, deep bool) (image.Image, error) {
+	mode, err := parseScaleMode(config.ScaleMode)
+	if err != nil {
+		return nil, classify(ErrConfiguration, fmt.Errorf("scaleMode of %s: %v", config.Name, err))
+	}
+	alignX, alignY, err := parseAlignment(config.Align)
+	if err != nil {
+		return nil, classify(ErrConfiguration, fmt.Errorf("align of %s: %v", config.Name, err))
+	}
+	source := img.Bounds().Size()
+	if config.Tile && !img.Bounds().Empty() {
+		if scale > 1 || deep {
+			img = resizeImage(img, source.X*scale, source.Y*scale, filter, deep)
+		}
+		return tileImage(img, size), nil
+	}
+	if mode == ScaleStretch || source.X == 0 || source.Y == 0 {
+		return resizeImage(img, size.X, size.Y, filter, deep), nil
+	}
+	factor := float64(scale)
+	switch mode {
+	case ScaleFit:
+		factor = min(float64(size.X)/float64(source.X), float64(size.Y)/float64(source.Y))
+	case ScaleFill:
+		factor = max(float64(size.X)/float64(source.X), float64(size.Y)/float64(source.Y))
+	}
+	scaled := image.Pt(max(1, int(float64(source.X)*factor+0.5)), max(1, int(float64(source.Y)*factor+0.5)))
+	if scaled != source || deep {
+		img = resizeImage(img, scaled.X, scaled.Y, filter, deep)
+	}
+	if scaled == size {
+		return img, nil
+	}
+	// The image is cut off where it is larger than the area and transparent around it where it is smaller
+	offset := image.Pt(int(float64(size.X-scaled.X)*alignX), int(float64(size.Y-scaled.Y)*alignY))
+	canvas := newCanvas(image.Rectangle{Max: size}, isDeepImage(img))
+	draw.Draw(canvas, image.Rectangle{Min: offset, Max: offset.Add(scaled)}, img, img.Bounds().Min, draw.Src)
+	return canvas, nil
+}
+
+// tileImage repeats img from the top left corner of an image of size, cutting off the tiles along the right and bottom
+func tileImage(img image.Image, size image.Point) draw.Image {
+	tiled := newCanvas(image.Rectangle{Max: size}, isDeepImage(img))
+	tile := img.Bounds().Size()
+	for y := 0; y < size.Y; y += tile.Y {
+		for x := 0; x < size.X; x += tile.X {
+			draw.Draw(tiled, image.Rectangle{Min: image.Pt(x, y), Max: image.Pt(x, y).Add(tile)}, img, img.Bounds().Min, draw.Src)
+		}
+	}
+	return tiled
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// CaptureRegion is a rectangle of the desktop in screen pixels, the primary monitor starts at 0,0
+type CaptureRegion struct {
+	Left   int `json:"left"`
+	Top    int `json:"top"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// CaptureRegions name the regions of the screen a configuration captures with capture:<name>
+type CaptureRegions map[string]CaptureRegion
+
+func (c CaptureRegion) rect() image.Rectangle {
+	return image.Rect(c.Left, c.Top, c.Left+c.Width, c.Top+c.Height)
+}
+
+// CaptureSource grabs a rectangle of the screen as the source image, capture:left,top,width,height or capture:<name>
+// of a region of the captureRegions setting, such as an MFD viewport DCS exports to a monitor
+type CaptureSource struct {
+	Regions CaptureRegions
+}
+
+func (s CaptureSource) Open(name string) (image.Image, error) {
+	region, err := s.region(name)
+	if err != nil {
+		return nil, err
+	}
+	img, err := captureScreen(region.rect())
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture %s: %w", name, err)
+	}
+	return img, nil
+}
+
+// region is the named region or the four numbers of the name
+func (s CaptureSource) region(name string) (CaptureRegion, error) {
+	for key, region := range s.Regions {
+		if strings.EqualFold(key, name) {
+			return region, nil
+		}
+	}
+	parts := strings.Split(name, ",")
+	if len(parts) != 4 {
+		return CaptureRegion{}, fmt.Errorf("capture:%s is neither a captureRegions name nor left,top,width,height", name)
+	}
+	var values [4]int
+	for i, part := range parts {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return CaptureRegion{}, fmt.Errorf("capture:%s: %q is not a number", name, part)
+		}
+		values[i] = value
+	}
+	region := CaptureRegion{Left: values[0], Top: values[1], Width: values[2], Height: values[3]}
+	return region, region.validate()
+}
+
+// validate checks that the region has an area
+func (c CaptureRegion) validate() error {
+	if c.Width <= 0 || c.Height <= 0 {
+		return fmt.Errorf("the capture region %dx%d at %d,%d has no area", c.Width, c.Height, c.Left, c.Top)
+	}
+	return nil
+}
+
+// validate checks every region has an area
+func (regions CaptureRegions) validate() error {
+	for name, region := range regions {
+		if err := region.validate(); err != nil {
+			return fmt.Errorf("captureRegions %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// usesCapture is true when a configuration of the module is captured from the screen, it changes without its files
+func usesCapture(module *Module) bool {
+	var captured func(configs []Configuration) bool
+	captured = func(configs []Configuration) bool {
+		for i := range configs {
+			if scheme, _, ok := splitScheme(configs[i].FileName); ok && scheme == "capture" || captured(configs[i].Configurations) {
+				return true
+			}
+		}
+		return false
+	}
+	return captured(module.Configurations)
+}
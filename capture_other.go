@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"image"
+)
+
+// captureScreen is only available on Windows
+func captureScreen(area image.Rectangle) (image.Image, error) {
+	return nil, errors.New("screen capture is only supported on Windows")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"unsafe"
+)
+
+// GDI bindings of the screen capture
+var (
+	procGetDC                  = user32.NewProc("GetDC")
+	procReleaseDC              = user32.NewProc("ReleaseDC")
+	procCreateCompatibleDC     = gdi32.NewProc("CreateCompatibleDC")
+	procCreateCompatibleBitmap = gdi32.NewProc("CreateCompatibleBitmap")
+	procSelectObject           = gdi32.NewProc("SelectObject")
+	procBitBlt                 = gdi32.NewProc("BitBlt")
+	procGetDIBits              = gdi32.NewProc("GetDIBits")
+	procDeleteObject           = gdi32.NewProc("DeleteObject")
+	procDeleteDC               = gdi32.NewProc("DeleteDC")
+)
+
+// captureBlt includes the layered windows in the copy
+const captureBlt = 0x40000000
+
+// captureScreen copies the area of the desktop with GDI, the top-down BGRA rows of the bitmap become an RGBA image
+func captureScreen(area image.Rectangle) (image.Image, error) {
+	width, height := area.Dx(), area.Dy()
+	screen, _, _ := procGetDC.Call(0)
+	if screen == 0 {
+		return nil, errors.New("the desktop cannot be read")
+	}
+	defer procReleaseDC.Call(0, screen)
+	memory, _, _ := procCreateCompatibleDC.Call(screen)
+	if memory == 0 {
+		return nil, errors.New("CreateCompatibleDC failed")
+	}
+	defer procDeleteDC.Call(memory)
+	bitmap, _, _ := procCreateCompatibleBitmap.Call(screen, uintptr(width), uintptr(height))
+	if bitmap == 0 {
+		return nil, errors.New("CreateCompatibleBitmap failed")
+	}
+	defer procDeleteObject.Call(bitmap)
+	previous, _, _ := procSelectObject.Call(memory, bitmap)
+	ok, _, err := procBitBlt.Call(memory, 0, 0, uintptr(width), uintptr(height), screen, uintptr(area.Min.X), uintptr(area.Min.Y), srcCopy|captureBlt)
+	procSelectObject.Call(memory, previous)
+	if ok == 0 {
+		return nil, err
+	}
+
+	var info struct {
+		header bitmapInfoHeader
+		colors [4]uint32
+	}
+	info.header = bitmapInfoHeader{Width: int32(width), Height: -int32(height), Planes: 1, BitCount: 32}
+	info.header.Size = uint32(unsafe.Sizeof(info.header))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	lines, _, err := procGetDIBits.Call(memory, bitmap, 0, uintptr(height), uintptr(unsafe.Pointer(&img.Pix[0])), uintptr(unsafe.Pointer(&info)), dibRGBColors)
+	if lines == 0 {
+		return nil, err
+	}
+	for i := 0; i < len(img.Pix); i += 4 {
+		// GDI leaves the alpha of the desktop at zero
+		img.Pix[i], img.Pix[i+2], img.Pix[i+3] = img.Pix[i+2], img.Pix[i], 0xff
+	}
+	return img, nil
+}
@@ -0,0 +1,829 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Command is a gomfd subcommand with its own flags and help text
+type Command struct {
+	Name      string
+	Summary   string
+	Args      string
+	Flags     *flag.FlagSet
+	Run       func(args []string) error
+	verbose   bool
+	quiet     bool
+	logFormat string
+	logFile   string
+	// stdoutOnly keeps the console log to errors on stderr so stdout only carries the output of the command
+	stdoutOnly bool
+	// standalone commands run without loading the settings or opening the log
+	standalone bool
+}
+
+// newCommand creates a Command whose flag set prints the command help on -h and carries the logging flags
+func newCommand(name string, args string, summary string) *Command {
+	cmd := &Command{Name: name, Args: args, Summary: summary}
+	cmd.Flags = flag.NewFlagSet(name, flag.ContinueOnError)
+	cmd.Flags.BoolVar(&cmd.verbose, "verbose", false, "Log debug output including the geometry of every configuration")
+	cmd.Flags.BoolVar(&cmd.quiet, "quiet", false, "Only show errors and the final summary")
+	cmd.Flags.StringVar(&cmd.logFormat, "log-format", "text", "Log output format, text or json")
+	cmd.Flags.StringVar(&cmd.logFile, "log-file", "", "Write the log to this file instead of the log folder, or stderr to only log to stderr")
+	cmd.Flags.Usage = func() {
+		out := cmd.Flags.Output()
+		fmt.Fprintf(out, "Usage: gomfd %s [flags] %s\n\n%s\n\nFlags:\n", cmd.Name, cmd.Args, cmd.Summary)
+		cmd.Flags.PrintDefaults()
+	}
+	return cmd
+}
+
+// commands returns every subcommand in the order they are listed in the help
+func commands() []*Command {
+	return []*Command{
+		newGenerateCommand(),
+		newClearCacheCommand(),
+		newListCommand(),
+		newPresetsCommand(),
+		newValidateCommand(),
+		newPackCommand(),
+		newKeygenCommand(),
+		newInstallCommand(),
+		newFetchCommand(),
+		newWatchCommand(),
+		newPreviewCommand(),
+		newPickCommand(),
+		newCompareCommand(),
+		newServeCommand(),
+		newCacheStatsCommand(),
+		newCachePruneCommand(),
+		newMetricsCommand(),
+		newServiceInstallCommand(),
+		newServiceUninstallCommand(),
+		newServiceRunCommand(),
+		newTrayCommand(),
+		newDisplayCommand(),
+		newSelectCommand(),
+		newBrowseCommand(),
+		newBenchmarkCommand(),
+		newSelftestCommand(),
+		newFixturesCommand(),
+		newKneeboardCommand(),
+		newPDFCommand(),
+		newHeliosCommand(),
+		newTouchPortalCommand(),
+		newStreamDeckCommand(),
+		newAircraftCommand(),
+		newInstallExportCommand(),
+		newVersionCommand(),
+	}
+}
+
+// findCommand returns the command named by the first one or two arguments and how many arguments its name takes
+func findCommand(args []string) (*Command, int) {
+	for _, cmd := range commands() {
+		words := strings.Fields(cmd.Name)
+		if len(words) <= len(args) && strings.Join(words, " ") == strings.Join(args[:len(words)], " ") {
+			return cmd, len(words)
+		}
+	}
+	return nil, 0
+}
+
+func printUsage() {
+	out := os.Stderr
+	fmt.Fprintf(out, "Usage: gomfd <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands() {
+		fmt.Fprintf(out, "  %-14s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintf(out, "\nRun 'gomfd help <command>' for the flags of a command. Without a command gomfd runs generate.\n")
+}
+
+// legacyArguments maps the original flag-only command line onto the subcommands, -clear keeps its other flags such as -mod
+func legacyArguments(args []string) []string {
+	for i, arg := range args {
+		if arg == "-version" || arg == "--version" {
+			return []string{"version"}
+		}
+		if arg == "-tray" || arg == "--tray" {
+			rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+			return append([]string{"tray"}, rest...)
+		}
+		// The Stream Deck app starts its plugins with only its own flags
+		if arg == "-registerEvent" {
+			return append([]string{"streamdeck"}, args...)
+		}
+		if arg == "-clear" || arg == "--clear" {
+			rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+			return append([]string{"clear-cache"}, rest...)
+		}
+	}
+	return append([]string{"generate"}, args...)
+}
+
+// runCommand dispatches the command line to the matching subcommand
+func runCommand(args []string) error {
+	if len(args) == 0 || (strings.HasPrefix(args[0], "-") && !isHelpFlag(args[0])) {
+		args = legacyArguments(args)
+	}
+
+	name := args[0]
+	if isHelpFlag(name) || name == "help" {
+		if len(args) > 1 {
+			if cmd, _ := findCommand(args[1:]); cmd != nil {
+				cmd.Flags.Usage()
+				return nil
+			}
+			return fmt.Errorf("unknown command %q", strings.Join(args[1:], " "))
+		}
+		printUsage()
+		return nil
+	}
+
+	cmd, nameLength := findCommand(args)
+	if cmd == nil {
+		printUsage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+	if err := cmd.Flags.Parse(args[nameLength:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if cmd.standalone {
+		return cmd.Run(cmd.Flags.Args())
+	}
+	if err := instance.SetFormat(cmd.logFormat); err != nil {
+		return err
+	}
+	instance.SetVerbosity(cmd.verbose, cmd.quiet || cmd.stdoutOnly)
+	var logSettings LogSettings
+	if config, err := LoadConfiguration(getConfigurationFilePath()); err == nil && config != nil {
+		logSettings = config.Logging
+	}
+	if cmd.logFile == "stderr" {
+		logSettings.Stderr = true
+	} else if cmd.logFile != "" {
+		logSettings.File = cmd.logFile
+		logSettings.Stderr = false
+	}
+	instance.ApplySettings(logSettings)
+	instance.Infof("Starting %s", currentBuild())
+	return cmd.Run(cmd.Flags.Args())
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// selectionFlags are the -mod, -sub and -match flags shared by the commands working on a subset of the modules
+type selectionFlags struct {
+	module        string
+	configuration string
+	match         string
+	aircraft      string
+}
+
+func addSelectionFlags(fs *flag.FlagSet) *selectionFlags {
+	f := &selectionFlags{}
+	fs.StringVar(&f.module, "mod", "", "Module to select")
+	fs.StringVar(&f.configuration, "sub", "", "Configuration or sub-configuration to select")
+	fs.StringVar(&f.match, "match", "", "Glob (or re:<regex>) selecting modules and configurations by name")
+	fs.StringVar(&f.aircraft, "aircraft", "", "Select the modules of a DCS aircraft such as F-16C_50, detect waits for the Export.lua hook to report it")
+	return f
+}
+
+func (f *selectionFlags) Selection() (Selection, error) {
+	selection := Selection{ModuleName: f.module, ConfigurationName: f.configuration, Aircraft: f.aircraft}
+	if f.aircraft == "detect" {
+		aircraft, err := detectAircraft(time.Minute)
+		if err != nil {
+			return selection, err
+		}
+		selection.Aircraft = aircraft
+	}
+	if f.match != "" {
+		pattern, err := NewNameMatcher(f.match)
+		if err != nil {
+			return selection, classify(ErrConfiguration, err)
+		}
+		selection.Pattern = pattern
+	}
+	return selection, nil
+}
+
+// addOutputFlag adds the -output flag overriding the cache directory
+func addOutputFlag(fs *flag.FlagSet) *string {
+	return fs.String("output", "", "Directory the images are written to instead of the cachePath setting")
+}
+
+// interruptContext is cancelled by Ctrl+C so a long run stops after the images in progress instead of being killed
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// useOutputDirectory points the cache at the -output directory when it was given
+func useOutputDirectory(output string) {
+	if output == "" {
+		return
+	}
+	outputOverride = filepath.Clean(output)
+}
+
+// addRunFlags adds the -continue-on-error and -force flags of the rendering commands
+func addRunFlags(fs *flag.FlagSet) *RunOptions {
+	options := &RunOptions{}
+	fs.BoolVar(&options.ContinueOnError, "continue-on-error", true, "Record failed configurations and carry on with the rest, reporting them at the end")
+	fs.BoolVar(&options.Force, "force", false, "Render every configuration even when its cached output is up to date")
+	fs.IntVar(&options.Workers, "workers", runtime.NumCPU(), "How many images are decoded and encoded at the same time")
+	fs.BoolVar(&options.StrictCrop, "strict", false, "Fail configurations whose crop rectangle exceeds their image instead of clamping it")
+	fs.Func("missing", "What a missing source image does to its configuration: fail, skip or placeholder (default: the missingImages setting)", func(value string) error {
+		policy, err := parseMissingImagePolicy(value)
+		options.MissingImages = policy
+		return err
+	})
+	fs.Func("memory-budget", "Limit the estimated memory of the images rendered at the same time, for example 2GB (default: the memoryBudget setting)", func(value string) error {
+		budget, err := parseSize(value)
+		options.Render = append(options.Render, WithMemoryBudget(budget))
+		return err
+	})
+	return options
+}
+
+func newGenerateCommand() *Command {
+	cmd := newCommand("generate", "", "Render the composite images of the selected modules into the cache")
+	selectionArgs := addSelectionFlags(cmd.Flags)
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	local := cmd.Flags.Bool("local", false, "Render in this process even when a running gomfd could render it")
+	cmd.Flags.BoolVar(&runOptions.Diff, "diff", false, "Compare every composite with the cached output instead of replacing it and highlight the changed pixels in Saved Games\\MFDMF\\Diff")
+	cmd.Flags.BoolVar(&cmd.stdoutOnly, "plan-json", false, "Print the source, crop, size, position and output files of every selected configuration as JSON to stdout instead of rendering")
+	cmd.Run = func(args []string) error {
+		selection, err := selectionArgs.Selection()
+		if err != nil {
+			return err
+		}
+		// The running instance renders a module so it is never rendered by two processes at once, unless a flag it
+		// does not receive was given
+		if !*local && selection.ModuleName != "" && onlyForwardedFlags(cmd.Flags) {
+			request := ipcRequest{Command: "generate", Module: selection.ModuleName, Configuration: selection.ConfigurationName, Force: runOptions.Force}
+			result, err := forwardToInstance(request)
+			if err == nil {
+				instance.Infof("The running gomfd rendered %s: %s", selection.ModuleName, result)
+				return nil
+			}
+			if !errors.Is(err, errNoInstance) {
+				return fmt.Errorf("the running gomfd failed to render %s: %w", selection.ModuleName, err)
+			}
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		if cmd.stdoutOnly {
+			plan, err := buildRunPlan(env, selection, *runOptions)
+			if err != nil {
+				return err
+			}
+			return writeRunPlan(os.Stdout, plan)
+		}
+		ctx, stop := interruptContext()
+		defer stop()
+		_, _, err = generateModules(ctx, env, selection, NewRunReport(*runOptions))
+		return err
+	}
+	return cmd
+}
+
+// onlyForwardedFlags is true when no flag was given besides the ones a generate forwarded to the running instance
+// keeps, -mod, -sub, -force and the logging flags
+func onlyForwardedFlags(flags *flag.FlagSet) bool {
+	forwarded := true
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "mod", "sub", "force", "local", "verbose", "quiet", "log-format", "log-file":
+		default:
+			forwarded = false
+		}
+	})
+	return forwarded
+}
+
+func newClearCacheCommand() *Command {
+	cmd := newCommand("clear-cache", "", "Move the generated images of every module, one module or a category from the cache to the trash")
+	output := addOutputFlag(cmd.Flags)
+	moduleName := cmd.Flags.String("mod", "", "Only clear the images of this module")
+	category := cmd.Flags.String("category", "", "Only clear the images of the modules in this category, for example Aircraft")
+	purge := cmd.Flags.Bool("purge", false, "Delete the images for good instead of moving them to the trash")
+	undo := cmd.Flags.Bool("undo-last-clear", false, "Move the images of the last clear back from the trash into the cache")
+	cmd.Run = func(args []string) error {
+		if *undo {
+			_, err := undoLastClear()
+			return err
+		}
+		if *moduleName == "" && *category == "" {
+			useOutputDirectory(*output)
+			return clearCacheFolder(currentSettings(), *purge)
+		}
+
+		var names []string
+		if *moduleName != "" {
+			names = append(names, *moduleName)
+		}
+		if *category != "" {
+			env, err := loadEnvironment()
+			if err != nil {
+				return err
+			}
+			inCategory := moduleNamesInCategory(env.Modules, *category)
+			if len(inCategory) == 0 {
+				return classify(ErrConfiguration, fmt.Errorf("no modules found in category %s", *category))
+			}
+			names = append(names, inCategory...)
+		}
+		useOutputDirectory(*output)
+		removed, err := clearModuleCaches(getCacheBaseDirectory(currentSettings()), names, *purge)
+		for _, folder := range removed {
+			instance.Infof("The cache has been cleared at %s", folder)
+		}
+		if err == nil && len(removed) == 0 {
+			instance.Warnf("No cached images found for %s", strings.Join(names, ", "))
+		}
+		return err
+	}
+	return cmd
+}
+
+func newListCommand() *Command {
+	cmd := newCommand("list", "", "List the modules and their configuration trees")
+	selectionArgs := addSelectionFlags(cmd.Flags)
+	details := cmd.Flags.Bool("details", false, "Show the resolved geometry and image of every configuration")
+	cmd.Run = func(args []string) error {
+		selection, err := selectionArgs.Selection()
+		if err != nil {
+			return err
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		for _, module := range filterModules(env.Modules, selection) {
+			if *details {
+				prepareModule(&module, env)
+				fmt.Println(formatModule(&module))
+				continue
+			}
+			fmt.Printf("%s (%s) [%s]\n", module.Name, module.DisplayName, module.Category)
+			wholeModule := selection.IncludesWholeModule(&module)
+			for _, config := range module.Configurations {
+				listConfiguration(config, "", 1, wholeModule, selection)
+			}
+		}
+		return nil
+	}
+	return cmd
+}
+
+// listConfiguration prints the configuration tree, when filtering only the matching configurations are printed with their full path
+func listConfiguration(config Configuration, parentPath string, level int, all bool, selection Selection) {
+	configPath := config.Name
+	if parentPath != "" {
+		configPath = parentPath + "/" + config.Name
+	}
+	if all {
+		fmt.Printf("%s%s\n", strings.Repeat("  ", level), config.Name)
+	} else if selection.IncludesConfiguration(&config) {
+		fmt.Printf("  %s\n", configPath)
+	}
+	for _, subConfig := range config.Configurations {
+		listConfiguration(subConfig, configPath, level+1, all, selection)
+	}
+}
+
+func newValidateCommand() *Command {
+	cmd := newCommand("validate", "", "Check the settings, displays and modules for problems without rendering")
+	selectionArgs := addSelectionFlags(cmd.Flags)
+	cmd.Run = func(args []string) error {
+		selection, err := selectionArgs.Selection()
+		if err != nil {
+			return err
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		problems := 0
+		for _, module := range filterModules(env.Modules, selection) {
+			prepareModule(&module, env)
+			for _, problem := range validateModule(env.Config, &module) {
+				fmt.Printf("%s: %s\n", module.Name, problem)
+				problems++
+			}
+		}
+		if problems > 0 {
+			return classify(ErrConfiguration, fmt.Errorf("validation found %d problems", problems))
+		}
+		fmt.Println("No problems found")
+		return nil
+	}
+	return cmd
+}
+
+// validateModule returns a description of every problem found in an enriched Module
+func validateModule(settings *MfdConfig, module *Module) []string {
+	var problems []string
+	var check func(config *Configuration, configPath string)
+	check = func(config *Configuration, configPath string) {
+		if config.FileName == "" {
+			problems = append(problems, fmt.Sprintf("%s has no image file", configPath))
+		} else if strings.Contains(config.FileName, "SEAT") && len(module.Seats) == 0 {
+			problems = append(problems, fmt.Sprintf("%s image %s names a SEAT but the module has no seats", configPath, config.FileName))
+		} else if scheme, name, _ := splitScheme(config.FileName); scheme == "capture" {
+			if _, err := (CaptureSource{Regions: settings.CaptureRegions}).region(name); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", configPath, err))
+			}
+		} else if _, err := os.Stat(config.FileName); err != nil {
+			problems = append(problems, fmt.Sprintf("%s image %s was not found", configPath, config.FileName))
+		} else if err := settings.DecodeLimits.checkFile(config.FileName); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", configPath, err))
+		}
+		for _, filter := range config.Filters {
+			if err := validateFilter(filter); err != nil {
+				problems = append(problems, fmt.Sprintf("%s filter %q cannot run: %v", configPath, filter, err))
+			}
+		}
+		for _, format := range config.OutputFormats {
+			if _, err := parseImageFormat(format); err != nil {
+				problems = append(problems, fmt.Sprintf("%s outputFormats: %v", configPath, err))
+			}
+		}
+		if config.BackgroundColor != "" {
+			if _, err := parseColor(config.BackgroundColor); err != nil {
+				problems = append(problems, fmt.Sprintf("%s backgroundColor: %v", configPath, err))
+			}
+		}
+		if config.Width != nil && config.Height != nil {
+			if _, err := paddedArea(config, config.GetSize(), 1); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", configPath, err))
+			}
+		}
+		if _, err := bezelOf(config); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", configPath, err))
+		}
+		if _, _, err := osbLabels(config); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", configPath, err))
+		}
+		if _, err := parseScaleMode(config.ScaleMode); err != nil {
+			problems = append(problems, fmt.Sprintf("%s scaleMode: %v", configPath, err))
+		}
+		if _, _, err := parseAlignment(config.Align); err != nil {
+			problems = append(problems, fmt.Sprintf("%s align: %v", configPath, err))
+		}
+		if config.Supersample < 0 || config.Supersample > maxSupersample {
+			problems = append(problems, fmt.Sprintf("%s supersample %d is not from 1 to %d", configPath, config.Supersample, maxSupersample))
+		}
+		if config.Width == nil || config.Height == nil || *config.Width <= 0 || *config.Height <= 0 {
+			problems = append(problems, fmt.Sprintf("%s has no width or height", configPath))
+		}
+		if config.XOffsetStart != nil && config.XOffsetFinish != nil && config.YOffsetStart != nil && config.YOffsetFinish != nil {
+			if !config.CanCrop() {
+				problems = append(problems, fmt.Sprintf("%s has an empty crop rectangle (%s)", configPath, config.GetOffsetString()))
+			} else if size, err := imageSize(config.FileName); err == nil && !config.GetCropRect().In(image.Rect(0, 0, size.X, size.Y)) {
+				problems = append(problems, fmt.Sprintf("%s crop rectangle %v exceeds the %dx%d image %s", configPath, config.GetCropRect(), size.X, size.Y, config.FileName))
+			}
+		}
+		for i := range config.Configurations {
+			check(&config.Configurations[i], configPath+"/"+config.Configurations[i].Name)
+		}
+	}
+	for i := range module.Configurations {
+		check(&module.Configurations[i], module.Configurations[i].Name)
+	}
+
+	return append(problems, outputCollisions(settings, *module)...)
+}
+
+// imageSize reads the size of an image file without decoding its pixels
+func imageSize(fileName string) (image.Point, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return image.Point{}, err
+	}
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return image.Point{}, err
+	}
+	return image.Point{X: config.Width, Y: config.Height}, nil
+}
+
+func newWatchCommand() *Command {
+	cmd := newCommand("watch", "", "Regenerate modules whenever their module files, images or the displays change")
+	selectionArgs := addSelectionFlags(cmd.Flags)
+	interval := cmd.Flags.Duration("interval", 2*time.Second, "How often the files are checked for changes")
+	output := addOutputFlag(cmd.Flags)
+	workers := cmd.Flags.Int("workers", runtime.NumCPU(), "How many images are decoded and encoded at the same time")
+	cmd.Run = func(args []string) error {
+		selection, err := selectionArgs.Selection()
+		if err != nil {
+			return err
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		ctx, stop := interruptContext()
+		defer stop()
+		return watchModules(ctx, env, selection, *interval, *workers)
+	}
+	return cmd
+}
+
+// watchModules polls the module files, their images and the display file and regenerates the modules that changed until ctx is cancelled
+func watchModules(ctx context.Context, env *Environment, selection Selection, interval time.Duration, workers int) error {
+	fingerprints := make(map[string]string)
+	settingsChanged := fileModTime(getConfigurationFilePath())
+	lastProblems := ""
+	displaysChanged := fileModTime(env.Config.DisplayConfigurationFile)
+	first := true
+	env.Logger.Infof("Watching %s every %s, press Ctrl+C to stop", env.Config.Modules, interval)
+	renderer := newRunRenderer(env, RunOptions{Workers: workers})
+	for {
+		if stamp := fileModTime(getConfigurationFilePath()); !stamp.Equal(settingsChanged) {
+			settingsChanged = stamp
+			settings, err := ReloadConfiguration(getConfigurationFilePath())
+			if err != nil {
+				env.Logger.Errorf("Error reading Configuration, keeping the previous settings: %v", err)
+			} else {
+				env.Logger.Log("Settings changed, regenerating")
+				env.Config = settings
+				renderer = newRunRenderer(env, RunOptions{Workers: workers})
+				displaysChanged = time.Time{}
+				fingerprints = make(map[string]string)
+			}
+		}
+		if stamp := fileModTime(env.Config.DisplayConfigurationFile); !stamp.Equal(displaysChanged) {
+			displays, err := readDisplaysJSON(env.Config.DisplayConfigurationFile)
+			if err != nil {
+				env.Logger.Errorf("Error reading displays.json: %v", err)
+			} else {
+				setDisplays(displays, env.Logger)
+				env.Displays = displays
+				displaysChanged = stamp
+				fingerprints = make(map[string]string)
+			}
+		}
+
+		// The modules of the valid files are still watched while another file has problems
+		modules, err := readModuleFiles(env.Config.Modules)
+		problems := ""
+		if err != nil {
+			problems = err.Error()
+		}
+		if problems != "" && problems != lastProblems {
+			env.Logger.Errorf("Error reading the module files: %v", err)
+		}
+		lastProblems = problems
+		env.Modules = modules
+		present := make(map[string]bool)
+		for _, module := range filterModules(modules, selection) {
+			key := module.SourceFile + "|" + module.Name
+			present[key] = true
+			fingerprint := moduleFingerprint(env.Config, &module)
+			previous, known := fingerprints[key]
+			// A module captured from the screen changes without its files, it is rendered on every check
+			if previous == fingerprint && !usesCapture(&module) {
+				continue
+			}
+			fingerprints[key] = fingerprint
+			if !first && known && previous != fingerprint {
+				env.Logger.Infof("Change detected in module %s", module.Name)
+			} else if !first && !known {
+				env.Logger.Infof("New module %s found in %s", module.Name, module.SourceFile)
+			}
+			report := NewRunReport(RunOptions{ContinueOnError: true, Workers: workers})
+			renderMu.Lock()
+			if _, err := processModule(ctx, env, renderer, &module, selection, report); err != nil {
+				env.Logger.Errorf("Error processing module %s: %v", module.Name, err)
+			}
+			renderMu.Unlock()
+			report.LogFailures()
+			// A module added while watching is checked the way validate does, processModule has prepared it
+			if !first && !known {
+				for _, problem := range validateModule(env.Config, &module) {
+					env.Logger.Warnf("%s: %s", module.Name, problem)
+				}
+			}
+		}
+		// The modules of a file with problems are not forgotten, fixing it is a change rather than a new module
+		for key := range fingerprints {
+			if !present[key] && problems == "" {
+				delete(fingerprints, key)
+				_, name, _ := strings.Cut(key, "|")
+				env.Logger.Infof("Module %s was removed", name)
+			}
+		}
+		first = false
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// moduleFingerprint hashes the module definition with the modification times of the images it references
+func moduleFingerprint(settings *MfdConfig, module *Module) string {
+	hash := sha256.New()
+	data, _ := json.Marshal(module)
+	hash.Write(data)
+	files := []string{module.SourceFile, resolveImagePath(settings, module.Name, module.FileName), moduleScriptPath(module)}
+	var collect func(configs []Configuration)
+	collect = func(configs []Configuration) {
+		for _, config := range configs {
+			files = append(files, resolveImagePath(settings, module.Name, config.FileName))
+			collect(config.Configurations)
+		}
+	}
+	collect(module.Configurations)
+	for _, file := range files {
+		fmt.Fprintf(hash, "%s=%d\n", file, fileModTime(file).UnixNano())
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func fileModTime(fileName string) time.Time {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func newPreviewCommand() *Command {
+	cmd := newCommand("preview", "", "Render a single configuration and open it in the default image viewer")
+	selectionArgs := addSelectionFlags(cmd.Flags)
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	format := cmd.Flags.String("format", "jpg", "Image format of the preview, jpg or png")
+	quality := cmd.Flags.Int("quality", 90, "JPEG quality from 1 to 100")
+	filter := cmd.Flags.String("filter", "lanczos", "Resampling filter, lanczos, catmullrom, linear, box or nearest")
+	cmd.Run = func(args []string) error {
+		selection, err := selectionArgs.Selection()
+		if err != nil {
+			return err
+		}
+		if selection.ModuleName == "" || selection.ConfigurationName == "" {
+			return errors.New("preview needs both -mod and -sub")
+		}
+		imageFormat, err := parseImageFormat(*format)
+		if err != nil {
+			return err
+		}
+		resampleFilter, err := parseResampleFilter(*filter)
+		if err != nil {
+			return err
+		}
+		if *quality < 1 || *quality > 100 {
+			return errors.New("-quality must be from 1 to 100")
+		}
+		// The cached composites were made with the defaults, other settings always render again
+		if imageFormat != "jpg" || *quality != 90 || *filter != "lanczos" {
+			runOptions.Force = true
+		}
+		runOptions.Render = []RendererOption{WithFormat(imageFormat), WithQuality(*quality), WithFilter(resampleFilter)}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		return previewConfiguration(env, selection, *runOptions)
+	}
+	return cmd
+}
+
+// previewConfiguration renders the configuration named by the selection and opens it in the image viewer
+func previewConfiguration(env *Environment, selection Selection, options RunOptions) error {
+	ctx, stop := interruptContext()
+	defer stop()
+	_, rendered, err := generateModules(ctx, env, selection, NewRunReport(options))
+	if err != nil {
+		return err
+	}
+	if rendered == 0 {
+		return fmt.Errorf("configuration %s was not found in module %s", selection.ConfigurationName, selection.ModuleName)
+	}
+	for _, module := range filterModules(env.Modules, selection) {
+		for name, fileName := range generateConfigToFileMap(env.Config, module) {
+			if strings.EqualFold(configurationPathName(name), selection.ConfigurationName) {
+				return openInViewer(fileName + NewRenderer(options.Render...).Extension())
+			}
+		}
+	}
+	return fmt.Errorf("no output was produced for %s", selection.ConfigurationName)
+}
+
+// openInViewer opens a file with the application registered by the operating system
+func openInViewer(fileName string) error {
+	instance.Infof("Opening %s", fileName)
+	var viewer *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		viewer = exec.Command("rundll32", "url.dll,FileProtocolHandler", fileName)
+	case "darwin":
+		viewer = exec.Command("open", fileName)
+	default:
+		viewer = exec.Command("xdg-open", fileName)
+	}
+	return viewer.Start()
+}
+
+func newCacheStatsCommand() *Command {
+	cmd := newCommand("cache stats", "", "Report the cache size per module, the oldest and newest entries and orphaned files")
+	output := addOutputFlag(cmd.Flags)
+	cmd.Run = func(args []string) error {
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		cacheDirectory := getCacheBaseDirectory(env.Config)
+		entries, err := readCacheEntries(cacheDirectory)
+		if err != nil {
+			return fmt.Errorf("failed to read the cache: %w", err)
+		}
+		// The outputName template may use the size the displays give the configurations
+		for i := range env.Modules {
+			prepareModule(&env.Modules[i], env)
+		}
+		summary, orphans := summarizeCache(entries, expectedCacheFiles(env.Config, env.Modules))
+		writeCacheStats(os.Stdout, cacheDirectory, summary, orphans)
+		return nil
+	}
+	return cmd
+}
+
+func newCachePruneCommand() *Command {
+	cmd := newCommand("cache prune", "", "Remove the least recently generated images until the cache meets the age and size limits")
+	output := addOutputFlag(cmd.Flags)
+	maxAge := cmd.Flags.String("max-age", "", "Remove images generated longer ago than this, for example 30d, 2w or 12h")
+	maxSize := cmd.Flags.String("max-size", "", "Remove the oldest images until the cache is no larger than this, for example 2GB or 500MB")
+	dryRun := cmd.Flags.Bool("dry-run", false, "Only list the images that would be removed")
+	cmd.Run = func(args []string) error {
+		age, err := parseAge(*maxAge)
+		if err != nil {
+			return err
+		}
+		size, err := parseSize(*maxSize)
+		if err != nil {
+			return err
+		}
+		if age == 0 && size == 0 {
+			return errors.New("cache prune needs -max-age, -max-size or both")
+		}
+		useOutputDirectory(*output)
+		cacheDirectory := getCacheBaseDirectory(currentSettings())
+		entries, err := readCacheEntries(cacheDirectory)
+		if err != nil {
+			return fmt.Errorf("failed to read the cache: %w", err)
+		}
+		removed, freed, err := pruneCache(cacheDirectory, selectPruneEntries(entries, age, size, time.Now()), *dryRun)
+		verb := "Removed"
+		if *dryRun {
+			verb = "Would remove"
+		}
+		instance.Summary(fmt.Sprintf("%s %d of %d cached files, freeing %s", verb, removed, len(entries), formatBytes(freed)))
+		return err
+	}
+	return cmd
+}
+
+func newTrayCommand() *Command {
+	cmd := newCommand("tray", "", "Stay resident in the Windows system tray with regenerate, clear cache and open logs actions")
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	cmd.Run = func(args []string) error {
+		if _, err := loadEnvironment(); err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		return runTray(*runOptions)
+	}
+	return cmd
+}
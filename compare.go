@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// compareGap is the black gap between the two sides of a comparison, in pixels of the composite
+const compareGap = 8
+
+// compareVariant is one side of a comparison, the renderer options and the crop its -a or -b flag asks for
+type compareVariant struct {
+	Label   string
+	Options []RendererOption
+	Crop    []int
+}
+
+// parseCompareVariant reads the key=value pairs of a side separated by commas, filter, quality, format, dither,
+// supersample, colorManagement, crop=xOffsetStart:xOffsetFinish:yOffsetStart:yOffsetFinish and label, an empty
+// side renders with the settings
+func parseCompareVariant(spec string) (compareVariant, error) {
+	variant := compareVariant{Label: spec}
+	if strings.TrimSpace(spec) == "" {
+		variant.Label = "settings"
+		return variant, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return variant, fmt.Errorf("%q is not key=value", pair)
+		}
+		switch strings.ToLower(key) {
+		case "filter":
+			filter, err := parseResampleFilter(value)
+			if err != nil {
+				return variant, err
+			}
+			variant.Options = append(variant.Options, WithFilter(filter))
+		case "quality":
+			quality, err := strconv.Atoi(value)
+			if err != nil || quality < 1 || quality > 100 {
+				return variant, fmt.Errorf("quality %q is not from 1 to 100", value)
+			}
+			variant.Options = append(variant.Options, WithQuality(quality))
+		case "format":
+			format, err := parseImageFormat(value)
+			if err != nil {
+				return variant, err
+			}
+			variant.Options = append(variant.Options, WithFormat(format))
+		case "dither":
+			mode, err := parseDitherMode(value)
+			if err != nil {
+				return variant, err
+			}
+			variant.Options = append(variant.Options, WithDither(mode))
+		case "supersample":
+			factor, err := strconv.Atoi(value)
+			if err != nil || factor < 1 || factor > maxSupersample {
+				return variant, fmt.Errorf("supersample %q is not from 1 to %d", value, maxSupersample)
+			}
+			variant.Options = append(variant.Options, WithSupersample(factor))
+		case "colormanagement":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return variant, fmt.Errorf("colorManagement %q is not true or false", value)
+			}
+			variant.Options = append(variant.Options, WithColorManagement(enabled))
+		case "crop":
+			parts := strings.Split(value, ":")
+			if len(parts) != 4 {
+				return variant, fmt.Errorf("crop %q is not xOffsetStart:xOffsetFinish:yOffsetStart:yOffsetFinish", value)
+			}
+			variant.Crop = make([]int, 4)
+			for i, part := range parts {
+				number, err := strconv.Atoi(part)
+				if err != nil {
+					return variant, fmt.Errorf("crop %q: %q is not a number", value, part)
+				}
+				variant.Crop[i] = number
+			}
+		case "label":
+			variant.Label = value
+		default:
+			return variant, fmt.Errorf("unknown key %q, use filter, quality, format, dither, supersample, colorManagement, crop or label", key)
+		}
+	}
+	return variant, nil
+}
+
+// renderVariant renders config the way the variant would write it, the composite is encoded and decoded again so
+// the format, quality and dithering show in the comparison
+func renderVariant(ctx context.Context, env *Environment, config *Configuration, variant compareVariant) (image.Image, error) {
+	target := config
+	if variant.Crop != nil {
+		cropped := *config
+		cropped.XOffsetStart, cropped.XOffsetFinish = &variant.Crop[0], &variant.Crop[1]
+		cropped.YOffsetStart, cropped.YOffsetFinish = &variant.Crop[2], &variant.Crop[3]
+		target = &cropped
+	}
+	renderer := newRunRenderer(env, RunOptions{MissingImages: env.Config.MissingImages, Render: variant.Options})
+	img, err := renderer.Render(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	var encoded bytes.Buffer
+	if err := renderer.encode(&encoded, img); err != nil {
+		return nil, err
+	}
+	decoded, _, err := image.Decode(&encoded)
+	return decoded, err
+}
+
+// sideBySide places the images next to each other on black with their labels above them, the fixed 7x13 font is
+// scaled up with the images like the OSB labels
+func sideBySide(images []image.Image, labels []string) *image.RGBA {
+	width, height := compareGap*(len(images)-1), 0
+	for _, img := range images {
+		width += img.Bounds().Dx()
+		height = max(height, img.Bounds().Dy())
+	}
+	face := basicfont.Face7x13
+	factor := max(1, height/300)
+	header := (face.Height + 4) * factor
+	canvas := image.NewRGBA(image.Rect(0, 0, width, header+height))
+	fillCanvas(canvas, color.Black)
+	x := 0
+	for i, img := range images {
+		bounds := img.Bounds()
+		draw.Draw(canvas, image.Rect(x, header, x+bounds.Dx(), header+bounds.Dy()), img, bounds.Min, draw.Src)
+		text := image.NewRGBA(image.Rect(0, 0, font.MeasureString(face, labels[i]).Ceil()+2, face.Height+2))
+		drawer := &font.Drawer{Dst: text, Src: image.NewUniform(color.White), Face: face, Dot: fixed.P(1, 1+face.Ascent)}
+		drawer.DrawString(labels[i])
+		// A long label is drawn smaller rather than over the other side
+		scale := max(1, min(factor, bounds.Dx()/text.Bounds().Dx()))
+		size := text.Bounds().Size().Mul(scale)
+		at := image.Pt(x+(bounds.Dx()-size.X)/2, (header-size.Y)/2)
+		xdraw.NearestNeighbor.Scale(canvas, image.Rectangle{Min: at, Max: at.Add(size)}.Intersect(image.Rect(x, 0, x+bounds.Dx(), header)), text, text.Bounds(), xdraw.Over, nil)
+		x += bounds.Dx() + compareGap
+	}
+	return canvas
+}
+
+// changedPixels counts the pixels that differ between two images of the same size
+func changedPixels(a image.Image, b image.Image) (int, bool) {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return 0, false
+	}
+	changed := 0
+	offset := b.Bounds().Min.Sub(a.Bounds().Min)
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x+offset.X, y+offset.Y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				changed++
+			}
+		}
+	}
+	return changed, true
+}
+
+func newCompareCommand() *Command {
+	cmd := newCommand("compare", "", "Render -mod -sub with the settings of -a and -b and write both side by side with their labels")
+	moduleName := cmd.Flags.String("mod", "", "Module of the configuration")
+	configurationName := cmd.Flags.String("sub", "", "Configuration to compare")
+	sideA := cmd.Flags.String("a", "", "Left side, such as filter=lanczos or crop=0:800:0:800,label=old, empty for the settings")
+	sideB := cmd.Flags.String("b", "", "Right side, such as filter=nearest or quality=60,format=jpg")
+	fileName := cmd.Flags.String("o", "", "PNG to write, defaults to <module>_<configuration>_compare.png")
+	cmd.Run = func(args []string) error {
+		if *moduleName == "" || *configurationName == "" {
+			return errors.New("compare needs both -mod and -sub")
+		}
+		var variants []compareVariant
+		for _, spec := range []string{*sideA, *sideB} {
+			variant, err := parseCompareVariant(spec)
+			if err != nil {
+				return fmt.Errorf("compare side %q: %w", spec, err)
+			}
+			variants = append(variants, variant)
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		modules := filterModules(env.Modules, Selection{ModuleName: *moduleName})
+		if len(modules) == 0 {
+			return classify(ErrConfiguration, fmt.Errorf("module %s was not found in %s", *moduleName, env.Config.Modules))
+		}
+		module := modules[0]
+		prepareModule(&module, env)
+		config := findPreparedConfiguration(module.Configurations, *configurationName)
+		if config == nil {
+			return classify(ErrConfiguration, fmt.Errorf("configuration %s was not found in module %s", *configurationName, module.Name))
+		}
+		ctx, stop := interruptContext()
+		defer stop()
+		var images []image.Image
+		var labels []string
+		for i, variant := range variants {
+			img, err := renderVariant(ctx, env, config, variant)
+			if err != nil {
+				return err
+			}
+			images = append(images, img)
+			labels = append(labels, fmt.Sprintf("%c: %s", 'A'+i, variant.Label))
+		}
+		if *fileName == "" {
+			*fileName = module.Name + "_" + config.Name + "_compare.png"
+		}
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, sideBySide(images, labels)); err != nil {
+			return classify(ErrEncode, err)
+		}
+		if err := os.WriteFile(longPath(*fileName), encoded.Bytes(), 0644); err != nil {
+			return classify(ErrEncode, fmt.Errorf("failed to write %s: %w", *fileName, err))
+		}
+		if changed, same := changedPixels(images[0], images[1]); same {
+			total := images[0].Bounds().Dx() * images[0].Bounds().Dy()
+			instance.Infof("Wrote %s, %d of %d pixels differ", *fileName, changed, total)
+		} else {
+			instance.Infof("Wrote %s, the sides differ in size", *fileName)
+		}
+		return nil
+	}
+	return cmd
+}
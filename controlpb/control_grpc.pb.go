@@ -0,0 +1,256 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: control.proto
+
+package controlpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Control_GenerateModule_FullMethodName      = "/gomfd.control.v1.Control/GenerateModule"
+	Control_ListConfigurations_FullMethodName  = "/gomfd.control.v1.Control/ListConfigurations"
+	Control_SelectConfiguration_FullMethodName = "/gomfd.control.v1.Control/SelectConfiguration"
+	Control_StreamProgress_FullMethodName      = "/gomfd.control.v1.Control/StreamProgress"
+)
+
+// ControlClient is the client API for Control service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ControlClient interface {
+	// GenerateModule renders a module, or one configuration of it, into the cache
+	GenerateModule(ctx context.Context, in *GenerateModuleRequest, opts ...grpc.CallOption) (*GenerateModuleResponse, error)
+	// ListConfigurations lists the configuration trees of every module, or of one module
+	ListConfigurations(ctx context.Context, in *ListConfigurationsRequest, opts ...grpc.CallOption) (*ListConfigurationsResponse, error)
+	// SelectConfiguration shows a page on a display, or turns a switch display
+	SelectConfiguration(ctx context.Context, in *SelectConfigurationRequest, opts ...grpc.CallOption) (*SelectConfigurationResponse, error)
+	// StreamProgress sends an event for every configuration rendered, skipped or failed until the client cancels
+	StreamProgress(ctx context.Context, in *StreamProgressRequest, opts ...grpc.CallOption) (Control_StreamProgressClient, error)
+}
+
+type controlClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewControlClient(cc grpc.ClientConnInterface) ControlClient {
+	return &controlClient{cc}
+}
+
+func (c *controlClient) GenerateModule(ctx context.Context, in *GenerateModuleRequest, opts ...grpc.CallOption) (*GenerateModuleResponse, error) {
+	out := new(GenerateModuleResponse)
+	err := c.cc.Invoke(ctx, Control_GenerateModule_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) ListConfigurations(ctx context.Context, in *ListConfigurationsRequest, opts ...grpc.CallOption) (*ListConfigurationsResponse, error) {
+	out := new(ListConfigurationsResponse)
+	err := c.cc.Invoke(ctx, Control_ListConfigurations_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) SelectConfiguration(ctx context.Context, in *SelectConfigurationRequest, opts ...grpc.CallOption) (*SelectConfigurationResponse, error) {
+	out := new(SelectConfigurationResponse)
+	err := c.cc.Invoke(ctx, Control_SelectConfiguration_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) StreamProgress(ctx context.Context, in *StreamProgressRequest, opts ...grpc.CallOption) (Control_StreamProgressClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Control_ServiceDesc.Streams[0], Control_StreamProgress_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &controlStreamProgressClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Control_StreamProgressClient interface {
+	Recv() (*ProgressEvent, error)
+	grpc.ClientStream
+}
+
+type controlStreamProgressClient struct {
+	grpc.ClientStream
+}
+
+func (x *controlStreamProgressClient) Recv() (*ProgressEvent, error) {
+	m := new(ProgressEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ControlServer is the server API for Control service.
+// All implementations must embed UnimplementedControlServer
+// for forward compatibility
+type ControlServer interface {
+	// GenerateModule renders a module, or one configuration of it, into the cache
+	GenerateModule(context.Context, *GenerateModuleRequest) (*GenerateModuleResponse, error)
+	// ListConfigurations lists the configuration trees of every module, or of one module
+	ListConfigurations(context.Context, *ListConfigurationsRequest) (*ListConfigurationsResponse, error)
+	// SelectConfiguration shows a page on a display, or turns a switch display
+	SelectConfiguration(context.Context, *SelectConfigurationRequest) (*SelectConfigurationResponse, error)
+	// StreamProgress sends an event for every configuration rendered, skipped or failed until the client cancels
+	StreamProgress(*StreamProgressRequest, Control_StreamProgressServer) error
+	mustEmbedUnimplementedControlServer()
+}
+
+// UnimplementedControlServer must be embedded to have forward compatible implementations.
+type UnimplementedControlServer struct {
+}
+
+func (UnimplementedControlServer) GenerateModule(context.Context, *GenerateModuleRequest) (*GenerateModuleResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GenerateModule not implemented")
+}
+func (UnimplementedControlServer) ListConfigurations(context.Context, *ListConfigurationsRequest) (*ListConfigurationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConfigurations not implemented")
+}
+func (UnimplementedControlServer) SelectConfiguration(context.Context, *SelectConfigurationRequest) (*SelectConfigurationResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SelectConfiguration not implemented")
+}
+func (UnimplementedControlServer) StreamProgress(*StreamProgressRequest, Control_StreamProgressServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamProgress not implemented")
+}
+func (UnimplementedControlServer) mustEmbedUnimplementedControlServer() {}
+
+// UnsafeControlServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ControlServer will
+// result in compilation errors.
+type UnsafeControlServer interface {
+	mustEmbedUnimplementedControlServer()
+}
+
+func RegisterControlServer(s grpc.ServiceRegistrar, srv ControlServer) {
+	s.RegisterService(&Control_ServiceDesc, srv)
+}
+
+func _Control_GenerateModule_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GenerateModuleRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).GenerateModule(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_GenerateModule_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).GenerateModule(ctx, req.(*GenerateModuleRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_ListConfigurations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConfigurationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).ListConfigurations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_ListConfigurations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).ListConfigurations(ctx, req.(*ListConfigurationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_SelectConfiguration_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SelectConfigurationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).SelectConfiguration(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Control_SelectConfiguration_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).SelectConfiguration(ctx, req.(*SelectConfigurationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_StreamProgress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamProgressRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ControlServer).StreamProgress(m, &controlStreamProgressServer{stream})
+}
+
+type Control_StreamProgressServer interface {
+	Send(*ProgressEvent) error
+	grpc.ServerStream
+}
+
+type controlStreamProgressServer struct {
+	grpc.ServerStream
+}
+
+func (x *controlStreamProgressServer) Send(m *ProgressEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Control_ServiceDesc is the grpc.ServiceDesc for Control service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Control_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gomfd.control.v1.Control",
+	HandlerType: (*ControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GenerateModule",
+			Handler:    _Control_GenerateModule_Handler,
+		},
+		{
+			MethodName: "ListConfigurations",
+			Handler:    _Control_ListConfigurations_Handler,
+		},
+		{
+			MethodName: "SelectConfiguration",
+			Handler:    _Control_SelectConfiguration_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamProgress",
+			Handler:       _Control_StreamProgress_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "control.proto",
+}
@@ -0,0 +1,4 @@
+// Package controlpb is the gRPC control API of GOMFD, generated from control.proto for companion apps.
+package controlpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative control.proto
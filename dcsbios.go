@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// dcsBiosDefaultAddress is the multicast group DCS-BIOS exports the cockpit state to
+const dcsBiosDefaultAddress = "239.255.50.10:5010"
+
+// dcsBiosSync starts every frame of the export stream
+var dcsBiosSync = []byte{0x55, 0x55, 0x55, 0x55}
+
+// DcsBiosSettings enables the DCS-BIOS listener of the display mode
+type DcsBiosSettings struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address,omitempty"`
+}
+
+// BiosAddress is a DCS-BIOS export address, written as a number or as a hex string such as "0x4408"
+type BiosAddress uint16
+
+func (a *BiosAddress) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		text = string(data)
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(text), 0, 16)
+	if err != nil {
+		return fmt.Errorf("invalid DCS-BIOS address %s", data)
+	}
+	*a = BiosAddress(value)
+	return nil
+}
+
+// BiosRule runs a PageAction when an exported value starts to match, for example when an OSB is pressed or the master mode changes.
+// The value is read like the DCS-BIOS control reference describes it, (word at address & mask) >> shift
+type BiosRule struct {
+	Address BiosAddress `json:"address"`
+	Mask    uint16      `json:"mask,omitempty"`
+	Shift   uint        `json:"shift,omitempty"`
+	Value   uint16      `json:"value"`
+	PageAction
+}
+
+func (r BiosRule) String() string {
+	return fmt.Sprintf("DCS-BIOS 0x%04X=%d", uint16(r.Address), r.Value)
+}
+
+func (r BiosRule) matches(state *biosState) bool {
+	mask := r.Mask
+	if mask == 0 {
+		mask = 0xFFFF
+	}
+	return (state.word(uint16(r.Address))&mask)>>r.Shift == r.Value
+}
+
+// biosState is the exported cockpit memory as DCS-BIOS writes it
+type biosState struct {
+	memory [0x10000]byte
+}
+
+func (s *biosState) word(address uint16) uint16 {
+	return binary.LittleEndian.Uint16(s.memory[address&0xFFFE:])
+}
+
+// apply writes the address, count and data blocks of a packet into the memory
+func (s *biosState) apply(packet []byte) {
+	for len(packet) >= 4 {
+		if string(packet[:4]) == string(dcsBiosSync) {
+			packet = packet[4:]
+			continue
+		}
+		address := int(binary.LittleEndian.Uint16(packet))
+		count := int(binary.LittleEndian.Uint16(packet[2:]))
+		packet = packet[4:]
+		if count > len(packet) || address+count > len(s.memory) {
+			return
+		}
+		copy(s.memory[address:], packet[:count])
+		packet = packet[count:]
+	}
+}
+
+// validateBiosRules checks the DCS-BIOS rules of a module
+func validateBiosRules(rules []BiosRule) error {
+	for _, rule := range rules {
+		if rule.Shift > 15 {
+			return classify(ErrConfiguration, fmt.Errorf("%s: shift %d is out of range", rule, rule.Shift))
+		}
+		if err := rule.validate(rule.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listenDcsBios joins the DCS-BIOS export group and calls onMatch with the index of every rule that starts to match,
+// closing the returned listener stops it
+func listenDcsBios(address string, rules []BiosRule, onMatch func(index int)) (io.Closer, error) {
+	if address == "" {
+		address = dcsBiosDefaultAddress
+	}
+	group, err := net.ResolveUDPAddr("udp4", address)
+	if err != nil {
+		return nil, classify(ErrConfiguration, fmt.Errorf("invalid DCS-BIOS address %s: %w", address, err))
+	}
+	var conn *net.UDPConn
+	if group.IP.IsMulticast() {
+		conn, err = net.ListenMulticastUDP("udp4", nil, group)
+	} else {
+		conn, err = net.ListenUDP("udp4", group)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for DCS-BIOS on %s: %w", address, err)
+	}
+
+	go func() {
+		state := &biosState{}
+		matched := make([]bool, len(rules))
+		buffer := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			state.apply(buffer[:n])
+			for i, rule := range rules {
+				now := rule.matches(state)
+				if now && !matched[i] {
+					onMatch(i)
+				}
+				matched[i] = now
+			}
+		}
+	}()
+	instance.Infof("Listening for DCS-BIOS on %s with %d rules", address, len(rules))
+	return conn, nil
+}
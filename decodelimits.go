@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// OversizedPolicy is what happens to a source image with more pixels than the decode limits allow
+type OversizedPolicy string
+
+const (
+	OversizedReject     OversizedPolicy = "reject"
+	OversizedDownsample OversizedPolicy = "downsample"
+)
+
+func parseOversizedPolicy(value string) (OversizedPolicy, error) {
+	switch policy := OversizedPolicy(strings.ToLower(value)); policy {
+	case "":
+		return OversizedReject, nil
+	case OversizedReject, OversizedDownsample:
+		return policy, nil
+	}
+	return "", fmt.Errorf("oversized %q is not reject or downsample", value)
+}
+
+// DecodeLimits are checked from the size and header of a source image before it is decoded, an image over MaxPixels
+// is rejected or down-sampled after decoding it and a file over MaxFileSize is always rejected, 0 does not limit
+type DecodeLimits struct {
+	MaxPixels   int64           `json:"maxPixels,omitempty"`
+	MaxFileSize string          `json:"maxFileSize,omitempty"`
+	Oversized   OversizedPolicy `json:"oversized,omitempty"`
+	// maxBytes is MaxFileSize in bytes
+	maxBytes int64
+}
+
+// validate checks the limits and parses the file size
+func (l *DecodeLimits) validate() error {
+	if l.MaxPixels < 0 {
+		return fmt.Errorf("decodeLimits maxPixels %d is negative", l.MaxPixels)
+	}
+	maxBytes, err := parseSize(l.MaxFileSize)
+	if err != nil {
+		return fmt.Errorf("decodeLimits maxFileSize: %w", err)
+	}
+	l.maxBytes = maxBytes
+	policy, err := parseOversizedPolicy(string(l.Oversized))
+	if err != nil {
+		return fmt.Errorf("decodeLimits %w", err)
+	}
+	l.Oversized = policy
+	return nil
+}
+
+// megapixels formats a pixel count for the errors
+func megapixels(pixels int64) string {
+	return fmt.Sprintf("%.1f megapixels", float64(pixels)/1e6)
+}
+
+// checkPixels returns the error of an image of size over MaxPixels when it is rejected rather than down-sampled
+func (l *DecodeLimits) checkPixels(name string, size image.Point) error {
+	pixels := int64(size.X) * int64(size.Y)
+	if l == nil || l.MaxPixels == 0 || pixels <= l.MaxPixels || l.Oversized == OversizedDownsample {
+		return nil
+	}
+	return fmt.Errorf("%s is %dx%d, %s, over the maxPixels decode limit of %s", name, size.X, size.Y, megapixels(pixels), megapixels(l.MaxPixels))
+}
+
+// checkFile reads the size and header of an image file without decoding it and returns the error of a corrupt header or
+// of a file over the limits, a file that does not exist is left to opening it
+func (l *DecodeLimits) checkFile(name string) error {
+	info, err := os.Stat(longPath(name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if l != nil && l.maxBytes > 0 && info.Size() > l.maxBytes {
+		return fmt.Errorf("%s is %s, over the maxFileSize decode limit of %s", name, formatBytes(info.Size()), formatBytes(l.maxBytes))
+	}
+	header, err := FileSource{}.Header(name)
+	if err != nil {
+		return err
+	}
+	return l.checkPixels(name, image.Pt(header.Width, header.Height))
+}
+
+// reducedImage is a source image down-sampled to the decode limits, a pixel of the file is Scale pixels of the image
+type reducedImage struct {
+	image.Image
+	Scale float64
+}
+
+// reduce down-samples an image over MaxPixels until it fits, keeping its ICC profile
+func (l *DecodeLimits) reduce(img image.Image) image.Image {
+	size := img.Bounds().Size()
+	pixels := int64(size.X) * int64(size.Y)
+	if l == nil || l.MaxPixels == 0 || pixels <= l.MaxPixels {
+		return img
+	}
+	scale := math.Sqrt(float64(l.MaxPixels) / float64(pixels))
+	width, height := max(1, int(float64(size.X)*scale)), max(1, int(float64(size.Y)*scale))
+	// A box filter averages the many source pixels of a large reduction at a fraction of the cost of lanczos
+	if profiled, ok := img.(*profiledImage); ok {
+		resized := resizeImage(profiled.Image, width, height, imaging.Box, false)
+		return &reducedImage{Image: &profiledImage{Image: resized, Profile: profiled.Profile}, Scale: float64(width) / float64(size.X)}
+	}
+	return &reducedImage{Image: resizeImage(img, width, height, imaging.Box, false), Scale: float64(width) / float64(size.X)}
+}
+
+// scaleRect maps a crop rectangle in pixels of the file to the pixels of an image reduced by scale
+func scaleRect(rect image.Rectangle, scale float64) image.Rectangle {
+	at := func(value int) int { return int(math.Round(float64(value) * scale)) }
+	return image.Rect(at(rect.Min.X), at(rect.Min.Y), at(rect.Max.X), at(rect.Max.Y))
+}
+
+// describeDecodeError explains why an image could not be decoded, a truncated file, a format gomfd does not read or
+// corrupt data, instead of the bare error of the decoder
+func describeDecodeError(err error) error {
+	switch {
+	// The PNG decoder reports image data cut short as a format error
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF), strings.HasSuffix(err.Error(), "not enough pixel data"):
+		return fmt.Errorf("the file is truncated, it ends before the image data does: %w", err)
+	case errors.Is(err, image.ErrFormat):
+		return fmt.Errorf("the file is not a PNG, JPEG, GIF, BMP or TIFF image: %w", err)
+	}
+	return fmt.Errorf("the file is corrupt: %w", err)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/disintegration/imaging"
+	xdraw "golang.org/x/image/draw"
+)
+
+// isDeepImage is true for an image with 16 bits per channel, such as a 16 bit PNG, which is kept at 16 bits until it is
+// encoded so gradients do not band
+func isDeepImage(img image.Image) bool {
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return true
+	}
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		return true
+	}
+	return false
+}
+
+// newCanvas is an empty image to draw on, 16 bits per channel when deep
+func newCanvas(bounds image.Rectangle, deep bool) draw.Image {
+	if deep {
+		return image.NewRGBA64(bounds)
+	}
+	return image.NewRGBA(bounds)
+}
+
+// flattenImage converts any image to one that can be drawn on, an *image.RGBA64 for a 16 bit image and an *image.RGBA
+// for the rest
+func flattenImage(src image.Image) draw.Image {
+	switch img := src.(type) {
+	case *image.RGBA:
+		return img
+	case *image.RGBA64:
+		return img
+	}
+	if !isDeepImage(src) {
+		return convertToRGBA(src)
+	}
+	bounds := src.Bounds()
+	deep := image.NewRGBA64(bounds)
+	draw.Draw(deep, bounds, src, bounds.Min, draw.Src)
+	return deep
+}
+
+// resizeImage resizes an image with the filter, imaging works with 8 bits per channel so a 16 bit image, or any image
+// when deep, is scaled with the same kernel by x/image into 16 bits per channel instead
+func resizeImage(img image.Image, width int, height int, filter imaging.ResampleFilter, deep bool) image.Image {
+	if !deep && !isDeepImage(img) {
+		return imaging.Resize(img, width, height, filter)
+	}
+	resized := image.NewRGBA64(image.Rect(0, 0, width, height))
+	var scaler xdraw.Scaler = xdraw.NearestNeighbor
+	if filter.Support > 0 {
+		scaler = &xdraw.Kernel{Support: filter.Support, At: filter.Kernel}
+	}
+	scaler.Scale(resized, resized.Bounds(), img, img.Bounds(), xdraw.Src, nil)
+	return resized
+}
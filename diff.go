@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DiffStatus is how a new composite compares to the cached one
+type DiffStatus string
+
+const (
+	DiffUnchanged DiffStatus = "unchanged"
+	DiffChanged   DiffStatus = "changed"
+	DiffNew       DiffStatus = "new"
+)
+
+// DiffResult is the comparison of the composite of a configuration with its cached output
+type DiffResult struct {
+	Module        string
+	Configuration string
+	Status        DiffStatus
+	ChangedPixels int
+	TotalPixels   int
+	// DiffFile highlights the changed pixels, it is empty when the sizes differ
+	DiffFile string
+	Detail   string
+}
+
+func (d DiffResult) String() string {
+	text := fmt.Sprintf("%s/%s: %s", d.Module, d.Configuration, d.Status)
+	if d.Detail != "" {
+		text += ", " + d.Detail
+	}
+	if d.DiffFile != "" {
+		text += ", see " + d.DiffFile
+	}
+	return text
+}
+
+// getDiffFolderPath is where -diff writes the difference images, mirroring the cache
+func getDiffFolderPath() string {
+	return filepath.Join(getSavedGamesFolder(), "MFDMF", "Diff")
+}
+
+// diffOutput compares the composite of config with the output cached in fileName instead of replacing it, the
+// pixels that changed are highlighted in a difference image. Both are compared as encoded in the format of the run
+// so a JPEG is not reported as changed by its compression alone
+func (rc *RenderContext) diffOutput(fileName string, config *Configuration, img image.Image) error {
+	result := DiffResult{Module: moduleName(config), Configuration: configurationPath(config), Status: DiffNew}
+	cachedFile := fileName + rc.Renderer.Extension()
+	diffFile := filepath.Join(getDiffFolderPath(), strings.TrimPrefix(fileName, getCacheBaseDirectory(rc.Config))) + ".diff.png"
+	// A difference image from an earlier run no longer applies
+	os.Remove(longPath(diffFile))
+
+	cached, err := loadImageFile(cachedFile)
+	if err != nil {
+		rc.Report.RecordDiff(result)
+		return nil
+	}
+	var encoded bytes.Buffer
+	if err := rc.Renderer.encode(&encoded, img); err != nil {
+		return err
+	}
+	rendered, _, err := image.Decode(&encoded)
+	if err != nil {
+		return classify(ErrEncode, err)
+	}
+
+	result.Status = DiffUnchanged
+	if rendered.Bounds().Size() != cached.Bounds().Size() {
+		result.Status = DiffChanged
+		result.Detail = fmt.Sprintf("the size changed from %v to %v", cached.Bounds().Size(), rendered.Bounds().Size())
+		rc.Report.RecordDiff(result)
+		return nil
+	}
+	changed, highlighted := compareImages(cached, rendered, 0)
+	result.ChangedPixels = changed
+	result.TotalPixels = rendered.Bounds().Dx() * rendered.Bounds().Dy()
+	if changed > 0 {
+		result.Status = DiffChanged
+		result.Detail = fmt.Sprintf("%d of %d pixels (%.2f%%)", changed, result.TotalPixels, 100*float64(changed)/float64(result.TotalPixels))
+		if err := ensurePathExists(filepath.Dir(diffFile)); err != nil {
+			return err
+		}
+		if err := encodeImageFile(diffFile, highlighted, 0); err != nil {
+			return err
+		}
+		result.DiffFile = diffFile
+	}
+	rc.Report.RecordDiff(result)
+	return nil
+}
+
+// compareImages counts the pixels of two images of the same size with a channel that differs by more than tolerance
+// and returns the new image faded to gray with those pixels in red
+func compareImages(before image.Image, after image.Image, tolerance int) (int, *image.RGBA) {
+	bounds := after.Bounds()
+	highlighted := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	offset := before.Bounds().Min.Sub(bounds.Min)
+	changed := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := after.At(x, y)
+			if similarColor(before.At(x+offset.X, y+offset.Y), pixel, tolerance) {
+				gray := color.GrayModel.Convert(pixel).(color.Gray).Y
+				faded := 160 + gray/3
+				highlighted.Set(x-bounds.Min.X, y-bounds.Min.Y, color.RGBA{faded, faded, faded, 255})
+				continue
+			}
+			changed++
+			highlighted.Set(x-bounds.Min.X, y-bounds.Min.Y, RedColor)
+		}
+	}
+	return changed, highlighted
+}
+
+// similarColor is true when no 8 bit channel of the colors differs by more than tolerance
+func similarColor(a color.Color, b color.Color, tolerance int) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	for _, channels := range [][2]uint32{{r1, r2}, {g1, g2}, {b1, b2}, {a1, a2}} {
+		delta := int(channels[0]>>8) - int(channels[1]>>8)
+		if delta > tolerance || -delta > tolerance {
+			return false
+		}
+	}
+	return true
+}
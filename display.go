@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+// DisplayPage is a composite a display window can show, the top level configuration or one of its sub-configurations
+type DisplayPage struct {
+	Configuration string
+	Image         image.Image
+}
+
+// DisplayWindow is a Display shown on screen with the pages of the configuration assigned to it
+type DisplayWindow struct {
+	Module  string
+	Display string
+	Monitor string
+	Bounds  image.Rectangle
+	Pages   []DisplayPage
+	Current int
+	// Switch windows cycle through the sub-configurations like a rotary switch when clicked
+	Switch bool
+}
+
+// Page is the page currently shown
+func (w *DisplayWindow) Page() DisplayPage {
+	return w.Pages[w.Current]
+}
+
+// ShowPage switches to the named page and reports whether the window has it
+func (w *DisplayWindow) ShowPage(configurationName string) bool {
+	for i, page := range w.Pages {
+		if strings.EqualFold(page.Configuration, configurationName) {
+			w.Current = i
+			return true
+		}
+	}
+	return false
+}
+
+// loadPreparedModule loads the named module with its image paths resolved and its configurations enriched
+func loadPreparedModule(name string) (*Module, error) {
+	env, err := loadEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	modules := filterModules(env.Modules, Selection{ModuleName: name})
+	if len(modules) == 0 {
+		return nil, classify(ErrConfiguration, fmt.Errorf("module %s was not found in %s", name, env.Config.Modules))
+	}
+	module := modules[0]
+	prepareModule(&module, env)
+	return &module, nil
+}
+
+// configurationBounds is the screen rectangle of a configuration
+func configurationBounds(config *Configuration) image.Rectangle {
+	left, top, width, height := 0, 0, 0, 0
+	if config.Left != nil {
+		left = *config.Left
+	}
+	if config.Top != nil {
+		top = *config.Top
+	}
+	if config.Width != nil {
+		width = *config.Width
+	}
+	if config.Height != nil {
+		height = *config.Height
+	}
+	return image.Rect(left, top, left+width, top+height)
+}
+
+// Cycle turns a switch window step positions through its sub-configurations, wrapping around at either end
+func (w *DisplayWindow) Cycle(step int) bool {
+	positions := len(w.Pages) - 1
+	if !w.Switch || positions < 1 {
+		return false
+	}
+	position := 0
+	if w.Current > 0 {
+		position = ((w.Current-1+step)%positions + positions) % positions
+	} else if step < 0 {
+		position = positions - 1
+	}
+	w.Current = position + 1
+	return true
+}
+
+// switchStateFile remembers the position of every switch between runs
+func switchStateFile() string {
+	return filepath.Join(getSavedGamesFolder(), "MFDMF", "switches.json")
+}
+
+func switchKey(w *DisplayWindow) string {
+	return w.Module + "/" + w.Display
+}
+
+func loadSwitchState() map[string]string {
+	state := map[string]string{}
+	if data, err := os.ReadFile(switchStateFile()); err == nil {
+		if err := json.Unmarshal(data, &state); err != nil {
+			instance.Warnf("Ignoring the switch positions in %s: %v", switchStateFile(), err)
+		}
+	}
+	return state
+}
+
+// restoreSwitches puts every switch window back on the page it showed when the last run ended, a new switch starts on its first position
+func restoreSwitches(windows []*DisplayWindow) {
+	state := loadSwitchState()
+	for _, window := range windows {
+		if !window.Switch {
+			continue
+		}
+		if page, ok := state[switchKey(window)]; !ok || !window.ShowPage(page) {
+			window.Cycle(0)
+		}
+	}
+}
+
+// rememberSwitch stores the position of a switch window for the next run
+func rememberSwitch(window *DisplayWindow) {
+	state := loadSwitchState()
+	state[switchKey(window)] = window.Page().Configuration
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = os.WriteFile(switchStateFile(), data, 0644)
+	}
+	if err != nil {
+		instance.Warnf("Failed to remember the position of %s: %v", window.Display, err)
+	}
+}
+
+// displayWindows pairs every enabled display of the module with its pages, the -sub configuration is shown first instead of its parent
+func displayWindows(env *Environment, module *Module, configurationName string) ([]*DisplayWindow, error) {
+	files := generateConfigToFileMap(env.Config, *module)
+	var windows []*DisplayWindow
+	found := configurationName == ""
+	for i := range module.Configurations {
+		config := &module.Configurations[i]
+		if config.Display == nil || (config.Enabled != nil && !*config.Enabled) {
+			continue
+		}
+		window := &DisplayWindow{
+			Module:  module.Name,
+			Switch:  config.UseAsSwitch != nil && *config.UseAsSwitch,
+			Display: config.Display.Name,
+			Monitor: config.Display.Monitor,
+			Bounds:  configurationBounds(config),
+		}
+		pages := []*Configuration{config}
+		for j := range config.Configurations {
+			pages = append(pages, &config.Configurations[j])
+		}
+		for _, page := range pages {
+			img, err := loadImageFile(files[configurationPath(page)] + ".jpg")
+			if err != nil {
+				return nil, classify(ErrInputImage, fmt.Errorf("failed to load the composite of %s: %w", page.Name, err))
+			}
+			window.Pages = append(window.Pages, DisplayPage{Configuration: page.Name, Image: img})
+		}
+		if configurationName != "" && window.ShowPage(configurationName) {
+			found = true
+		}
+		windows = append(windows, window)
+	}
+	if !found {
+		return nil, classify(ErrConfiguration, fmt.Errorf("configuration %s was not found in module %s", configurationName, module.Name))
+	}
+	if len(windows) == 0 {
+		return nil, classify(ErrConfiguration, fmt.Errorf("module %s has no configurations assigned to a display", module.Name))
+	}
+	return windows, nil
+}
+
+// Monitor is a physical screen in virtual desktop coordinates, left of or above the primary monitor they are negative
+type Monitor struct {
+	Name    string
+	Bounds  image.Rectangle
+	Primary bool
+}
+
+// findMonitor looks a monitor up by device name, by its 1-based position or as primary
+func findMonitor(monitors []Monitor, name string) (Monitor, bool) {
+	for i, monitor := range monitors {
+		if strings.EqualFold(monitor.Name, name) || strings.EqualFold(strings.TrimPrefix(monitor.Name, `\\.\`), name) ||
+			fmt.Sprint(i+1) == name || (monitor.Primary && strings.EqualFold(name, "primary")) {
+			return monitor, true
+		}
+	}
+	return Monitor{}, false
+}
+
+// placeDisplayWindows maps every window onto a monitor, a display with a monitor is positioned relative to that monitor,
+// any other keeps its virtual desktop position and is moved onto the nearest monitor when it would be off screen
+func placeDisplayWindows(windows []*DisplayWindow, monitors []Monitor) {
+	if len(monitors) == 0 {
+		return
+	}
+	for _, window := range windows {
+		if window.Monitor != "" {
+			if monitor, ok := findMonitor(monitors, window.Monitor); ok {
+				window.Bounds = window.Bounds.Add(monitor.Bounds.Min)
+				window.Monitor = monitor.Name
+				continue
+			}
+			instance.Warnf("Monitor %s of %s was not found, using the virtual desktop position", window.Monitor, window.Display)
+		}
+
+		best, bestArea := -1, 0
+		for i, monitor := range monitors {
+			overlap := window.Bounds.Intersect(monitor.Bounds)
+			if area := overlap.Dx() * overlap.Dy(); area > bestArea {
+				best, bestArea = i, area
+			}
+		}
+		if best >= 0 {
+			window.Monitor = monitors[best].Name
+			continue
+		}
+
+		nearest := nearestMonitor(monitors, window.Bounds.Min)
+		moved := window.Bounds.Add(nearest.Bounds.Min.Sub(window.Bounds.Min))
+		instance.Warnf("%s at %v is off screen, moved to %v on %s", window.Display, window.Bounds, moved, nearest.Name)
+		window.Bounds = moved
+		window.Monitor = nearest.Name
+	}
+}
+
+// nearestMonitor is the monitor whose bounds are closest to point
+func nearestMonitor(monitors []Monitor, point image.Point) Monitor {
+	nearest, nearestDistance := monitors[0], -1
+	for _, monitor := range monitors {
+		closest := image.Point{X: clamp(point.X, monitor.Bounds.Min.X, monitor.Bounds.Max.X-1), Y: clamp(point.Y, monitor.Bounds.Min.Y, monitor.Bounds.Max.Y-1)}
+		delta := point.Sub(closest)
+		if distance := delta.X*delta.X + delta.Y*delta.Y; nearestDistance < 0 || distance < nearestDistance {
+			nearest, nearestDistance = monitor, distance
+		}
+	}
+	return nearest
+}
+
+func clamp(value int, low int, high int) int {
+	if value < low {
+		return low
+	}
+	if value > high {
+		return high
+	}
+	return value
+}
+
+// runDisplays brings the cache of the module up to date and shows its displays until they are closed or closeRequest fires
+func runDisplays(moduleName string, configurationName string, options RunOptions, closeRequest <-chan struct{}) error {
+	env, err := loadEnvironment()
+	if err != nil {
+		return err
+	}
+	// Bring the cache up to date, the windows show the cached composites
+	if _, _, err := generateModules(context.Background(), env, Selection{ModuleName: moduleName}, NewRunReport(options)); err != nil {
+		return err
+	}
+	module, err := loadPreparedModule(moduleName)
+	if err != nil {
+		return err
+	}
+	windows, err := displayWindows(env, module, configurationName)
+	if err != nil {
+		return err
+	}
+	if configurationName == "" {
+		restoreSwitches(windows)
+	}
+	monitors, err := enumerateMonitors()
+	if err != nil {
+		return err
+	}
+	for i, monitor := range monitors {
+		instance.Debugf("Monitor %d %s at %v, primary %v", i+1, monitor.Name, monitor.Bounds, monitor.Primary)
+	}
+	placeDisplayWindows(windows, monitors)
+	for _, window := range windows {
+		instance.Infof("Showing %s on %s at %v (%s)", window.Page().Configuration, window.Display, window.Bounds, window.Monitor)
+	}
+	inputs, err := loadDisplayInputs(env.Config, module, windows)
+	if err != nil {
+		return err
+	}
+	return showDisplayWindows(windows, inputs, closeRequest)
+}
+
+// moduleForAircraft returns the first module made for the DCS aircraft
+func moduleForAircraft(modules []Module, aircraft string) string {
+	for i := range modules {
+		if moduleFlies(&modules[i], aircraft) {
+			return modules[i].Name
+		}
+	}
+	return ""
+}
+
+// waitForAircraftModule blocks until DCS reports an aircraft one of the modules is made for, an empty name means Ctrl+C was pressed
+func waitForAircraftModule(detector *AircraftDetector, modules []Module) (string, error) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	instance.Log("Waiting for DCS to report an aircraft with a module")
+	for {
+		select {
+		case aircraft, ok := <-detector.Changes():
+			if !ok {
+				return "", errors.New("stopped listening for the aircraft")
+			}
+			if name := moduleForAircraft(modules, aircraft); name != "" {
+				return name, nil
+			}
+			if aircraft != "" {
+				instance.Warnf("No module is made for aircraft %s", aircraft)
+			}
+		case <-interrupt:
+			return "", nil
+		}
+	}
+}
+
+// followAircraft shows the displays of the module of the flown aircraft and switches module whenever DCS reports another aircraft
+func followAircraft(moduleName string, options RunOptions) error {
+	env, err := loadEnvironment()
+	if err != nil {
+		return err
+	}
+	detector, err := listenAircraft(env.Config.Aircraft.Address)
+	if err != nil {
+		return err
+	}
+	defer detector.Close()
+
+	for {
+		if moduleName == "" {
+			if moduleName, err = waitForAircraftModule(detector, env.Modules); err != nil || moduleName == "" {
+				return err
+			}
+		}
+
+		closeRequest := make(chan struct{})
+		shown := make(chan struct{})
+		next := make(chan string, 1)
+		go func(current string) {
+			for {
+				select {
+				case aircraft, ok := <-detector.Changes():
+					if !ok {
+						return
+					}
+					if name := moduleForAircraft(env.Modules, aircraft); name != "" && !strings.EqualFold(name, current) {
+						instance.Infof("Switching to %s for %s", name, aircraft)
+						next <- name
+						close(closeRequest)
+						return
+					}
+				case <-shown:
+					return
+				}
+			}
+		}(moduleName)
+
+		err := runDisplays(moduleName, "", options, closeRequest)
+		close(shown)
+		if err != nil {
+			return err
+		}
+		select {
+		case moduleName = <-next:
+		default:
+			return nil
+		}
+	}
+}
+
+func newDisplayCommand() *Command {
+	cmd := newCommand("display", "", "Show the composites of a module in borderless, always on top windows over the MFD screens")
+	selectionArgs := addSelectionFlags(cmd.Flags)
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	follow := cmd.Flags.Bool("follow-aircraft", false, "Show the module of the aircraft DCS reports and switch whenever it changes")
+	api := cmd.Flags.String("api", "", "Serve the control API on this address, for example localhost:8081")
+	grpcAddress := cmd.Flags.String("grpc", "", "Serve the gRPC control API on this address, for example localhost:8082")
+	cmd.Run = func(args []string) error {
+		selection, err := selectionArgs.Selection()
+		if err != nil {
+			return err
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		if selection.Aircraft != "" {
+			selection.ModuleName = moduleForAircraft(env.Modules, selection.Aircraft)
+			if selection.ModuleName == "" {
+				return classify(ErrConfiguration, fmt.Errorf("%s was not found in %s", selection.describeModules(), env.Config.Modules))
+			}
+		}
+		if selection.ModuleName == "" {
+			selection.ModuleName = env.Config.DefaultConfiguration
+		}
+		if env.Config.Mqtt.Broker != "" {
+			bridge, err := connectMqtt(env.Config.Mqtt)
+			if err != nil {
+				return err
+			}
+			defer bridge.Close()
+			activeMqtt = bridge
+			defer func() { activeMqtt = nil }()
+		}
+		if listener := startIPCListener(); listener != nil {
+			defer listener.Close()
+		}
+		if *api != "" {
+			startControlAPI(*api)
+		}
+		if *grpcAddress != "" {
+			if err := startControlGRPC(*grpcAddress); err != nil {
+				return err
+			}
+		}
+		if *follow {
+			return followAircraft(selection.ModuleName, *runOptions)
+		}
+		if selection.ModuleName == "" {
+			return errors.New("display needs -mod or a defaultConfiguration in the settings")
+		}
+		return runDisplays(selection.ModuleName, selection.ConfigurationName, *runOptions, nil)
+	}
+	return cmd
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// showDisplayWindows is only available on Windows
+func showDisplayWindows(windows []*DisplayWindow, inputs DisplayInputs, closeRequest <-chan struct{}) error {
+	return errors.New("display mode is only supported on Windows")
+}
+
+// enumerateMonitors has no monitors to report outside Windows, the windows keep their positions
+func enumerateMonitors() ([]Monitor, error) {
+	return nil, nil
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const displayClassName = "GOMFDDisplay"
+
+// nativeDisplay is a DisplayWindow with its window handle and the pixels StretchDIBits draws
+type nativeDisplay struct {
+	window *DisplayWindow
+	header bitmapInfoHeader
+	pixels []byte
+}
+
+const (
+	// wmJoystickButton is posted to the input owner with the index of the pressed ButtonBinding
+	wmJoystickButton = wmApp + 2
+	// wmDcsBiosRule is posted to the input owner with the index of the BiosRule that started to match
+	wmDcsBiosRule = wmApp + 3
+	// wmStreamDeckKey is posted to the input owner with the index of the pressed StreamDeckKey
+	wmStreamDeckKey = wmApp + 4
+	// wmApiAction is posted to the input owner after an action of the control API was queued
+	wmApiAction = wmApp + 5
+)
+
+// apiActions are the page actions of the control API waiting for the message loop
+var apiActions = make(chan PageAction, 16)
+
+// openDisplays are the display windows by handle, they and the inputs are only used on the thread running the message loop
+var openDisplays = map[uintptr]*nativeDisplay{}
+
+var (
+	displayInputs DisplayInputs
+	inputOwner    uintptr
+)
+
+// showDisplayWindows opens a borderless, topmost window per display and blocks until they are all closed by Escape, Ctrl+C or closeRequest
+func showDisplayWindows(windows []*DisplayWindow, inputs DisplayInputs, closeRequest <-chan struct{}) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	brush, _, _ := procGetStockObject.Call(blackBrush)
+	if err := registerWindowClass(displayClassName, displayWndProc, brush); err != nil {
+		return fmt.Errorf("failed to register the display window: %w", err)
+	}
+
+	var handles []uintptr
+	for _, window := range windows {
+		display := &nativeDisplay{window: window}
+		display.setImage(window.Page().Image)
+		bounds := window.Bounds
+		hwnd, _, err := procCreateWindowExW.Call(wsExTopmost|wsExToolWindow, uintptr(unsafe.Pointer(utf16Ptr(displayClassName))), uintptr(unsafe.Pointer(utf16Ptr("GOMFD "+window.Display))),
+			wsPopup|wsVisible, uintptr(bounds.Min.X), uintptr(bounds.Min.Y), uintptr(bounds.Dx()), uintptr(bounds.Dy()), 0, 0, moduleHandle(), 0)
+		if hwnd == 0 {
+			closeDisplays(handles)
+			return fmt.Errorf("failed to create the window of %s: %w", window.Display, err)
+		}
+		openDisplays[hwnd] = display
+		handles = append(handles, hwnd)
+	}
+
+	inputOwner = handles[0]
+	displayInputs = inputs
+	registerHotkeys()
+	stopJoysticks := pollJoysticks(inputOwner, inputs.Buttons)
+	defer close(stopJoysticks)
+	if len(inputs.DcsBiosRules) > 0 {
+		listener, err := listenDcsBios(inputs.DcsBios.Address, inputs.DcsBiosRules, func(index int) {
+			procPostMessageW.Call(inputOwner, wmDcsBiosRule, uintptr(index), 0)
+		})
+		if err != nil {
+			instance.Warn(err.Error())
+		} else {
+			defer listener.Close()
+		}
+	}
+
+	if inputs.StreamDeck != nil {
+		inputs.StreamDeck.OnKey(func(index int) {
+			procPostMessageW.Call(inputOwner, wmStreamDeckKey, uintptr(index), 0)
+		})
+		defer inputs.StreamDeck.OnKey(nil)
+	}
+
+	shownDisplays.Attach(windows, func(action PageAction) {
+		select {
+		case apiActions <- action:
+			procPostMessageW.Call(inputOwner, wmApiAction, 0, 0)
+		default:
+			instance.Warnf("Dropped the API action on %s, too many are waiting", action.Display)
+		}
+	})
+	defer shownDisplays.Detach()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-interrupt:
+			instance.Log("Closing the display windows")
+			closeDisplays(handles)
+		case <-closeRequest:
+			closeDisplays(handles)
+		case <-finished:
+		}
+	}()
+
+	instance.Log("Showing the displays, press Escape on a display or Ctrl+C to close them")
+	runMessageLoop()
+	signal.Stop(interrupt)
+	close(finished)
+	return nil
+}
+
+// registerHotkeys registers the global hotkeys on the input owner, a hotkey already taken by another application is skipped with a warning
+func registerHotkeys() {
+	for i, hotkey := range displayInputs.Hotkeys {
+		if ok, _, err := procRegisterHotKey.Call(inputOwner, uintptr(i+1), uintptr(hotkey.Modifiers|hotkeyNoRepeat), uintptr(hotkey.Key)); ok == 0 {
+			instance.Warnf("Hotkey %s could not be registered: %v", hotkey.Keys, err)
+		}
+	}
+}
+
+func unregisterHotkeys() {
+	for i := range displayInputs.Hotkeys {
+		procUnregisterHotKey.Call(inputOwner, uintptr(i+1))
+	}
+	displayInputs.Hotkeys = nil
+}
+
+// onHotkey runs the action of the hotkey with the given id
+func onHotkey(id int) {
+	if id >= 1 && id <= len(displayInputs.Hotkeys) {
+		hotkey := displayInputs.Hotkeys[id-1]
+		applyPageAction(hotkey.Keys, hotkey.PageAction)
+	}
+}
+
+// onJoystickButton runs the action of the button binding at index
+func onJoystickButton(index int) {
+	if index >= 0 && index < len(displayInputs.Buttons) {
+		button := displayInputs.Buttons[index]
+		applyPageAction(button.String(), button.PageAction)
+	}
+}
+
+// onDcsBiosRule runs the action of the DCS-BIOS rule at index
+func onDcsBiosRule(index int) {
+	if index >= 0 && index < len(displayInputs.DcsBiosRules) {
+		rule := displayInputs.DcsBiosRules[index]
+		applyPageAction(rule.String(), rule.PageAction)
+	}
+}
+
+// onStreamDeckKey runs the action of the Stream Deck key at index
+func onStreamDeckKey(index int) {
+	if index >= 0 && index < len(displayInputs.StreamDeckKeys) {
+		key := displayInputs.StreamDeckKeys[index]
+		applyPageAction(key.String(), key.PageAction)
+	}
+}
+
+// applyPageAction shows the configuration of the action, or turns the switch, on its display
+func applyPageAction(source string, action PageAction) {
+	for hwnd, display := range openDisplays {
+		if !strings.EqualFold(display.window.Display, action.Display) {
+			continue
+		}
+		if step := action.Step(); step != 0 {
+			display.turnSwitch(hwnd, step)
+		} else if display.window.ShowPage(action.Configuration) {
+			instance.Infof("%s: showing %s on %s", source, action.Configuration, action.Display)
+			display.showCurrentPage(hwnd)
+		}
+	}
+}
+
+// turnSwitch cycles a UseAsSwitch display and remembers its new position
+func (d *nativeDisplay) turnSwitch(hwnd uintptr, step int) {
+	if !d.window.Cycle(step) {
+		return
+	}
+	instance.Infof("Switch %s turned to %s", d.window.Display, d.window.Page().Configuration)
+	d.showCurrentPage(hwnd)
+	rememberSwitch(d.window)
+}
+
+// showCurrentPage repaints the window with the page its DisplayWindow is on and tells the Stream Deck and MQTT about it
+func (d *nativeDisplay) showCurrentPage(hwnd uintptr) {
+	d.setImage(d.window.Page().Image)
+	procInvalidateRect.Call(hwnd, 0, 0)
+	if displayInputs.StreamDeck != nil {
+		displayInputs.StreamDeck.PageChanged(d.window.Display, d.window.Page().Configuration)
+	}
+	if displayInputs.Mqtt != nil {
+		displayInputs.Mqtt.PageChanged(d.window.Module, d.window.Display, d.window.Page().Configuration)
+	}
+}
+
+// monitorCallback is the EnumDisplayMonitors callback, created once since callbacks are never freed, it appends every
+// monitor to the *[]Monitor passed as data
+var monitorCallback uintptr
+var monitorCallbackOnce sync.Once
+
+func addMonitor(handle uintptr, hdc uintptr, bounds uintptr, data uintptr) uintptr {
+	// data is the address enumerateMonitors passed, read through its own address so vet sees no uintptr conversion
+	monitors := *(**[]Monitor)(unsafe.Pointer(&data))
+	info := monitorInfoEx{}
+	info.Size = uint32(unsafe.Sizeof(info))
+	if ok, _, _ := procGetMonitorInfoW.Call(handle, uintptr(unsafe.Pointer(&info))); ok != 0 {
+		*monitors = append(*monitors, Monitor{
+			Name:    syscall.UTF16ToString(info.Device[:]),
+			Bounds:  image.Rect(int(info.Monitor.Left), int(info.Monitor.Top), int(info.Monitor.Right), int(info.Monitor.Bottom)),
+			Primary: info.Flags&monitorInfoPrimary != 0,
+		})
+	}
+	return 1
+}
+
+// enumerateMonitors lists the monitors in physical pixels, the process is made DPI aware so they match the display coordinates
+func enumerateMonitors() ([]Monitor, error) {
+	procSetProcessDPIAware.Call()
+	monitorCallbackOnce.Do(func() { monitorCallback = syscall.NewCallback(addMonitor) })
+	var monitors []Monitor
+	if ok, _, err := procEnumDisplayMonitors.Call(0, 0, monitorCallback, uintptr(unsafe.Pointer(&monitors))); ok == 0 {
+		return nil, fmt.Errorf("failed to enumerate the monitors: %w", err)
+	}
+	return monitors, nil
+}
+
+// closeDisplays asks every window to close, it is safe to call from any goroutine
+func closeDisplays(handles []uintptr) {
+	for _, hwnd := range handles {
+		procPostMessageW.Call(hwnd, wmClose, 0, 0)
+	}
+}
+
+// setImage converts img to the top-down BGRA rows a device independent bitmap expects
+func (d *nativeDisplay) setImage(img image.Image) {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	pixels := make([]byte, len(rgba.Pix))
+	for i := 0; i < len(pixels); i += 4 {
+		pixels[i], pixels[i+1], pixels[i+2], pixels[i+3] = rgba.Pix[i+2], rgba.Pix[i+1], rgba.Pix[i], rgba.Pix[i+3]
+	}
+	d.pixels = pixels
+	d.header = bitmapInfoHeader{Width: int32(bounds.Dx()), Height: -int32(bounds.Dy()), Planes: 1, BitCount: 32}
+	d.header.Size = uint32(unsafe.Sizeof(d.header))
+}
+
+// paint stretches the image over the whole window
+func (d *nativeDisplay) paint(hwnd uintptr) {
+	var ps paintStruct
+	hdc, _, _ := procBeginPaint.Call(hwnd, uintptr(unsafe.Pointer(&ps)))
+	defer procEndPaint.Call(hwnd, uintptr(unsafe.Pointer(&ps)))
+	if len(d.pixels) == 0 {
+		return
+	}
+	bounds := d.window.Bounds
+	procStretchDIBits.Call(hdc, 0, 0, uintptr(bounds.Dx()), uintptr(bounds.Dy()), 0, 0, uintptr(d.header.Width), uintptr(-d.header.Height),
+		uintptr(unsafe.Pointer(&d.pixels[0])), uintptr(unsafe.Pointer(&d.header)), dibRGBColors, srcCopy)
+}
+
+func displayWndProc(hwnd uintptr, message uint32, wParam uintptr, lParam uintptr) uintptr {
+	display := openDisplays[hwnd]
+	switch message {
+	case wmPaint:
+		if display != nil {
+			display.paint(hwnd)
+			return 0
+		}
+	case wmKeyDown:
+		if wParam == vkEscape {
+			for handle := range openDisplays {
+				procPostMessageW.Call(handle, wmClose, 0, 0)
+			}
+			return 0
+		}
+	case wmLButtonUp, wmRButtonUp:
+		if display != nil && display.window.Switch {
+			step := 1
+			if message == wmRButtonUp {
+				step = -1
+			}
+			display.turnSwitch(hwnd, step)
+			return 0
+		}
+	case wmHotkey:
+		onHotkey(int(wParam))
+		return 0
+	case wmJoystickButton:
+		onJoystickButton(int(wParam))
+		return 0
+	case wmDcsBiosRule:
+		onDcsBiosRule(int(wParam))
+		return 0
+	case wmStreamDeckKey:
+		onStreamDeckKey(int(wParam))
+		return 0
+	case wmApiAction:
+		for len(apiActions) > 0 {
+			applyPageAction("API", <-apiActions)
+		}
+		return 0
+	case wmDestroy:
+		if hwnd == inputOwner {
+			unregisterHotkeys()
+		}
+		delete(openDisplays, hwnd)
+		if len(openDisplays) == 0 {
+			procPostQuitMessage.Call(0)
+		}
+		return 0
+	}
+	return defWindowProc(hwnd, message, wParam, lParam)
+}
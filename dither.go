@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// DitherMode is how a composite with 16 bits per channel is reduced to the 8 bits of a JPEG
+type DitherMode string
+
+const (
+	DitherNone           DitherMode = "none"
+	DitherOrdered        DitherMode = "ordered"
+	DitherFloydSteinberg DitherMode = "floyd-steinberg"
+)
+
+// parseDitherMode accepts none, ordered and floyd-steinberg, empty is none
+func parseDitherMode(name string) (DitherMode, error) {
+	switch mode := DitherMode(strings.ToLower(name)); mode {
+	case "":
+		return DitherNone, nil
+	case DitherNone, DitherOrdered, DitherFloydSteinberg:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown dither mode %q, use none, ordered or floyd-steinberg", name)
+}
+
+// bayerMatrix orders the thresholds of the ordered dither over 8x8 pixels
+var bayerMatrix = [8][8]float64{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// ditherImage reduces an image to 8 bits per channel, spreading the fraction each pixel loses over its neighbours so
+// a dark gradient does not turn into bands, the alpha channel is rounded
+func ditherImage(img image.Image, mode DitherMode) *image.RGBA {
+	bounds := img.Bounds()
+	dithered := image.NewRGBA(bounds)
+	width := bounds.Dx()
+	// The error Floyd-Steinberg carries to the current and the next row, per channel
+	current := make([][3]float64, width+2)
+	next := make([][3]float64, width+2)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			alpha := uint8((a + 128) / 257)
+			i := x - bounds.Min.X + 1
+			var out [3]uint8
+			for channel, value := range [3]uint32{r, g, b} {
+				exact := float64(value) / 257
+				var quantized float64
+				switch mode {
+				case DitherOrdered:
+					quantized = float64(int(exact + (bayerMatrix[y&7][x&7]+0.5)/64))
+				case DitherFloydSteinberg:
+					exact += current[i][channel]
+					quantized = float64(int(exact + 0.5))
+				default:
+					quantized = float64(int(exact + 0.5))
+				}
+				// The channels are premultiplied and cannot exceed alpha
+				quantized = max(0, min(quantized, float64(alpha)))
+				out[channel] = uint8(quantized)
+				if mode == DitherFloydSteinberg {
+					loss := exact - quantized
+					current[i+1][channel] += loss * 7 / 16
+					next[i-1][channel] += loss * 3 / 16
+					next[i][channel] += loss * 5 / 16
+					next[i+1][channel] += loss * 1 / 16
+				}
+			}
+			dithered.SetRGBA(x, y, color.RGBA{R: out[0], G: out[1], B: out[2], A: alpha})
+		}
+		current, next = next, current
+		clear(next)
+	}
+	return dithered
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+)
+
+// Process exit codes reported to batch scripts
+const (
+	ExitSuccess        = 0
+	ExitFailure        = 1
+	ExitConfigError    = 2
+	ExitInputImage     = 3
+	ExitEncodeFailure  = 4
+	ExitPartialFailure = 5
+	ExitOutputChanged  = 6
+)
+
+// Error kinds used to choose the exit code of a failed run
+var (
+	ErrConfiguration  = errors.New("configuration error")
+	ErrInputImage     = errors.New("missing or unreadable input image")
+	ErrEncode         = errors.New("encode failure")
+	ErrPartialFailure = errors.New("partial failure")
+	ErrOutputChanged  = errors.New("output changed")
+)
+
+// classifiedError tags an error with one of the error kinds without changing its message
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// classify tags err with kind so errors.Is(err, kind) holds
+func classify(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{kind: kind, err: err}
+}
+
+// exitCode maps the error returned by a command to the process exit code
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitSuccess
+	case errors.Is(err, ErrPartialFailure):
+		return ExitPartialFailure
+	case errors.Is(err, ErrOutputChanged):
+		return ExitOutputChanged
+	case errors.Is(err, ErrConfiguration):
+		return ExitConfigError
+	case errors.Is(err, ErrInputImage):
+		return ExitInputImage
+	case errors.Is(err, ErrEncode):
+		return ExitEncodeFailure
+	default:
+		return ExitFailure
+	}
+}
+
+// exitCodeKind is the error kind exitCode maps to code, nil for a code without one
+func exitCodeKind(code int) error {
+	switch code {
+	case ExitPartialFailure:
+		return ErrPartialFailure
+	case ExitOutputChanged:
+		return ErrOutputChanged
+	case ExitConfigError:
+		return ErrConfiguration
+	case ExitInputImage:
+		return ErrInputImage
+	case ExitEncodeFailure:
+		return ErrEncode
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRunReportExitCode(t *testing.T) {
+	GetLogger()
+	imageErr := classify(ErrInputImage, errors.New("cockpit.png was not found"))
+	tests := []struct {
+		name     string
+		rendered int
+		failures []Failure
+		diffs    []DiffStatus
+		want     int
+	}{
+		{"nothing", 0, nil, nil, ExitSuccess},
+		{"rendered", 3, nil, nil, ExitSuccess},
+		{"unchanged diffs", 0, nil, []DiffStatus{DiffUnchanged, DiffUnchanged}, ExitSuccess},
+		{"changed diffs", 0, nil, []DiffStatus{DiffUnchanged, DiffChanged, DiffChanged}, ExitOutputChanged},
+		{"failed", 0, []Failure{{Module: "F16C", Configuration: "LMFD", Err: imageErr}}, nil, ExitInputImage},
+		{"partly failed", 2, []Failure{{Module: "F16C", Configuration: "LMFD", Err: imageErr}}, nil, ExitPartialFailure},
+		{"failed with changed diffs", 2, []Failure{{Module: "F16C", Configuration: "LMFD", Err: imageErr}}, []DiffStatus{DiffChanged}, ExitPartialFailure},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := NewRunReport(RunOptions{Diff: test.diffs != nil})
+			report.Rendered = test.rendered
+			report.Failures = test.failures
+			for _, status := range test.diffs {
+				report.RecordDiff(DiffResult{Module: "F16C", Configuration: "LMFD", Status: status})
+			}
+			err := report.Err()
+			if got := exitCode(err); got != test.want {
+				t.Errorf("exitCode(%v) = %d, want %d", err, got, test.want)
+			}
+		})
+	}
+}
+
+func TestExitCodeKind(t *testing.T) {
+	for _, code := range []int{ExitConfigError, ExitInputImage, ExitEncodeFailure, ExitPartialFailure, ExitOutputChanged} {
+		err := classify(exitCodeKind(code), errors.New("forwarded"))
+		if got := exitCode(err); got != code {
+			t.Errorf("exitCode(exitCodeKind(%d)) = %d", code, got)
+		}
+	}
+	if kind := exitCodeKind(ExitFailure); kind != nil {
+		t.Errorf("exitCodeKind(%d) = %v, want nil", ExitFailure, kind)
+	}
+}
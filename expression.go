@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Expression is arithmetic over numbers and the geometry of a configuration, its parent and its display, such as parent.width/2 - 64
+type Expression struct {
+	source string
+	root   expressionNode
+}
+
+type expressionNode interface {
+	eval(resolve func(name string) (float64, error)) (float64, error)
+}
+
+type numberNode float64
+
+func (n numberNode) eval(func(string) (float64, error)) (float64, error) {
+	return float64(n), nil
+}
+
+type variableNode string
+
+func (n variableNode) eval(resolve func(string) (float64, error)) (float64, error) {
+	return resolve(string(n))
+}
+
+type unaryNode struct {
+	operand expressionNode
+}
+
+func (n unaryNode) eval(resolve func(string) (float64, error)) (float64, error) {
+	value, err := n.operand.eval(resolve)
+	return -value, err
+}
+
+type binaryNode struct {
+	operator    byte
+	left, right expressionNode
+}
+
+func (n binaryNode) eval(resolve func(string) (float64, error)) (float64, error) {
+	left, err := n.left.eval(resolve)
+	if err != nil {
+		return 0, err
+	}
+	right, err := n.right.eval(resolve)
+	if err != nil {
+		return 0, err
+	}
+	switch n.operator {
+	case '+':
+		return left + right, nil
+	case '-':
+		return left - right, nil
+	case '*':
+		return left * right, nil
+	case '/':
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return left / right, nil
+	default:
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return math.Mod(left, right), nil
+	}
+}
+
+type callNode struct {
+	function  string
+	arguments []expressionNode
+}
+
+// expressionFunctions are the functions an expression can call
+var expressionFunctions = map[string]func(values []float64) float64{
+	"min":   func(values []float64) float64 { return math.Min(values[0], values[1]) },
+	"max":   func(values []float64) float64 { return math.Max(values[0], values[1]) },
+	"round": func(values []float64) float64 { return math.Round(values[0]) },
+	"floor": func(values []float64) float64 { return math.Floor(values[0]) },
+	"ceil":  func(values []float64) float64 { return math.Ceil(values[0]) },
+}
+
+// expressionArity is how many arguments each function takes
+var expressionArity = map[string]int{"min": 2, "max": 2, "round": 1, "floor": 1, "ceil": 1}
+
+func (n callNode) eval(resolve func(string) (float64, error)) (float64, error) {
+	values := make([]float64, len(n.arguments))
+	for i, argument := range n.arguments {
+		value, err := argument.eval(resolve)
+		if err != nil {
+			return 0, err
+		}
+		values[i] = value
+	}
+	return expressionFunctions[n.function](values), nil
+}
+
+// ParseExpression parses the arithmetic of a numeric field
+func ParseExpression(source string) (*Expression, error) {
+	p := &expressionParser{source: source}
+	root, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.source) {
+		return nil, fmt.Errorf("unexpected %q at %d in %q", p.source[p.pos], p.pos+1, source)
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+// String is the expression as written in the module file
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Evaluate computes the expression, resolve returns the value of a name such as width or parent.height
+func (e *Expression) Evaluate(resolve func(name string) (float64, error)) (float64, error) {
+	return e.root.eval(resolve)
+}
+
+type expressionParser struct {
+	source string
+	pos    int
+}
+
+func (p *expressionParser) skipSpaces() {
+	for p.pos < len(p.source) && (p.source[p.pos] == ' ' || p.source[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next character after the spaces, 0 at the end
+func (p *expressionParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.source) {
+		return p.source[p.pos]
+	}
+	return 0
+}
+
+func (p *expressionParser) parseSum() (expressionNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for operator := p.peek(); operator == '+' || operator == '-'; operator = p.peek() {
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseProduct() (expressionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for operator := p.peek(); operator == '*' || operator == '/' || operator == '%'; operator = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: operator, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseUnary() (expressionNode, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{operand: operand}, nil
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parseOperand()
+}
+
+func (p *expressionParser) parseOperand() (expressionNode, error) {
+	c := p.peek()
+	switch {
+	case c == '(':
+		p.pos++
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ) in %q", p.source)
+		}
+		p.pos++
+		return inner, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.source) && (p.source[p.pos] >= '0' && p.source[p.pos] <= '9' || p.source[p.pos] == '.') {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.source[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q in %q", p.source[start:p.pos], p.source)
+		}
+		return numberNode(value), nil
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_':
+		start := p.pos
+		for p.pos < len(p.source) && isIdentifierByte(p.source[p.pos]) {
+			p.pos++
+		}
+		name := p.source[start:p.pos]
+		if p.peek() != '(' {
+			return variableNode(name), nil
+		}
+		return p.parseCall(name)
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of %q", p.source)
+	}
+	return nil, fmt.Errorf("unexpected %q at %d in %q", c, p.pos+1, p.source)
+}
+
+func (p *expressionParser) parseCall(name string) (expressionNode, error) {
+	arity, ok := expressionArity[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s in %q", name, p.source)
+	}
+	p.pos++
+	call := callNode{function: name}
+	for p.peek() != ')' {
+		if len(call.arguments) > 0 {
+			if p.peek() != ',' {
+				return nil, fmt.Errorf("missing , or ) in %q", p.source)
+			}
+			p.pos++
+		}
+		argument, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		call.arguments = append(call.arguments, argument)
+	}
+	p.pos++
+	if len(call.arguments) != arity {
+		return nil, fmt.Errorf("%s takes %d arguments in %q", name, arity, p.source)
+	}
+	return call, nil
+}
+
+func isIdentifierByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.'
+}
+
+// UnmarshalJSON accepts a string expression in place of the number of a geometry field
+func (config *Configuration) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, raw := range fields {
+		name, ok := geometryFieldName(key)
+		if !ok || len(raw) == 0 || raw[0] != '"' {
+			continue
+		}
+		var source string
+		if err := json.Unmarshal(raw, &source); err != nil {
+			return err
+		}
+		expression, err := ParseExpression(source)
+		if err != nil {
+			return fmt.Errorf("%s of configuration %s: %v", name, fields["name"], err)
+		}
+		if config.Expressions == nil {
+			config.Expressions = make(map[string]*Expression)
+		}
+		config.Expressions[name] = expression
+		delete(fields, key)
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	type plainConfiguration Configuration
+	return json.Unmarshal(data, (*plainConfiguration)(config))
+}
+
+// geometryFieldName is the field name of a module file key, matched without case like encoding/json does
+func geometryFieldName(key string) (string, bool) {
+	for name := range geometryFields(&Rectangle{}, &Offsets{}) {
+		if strings.EqualFold(name, key) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// geometryFields are the numeric fields of a configuration or display by their module file name
+func geometryFields(rectangle *Rectangle, offsets *Offsets) map[string]**int {
+	return map[string]**int{
+		"left":          &rectangle.Left,
+		"top":           &rectangle.Top,
+		"width":         &rectangle.Width,
+		"height":        &rectangle.Height,
+		"xOffsetStart":  &offsets.XOffsetStart,
+		"xOffsetFinish": &offsets.XOffsetFinish,
+		"yOffsetStart":  &offsets.YOffsetStart,
+		"yOffsetFinish": &offsets.YOffsetFinish,
+	}
+}
+
+// evaluateExpressions sets the fields of an enriched configuration that are expressions, a field may use the other fields
+// of the configuration by name, the ones of its parent as parent.<field> and the ones of its display as display.<field>
+func evaluateExpressions(config *Configuration) error {
+	fields := geometryFields(&config.Rectangle, &config.Offsets)
+	done := make(map[string]bool)
+	evaluating := make(map[string]bool)
+	var evaluate func(name string) error
+	var resolve func(name string) (float64, error)
+	evaluate = func(name string) error {
+		expression, ok := config.Expressions[name]
+		if !ok || done[name] {
+			return nil
+		}
+		if evaluating[name] {
+			return fmt.Errorf("%s depends on itself", name)
+		}
+		evaluating[name] = true
+		value, err := expression.Evaluate(resolve)
+		if err != nil {
+			return fmt.Errorf("%s = %q: %v", name, expression, err)
+		}
+		result := int(math.Round(value))
+		*fields[name] = &result
+		done[name] = true
+		return nil
+	}
+	resolve = func(name string) (float64, error) {
+		scope, field, scoped := strings.Cut(name, ".")
+		if !scoped {
+			if err := evaluate(name); err != nil {
+				return 0, err
+			}
+			return fieldValue(fields, name)
+		}
+		switch scope {
+		case "parent":
+			if config.Parent == nil {
+				return 0, fmt.Errorf("%s is a top level configuration without a parent", config.Name)
+			}
+			return fieldValue(geometryFields(&config.Parent.Rectangle, &config.Parent.Offsets), field)
+		case "display":
+			if config.Display == nil {
+				return 0, fmt.Errorf("%s matches no display", config.Name)
+			}
+			return fieldValue(geometryFields(&config.Display.Rectangle, &config.Display.Offsets), field)
+		}
+		return 0, fmt.Errorf("unknown name %s, use a field, parent.<field> or display.<field>", name)
+	}
+	for name := range config.Expressions {
+		if err := evaluate(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldValue is the value of a geometry field, an unset field is 0
+func fieldValue(fields map[string]**int, name string) (float64, error) {
+	field, ok := fields[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown field %s", name)
+	}
+	if *field == nil {
+		return 0, nil
+	}
+	return float64(**field), nil
+}
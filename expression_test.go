@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExpressionEvaluate(t *testing.T) {
+	names := map[string]float64{"width": 400, "parent.width": 1024, "display.height": 768}
+	resolve := func(name string) (float64, error) {
+		value, ok := names[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown name %s", name)
+		}
+		return value, nil
+	}
+	tests := []struct {
+		source string
+		want   float64
+	}{
+		{"42", 42},
+		{"1.5", 1.5},
+		{"2 + 3 * 4", 14},
+		{"(2 + 3) * 4", 20},
+		{"10 - 4 - 3", 3},
+		{"100 / 10 / 2", 5},
+		{"7 % 4 * 2", 6},
+		{"-5", -5},
+		{"-5 + 2", -3},
+		{"--5", 5},
+		{"+5", 5},
+		{"2 * -3", -6},
+		{"-(2 + 3) * 2", -10},
+		{"parent.width/2 - 64", 448},
+		{"display.height - width", 368},
+		{"min(width, 300) + max(1, 2)", 302},
+		{"round(2.5) + floor(1.9) + ceil(1.1)", 6},
+		{"max(min(width, parent.width), 0) / 4", 100},
+		{"\t1 +  2 ", 3},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			expression, err := ParseExpression(test.source)
+			if err != nil {
+				t.Fatalf("ParseExpression(%q): %v", test.source, err)
+			}
+			got, err := expression.Evaluate(resolve)
+			if err != nil {
+				t.Fatalf("Evaluate(%q): %v", test.source, err)
+			}
+			if got != test.want {
+				t.Errorf("Evaluate(%q) = %v, want %v", test.source, got, test.want)
+			}
+			if expression.String() != test.source {
+				t.Errorf("String() = %q, want %q", expression.String(), test.source)
+			}
+		})
+	}
+}
+
+func TestExpressionParseErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"", `unexpected end of ""`},
+		{"1 +", `unexpected end of "1 +"`},
+		{"(1 + 2", `missing ) in "(1 + 2"`},
+		{"1 2", `unexpected '2' at 3 in "1 2"`},
+		{"1 # 2", `unexpected '#' at 3 in "1 # 2"`},
+		{"1..2", `bad number "1..2" in "1..2"`},
+		{"sqrt(4)", `unknown function sqrt in "sqrt(4)"`},
+		{"min(1)", `min takes 2 arguments in "min(1)"`},
+		{"round(1, 2)", `round takes 1 arguments in "round(1, 2)"`},
+		{"max(1 2)", `missing , or ) in "max(1 2)"`},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			_, err := ParseExpression(test.source)
+			if err == nil {
+				t.Fatalf("ParseExpression(%q) succeeded, want %s", test.source, test.want)
+			}
+			if err.Error() != test.want {
+				t.Errorf("ParseExpression(%q) = %s, want %s", test.source, err, test.want)
+			}
+		})
+	}
+}
+
+func TestExpressionEvaluateErrors(t *testing.T) {
+	resolve := func(name string) (float64, error) {
+		return 0, fmt.Errorf("unknown name %s", name)
+	}
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{"4 / (2 - 2)", "division by zero"},
+		{"1 + missing", "unknown name missing"},
+		{"max(1, parent.nothing)", "unknown name parent.nothing"},
+		{"-missing", "unknown name missing"},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			expression, err := ParseExpression(test.source)
+			if err != nil {
+				t.Fatalf("ParseExpression(%q): %v", test.source, err)
+			}
+			_, err = expression.Evaluate(resolve)
+			if err == nil {
+				t.Fatalf("Evaluate(%q) succeeded, want %s", test.source, test.want)
+			}
+			if err.Error() != test.want {
+				t.Errorf("Evaluate(%q) = %s, want %s", test.source, err, test.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateExpressionsNames(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		parent     bool
+		want       string
+	}{
+		{"undefined field", "nothing + 1", true, `left = "nothing + 1": unknown field nothing`},
+		{"undefined scope", "screen.width", true, `left = "screen.width": unknown name screen.width, use a field, parent.<field> or display.<field>`},
+		{"undefined parent field", "parent.depth", true, `left = "parent.depth": unknown field depth`},
+		{"no parent", "parent.width", false, `left = "parent.width": TOP is a top level configuration without a parent`},
+		{"no display", "display.width", true, `left = "display.width": TOP matches no display`},
+		{"itself", "left + 1", true, `left = "left + 1": left depends on itself`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := ParseExpression(test.expression)
+			if err != nil {
+				t.Fatalf("ParseExpression(%q): %v", test.expression, err)
+			}
+			config := &Configuration{Name: "TOP", Expressions: map[string]*Expression{"left": expression}}
+			if test.parent {
+				config.Parent = &Configuration{Name: "PARENT"}
+			}
+			err = evaluateExpressions(config)
+			if err == nil {
+				t.Fatalf("evaluateExpressions succeeded, want %s", test.want)
+			}
+			if err.Error() != test.want {
+				t.Errorf("evaluateExpressions = %s, want %s", err, test.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateExpressionsFields(t *testing.T) {
+	width, parentWidth := 200, 800
+	config := &Configuration{Name: "CHILD", Parent: &Configuration{Name: "PARENT"}}
+	config.Width = &width
+	config.Parent.Width = &parentWidth
+	for field, source := range map[string]string{"left": "(parent.width - width) / 2", "top": "left / 3", "height": "width * 0.75"} {
+		expression, err := ParseExpression(source)
+		if err != nil {
+			t.Fatalf("ParseExpression(%q): %v", source, err)
+		}
+		if config.Expressions == nil {
+			config.Expressions = make(map[string]*Expression)
+		}
+		config.Expressions[field] = expression
+	}
+	if err := evaluateExpressions(config); err != nil {
+		t.Fatalf("evaluateExpressions: %v", err)
+	}
+	for field, want := range map[string]int{"left": 300, "top": 100, "height": 150} {
+		value := *geometryFields(&config.Rectangle, &config.Offsets)[field]
+		if value == nil || *value != want {
+			t.Errorf("%s = %v, want %d", field, value, want)
+		}
+	}
+}
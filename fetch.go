@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// githubAPI is where an owner/repo catalog entry lists its releases
+const githubAPI = "https://api.github.com/repos/"
+
+// githubRelease is a release of the GitHub API with only the fields fetch uses
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+		Size int64  `json:"size"`
+	} `json:"assets"`
+}
+
+// CatalogPackage is a module package attached to a release, the module is the name of the zip without .zip
+type CatalogPackage struct {
+	Module  string
+	Version string
+	Source  string
+	URL     string
+	Size    int64
+}
+
+// releasesURL is the releases endpoint of a catalog entry, owner/repo is a GitHub repository and a URL is used as it is
+func releasesURL(entry string) string {
+	if strings.HasPrefix(entry, "http://") || strings.HasPrefix(entry, "https://") {
+		return entry
+	}
+	return githubAPI + strings.Trim(entry, "/") + "/releases"
+}
+
+// fetchReleases reads the releases of a catalog entry, newest first as GitHub lists them, GITHUB_TOKEN raises the
+// rate limit of the API
+func fetchReleases(client *http.Client, entry string) ([]githubRelease, error) {
+	request, err := http.NewRequest(http.MethodGet, releasesURL(entry), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/vnd.github+json")
+	request.Header.Set("User-Agent", "gomfd/"+currentBuild().Version)
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", request.URL, response.Status)
+	}
+	var releases []githubRelease
+	if err := json.NewDecoder(io.LimitReader(response.Body, 16<<20)).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("%s: %w", request.URL, err)
+	}
+	return releases, nil
+}
+
+// catalogPackages lists the zip assets of the releases of every catalog entry, an entry that cannot be read is
+// warned about and skipped
+func catalogPackages(catalog []string) []CatalogPackage {
+	client := &http.Client{Timeout: 30 * time.Second}
+	var packages []CatalogPackage
+	for _, entry := range catalog {
+		releases, err := fetchReleases(client, entry)
+		if err != nil {
+			instance.Warnf("Skipping the catalog %s: %v", entry, err)
+			continue
+		}
+		for _, release := range releases {
+			for _, asset := range release.Assets {
+				if !strings.EqualFold(path.Ext(asset.Name), ".zip") {
+					continue
+				}
+				packages = append(packages, CatalogPackage{
+					Module:  asset.Name[:len(asset.Name)-len(".zip")],
+					Version: release.TagName,
+					Source:  entry,
+					URL:     asset.URL,
+					Size:    asset.Size,
+				})
+			}
+		}
+	}
+	return packages
+}
+
+// findCatalogPackage picks the package of the module, the first listed version is the newest release, version picks
+// a release by its tag
+func findCatalogPackage(packages []CatalogPackage, module string, version string) (CatalogPackage, bool) {
+	for _, candidate := range packages {
+		if strings.EqualFold(candidate.Module, module) && (version == "" || candidate.Version == version) {
+			return candidate, true
+		}
+	}
+	return CatalogPackage{}, false
+}
+
+// writeCatalog lists the packages with their version and where they come from
+func writeCatalog(packages []CatalogPackage) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Module\tVersion\tSize\tCatalog")
+	for _, candidate := range packages {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", candidate.Module, candidate.Version, formatBytes(candidate.Size), candidate.Source)
+	}
+	writer.Flush()
+}
+
+func newFetchCommand() *Command {
+	cmd := newCommand("fetch", "", "List the module packages of the releases in the catalog setting, or install -mod from them")
+	moduleName := cmd.Flags.String("mod", "", "Module to install, without it the available modules are listed")
+	version := cmd.Flags.String("version", "", "Release tag to install, defaults to the newest release with the module")
+	repository := cmd.Flags.String("repo", "", "Look in this owner/repo or releases URL instead of the catalog setting")
+	force := cmd.Flags.Bool("force", false, "Replace the installed module and images the package conflicts with")
+	allowExec := cmd.Flags.Bool("allow-exec", false, "Install a module whose filters run programs, they run on every render")
+	cmd.Run = func(args []string) error {
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		catalog := env.Config.Catalog
+		if *repository != "" {
+			catalog = []string{*repository}
+		}
+		if len(catalog) == 0 {
+			return classify(ErrConfiguration, errors.New("there is no catalog, add \"catalog\": [\"owner/repo\"] to appsettings.json or use -repo"))
+		}
+		packages := catalogPackages(catalog)
+		if *moduleName == "" {
+			writeCatalog(packages)
+			return nil
+		}
+		candidate, ok := findCatalogPackage(packages, *moduleName, *version)
+		if !ok {
+			return classify(ErrConfiguration, fmt.Errorf("no release of the catalog has the module %s %s", *moduleName, *version))
+		}
+		instance.Infof("Downloading %s %s from %s", candidate.Module, candidate.Version, candidate.URL)
+		data, err := readPackage(candidate.URL)
+		if err != nil {
+			return err
+		}
+		pkg, err := openPackage(env.Config, data)
+		if err != nil {
+			return classify(ErrConfiguration, fmt.Errorf("%s: %w", candidate.URL, err))
+		}
+		if err := installPackage(env, pkg, *force, *allowExec); err != nil {
+			return err
+		}
+		checkInstalledModule(pkg.Manifest.Module)
+		return nil
+	}
+	return cmd
+}
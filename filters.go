@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// builtinFilterPrefix names a filter GOMFD runs itself instead of a program, like the builtin: images
+const builtinFilterPrefix = "builtin:"
+
+// builtinFilters are the filters run without a program by the name after builtin:, with the arguments that follow it
+var builtinFilters = map[string]func(img image.Image, args []string) (image.Image, error){
+	"hud-green": hudGreenFilter,
+}
+
+// externalFilters lists the filters of configs and their sub-configurations that run a program, each once
+func externalFilters(configs []Configuration) []string {
+	var commands []string
+	for _, config := range configs {
+		for _, filter := range config.Filters {
+			if !strings.HasPrefix(strings.TrimSpace(filter), builtinFilterPrefix) && !slices.Contains(commands, filter) {
+				commands = append(commands, filter)
+			}
+		}
+		for _, command := range externalFilters(config.Configurations) {
+			if !slices.Contains(commands, command) {
+				commands = append(commands, command)
+			}
+		}
+	}
+	return commands
+}
+
+// runFilter runs a builtin filter or pipes img as a PNG through the command line of an external filter and decodes the
+// PNG it writes to stdout
+func runFilter(ctx context.Context, commandLine string, img image.Image) (image.Image, error) {
+	args, err := splitCommandLine(commandLine)
+	if err != nil {
+		return nil, err
+	}
+	if name, ok := strings.CutPrefix(args[0], builtinFilterPrefix); ok {
+		filter, found := builtinFilters[strings.ToLower(name)]
+		if !found {
+			return nil, fmt.Errorf("no builtin filter %s", name)
+		}
+		return filter(img, args[1:])
+	}
+	var input bytes.Buffer
+	if err := png.Encode(&input, img); err != nil {
+		return nil, err
+	}
+	var output, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = &input
+	cmd.Stdout = &output
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%v: %s", err, message)
+		}
+		return nil, err
+	}
+	filtered, err := png.Decode(&output)
+	if err != nil {
+		return nil, fmt.Errorf("the output is not a PNG: %v", err)
+	}
+	return filtered, nil
+}
+
+// splitCommandLine splits a filter into its program and arguments at spaces outside double quotes
+func splitCommandLine(commandLine string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	quoted, started := false, false
+	for _, r := range commandLine {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if started {
+				args = append(args, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if started {
+		args = append(args, current.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
+
+// validateFilter checks that a filter names a builtin filter or a program that can be found
+func validateFilter(commandLine string) error {
+	args, err := splitCommandLine(commandLine)
+	if err != nil {
+		return err
+	}
+	if name, ok := strings.CutPrefix(args[0], builtinFilterPrefix); ok {
+		if _, found := builtinFilters[strings.ToLower(name)]; !found {
+			return fmt.Errorf("no builtin filter %s, use builtin:hud-green", name)
+		}
+		return nil
+	}
+	_, err = exec.LookPath(args[0])
+	return err
+}
+
+// hudGreenTint is the phosphor green of a HUD repeater
+var hudGreenTint = color.NRGBA{R: 0x40, G: 0xff, B: 0x60, A: 0xff}
+
+// hudGreenFilter turns an image into green on black like a HUD repeater, the parts darker than the threshold, a
+// brightness from 0 to 1 that defaults to 0.35, turn black and the rest is tinted green by its brightness
+func hudGreenFilter(img image.Image, args []string) (image.Image, error) {
+	threshold := 0.35
+	if len(args) > 0 {
+		value, err := strconv.ParseFloat(args[0], 64)
+		if err != nil || value < 0 || value >= 1 {
+			return nil, fmt.Errorf("the threshold %q of hud-green is not from 0 to below 1", args[0])
+		}
+		threshold = value
+	}
+	bounds := img.Bounds()
+	green := newCanvas(bounds, isDeepImage(img))
+	tint := [3]float64{float64(hudGreenTint.R) / 255, float64(hudGreenTint.G) / 255, float64(hudGreenTint.B) / 255}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			luminance := (0.2126*float64(pixel.R) + 0.7152*float64(pixel.G) + 0.0722*float64(pixel.B)) / 0xffff
+			level := max(0, (luminance-threshold)/(1-threshold))
+			green.Set(x, y, color.NRGBA64{
+				R: uint16(tint[0] * level * 0xffff),
+				G: uint16(tint[1] * level * 0xffff),
+				B: uint16(tint[2] * level * 0xffff),
+				A: pixel.A,
+			})
+		}
+	}
+	return green, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// fixtureDisplays are the two 600 pixel MFDs of the synthetic cockpit, cropped from the numbered squares on it
+const fixtureDisplays = `[
+  {"name": "LMFD", "left": 0, "top": 0, "width": 600, "height": 600, "xOffsetStart": 100, "xOffsetFinish": 700, "yOffsetStart": 200, "yOffsetFinish": 800},
+  {"name": "RMFD", "left": 600, "top": 0, "width": 600, "height": 600, "xOffsetStart": 900, "xOffsetFinish": 1500, "yOffsetStart": 200, "yOffsetFinish": 800}
+]
+`
+
+// fixtureModule draws the grid, the gradient and the quadrants on the MFDs, centered, faded and placed at an offset
+const fixtureModule = `{
+  "modules": [
+    {
+      "name": "Sample",
+      "displayName": "Synthetic sample",
+      "tag": "Sample",
+      "fileName": "cockpit.png",
+      "configurations": [
+        {
+          "name": "LMFD",
+          "subConfigDef": [
+            {"name": "LMFD_GRID", "fileName": "grid.png", "center": true, "width": 400, "height": 400, "xOffsetStart": 0, "xOffsetFinish": 800, "yOffsetStart": 0, "yOffsetFinish": 800}
+          ]
+        },
+        {
+          "name": "RMFD",
+          "subConfigDef": [
+            {"name": "RMFD_GRADIENT", "fileName": "gradient.png", "center": true, "width": 500, "height": 500, "xOffsetStart": 0, "xOffsetFinish": 800, "yOffsetStart": 0, "yOffsetFinish": 800},
+            {"name": "RMFD_QUADRANTS", "fileName": "quadrants.png", "opacity": 0.7, "left": 50, "top": 50, "width": 300, "height": 300, "xOffsetStart": 200, "xOffsetFinish": 600, "yOffsetStart": 200, "yOffsetFinish": 600}
+          ]
+        }
+      ]
+    }
+  ]
+}
+`
+
+// quadrantColors fill the numbered quadrants clockwise from the top left
+var quadrantColors = []color.RGBA{{R: 200, G: 40, B: 40, A: 255}, {R: 40, G: 160, B: 40, A: 255}, {R: 40, G: 80, B: 200, A: 255}, {R: 200, G: 160, B: 40, A: 255}}
+
+// drawFixtureText writes text with the fixed 7x13 font scaled up by whole pixels, its top left at at
+func drawFixtureText(img draw.Image, text string, at image.Point, scale int, textColor color.Color) {
+	face := basicfont.Face7x13
+	label := image.NewRGBA(image.Rect(0, 0, font.MeasureString(face, text).Ceil(), face.Height))
+	drawer := &font.Drawer{Dst: label, Src: image.NewUniform(textColor), Face: face, Dot: fixed.P(0, face.Ascent)}
+	drawer.DrawString(text)
+	size := label.Bounds().Size().Mul(scale)
+	xdraw.NearestNeighbor.Scale(img, image.Rectangle{Min: at, Max: at.Add(size)}, label, label.Bounds(), xdraw.Over, nil)
+}
+
+// drawGrid draws lines every step pixels and labels every other one with its coordinates
+func drawGrid(img draw.Image, area image.Rectangle, step int, lineColor color.Color) {
+	for x := area.Min.X; x < area.Max.X; x += step {
+		draw.Draw(img, image.Rect(x, area.Min.Y, x+1, area.Max.Y), image.NewUniform(lineColor), image.Point{}, draw.Over)
+	}
+	for y := area.Min.Y; y < area.Max.Y; y += step {
+		draw.Draw(img, image.Rect(area.Min.X, y, area.Max.X, y+1), image.NewUniform(lineColor), image.Point{}, draw.Over)
+	}
+	for y := area.Min.Y; y < area.Max.Y; y += 2 * step {
+		for x := area.Min.X; x < area.Max.X; x += 2 * step {
+			drawFixtureText(img, fmt.Sprintf("%d,%d", x, y), image.Pt(x+3, y+3), 1, lineColor)
+		}
+	}
+}
+
+// drawQuadrants fills the four quarters of area with their color and a large number
+func drawQuadrants(img draw.Image, area image.Rectangle) {
+	half := area.Size().Div(2)
+	for i, fill := range quadrantColors {
+		corner := area.Min.Add(image.Pt([]int{0, half.X, half.X, 0}[i], []int{0, 0, half.Y, half.Y}[i]))
+		quadrant := image.Rectangle{Min: corner, Max: corner.Add(half)}
+		draw.Draw(img, quadrant, image.NewUniform(fill), image.Point{}, draw.Src)
+		scale := max(1, half.Y/40)
+		number := strconv.Itoa(i + 1)
+		center := quadrant.Min.Add(half.Div(2)).Sub(image.Pt(7*scale/2, 13*scale/2))
+		drawFixtureText(img, number, center, scale, color.White)
+	}
+}
+
+// fixtureImages draws the synthetic source images, a cockpit with two numbered MFD squares on a gradient, a grid, a
+// color gradient and numbered quadrants
+func fixtureImages() map[string]image.Image {
+	cockpit := image.NewRGBA(image.Rect(0, 0, 1600, 900))
+	for y := 0; y < 900; y++ {
+		shade := uint8(20 + y*60/900)
+		draw.Draw(cockpit, image.Rect(0, y, 1600, y+1), image.NewUniform(color.RGBA{R: shade, G: shade, B: shade + 30, A: 255}), image.Point{}, draw.Src)
+	}
+	drawGrid(cockpit, cockpit.Bounds(), 50, color.RGBA{R: 90, G: 90, B: 110, A: 255})
+	for i, name := range []string{"LMFD", "RMFD"} {
+		area := image.Rect(100+800*i, 200, 700+800*i, 800)
+		drawQuadrants(cockpit, area)
+		drawFixtureText(cockpit, name, image.Pt(area.Min.X, area.Min.Y-40), 3, color.White)
+	}
+
+	grid := image.NewRGBA(image.Rect(0, 0, 800, 800))
+	fillCanvas(grid, color.Black)
+	drawGrid(grid, grid.Bounds(), 50, color.White)
+
+	gradient := image.NewRGBA(image.Rect(0, 0, 800, 800))
+	for y := 0; y < 800; y++ {
+		for x := 0; x < 800; x++ {
+			gradient.SetRGBA(x, y, color.RGBA{R: uint8(x * 255 / 799), G: uint8(y * 255 / 799), B: uint8(255 - x*255/799), A: 255})
+		}
+	}
+	drawFixtureText(gradient, "GRADIENT", image.Pt(8, 8), 3, color.White)
+
+	quadrants := image.NewRGBA(image.Rect(0, 0, 800, 800))
+	drawQuadrants(quadrants, quadrants.Bounds())
+	return map[string]image.Image{"cockpit.png": cockpit, "grid.png": grid, "gradient.png": gradient, "quadrants.png": quadrants}
+}
+
+// writeFixtures writes the synthetic images, displays.json, the Sample module and an appsettings.json using them
+// into folder and returns those settings
+func writeFixtures(folder string) (*MfdConfig, error) {
+	settings := &MfdConfig{
+		DisplayConfigurationFile: filepath.Join(folder, "displays.json"),
+		Modules:                  filepath.Join(folder, "modules"),
+		FilePath:                 filepath.Join(folder, "images"),
+		CachePath:                filepath.Join(folder, "Cache"),
+	}
+	for _, path := range []string{settings.Modules, settings.FilePath, filepath.Join(folder, "MFDMF")} {
+		if err := ensurePathExists(path); err != nil {
+			return nil, err
+		}
+	}
+	files := map[string][]byte{
+		settings.DisplayConfigurationFile:              []byte(fixtureDisplays),
+		filepath.Join(settings.Modules, "Sample.json"): []byte(fixtureModule),
+	}
+	for name, img := range fixtureImages() {
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, img); err != nil {
+			return nil, err
+		}
+		files[filepath.Join(settings.FilePath, name)] = encoded.Bytes()
+	}
+	appSettings, err := json.MarshalIndent(map[string]string{
+		"displayConfigurationFile": settings.DisplayConfigurationFile,
+		"modules":                  settings.Modules,
+		"filePath":                 settings.FilePath,
+		"cachePath":                settings.CachePath,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files[filepath.Join(folder, "MFDMF", "appsettings.json")] = appSettings
+	for name, data := range files {
+		if err := os.WriteFile(longPath(name), data, 0644); err != nil {
+			return nil, classify(ErrEncode, fmt.Errorf("failed to write %s: %w", name, err))
+		}
+	}
+	return settings, nil
+}
+
+// renderFixtures runs the fixtures through the whole pipeline into their cache with their own settings, the settings
+// of the user are not read
+func renderFixtures(settings *MfdConfig) (*RunReport, error) {
+	displays, err := readDisplaysJSON(settings.DisplayConfigurationFile)
+	if err != nil {
+		return nil, err
+	}
+	setDisplays(displays, instance)
+	modules, err := readModuleFiles(settings.Modules)
+	if err != nil {
+		return nil, err
+	}
+	env := &Environment{Config: settings, Logger: instance, Displays: displays, Modules: modules}
+	ctx, stop := interruptContext()
+	defer stop()
+	report := NewRunReport(RunOptions{Force: true, Workers: runtime.NumCPU()})
+	_, _, err = generateModules(ctx, env, Selection{}, report)
+	return report, err
+}
+
+func newFixturesCommand() *Command {
+	cmd := newCommand("fixtures", "", "Write synthetic source images, displays and a sample module that use no cockpit imagery, and render them with -render")
+	folder := cmd.Flags.String("o", "", "Folder to write into, defaults to a new temp folder")
+	render := cmd.Flags.Bool("render", false, "Render the sample module into the Cache folder of the fixtures")
+	cmd.Run = func(args []string) error {
+		if *folder == "" {
+			created, err := os.MkdirTemp("", "gomfd-fixtures-")
+			if err != nil {
+				return err
+			}
+			*folder = created
+		}
+		settings, err := writeFixtures(*folder)
+		if err != nil {
+			return err
+		}
+		instance.Infof("Wrote the fixtures to %s, copy its MFDMF/appsettings.json over the one in Saved Games to use them", *folder)
+		if !*render {
+			return nil
+		}
+		report, err := renderFixtures(settings)
+		if err != nil {
+			return err
+		}
+		instance.Infof("Rendered %d configurations into %s", report.Rendered, settings.CachePath)
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useSavedGames points the Saved Games folder at folder until the test ends, the log, the settings and the overrides
+// are read there
+func useSavedGames(t *testing.T, folder string) {
+	t.Helper()
+	GetLogger()
+	previous := savedGamesOverride
+	savedGamesOverride = folder
+	t.Cleanup(func() {
+		savedGamesOverride = previous
+		// The settings loaded from folder are read again from the next Saved Games folder
+		configMu.Lock()
+		configLoaded = false
+		configMu.Unlock()
+	})
+}
+
+func TestRenderFixtures(t *testing.T) {
+	folder := t.TempDir()
+	useSavedGames(t, folder)
+	settings, err := writeFixtures(folder)
+	if err != nil {
+		t.Fatalf("writeFixtures: %v", err)
+	}
+	report, err := renderFixtures(settings)
+	if err != nil {
+		t.Fatalf("renderFixtures: %v", err)
+	}
+	if report.Rendered != 5 || len(report.Failures) != 0 {
+		t.Errorf("renderFixtures rendered %d configurations with %d failures, want 5 and none", report.Rendered, len(report.Failures))
+	}
+	modules, err := readModuleFiles(settings.Modules)
+	if err != nil || len(modules) != 1 {
+		t.Fatalf("readModuleFiles = %d modules, %v", len(modules), err)
+	}
+	sizes := map[string]image.Point{
+		"LMFD": image.Pt(600, 600), "LMFD/LMFD_GRID": image.Pt(600, 600),
+		"RMFD": image.Pt(600, 600), "RMFD/RMFD_GRADIENT": image.Pt(600, 600), "RMFD/RMFD_QUADRANTS": image.Pt(600, 600),
+	}
+	for _, output := range configurationOutputs(settings, modules[0]) {
+		files, _ := filepath.Glob(output.file + ".*")
+		if len(files) == 0 {
+			t.Errorf("%s was not written to %s", output.path, output.file)
+			continue
+		}
+		file, err := os.Open(files[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, _, err := image.DecodeConfig(file)
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: %v", files[0], err)
+			continue
+		}
+		if want, ok := sizes[output.path]; !ok || header.Width != want.X || header.Height != want.Y {
+			t.Errorf("%s is %dx%d, want %v", output.path, header.Width, header.Height, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"gomfd/controlpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// controlService is the gRPC control API, it drives the same functions as the REST API
+type controlService struct {
+	controlpb.UnimplementedControlServer
+}
+
+// grpcError maps the error kinds onto gRPC status codes
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, errNoDisplays):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrConfiguration):
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (s *controlService) GenerateModule(ctx context.Context, request *controlpb.GenerateModuleRequest) (*controlpb.GenerateModuleResponse, error) {
+	if request.Module == "" {
+		return nil, status.Error(codes.InvalidArgument, "module is required")
+	}
+	report, err := generateModule(ctx, request.Module, request.Configuration, request.Force)
+	if report == nil || (err != nil && report.Rendered == 0 && len(report.Failures) == 0) {
+		return nil, grpcError(err)
+	}
+	response := &controlpb.GenerateModuleResponse{Rendered: int32(report.Rendered), Skipped: int32(report.Skipped)}
+	for _, failure := range report.Failures {
+		response.Failures = append(response.Failures, failure.String())
+	}
+	return response, nil
+}
+
+func (s *controlService) ListConfigurations(ctx context.Context, request *controlpb.ListConfigurationsRequest) (*controlpb.ListConfigurationsResponse, error) {
+	env, err := loadEnvironment()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	modules := filterModules(env.Modules, Selection{ModuleName: request.Module})
+	if len(modules) == 0 {
+		return nil, status.Errorf(codes.NotFound, "module %s was not found", request.Module)
+	}
+	response := &controlpb.ListConfigurationsResponse{}
+	var collect func(module string, parent string, configs []Configuration)
+	collect = func(module string, parent string, configs []Configuration) {
+		for _, config := range configs {
+			item := &controlpb.Configuration{Module: module, Name: config.Name, Parent: parent}
+			if config.Display != nil {
+				item.Display = config.Display.Name
+			}
+			response.Configurations = append(response.Configurations, item)
+			collect(module, config.Name, config.Configurations)
+		}
+	}
+	for _, module := range modules {
+		prepareModule(&module, env)
+		collect(module.Name, "", module.Configurations)
+	}
+	return response, nil
+}
+
+func (s *controlService) SelectConfiguration(ctx context.Context, request *controlpb.SelectConfigurationRequest) (*controlpb.SelectConfigurationResponse, error) {
+	if request.Configuration == "" && request.Action == "" {
+		return nil, status.Error(codes.InvalidArgument, "select needs a configuration or an action")
+	}
+	action := PageAction{Display: request.Display, Configuration: request.Configuration, Action: request.Action}
+	if err := shownDisplays.Select(action); err != nil {
+		return nil, grpcError(err)
+	}
+	return &controlpb.SelectConfigurationResponse{}, nil
+}
+
+func (s *controlService) StreamProgress(request *controlpb.StreamProgressRequest, stream controlpb.Control_StreamProgressServer) error {
+	events := renderEvents.Subscribe()
+	defer renderEvents.Unsubscribe(events)
+	for {
+		select {
+		case event := <-events:
+			progress := &controlpb.ProgressEvent{Module: event.Module, Configuration: event.Configuration, DurationMs: event.Duration.Milliseconds()}
+			switch event.Kind {
+			case RenderRendered:
+				progress.Kind = controlpb.ProgressEvent_KIND_RENDERED
+			case RenderSkipped:
+				progress.Kind = controlpb.ProgressEvent_KIND_SKIPPED
+			case RenderFailed:
+				progress.Kind = controlpb.ProgressEvent_KIND_FAILED
+				progress.Error = event.Err.Error()
+			}
+			if err := stream.Send(progress); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// startControlGRPC serves the gRPC control API in the background
+func startControlGRPC(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC on %s: %w", address, err)
+	}
+	server := grpc.NewServer()
+	controlpb.RegisterControlServer(server, &controlService{})
+	instance.Infof("Serving the gRPC control API on %s", listener.Addr())
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			instance.Errorf("The gRPC control API stopped: %v", err)
+		}
+	}()
+	return nil
+}
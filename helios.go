@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// heliosImageType identifies the image decoration control of Helios, which shows a picture and can be hidden
+const heliosImageType = "Helios.Base.ImageDecoration"
+
+// heliosChildren is the Children element of a Helios monitor, the fragment is pasted into a profile
+type heliosChildren struct {
+	XMLName  xml.Name        `xml:"Children"`
+	Comment  string          `xml:",comment"`
+	Controls []heliosControl `xml:"Control"`
+}
+
+// heliosControl is an image decoration showing one composite at the position of its display
+type heliosControl struct {
+	Type      string `xml:"TypeIdentifier,attr"`
+	Name      string `xml:"Name,attr"`
+	Location  string `xml:"Location"`
+	Size      string `xml:"Size"`
+	Hidden    string `xml:"Hidden"`
+	Image     string `xml:"Image"`
+	Alignment string `xml:"Alignment"`
+}
+
+// heliosProfile is an image decoration for every composite of the displays of the module, at the position and size of
+// the display, the top level configuration is shown and its sub-configurations are hidden for the profile to switch
+func heliosProfile(env *Environment, module *Module) (heliosChildren, error) {
+	files := generateConfigToFileMap(env.Config, *module)
+	profile := heliosChildren{Comment: fmt.Sprintf(" GOMFD %s, paste the controls into the Children of a monitor ", module.Name)}
+	for i := range module.Configurations {
+		config := &module.Configurations[i]
+		if config.Display == nil || (config.Enabled != nil && !*config.Enabled) {
+			continue
+		}
+		bounds := configurationBounds(config)
+		pages := []*Configuration{config}
+		for j := range config.Configurations {
+			pages = append(pages, &config.Configurations[j])
+		}
+		for _, page := range pages {
+			fileName, err := filepath.Abs(files[configurationPath(page)] + ".jpg")
+			if err != nil {
+				return profile, err
+			}
+			hidden := "False"
+			if page != config {
+				hidden = "True"
+			}
+			profile.Controls = append(profile.Controls, heliosControl{
+				Type:      heliosImageType,
+				Name:      module.Name + " " + page.Name,
+				Location:  fmt.Sprintf("%d,%d", bounds.Min.X, bounds.Min.Y),
+				Size:      fmt.Sprintf("%d,%d", bounds.Dx(), bounds.Dy()),
+				Hidden:    hidden,
+				Image:     fileName,
+				Alignment: "Stretched",
+			})
+		}
+	}
+	if len(profile.Controls) == 0 {
+		return profile, classify(ErrConfiguration, fmt.Errorf("module %s has no configurations assigned to a display", module.Name))
+	}
+	return profile, nil
+}
+
+// exportHelios writes the Helios profile fragment of the module to fileName
+func exportHelios(env *Environment, module *Module, fileName string) error {
+	profile, err := heliosProfile(env, module)
+	if err != nil {
+		return err
+	}
+	data, err := xml.MarshalIndent(profile, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ensurePathExists(filepath.Dir(fileName)); err != nil {
+		return classify(ErrEncode, err)
+	}
+	if err := os.WriteFile(longPath(fileName), append(data, '\n'), 0644); err != nil {
+		return classify(ErrEncode, fmt.Errorf("failed to write %s: %w", fileName, err))
+	}
+	instance.Infof("Exported %d Helios images of %s to %s", len(profile.Controls), module.Name, fileName)
+	return nil
+}
+
+func newHeliosCommand() *Command {
+	cmd := newCommand("helios", "", "Export a Helios profile fragment placing the composites of each module at the positions of their displays")
+	selectionArgs := addSelectionFlags(cmd.Flags)
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	folder := cmd.Flags.String("dir", ".", "Folder the <module>.helios.xml files are written to")
+	cmd.Run = func(args []string) error {
+		selection, err := selectionArgs.Selection()
+		if err != nil {
+			return err
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		ctx, stop := interruptContext()
+		defer stop()
+		// The fragment refers to the cached composites, bring them up to date
+		if _, _, err := generateModules(ctx, env, selection, NewRunReport(*runOptions)); err != nil {
+			return err
+		}
+		var failed []string
+		for _, module := range filterModules(env.Modules, selection) {
+			prepareModule(&module, env)
+			if err := exportHelios(env, &module, filepath.Join(*folder, module.Name+".helios.xml")); err != nil {
+				instance.Error(err.Error())
+				failed = append(failed, module.Name)
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("the Helios profile of %s could not be exported", strings.Join(failed, ", "))
+		}
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PageAction shows a configuration on a display, with the next or previous action it turns a UseAsSwitch display instead
+type PageAction struct {
+	Display       string `json:"display"`
+	Configuration string `json:"configuration,omitempty"`
+	Action        string `json:"action,omitempty"`
+}
+
+// Step is how far the action turns a switch, 0 when it shows a configuration
+func (a PageAction) Step() int {
+	switch strings.ToLower(a.Action) {
+	case "next":
+		return 1
+	case "previous":
+		return -1
+	}
+	return 0
+}
+
+func (a PageAction) validate(source string) error {
+	if a.Action != "" && a.Step() == 0 {
+		return classify(ErrConfiguration, fmt.Errorf("unknown action %q of %s, use next or previous", a.Action, source))
+	}
+	return nil
+}
+
+// HotkeyBinding runs a PageAction when its keys are pressed, for example Ctrl+Alt+1
+type HotkeyBinding struct {
+	Keys string `json:"keys"`
+	PageAction
+}
+
+// Hotkey is a parsed HotkeyBinding with the Windows modifier flags and virtual-key code
+type Hotkey struct {
+	HotkeyBinding
+	Modifiers uint32
+	Key       uint32
+}
+
+// Windows RegisterHotKey modifier flags
+const (
+	hotkeyAlt      = 0x0001
+	hotkeyControl  = 0x0002
+	hotkeyShift    = 0x0004
+	hotkeyWin      = 0x0008
+	hotkeyNoRepeat = 0x4000
+)
+
+// namedKeys are the Windows virtual-key codes of the keys that are not a letter, digit or function key
+var namedKeys = map[string]uint32{
+	"space": 0x20, "pageup": 0x21, "pagedown": 0x22, "end": 0x23, "home": 0x24,
+	"left": 0x25, "up": 0x26, "right": 0x27, "down": 0x28, "insert": 0x2D, "delete": 0x2E,
+	"tab": 0x09, "enter": 0x0D, "pause": 0x13,
+}
+
+// parseKeys reads a key combination such as Ctrl+Alt+1, Shift+F5 or Ctrl+Num3 into modifiers and a virtual-key code
+func parseKeys(keys string) (uint32, uint32, error) {
+	var modifiers, key uint32
+	parts := strings.Split(keys, "+")
+	for i, part := range parts {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if i < len(parts)-1 {
+			switch name {
+			case "ctrl", "control":
+				modifiers |= hotkeyControl
+			case "alt":
+				modifiers |= hotkeyAlt
+			case "shift":
+				modifiers |= hotkeyShift
+			case "win":
+				modifiers |= hotkeyWin
+			default:
+				return 0, 0, fmt.Errorf("unknown modifier %q in hotkey %q", part, keys)
+			}
+			continue
+		}
+
+		var number uint32
+		switch {
+		case len(name) == 1 && name[0] >= '0' && name[0] <= '9':
+			key = uint32(name[0])
+		case len(name) == 1 && name[0] >= 'a' && name[0] <= 'z':
+			key = uint32(name[0] - 'a' + 'A')
+		case strings.HasPrefix(name, "num") && len(name) == 4 && name[3] >= '0' && name[3] <= '9':
+			key = 0x60 + uint32(name[3]-'0')
+		case strings.HasPrefix(name, "f") && len(name) > 1:
+			if _, err := fmt.Sscanf(name[1:], "%d", &number); err != nil || number < 1 || number > 24 {
+				return 0, 0, fmt.Errorf("unknown key %q in hotkey %q", part, keys)
+			}
+			key = 0x70 + number - 1
+		default:
+			code, ok := namedKeys[name]
+			if !ok {
+				return 0, 0, fmt.Errorf("unknown key %q in hotkey %q", part, keys)
+			}
+			key = code
+		}
+	}
+	if key == 0 {
+		return 0, 0, fmt.Errorf("hotkey %q has no key", keys)
+	}
+	return modifiers, key, nil
+}
+
+// parseHotkeys parses the hotkeys of the settings, any invalid one is a configuration error
+func parseHotkeys(bindings []HotkeyBinding) ([]Hotkey, error) {
+	var hotkeys []Hotkey
+	for _, binding := range bindings {
+		modifiers, key, err := parseKeys(binding.Keys)
+		if err != nil {
+			return nil, classify(ErrConfiguration, err)
+		}
+		if err := binding.validate("hotkey " + binding.Keys); err != nil {
+			return nil, err
+		}
+		hotkeys = append(hotkeys, Hotkey{HotkeyBinding: binding, Modifiers: modifiers, Key: key})
+	}
+	return hotkeys, nil
+}
+
+// checkPageAction warns about an action that names a display or configuration the module does not show
+func checkPageAction(source string, action PageAction, windows []*DisplayWindow) {
+	window := findDisplayWindow(windows, action.Display)
+	if window == nil {
+		instance.Warnf("%s: display %s is not shown", source, action.Display)
+		return
+	}
+	if action.Step() != 0 {
+		if !window.Switch {
+			instance.Warnf("%s: %s is not a switch, set useAsSwitch to turn it", source, action.Display)
+		}
+		return
+	}
+	current := window.Current
+	if !window.ShowPage(action.Configuration) {
+		instance.Warnf("%s: %s has no configuration %s", source, action.Display, action.Configuration)
+	}
+	window.Current = current
+}
+
+func findDisplayWindow(windows []*DisplayWindow, display string) *DisplayWindow {
+	for _, window := range windows {
+		if strings.EqualFold(window.Display, display) {
+			return window
+		}
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+)
+
+// profiledImage is a decoded source image with the ICC profile embedded in its file, the renderer converts it to sRGB
+// with color management and otherwise uses the image as is
+type profiledImage struct {
+	image.Image
+	Profile []byte
+}
+
+// decodeSourceImage decodes a source image and keeps the ICC profile of a PNG or JPEG with one
+func decodeSourceImage(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, describeDecodeError(err)
+	}
+	if profile := embeddedICCProfile(data); profile != nil {
+		return &profiledImage{Image: img, Profile: profile}, nil
+	}
+	return img, nil
+}
+
+// embeddedICCProfile is the ICC profile of the iCCP chunk of a PNG or the APP2 segments of a JPEG, nil without one
+func embeddedICCProfile(data []byte) []byte {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return pngICCProfile(data)
+	case bytes.HasPrefix(data, []byte{0xff, 0xd8}):
+		return jpegICCProfile(data)
+	}
+	return nil
+}
+
+func pngICCProfile(data []byte) []byte {
+	for offset := 8; offset+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		chunkType := string(data[offset+4 : offset+8])
+		if length < 0 || offset+12+length > len(data) || chunkType == "IDAT" {
+			return nil
+		}
+		if chunkType == "iCCP" {
+			// A profile name, its terminating zero and the compression method, which is always zlib
+			chunk := data[offset+8 : offset+8+length]
+			name := bytes.IndexByte(chunk, 0)
+			if name < 0 || name+2 > len(chunk) {
+				return nil
+			}
+			reader, err := zlib.NewReader(bytes.NewReader(chunk[name+2:]))
+			if err != nil {
+				return nil
+			}
+			defer reader.Close()
+			profile, err := io.ReadAll(reader)
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+		offset += 12 + length
+	}
+	return nil
+}
+
+func jpegICCProfile(data []byte) []byte {
+	const marker = "ICC_PROFILE\x00"
+	parts := map[byte][]byte{}
+	var count byte
+	for offset := 2; offset+4 <= len(data) && data[offset] == 0xff; {
+		segment := data[offset+1]
+		// The image data follows the start of scan
+		if segment == 0xda {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			return nil
+		}
+		body := data[offset+4 : offset+2+length]
+		// A profile too large for one segment is split over several numbered from 1
+		if segment == 0xe2 && len(body) > len(marker)+2 && string(body[:len(marker)]) == marker {
+			parts[body[len(marker)]] = body[len(marker)+2:]
+			count = body[len(marker)+1]
+		}
+		offset += 2 + length
+	}
+	if count == 0 || len(parts) != int(count) {
+		return nil
+	}
+	var profile []byte
+	for i := byte(1); i <= count; i++ {
+		part, ok := parts[i]
+		if !ok {
+			return nil
+		}
+		profile = append(profile, part...)
+	}
+	return profile
+}
+
+// toneCurve converts an encoded channel from 0 to 1 to linear light
+type toneCurve func(float64) float64
+
+// matrixProfile is an RGB ICC profile described by the D50 XYZ of its colorants and a tone curve per channel, the kind
+// cameras, screenshots and image editors embed
+type matrixProfile struct {
+	toXYZ  [3][3]float64
+	curves [3]toneCurve
+}
+
+// srgbToXYZD50 is the sRGB to XYZ matrix adapted to the D50 white of the ICC profile connection space
+var srgbToXYZD50 = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+// parseMatrixProfile reads the colorants and tone curves of an RGB profile, other profiles are not supported
+func parseMatrixProfile(profile []byte) (*matrixProfile, error) {
+	if len(profile) < 132 || string(profile[36:40]) != "acsp" {
+		return nil, errors.New("not an ICC profile")
+	}
+	if space := string(profile[16:20]); space != "RGB " {
+		return nil, fmt.Errorf("%q profiles are not supported", space)
+	}
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	for i := 0; i < count && 132+12*i+12 <= len(profile); i++ {
+		entry := profile[132+12*i:]
+		offset, size := int(binary.BigEndian.Uint32(entry[4:])), int(binary.BigEndian.Uint32(entry[8:]))
+		if offset >= 0 && size >= 0 && offset+size <= len(profile) {
+			tags[string(entry[:4])] = profile[offset : offset+size]
+		}
+	}
+	parsed := &matrixProfile{}
+	for channel, prefix := range []string{"r", "g", "b"} {
+		xyz, ok := tags[prefix+"XYZ"]
+		if !ok || len(xyz) < 20 || string(xyz[:4]) != "XYZ " {
+			return nil, errors.New("only matrix and tone curve profiles are supported")
+		}
+		for row := 0; row < 3; row++ {
+			parsed.toXYZ[row][channel] = s15Fixed16(xyz[8+4*row:])
+		}
+		curve, err := parseToneCurve(tags[prefix+"TRC"])
+		if err != nil {
+			return nil, fmt.Errorf("%sTRC: %w", prefix, err)
+		}
+		parsed.curves[channel] = curve
+	}
+	return parsed, nil
+}
+
+func s15Fixed16(data []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(data))) / 65536
+}
+
+// parseToneCurve reads a curv table or gamma or a para function
+func parseToneCurve(tag []byte) (toneCurve, error) {
+	if len(tag) < 12 {
+		return nil, errors.New("missing tone curve")
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(tag[8:]))
+		if len(tag) < 12+2*count {
+			return nil, errors.New("truncated tone curve")
+		}
+		switch count {
+		case 0:
+			return func(v float64) float64 { return v }, nil
+		case 1:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(v float64) float64 { return math.Pow(v, gamma) }, nil
+		}
+		table := make([]float64, count)
+		for i := range table {
+			table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+		}
+		return func(v float64) float64 {
+			position := v * float64(count-1)
+			i := min(int(position), count-2)
+			return table[i] + (table[i+1]-table[i])*(position-float64(i))
+		}, nil
+	case "para":
+		function := binary.BigEndian.Uint16(tag[8:])
+		// The number of parameters of each parametric function type
+		counts := []int{1, 3, 4, 5, 7}
+		if int(function) >= len(counts) || len(tag) < 12+4*counts[function] {
+			return nil, errors.New("unknown parametric tone curve")
+		}
+		p := [7]float64{}
+		for i := 0; i < counts[function]; i++ {
+			p[i] = s15Fixed16(tag[12+4*i:])
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		switch function {
+		case 0:
+			return func(v float64) float64 { return math.Pow(v, g) }, nil
+		case 1:
+			return func(v float64) float64 {
+				if v >= -b/a {
+					return math.Pow(a*v+b, g)
+				}
+				return 0
+			}, nil
+		case 2:
+			return func(v float64) float64 {
+				if v >= -b/a {
+					return math.Pow(a*v+b, g) + c
+				}
+				return c
+			}, nil
+		case 3:
+			return func(v float64) float64 {
+				if v >= d {
+					return math.Pow(a*v+b, g)
+				}
+				return c * v
+			}, nil
+		}
+		return func(v float64) float64 {
+			if v >= d {
+				return math.Pow(a*v+b, g) + e
+			}
+			return c*v + f
+		}, nil
+	}
+	return nil, fmt.Errorf("%q tone curves are not supported", tag[:4])
+}
+
+// srgbEncode converts linear light to the sRGB encoding
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// srgbDecode converts the sRGB encoding to linear light
+func srgbDecode(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// invert3x3 inverts a matrix, the colorants of a usable profile are never singular
+func invert3x3(m [3][3]float64) [3][3]float64 {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) - m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) + m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	var inverse [3][3]float64
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			// The cofactor of the transposed element
+			r1, r2 := (col+1)%3, (col+2)%3
+			c1, c2 := (row+1)%3, (row+2)%3
+			inverse[row][col] = (m[r1][c1]*m[r2][c2] - m[r1][c2]*m[r2][c1]) / det
+		}
+	}
+	return inverse
+}
+
+func multiply3x3(a [3][3]float64, b [3][3]float64) [3][3]float64 {
+	var product [3][3]float64
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			for k := 0; k < 3; k++ {
+				product[row][col] += a[row][k] * b[k][col]
+			}
+		}
+	}
+	return product
+}
+
+// colorLUTSize is the number of entries of the lookup tables the conversion uses per channel, one per 16 bit value
+const colorLUTSize = 1 << 16
+
+// convertToSRGB converts an image from its ICC profile to sRGB, an image that already is sRGB is returned as is
+func convertToSRGB(img image.Image, profile *matrixProfile) image.Image {
+	toSRGB := multiply3x3(invert3x3(srgbToXYZD50), profile.toXYZ)
+	// The tone curves decode through a table and the result is encoded through another
+	decode := [3][]float64{make([]float64, colorLUTSize), make([]float64, colorLUTSize), make([]float64, colorLUTSize)}
+	encode := make([]float64, colorLUTSize)
+	same := true
+	for i := 0; i < colorLUTSize; i++ {
+		v := float64(i) / (colorLUTSize - 1)
+		for channel := range decode {
+			decode[channel][i] = profile.curves[channel](v)
+			same = same && math.Abs(decode[channel][i]-srgbDecode(v)) < 0.002
+		}
+		encode[i] = srgbEncode(v)
+	}
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			identity := 0.0
+			if row == col {
+				identity = 1
+			}
+			same = same && math.Abs(toSRGB[row][col]-identity) < 0.002
+		}
+	}
+	if same {
+		return img
+	}
+
+	bounds := img.Bounds()
+	var converted draw.Image = image.NewNRGBA(bounds)
+	if isDeepImage(img) {
+		converted = image.NewNRGBA64(bounds)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			linear := [3]float64{
+				decode[0][pixel.R],
+				decode[1][pixel.G],
+				decode[2][pixel.B],
+			}
+			var out [3]uint16
+			for row := 0; row < 3; row++ {
+				v := toSRGB[row][0]*linear[0] + toSRGB[row][1]*linear[1] + toSRGB[row][2]*linear[2]
+				v = max(0, min(v, 1))
+				out[row] = uint16(encode[int(v*(colorLUTSize-1)+0.5)]*0xffff + 0.5)
+			}
+			converted.Set(x, y, color.NRGBA64{R: out[0], G: out[1], B: out[2], A: pixel.A})
+		}
+	}
+	return converted
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// builtinImages are the images every build carries, a module names them as builtin:<file>
+//
+//go:embed images
+var builtinImages embed.FS
+
+// ImageSource opens the source images the configurations are cropped from, decodeSourceImage keeps their ICC profile
+type ImageSource interface {
+	Open(name string) (image.Image, error)
+}
+
+// HeaderSource is an ImageSource that reads the size and color model of an image from its header without decoding it
+type HeaderSource interface {
+	Header(name string) (image.Config, error)
+}
+
+// errNoHeader is returned for an image whose header cannot be read before it is opened, such as a download
+var errNoHeader = errors.New("the image header cannot be read without opening the image")
+
+// decodeHeader reads the size and color model of an image from r
+func decodeHeader(r io.Reader, name string) (image.Config, error) {
+	config, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return config, fmt.Errorf("failed to read the header of %s: %w", name, describeDecodeError(err))
+	}
+	return config, nil
+}
+
+// FileSource opens images from the filesystem
+type FileSource struct{}
+
+func (FileSource) Header(name string) (image.Config, error) {
+	file, err := os.Open(longPath(name))
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer file.Close()
+	return decodeHeader(file, name)
+}
+
+func (FileSource) Open(name string) (image.Image, error) {
+	file, err := os.Open(longPath(name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := decodeSourceImage(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	return img, nil
+}
+
+// EmbeddedSource opens images from a file system such as an embed.FS or the files of a module package below Root
+type EmbeddedSource struct {
+	FS   fs.FS
+	Root string
+}
+
+func (s EmbeddedSource) Header(name string) (image.Config, error) {
+	file, err := s.FS.Open(path.Join(s.Root, strings.ReplaceAll(name, "\\", "/")))
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer file.Close()
+	return decodeHeader(file, name)
+}
+
+func (s EmbeddedSource) Open(name string) (image.Image, error) {
+	file, err := s.FS.Open(path.Join(s.Root, strings.ReplaceAll(name, "\\", "/")))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, err := decodeSourceImage(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	return img, nil
+}
+
+// HTTPSource downloads images from http and https URLs
+type HTTPSource struct {
+	Client *http.Client
+}
+
+func (s HTTPSource) Open(name string) (image.Image, error) {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	response, err := client.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("failed to download %s: %s: %w", name, response.Status, fs.ErrNotExist)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", name, response.Status)
+	}
+	img, err := decodeSourceImage(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	return img, nil
+}
+
+// SchemeSource opens a name starting with a registered scheme, such as https: or builtin:, from that source and every
+// other name from Files, an image over the Limits is rejected or down-sampled
+type SchemeSource struct {
+	Files   ImageSource
+	Schemes map[string]ImageSource
+	Limits  *DecodeLimits
+}
+
+func (s *SchemeSource) Open(name string) (image.Image, error) {
+	if s.Limits == nil {
+		return s.open(name)
+	}
+	// The header is checked before the image is decoded, an image without one only once it is
+	if hasScheme(name) {
+		if header, err := s.Header(name); err == nil {
+			if err := s.Limits.checkPixels(name, image.Pt(header.Width, header.Height)); err != nil {
+				return nil, err
+			}
+		}
+	} else if err := s.Limits.checkFile(name); err != nil {
+		return nil, err
+	}
+	img, err := s.open(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Limits.checkPixels(name, img.Bounds().Size()); err != nil {
+		return nil, err
+	}
+	return s.Limits.reduce(img), nil
+}
+
+func (s *SchemeSource) open(name string) (image.Image, error) {
+	if scheme, rest, ok := splitScheme(name); ok {
+		source, found := s.Schemes[scheme]
+		if !found {
+			return nil, fmt.Errorf("no image source for %s: names", scheme)
+		}
+		if scheme == "http" || scheme == "https" {
+			return source.Open(name)
+		}
+		return source.Open(rest)
+	}
+	return s.Files.Open(name)
+}
+
+// Header reads the header of a file or of an image of a scheme whose source can read it
+func (s *SchemeSource) Header(name string) (image.Config, error) {
+	source, rest := s.Files, name
+	if scheme, schemeRest, ok := splitScheme(name); ok {
+		source, rest = s.Schemes[scheme], schemeRest
+	}
+	if headers, ok := source.(HeaderSource); ok {
+		return headers.Header(rest)
+	}
+	return image.Config{}, errNoHeader
+}
+
+// Register makes the source open the names starting with scheme:
+func (s *SchemeSource) Register(scheme string, source ImageSource) {
+	s.Schemes[strings.ToLower(scheme)] = source
+}
+
+// newImageSource opens files, http and https URLs, the builtin: images and capture: regions of the screen
+func newImageSource() *SchemeSource {
+	web := HTTPSource{}
+	return &SchemeSource{
+		Files: FileSource{},
+		Schemes: map[string]ImageSource{
+			"http":    web,
+			"https":   web,
+			"builtin": EmbeddedSource{FS: builtinImages, Root: "images"},
+			"capture": CaptureSource{},
+		},
+	}
+}
+
+// splitScheme splits scheme:rest, a single letter is a Windows drive and not a scheme
+func splitScheme(name string) (string, string, bool) {
+	scheme, rest, ok := strings.Cut(name, ":")
+	if !ok || len(scheme) < 2 {
+		return "", "", false
+	}
+	for _, r := range scheme {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.') {
+			return "", "", false
+		}
+	}
+	return strings.ToLower(scheme), rest, true
+}
+
+// hasScheme is true for image names that are not paths, they are used as written instead of below the filePath setting
+func hasScheme(name string) bool {
+	_, _, ok := splitScheme(name)
+	return ok
+}
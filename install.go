@@ -0,0 +1,278 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxPackageSize is the largest module package install reads, images included
+const maxPackageSize = 256 << 20
+
+// readPackage reads a module package from a file or downloads it from an http or https URL
+func readPackage(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(longPath(source))
+	}
+	client := &http.Client{Timeout: 5 * time.Minute}
+	response, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", source, response.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxPackageSize+1))
+	if err == nil && len(data) > maxPackageSize {
+		err = fmt.Errorf("%s is larger than %d MB", source, maxPackageSize>>20)
+	}
+	return data, err
+}
+
+// packagePath is true for a name inside the archive that cannot reach outside the folder it is extracted into
+func packagePath(name string) bool {
+	return name != "" && !strings.Contains(name, "\\") && !strings.Contains(name, ":") && !path.IsAbs(name) &&
+		path.Clean(name) == name && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+// ModulePackage is an opened module package with the manifest and the files it lists by their path in the archive,
+// Commands are the programs its filters run
+type ModulePackage struct {
+	Manifest   PackageManifest
+	ModuleJSON []byte
+	Files      map[string][]byte
+	Commands   []string
+}
+
+// openPackage reads the manifest, the module JSON and the files of a package, checks that the module is in it and
+// refuses a package whose files do not match their checksums, that has files the manifest does not list or whose
+// signature does not verify
+func openPackage(settings *MfdConfig, data []byte) (*ModulePackage, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a module package: %w", err)
+	}
+	entries := make(map[string]*zip.File)
+	for _, entry := range archive.File {
+		entries[entry.Name] = entry
+	}
+	read := func(name string) ([]byte, error) {
+		entry, ok := entries[name]
+		if !ok || !packagePath(name) {
+			return nil, fmt.Errorf("the package has no %s", name)
+		}
+		reader, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(io.LimitReader(reader, maxPackageSize))
+	}
+	manifestJSON, err := read(packageManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("not a module package: %w", err)
+	}
+	var signature []byte
+	if _, signed := entries[packageSignatureName]; signed {
+		if signature, err = read(packageSignatureName); err != nil {
+			return nil, err
+		}
+	}
+	if err := verifyManifestSignature(settings, manifestJSON, signature); err != nil {
+		return nil, err
+	}
+	pkg := &ModulePackage{Files: make(map[string][]byte)}
+	if err := json.Unmarshal(manifestJSON, &pkg.Manifest); err != nil {
+		return nil, jsonError(packageManifestName, manifestJSON, err)
+	}
+	manifest := pkg.Manifest
+	// Read the files only through their checksums so a changed or added file is never installed
+	listed := map[string]bool{packageManifestName: true, packageSignatureName: true, manifest.ModuleFile: true}
+	for _, name := range manifest.Files {
+		listed[name] = true
+	}
+	for name, entry := range entries {
+		if !listed[name] && !entry.FileInfo().IsDir() {
+			return nil, fmt.Errorf("the package has %s, which its manifest does not list", name)
+		}
+	}
+	verified := func(name string) ([]byte, error) {
+		data, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		if checksum, ok := manifest.Checksums[name]; !ok || !strings.EqualFold(checksum, sha256Hex(data)) {
+			return nil, fmt.Errorf("%s does not match its checksum, the package is damaged or was changed", name)
+		}
+		return data, nil
+	}
+	if manifest.Format < 1 || manifest.Format > packageFormat {
+		return nil, fmt.Errorf("the package has format %d, this gomfd reads up to %d", manifest.Format, packageFormat)
+	}
+	if !pathName(manifest.Module) {
+		return nil, fmt.Errorf("the manifest names no module or an invalid module %q", manifest.Module)
+	}
+	if !packagePath(manifest.Category) {
+		return nil, fmt.Errorf("the manifest names an invalid category %q", manifest.Category)
+	}
+	if pkg.ModuleJSON, err = verified(manifest.ModuleFile); err != nil {
+		return nil, err
+	}
+	var definition JSONData
+	if err := json.Unmarshal(pkg.ModuleJSON, &definition); err != nil {
+		return nil, jsonError(manifest.ModuleFile, pkg.ModuleJSON, err)
+	}
+	if len(definition.Modules) != 1 || definition.Modules[0].Name != manifest.Module {
+		return nil, fmt.Errorf("%s does not define just the module %s", manifest.ModuleFile, manifest.Module)
+	}
+	if err := checkModuleNames(&definition.Modules[0]); err != nil {
+		return nil, fmt.Errorf("%s: %w", manifest.ModuleFile, err)
+	}
+	pkg.Commands = externalFilters(definition.Modules[0].Configurations)
+	for _, name := range manifest.Files {
+		if !strings.HasPrefix(name, "images/") && !strings.HasPrefix(name, "module/") {
+			return nil, fmt.Errorf("the package lists %s outside images/ and module/", name)
+		}
+		if pkg.Files[name], err = verified(name); err != nil {
+			return nil, err
+		}
+	}
+	return pkg, nil
+}
+
+// installTarget is where install writes a file of the package
+type installTarget struct {
+	Path string
+	Data []byte
+}
+
+// planInstall maps the files of the package to the Modules and FilePath folders, the conflicts are the existing
+// modules and files it would replace, the same module in another module file is an error as it would be there twice
+func planInstall(env *Environment, pkg *ModulePackage) ([]installTarget, []string, error) {
+	manifest := pkg.Manifest
+	moduleFile := filepath.Join(env.Config.Modules, filepath.FromSlash(manifest.Category)+".json")
+	var conflicts []string
+	for _, module := range env.Modules {
+		if !strings.EqualFold(module.Name, manifest.Module) {
+			if sameFile(module.SourceFile, moduleFile) {
+				conflicts = append(conflicts, fmt.Sprintf("%s also holds the module %s", moduleFile, module.Name))
+			}
+			continue
+		}
+		if !sameFile(module.SourceFile, moduleFile) {
+			return nil, nil, classify(ErrConfiguration, fmt.Errorf("module %s is already installed in %s, remove it before installing it into %s", module.Name, module.SourceFile, moduleFile))
+		}
+		conflicts = append(conflicts, fmt.Sprintf("module %s is already installed in %s", module.Name, module.SourceFile))
+	}
+	targets := []installTarget{{Path: moduleFile, Data: pkg.ModuleJSON}}
+	for _, name := range manifest.Files {
+		folder, rest, _ := strings.Cut(name, "/")
+		target := filepath.Join(env.Config.FilePath, filepath.FromSlash(rest))
+		if folder == "module" {
+			target = filepath.Join(filepath.Dir(moduleFile), filepath.FromSlash(rest))
+		}
+		if existing, err := os.ReadFile(longPath(target)); err == nil {
+			if bytes.Equal(existing, pkg.Files[name]) {
+				continue
+			}
+			conflicts = append(conflicts, fmt.Sprintf("%s would be replaced", target))
+		}
+		targets = append(targets, installTarget{Path: target, Data: pkg.Files[name]})
+	}
+	return targets, conflicts, nil
+}
+
+// sameFile compares two paths after cleaning them, without case as Windows does
+func sameFile(a string, b string) bool {
+	return a != "" && strings.EqualFold(filepath.Clean(a), filepath.Clean(b))
+}
+
+// installPackage extracts a package into the Modules and FilePath folders, conflicts stop it unless force is set and
+// filters running programs unless allowExec is, the module file is written last so a failed install leaves no module
+// without its images
+func installPackage(env *Environment, pkg *ModulePackage, force bool, allowExec bool) error {
+	// Every render runs the programs of the filters, a package may only bring them along when the user says so
+	if len(pkg.Commands) > 0 && !allowExec {
+		for _, command := range pkg.Commands {
+			instance.Warnf("Filter runs: %s", command)
+		}
+		return classify(ErrConfiguration, fmt.Errorf("module %s has filters that run %d programs, check them and install with -allow-exec to accept them", pkg.Manifest.Module, len(pkg.Commands)))
+	}
+	targets, conflicts, err := planInstall(env, pkg)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		for _, conflict := range conflicts {
+			instance.Warnf("Conflict: %s", conflict)
+		}
+		if !force {
+			return classify(ErrConfiguration, fmt.Errorf("%d conflicts with the installed modules, -force replaces them", len(conflicts)))
+		}
+	}
+	for i := len(targets) - 1; i >= 0; i-- {
+		target := targets[i]
+		if err := ensurePathExists(filepath.Dir(target.Path)); err != nil {
+			return classify(ErrEncode, err)
+		}
+		if err := os.WriteFile(longPath(target.Path), target.Data, 0644); err != nil {
+			return classify(ErrEncode, fmt.Errorf("failed to write %s: %w", target.Path, err))
+		}
+	}
+	instance.Infof("Installed %s with %d files into %s", strings.TrimSpace(pkg.Manifest.Module+" "+pkg.Manifest.Version), len(targets), env.Config.Modules)
+	return nil
+}
+
+// checkInstalledModule validates the installed module the way validate does and logs its problems
+func checkInstalledModule(name string) {
+	env, err := loadEnvironment()
+	if err != nil {
+		instance.Warnf("The modules cannot be loaded after the install: %v", err)
+		return
+	}
+	for _, module := range filterModules(env.Modules, Selection{ModuleName: name}) {
+		prepareModule(&module, env)
+		for _, problem := range validateModule(env.Config, &module) {
+			instance.Warnf("%s: %s", module.Name, problem)
+		}
+	}
+}
+
+func newInstallCommand() *Command {
+	cmd := newCommand("install", "<package.zip|URL>", "Install a module package made by gomfd pack into the Modules and FilePath folders")
+	force := cmd.Flags.Bool("force", false, "Replace the installed module and images the package conflicts with")
+	allowExec := cmd.Flags.Bool("allow-exec", false, "Install a module whose filters run programs, they run on every render")
+	cmd.Run = func(args []string) error {
+		if len(args) != 1 {
+			return errors.New("install needs a package file or URL")
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		data, err := readPackage(args[0])
+		if err != nil {
+			return err
+		}
+		pkg, err := openPackage(env.Config, data)
+		if err != nil {
+			return classify(ErrConfiguration, fmt.Errorf("%s: %w", args[0], err))
+		}
+		if err := installPackage(env, pkg, *force, *allowExec); err != nil {
+			return err
+		}
+		checkInstalledModule(pkg.Manifest.Module)
+		return nil
+	}
+	return cmd
+}
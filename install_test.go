@@ -0,0 +1,231 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPackagePath(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"manifest.json", true},
+		{"module/F16C.json", true},
+		{"images/F16C/LMFD.png", true},
+		{"..", false},
+		{"../evil.json", false},
+		{"images/../../evil.png", false},
+		{"images/./LMFD.png", false},
+		{"images//LMFD.png", false},
+		{"/etc/passwd", false},
+		{`C:\Windows\evil.dll`, false},
+		{"C:/Windows/evil.dll", false},
+		{`images\..\..\evil.png`, false},
+		{"", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := packagePath(test.name); got != test.want {
+				t.Errorf("packagePath(%q) = %v, want %v", test.name, got, test.want)
+			}
+		})
+	}
+}
+
+// testPackage zips a manifest for the module F16C with the checksums of files and then extra, the entries the manifest
+// does not know about, files has a module/F16C.json defining just F16C unless it names its own
+func testPackage(t *testing.T, change func(manifest *PackageManifest), files map[string][]byte, extra map[string][]byte) []byte {
+	t.Helper()
+	manifest := PackageManifest{
+		Format:     packageFormat,
+		Module:     "F16C",
+		Category:   "Aircraft",
+		Generator:  "gomfd",
+		ModuleFile: "module/F16C.json",
+		Checksums:  make(map[string]string),
+	}
+	if _, ok := files["module/F16C.json"]; !ok {
+		files["module/F16C.json"] = []byte(`{"modules": [{"name": "F16C", "configurations": []}]}`)
+	}
+	for name, data := range files {
+		if name != manifest.ModuleFile {
+			manifest.Files = append(manifest.Files, name)
+		}
+		manifest.Checksums[name] = sha256Hex(data)
+	}
+	if change != nil {
+		change(&manifest)
+	}
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	add := func(name string, data []byte) {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(packageManifestName, manifestJSON)
+	for name, data := range files {
+		add(name, data)
+	}
+	for name, data := range extra {
+		add(name, data)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestOpenPackage(t *testing.T) {
+	pkg, err := openPackage(&MfdConfig{}, testPackage(t, nil, map[string][]byte{"images/F16C/LMFD.png": []byte("png")}, nil))
+	if err != nil {
+		t.Fatalf("openPackage: %v", err)
+	}
+	if pkg.Manifest.Module != "F16C" || string(pkg.Files["images/F16C/LMFD.png"]) != "png" || len(pkg.Commands) != 0 {
+		t.Errorf("openPackage = %+v", pkg)
+	}
+}
+
+func TestReadModuleFilesRejectsNames(t *testing.T) {
+	folder := t.TempDir()
+	modules := `{"modules": [{"name": "F16C", "configurations": [{"name": "LMFD"}]}, {"name": "../../evil"},
+		{"name": "A10C", "configurations": [{"name": "LMFD", "subConfigDef": [{"name": "/etc"}]}]}]}`
+	if err := os.WriteFile(filepath.Join(folder, "Aircraft.json"), []byte(modules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readModuleFiles(folder)
+	if len(read) != 1 || read[0].Name != "F16C" {
+		t.Errorf("readModuleFiles read %d modules, want only F16C", len(read))
+	}
+	for _, want := range []string{`module name "../../evil" cannot be a folder name`, `module A10C: configuration name "/etc" cannot be a folder name`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("readModuleFiles = %v, want %s", err, want)
+		}
+	}
+}
+
+func TestOpenPackageRejects(t *testing.T) {
+	image := []byte("png")
+	tests := []struct {
+		name   string
+		change func(manifest *PackageManifest)
+		files  map[string][]byte
+		extra  map[string][]byte
+		want   string
+	}{
+		{
+			name:  "parent folder",
+			files: map[string][]byte{"images/../../evil.png": image},
+			want:  "the package has no images/../../evil.png",
+		},
+		{
+			name:  "parent folder below module",
+			files: map[string][]byte{"module/../../evil.json": image},
+			want:  "the package has no module/../../evil.json",
+		},
+		{
+			name:  "absolute path",
+			files: map[string][]byte{"/etc/evil.png": image},
+			want:  "the package lists /etc/evil.png outside images/ and module/",
+		},
+		{
+			name:  "outside images and module",
+			files: map[string][]byte{"evil.dll": image},
+			want:  "the package lists evil.dll outside images/ and module/",
+		},
+		{
+			name: "module file in a parent folder",
+			change: func(manifest *PackageManifest) {
+				manifest.Files = append(manifest.Files, manifest.ModuleFile)
+				manifest.ModuleFile = "../F16C.json"
+			},
+			extra: map[string][]byte{"../F16C.json": image},
+			want:  "the package has no ../F16C.json",
+		},
+		{
+			name:   "category in a parent folder",
+			change: func(manifest *PackageManifest) { manifest.Category = "../Aircraft" },
+			want:   `the manifest names an invalid category "../Aircraft"`,
+		},
+		{
+			name:   "absolute category",
+			change: func(manifest *PackageManifest) { manifest.Category = "/Aircraft" },
+			want:   `the manifest names an invalid category "/Aircraft"`,
+		},
+		{
+			name:  "unlisted entry",
+			extra: map[string][]byte{"images/F16C/RMFD.png": image},
+			want:  "the package has images/F16C/RMFD.png, which its manifest does not list",
+		},
+		{
+			name:  "unlisted entry in a parent folder",
+			extra: map[string][]byte{"../evil.dll": image},
+			want:  "the package has ../evil.dll, which its manifest does not list",
+		},
+		{
+			name:   "changed file",
+			files:  map[string][]byte{"images/F16C/LMFD.png": image},
+			change: func(manifest *PackageManifest) { manifest.Checksums["images/F16C/LMFD.png"] = sha256Hex([]byte("jpg")) },
+			want:   "images/F16C/LMFD.png does not match its checksum, the package is damaged or was changed",
+		},
+		{
+			name: "module name leaving the cache",
+			change: func(manifest *PackageManifest) {
+				manifest.Module = "../../.."
+			},
+			files: map[string][]byte{"module/F16C.json": []byte(`{"modules": [{"name": "../../.."}]}`)},
+			want:  `the manifest names no module or an invalid module "../../.."`,
+		},
+		{
+			name:   "module name with a volume",
+			change: func(manifest *PackageManifest) { manifest.Module = "C:Windows" },
+			files:  map[string][]byte{"module/F16C.json": []byte(`{"modules": [{"name": "C:Windows"}]}`)},
+			want:   `the manifest names no module or an invalid module "C:Windows"`,
+		},
+		{
+			name:  "configuration name leaving the cache",
+			files: map[string][]byte{"module/F16C.json": []byte(`{"modules": [{"name": "F16C", "configurations": [{"name": ".."}]}]}`)},
+			want:  `module F16C: configuration name ".." cannot be a folder name`,
+		},
+		{
+			name: "sub-configuration name with a separator",
+			files: map[string][]byte{"module/F16C.json": []byte(
+				`{"modules": [{"name": "F16C", "configurations": [{"name": "LMFD", "subConfigDef": [{"name": "..\\..\\evil"}]}]}]}`)},
+			want: `module F16C: configuration name "..\\..\\evil" cannot be a folder name`,
+		},
+		{
+			name:   "other module",
+			change: func(manifest *PackageManifest) { manifest.Module = "A10C" },
+			want:   "module/F16C.json does not define just the module A10C",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := test.files
+			if files == nil {
+				files = make(map[string][]byte)
+			}
+			_, err := openPackage(&MfdConfig{}, testPackage(t, test.change, files, test.extra))
+			if err == nil {
+				t.Fatalf("openPackage succeeded, want %s", test.want)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("openPackage = %s, want %s", err, test.want)
+			}
+		})
+	}
+}
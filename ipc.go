@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ipcRequest is a command a second gomfd forwards to the running instance
+type ipcRequest struct {
+	Command       string `json:"command"`
+	Module        string `json:"module,omitempty"`
+	Display       string `json:"display,omitempty"`
+	Configuration string `json:"configuration,omitempty"`
+	Action        string `json:"action,omitempty"`
+	Force         bool   `json:"force,omitempty"`
+}
+
+// ipcResponse is the outcome of a forwarded command
+type ipcResponse struct {
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// ExitCode keeps the kind of the error so the forwarding process exits as a local run would
+	ExitCode int `json:"exitCode,omitempty"`
+}
+
+// ipcSocketPath is the control socket of the running instance, unix sockets also work on Windows 10 and later
+func ipcSocketPath() string {
+	return filepath.Join(getSavedGamesFolder(), "MFDMF", "gomfd.sock")
+}
+
+// startIPCListener accepts the commands of later gomfd invocations, it returns nil when another instance already listens
+func startIPCListener() io.Closer {
+	path := ipcSocketPath()
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		instance.Warnf("Another gomfd already listens on %s, commands go to it", path)
+		return nil
+	}
+	// A socket left behind by an instance that crashed
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		instance.Warnf("Failed to listen for commands on %s: %v", path, err)
+		return nil
+	}
+	instance.Debugf("Listening for commands on %s", path)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleIPC(conn)
+		}
+	}()
+	return listener
+}
+
+func handleIPC(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Minute))
+	var request ipcRequest
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		return
+	}
+	output, err := runIPCRequest(request)
+	response := ipcResponse{Output: output}
+	if err != nil {
+		response.Error = err.Error()
+		response.ExitCode = exitCode(err)
+	}
+	json.NewEncoder(conn).Encode(response)
+}
+
+func runIPCRequest(request ipcRequest) (string, error) {
+	switch request.Command {
+	case "select":
+		action, err := shownDisplays.Resolve(request.Module, request.Display, request.Configuration)
+		if err != nil {
+			return "", err
+		}
+		if request.Action != "" {
+			action.Configuration, action.Action = "", request.Action
+		}
+		if err := shownDisplays.Select(action); err != nil {
+			return "", err
+		}
+		if action.Action != "" {
+			return fmt.Sprintf("Turned %s to the %s page", action.Display, action.Action), nil
+		}
+		return fmt.Sprintf("Showing %s on %s", action.Configuration, action.Display), nil
+	case "generate":
+		report, err := generateModule(context.Background(), request.Module, request.Configuration, request.Force)
+		if report == nil {
+			return "", err
+		}
+		return fmt.Sprintf("Rendered %d and skipped %d configurations", report.Rendered, report.Skipped), err
+	}
+	return "", fmt.Errorf("unknown command %q", request.Command)
+}
+
+// errNoInstance means no long running gomfd listens for commands
+var errNoInstance = errors.New("no running gomfd was found, start display, serve or the service first")
+
+// forwardToInstance sends the request to the running instance, errNoInstance when there is none
+func forwardToInstance(request ipcRequest) (string, error) {
+	conn, err := net.DialTimeout("unix", ipcSocketPath(), time.Second)
+	if err != nil {
+		return "", errNoInstance
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return "", err
+	}
+	var response ipcResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return "", fmt.Errorf("the running gomfd did not answer: %w", err)
+	}
+	if response.Error != "" {
+		err := errors.New(response.Error)
+		if kind := exitCodeKind(response.ExitCode); kind != nil {
+			err = classify(kind, err)
+		}
+		return response.Output, err
+	}
+	return response.Output, nil
+}
+
+func newSelectCommand() *Command {
+	cmd := newCommand("select", "[module] <configuration>", "Show a configuration on the display of the running gomfd, the display is found from the configuration")
+	display := cmd.Flags.String("display", "", "Display to change, needed when several displays have the configuration")
+	action := cmd.Flags.String("action", "", "next or previous to turn the switch of -display instead")
+	cmd.Run = func(args []string) error {
+		request := ipcRequest{Command: "select", Display: *display, Action: *action}
+		switch {
+		case len(args) == 2:
+			request.Module, request.Configuration = args[0], args[1]
+		case len(args) == 1:
+			request.Configuration = args[0]
+		case len(args) == 0 && *action != "" && *display != "":
+		default:
+			return errors.New("select needs a configuration, or -display with -action")
+		}
+		output, err := forwardToInstance(request)
+		if output != "" {
+			fmt.Println(output)
+		}
+		return err
+	}
+	return cmd
+}
+
+// displayOfConfiguration names the shown windows that have the configuration as a page
+func displayOfConfiguration(windows []*DisplayWindow, module string, configuration string) []string {
+	var displays []string
+	for _, window := range windows {
+		if (module == "" || strings.EqualFold(window.Module, module)) && hasPage(window, configuration) {
+			displays = append(displays, window.Display)
+		}
+	}
+	return displays
+}
@@ -0,0 +1,103 @@
+package main
+
+import "fmt"
+
+// maxJoystickButtons is the number of buttons the Windows joystick API reports
+const maxJoystickButtons = 32
+
+// ButtonBinding runs a PageAction when a joystick button is pressed, joystick is the device number or part of its name, empty for any device
+type ButtonBinding struct {
+	Joystick string `json:"joystick,omitempty"`
+	Button   int    `json:"button"`
+	PageAction
+}
+
+func (b ButtonBinding) String() string {
+	if b.Joystick == "" {
+		return fmt.Sprintf("button %d", b.Button)
+	}
+	return fmt.Sprintf("%s button %d", b.Joystick, b.Button)
+}
+
+// validateButtons checks the joystick bindings of the settings, any invalid one is a configuration error
+func validateButtons(buttons []ButtonBinding) error {
+	for _, binding := range buttons {
+		if binding.Button < 1 || binding.Button > maxJoystickButtons {
+			return classify(ErrConfiguration, fmt.Errorf("%s is out of range, buttons are numbered 1 to %d", binding, maxJoystickButtons))
+		}
+		if err := binding.validate(binding.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pressedButtons returns the 1-based buttons that are down in current but were up in previous
+func pressedButtons(previous uint32, current uint32) []int {
+	var pressed []int
+	changed := current &^ previous
+	for button := 0; button < maxJoystickButtons; button++ {
+		if changed&(1<<button) != 0 {
+			pressed = append(pressed, button+1)
+		}
+	}
+	return pressed
+}
+
+// DisplayInputs are the hotkeys, joystick buttons, DCS-BIOS rules and Stream Deck keys that change the pages while the displays are shown
+type DisplayInputs struct {
+	Hotkeys      []Hotkey
+	Buttons      []ButtonBinding
+	DcsBios      DcsBiosSettings
+	DcsBiosRules []BiosRule
+	// StreamDeck is set when GOMFD runs as the Stream Deck plugin
+	StreamDeck     *StreamDeck
+	StreamDeckKeys []StreamDeckKey
+	// Mqtt is set when a broker is configured
+	Mqtt *MqttBridge
+}
+
+// loadDisplayInputs parses the input bindings of the settings and warns about the ones that do not match the windows
+func loadDisplayInputs(config *MfdConfig, module *Module, windows []*DisplayWindow) (DisplayInputs, error) {
+	hotkeys, err := parseHotkeys(config.Hotkeys)
+	if err != nil {
+		return DisplayInputs{}, err
+	}
+	if err := validateButtons(config.Buttons); err != nil {
+		return DisplayInputs{}, err
+	}
+	rules := module.DcsBios
+	if !config.DcsBios.Enabled {
+		rules = nil
+	}
+	if err := validateBiosRules(rules); err != nil {
+		return DisplayInputs{}, err
+	}
+	for _, hotkey := range hotkeys {
+		checkPageAction("Hotkey "+hotkey.Keys, hotkey.PageAction, windows)
+	}
+	for _, button := range config.Buttons {
+		checkPageAction(button.String(), button.PageAction, windows)
+	}
+	for _, rule := range rules {
+		checkPageAction(rule.String(), rule.PageAction, windows)
+	}
+	inputs := DisplayInputs{Hotkeys: hotkeys, Buttons: config.Buttons, DcsBios: config.DcsBios, DcsBiosRules: rules}
+	if activeStreamDeck != nil {
+		if err := validateStreamDeckKeys(config.StreamDeck.Keys); err != nil {
+			return DisplayInputs{}, err
+		}
+		for _, key := range config.StreamDeck.Keys {
+			checkPageAction(key.String(), key.PageAction, windows)
+		}
+		if err := activeStreamDeck.Bind(config.StreamDeck.Keys, windows); err != nil {
+			return DisplayInputs{}, err
+		}
+		inputs.StreamDeck, inputs.StreamDeckKeys = activeStreamDeck, config.StreamDeck.Keys
+	}
+	if activeMqtt != nil {
+		activeMqtt.PublishDisplays(windows)
+		inputs.Mqtt = activeMqtt
+	}
+	return inputs, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// joystickPollInterval is how often the button states are read, short enough that a tap is never missed
+const joystickPollInterval = 20 * time.Millisecond
+
+// joystickDevice is a connected game controller as the Windows joystick API numbers it
+type joystickDevice struct {
+	ID   uint32
+	Name string
+}
+
+// connectedJoysticks lists the game controllers that are plugged in
+func connectedJoysticks() []joystickDevice {
+	var devices []joystickDevice
+	count, _, _ := procJoyGetNumDevs.Call()
+	for id := uint32(0); id < uint32(count); id++ {
+		if _, ok := joystickButtons(id); !ok {
+			continue
+		}
+		var caps joyCaps
+		procJoyGetDevCapsW.Call(uintptr(id), uintptr(unsafe.Pointer(&caps)), unsafe.Sizeof(caps))
+		devices = append(devices, joystickDevice{ID: id, Name: syscall.UTF16ToString(caps.Name[:])})
+	}
+	return devices
+}
+
+// joystickButtons reads the button bits of a joystick, ok is false when it is not connected
+func joystickButtons(id uint32) (uint32, bool) {
+	var info joyInfoEx
+	info.Size = uint32(unsafe.Sizeof(info))
+	info.Flags = joyReturnButtons
+	result, _, _ := procJoyGetPosEx.Call(uintptr(id), uintptr(unsafe.Pointer(&info)))
+	return info.Buttons, result == joyNoError
+}
+
+// matchesJoystick is true when the binding names the device by number or by part of its name, or names no device
+func matchesJoystick(binding ButtonBinding, device joystickDevice) bool {
+	if binding.Joystick == "" {
+		return true
+	}
+	if id, err := strconv.Atoi(binding.Joystick); err == nil {
+		return uint32(id) == device.ID
+	}
+	return strings.Contains(strings.ToLower(device.Name), strings.ToLower(binding.Joystick))
+}
+
+// pollJoysticks reads the buttons of the bound joysticks and posts a wmJoystickButton to owner for every press, until the returned channel is closed
+func pollJoysticks(owner uintptr, buttons []ButtonBinding) chan struct{} {
+	stop := make(chan struct{})
+	if len(buttons) == 0 {
+		return stop
+	}
+	devices := connectedJoysticks()
+	for _, device := range devices {
+		instance.Debugf("Joystick %d: %s", device.ID, device.Name)
+	}
+	for _, binding := range buttons {
+		found := false
+		for _, device := range devices {
+			found = found || matchesJoystick(binding, device)
+		}
+		if !found {
+			instance.Warnf("%s: no matching joystick is connected", binding)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(joystickPollInterval)
+		defer ticker.Stop()
+		// Buttons held when the displays open are not presses
+		previous := make(map[uint32]uint32)
+		for _, device := range devices {
+			previous[device.ID], _ = joystickButtons(device.ID)
+		}
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			for _, device := range devices {
+				state, ok := joystickButtons(device.ID)
+				if !ok {
+					continue
+				}
+				for _, button := range pressedButtons(previous[device.ID], state) {
+					for i, binding := range buttons {
+						if binding.Button == button && matchesJoystick(binding, device) {
+							procPostMessageW.Call(owner, wmJoystickButton, uintptr(i), 0)
+						}
+					}
+				}
+				previous[device.ID] = state
+			}
+		}
+	}()
+	return stop
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// kneeboardWidth and kneeboardHeight are the portrait page size the DCS kneeboard is drawn at
+const (
+	kneeboardWidth  = 768
+	kneeboardHeight = 1024
+)
+
+// kneeboardPrefix starts the name of every page GOMFD exports, so a new export only replaces its own pages
+const kneeboardPrefix = "GOMFD_"
+
+// dcsSavedGamesFolder is Saved Games\DCS, or the dcsSavedGamesPath setting when it is set
+func dcsSavedGamesFolder(settings *MfdConfig) string {
+	if settings != nil && settings.DcsSavedGamesPath != "" {
+		return settings.DcsSavedGamesPath
+	}
+	return filepath.Join(getSavedGamesFolder(), "DCS")
+}
+
+// kneeboardAircraft is the DCS aircraft folder the pages of the module go into, its tag or else its first aircraftIds entry
+func kneeboardAircraft(module *Module) string {
+	if module.Tag != "" {
+		return module.Tag
+	}
+	if len(module.AircraftIDs) > 0 {
+		return module.AircraftIDs[0]
+	}
+	return ""
+}
+
+// kneeboardConfigurations lists the configurations of the module in the selection in tree order, which is the page order
+func kneeboardConfigurations(module *Module, selection Selection) []*Configuration {
+	wholeModule := selection.IncludesWholeModule(module)
+	var pages []*Configuration
+	var walk func(configs []Configuration)
+	walk = func(configs []Configuration) {
+		for i := range configs {
+			config := &configs[i]
+			if wholeModule || selection.IncludesConfiguration(config) {
+				pages = append(pages, config)
+			}
+			walk(config.Configurations)
+		}
+	}
+	walk(module.Configurations)
+	return pages
+}
+
+// letterbox fits the image into a page of the given size, centered on black
+func letterbox(img image.Image, width int, height int) image.Image {
+	page := imaging.New(width, height, color.Black)
+	return imaging.PasteCenter(page, imaging.Fit(img, width, height, imaging.Lanczos))
+}
+
+// clearKneeboardPages removes the pages of a module exported before, DCS shows every image in the folder
+func clearKneeboardPages(folder string, moduleName string) error {
+	previous, err := filepath.Glob(filepath.Join(folder, kneeboardPrefix+moduleName+"_*.png"))
+	if err != nil {
+		return err
+	}
+	for _, fileName := range previous {
+		if err := os.Remove(fileName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportKneeboard writes the cached composites of the module into Saved Games\DCS\Kneeboard\<aircraft>, numbered so DCS shows them in tree order
+func exportKneeboard(env *Environment, module *Module, selection Selection, width int, height int) (int, error) {
+	aircraft := kneeboardAircraft(module)
+	if aircraft == "" {
+		return 0, classify(ErrConfiguration, fmt.Errorf("module %s has no tag or aircraftIds naming its DCS aircraft", module.Name))
+	}
+	folder := filepath.Join(dcsSavedGamesFolder(env.Config), "Kneeboard", aircraft)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return 0, classify(ErrEncode, err)
+	}
+	if err := clearKneeboardPages(folder, module.Name); err != nil {
+		return 0, classify(ErrEncode, fmt.Errorf("failed to remove the previous pages from %s: %w", folder, err))
+	}
+
+	files := generateConfigToFileMap(env.Config, *module)
+	written := 0
+	for _, config := range kneeboardConfigurations(module, selection) {
+		img, err := loadImageFile(files[configurationPath(config)] + ".jpg")
+		if err != nil {
+			instance.Warnf("Skipping %s, it has no composite: %v", config.Name, err)
+			continue
+		}
+		written++
+		fileName := filepath.Join(folder, fmt.Sprintf("%s%s_%02d_%s.png", kneeboardPrefix, module.Name, written, config.Name))
+		if err := writePNG(fileName, letterbox(img, width, height)); err != nil {
+			return written - 1, classify(ErrEncode, fmt.Errorf("failed to write the kneeboard page %s: %w", fileName, err))
+		}
+		instance.Debugf("Wrote %s", fileName)
+	}
+	instance.Infof("Exported %d kneeboard pages of %s to %s", written, module.Name, folder)
+	return written, nil
+}
+
+func writePNG(fileName string, img image.Image) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func newKneeboardCommand() *Command {
+	cmd := newCommand("kneeboard", "", "Export the selected composites as DCS kneeboard pages into Saved Games\\DCS\\Kneeboard\\<aircraft>")
+	selectionArgs := addSelectionFlags(cmd.Flags)
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	width := cmd.Flags.Int("width", kneeboardWidth, "Width of a kneeboard page in pixels")
+	height := cmd.Flags.Int("height", kneeboardHeight, "Height of a kneeboard page in pixels")
+	cmd.Run = func(args []string) error {
+		if *width < 1 || *height < 1 {
+			return errors.New("-width and -height must be positive")
+		}
+		selection, err := selectionArgs.Selection()
+		if err != nil {
+			return err
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		ctx, stop := interruptContext()
+		defer stop()
+		// Bring the cache up to date, the pages are made from the cached composites
+		if _, _, err := generateModules(ctx, env, selection, NewRunReport(*runOptions)); err != nil {
+			return err
+		}
+		var failed []string
+		for _, module := range filterModules(env.Modules, selection) {
+			prepareModule(&module, env)
+			if _, err := exportKneeboard(env, &module, selection, *width, *height); err != nil {
+				instance.Error(err.Error())
+				failed = append(failed, module.Name)
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("the kneeboard pages of %s could not be exported", strings.Join(failed, ", "))
+		}
+		return nil
+	}
+	return cmd
+}
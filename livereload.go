@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// reloadScript refreshes every image with a data-module and data-configuration when the server reports it was regenerated
+const reloadScript = `(function () {
+  function reload(update) {
+    document.querySelectorAll("img[data-module]").forEach(function (img) {
+      if (img.dataset.module.toLowerCase() === update.module.toLowerCase() &&
+          img.dataset.configuration.toLowerCase() === update.configuration.toLowerCase()) {
+        img.src = "/image/" + img.dataset.module + "/" + img.dataset.configuration + "?t=" + Date.now();
+      }
+    });
+  }
+  function connect() {
+    var socket = new WebSocket((location.protocol === "https:" ? "wss://" : "ws://") + location.host + "/ws");
+    socket.onmessage = function (event) { reload(JSON.parse(event.data)); };
+    socket.onclose = function () { setTimeout(connect, 2000); };
+  }
+  connect();
+})();
+`
+
+// renderedUpdate tells the browsers which composite was regenerated
+type renderedUpdate struct {
+	Module        string `json:"module"`
+	Configuration string `json:"configuration"`
+}
+
+var reloadUpgrader = websocket.Upgrader{}
+
+// serveLiveReload upgrades to a WebSocket and sends an update for every regenerated configuration until the browser goes away
+func serveLiveReload(w http.ResponseWriter, r *http.Request) {
+	conn, err := reloadUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	events := renderEvents.Subscribe()
+	defer renderEvents.Unsubscribe(events)
+
+	// The browser never sends anything, reading only notices it closing
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case event := <-events:
+			if event.Kind != RenderRendered {
+				continue
+			}
+			if err := conn.WriteJSON(renderedUpdate{Module: event.Module, Configuration: event.Configuration}); err != nil {
+				instance.Debugf("Live reload client %s went away: %v", r.RemoteAddr, err)
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func serveReloadScript(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	fmt.Fprint(w, reloadScript)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestLoggerWithoutSavedGamesFolder(t *testing.T) {
+	directory := t.TempDir()
+	working, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(directory); err != nil {
+		t.Fatal(err)
+	}
+	located, override := savedGamesFolder, savedGamesOverride
+	savedGamesFolder, savedGamesOverride = "", ""
+	defer func() {
+		savedGamesFolder, savedGamesOverride = located, override
+		os.Chdir(working)
+	}()
+
+	logger := &Logger{consoleLevel: LevelError, fileLevel: LevelInfo, muted: true}
+	logger.Errorf("Error: %v", "unknown command")
+	if !logger.stderrOnly || logger.file != nil {
+		t.Errorf("the logger writes to %q, want stderr only", logger.fileName)
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("the logger created %s in the current directory", entry.Name())
+	}
+}
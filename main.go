@@ -1,18 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
-	"image/jpeg"
 	"log"
 	"os"
 	"os/user"
-	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -59,18 +60,45 @@ type ImageProperties struct {
 }
 
 type Display struct {
-	Name string `json:"name"`
+	Name    string `json:"name"`
+	Monitor string `json:"monitor,omitempty"`
+	// Preset names bundled hardware whose screens replace this display, see gomfd presets
+	Preset string `json:"preset,omitempty"`
 	Dimensions
 	Offsets
 	ImageProperties
 }
 
 type Configuration struct {
-	Name     string `json:"name"`
-	FileName string `json:"fileName"`
-	Module   *Module
-	Parent   *Configuration
-	Display  *Display
+	Name     string   `json:"name"`
+	FileName string   `json:"fileName"`
+	Filters  []string `json:"filters,omitempty"`
+	// OutputFormats are written besides the format of the run, such as ["jpg", "png"]
+	OutputFormats []string `json:"outputFormats,omitempty"`
+	// Supersample renders the configuration at this many times its size and scales it down once at the end
+	Supersample int `json:"supersample,omitempty"`
+	// BackgroundColor fills the canvas before the image is drawn, a sub-configuration is drawn on it instead of its parent
+	BackgroundColor string `json:"backgroundColor,omitempty"`
+	// Padding insets the image from the sides of the area of the configuration, as a number or per side
+	Padding *Padding `json:"padding,omitempty"`
+	// AutoTrim removes the borders of one color or transparent around the cropped image before it is resized
+	AutoTrim bool `json:"autoTrim,omitempty"`
+	// ScaleMode is stretch, fit, fill or none, Align places a fitted, filled or unscaled image in the area
+	ScaleMode string `json:"scaleMode,omitempty"`
+	Align     string `json:"align,omitempty"`
+	// Tile repeats the cropped image at its size over the area instead of resizing it
+	Tile bool `json:"tile,omitempty"`
+	// OSBLabels are written next to the 20 buttons around the MFD, clockwise from the top left, in OSBLabelColor
+	OSBLabels     []string `json:"osbLabels,omitempty"`
+	OSBLabelColor string   `json:"osbLabelColor,omitempty"`
+	// Bezel draws a frame around the image, mfd with its buttons or a plain frame
+	Bezel  string `json:"bezel,omitempty"`
+	Script string `json:"script,omitempty"`
+	// Expressions are the geometry fields written as arithmetic, they are evaluated during enrichment
+	Expressions map[string]*Expression `json:"-"`
+	Module      *Module
+	Parent      *Configuration
+	Display     *Display
 	Dimensions
 	Offsets
 	ImageProperties
@@ -78,34 +106,138 @@ type Configuration struct {
 }
 
 type Module struct {
+	SourceFile     string          `json:"-"`
 	Name           string          `json:"name"`
 	Tag            string          `json:"tag"`
 	DisplayName    string          `json:"displayName"`
 	FileName       string          `json:"fileName"`
 	Category       string          `json:"category"`
+	AircraftIDs    []string        `json:"aircraftIds,omitempty"`
+	Seats          []string        `json:"seats,omitempty"`
+	Script         string          `json:"script,omitempty"`
 	Configurations []Configuration `json:"configurations"`
+	DcsBios        []BiosRule      `json:"dcsBios,omitempty"`
 }
 
 type JSONData struct {
 	Modules []Module `json:"modules"`
 }
 
-type Logger struct {
-	fileName string
-	file     *os.File
-	mu       sync.Mutex
+// LogLevel orders log messages by severity
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (level LogLevel) String() string {
+	switch level {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// LogFields are the optional details attached to a logged event
+type LogFields struct {
+	Module   string
+	Config   string
+	Duration time.Duration
+	// Stages splits the duration of a render into decoding, cropping and resizing, compositing and encoding
+	Stages StageDurations
 }
 
+// logEntry is the JSON representation of a logged event
+type logEntry struct {
+	Timestamp  string             `json:"timestamp"`
+	Level      string             `json:"level"`
+	Module     string             `json:"module,omitempty"`
+	Config     string             `json:"config,omitempty"`
+	Message    string             `json:"message"`
+	DurationMs float64            `json:"durationMs,omitempty"`
+	StagesMs   map[string]float64 `json:"stagesMs,omitempty"`
+}
+
+type Logger struct {
+	fileName     string
+	period       string
+	file         *os.File
+	mu           sync.Mutex
+	consoleLevel LogLevel
+	fileLevel    LogLevel
+	jsonFormat   bool
+	warnings     []string
+	maxSize      int64
+	directory    string
+	fixedFile    string
+	stderrOnly   bool
+	muted        bool
+	// serviceLog receives the warnings, errors and summaries while running as a service
+	serviceLog func(level LogLevel, message string)
+}
+
+// LogSettings controls where logs are written, when log files are rotated and how long they are kept
+type LogSettings struct {
+	Directory     string `json:"directory,omitempty"`
+	File          string `json:"file,omitempty"`
+	Stderr        bool   `json:"stderr,omitempty"`
+	MaxSizeMB     int    `json:"maxSizeMB,omitempty"`
+	RetentionDays int    `json:"retentionDays,omitempty"`
+}
+
+const (
+	defaultLogMaxSizeMB     = 10
+	defaultLogRetentionDays = 14
+	logFilePrefix           = "status_"
+	logPeriodFormat         = "2006_01_02_15"
+)
+
 type MfdConfig struct {
-	DisplayConfigurationFile string `json:"displayConfigurationFile"`
-	DefaultConfiguration     string `json:"defaultConfiguration"`
-	DcsSavedGamesPath        string `json:"dcsSavedGamesPath"`
-	SaveCroppedImages        bool   `json:"saveCroppedImages"`
-	Modules                  string `json:"modules"`
-	FilePath                 string `json:"filePath"`
-	UseCougar                bool   `json:"useCougar"`
-	ShowRulers               bool   `json:"showRulers"`
-	RulerSize                int    `json:"rulerSize"`
+	DisplayConfigurationFile string             `json:"displayConfigurationFile"`
+	DefaultConfiguration     string             `json:"defaultConfiguration"`
+	DcsSavedGamesPath        string             `json:"dcsSavedGamesPath"`
+	SaveCroppedImages        bool               `json:"saveCroppedImages"`
+	StrictCrop               bool               `json:"strictCrop,omitempty"`
+	MissingImages            MissingImagePolicy `json:"missingImages,omitempty"`
+	Modules                  string             `json:"modules"`
+	FilePath                 string             `json:"filePath"`
+	FilePaths                []string           `json:"filePaths,omitempty"`
+	OverridesPath            string             `json:"overridesPath,omitempty"`
+	UseCougar                bool               `json:"useCougar"`
+	ThrottleVariants         bool               `json:"throttleVariants,omitempty"`
+	ShowRulers               bool               `json:"showRulers"`
+	RulerSize                int                `json:"rulerSize"`
+	Ruler                    *RulerSettings     `json:"ruler,omitempty"`
+	CachePath                string             `json:"cachePath,omitempty"`
+	OutputName               string             `json:"outputName,omitempty"`
+	Supersample              int                `json:"supersample,omitempty"`
+	ColorManagement          bool               `json:"colorManagement,omitempty"`
+	Dither                   DitherMode         `json:"dither,omitempty"`
+	Overlay                  *OverlaySettings   `json:"overlay,omitempty"`
+	CaptureRegions           CaptureRegions     `json:"captureRegions,omitempty"`
+	MemoryBudget             string             `json:"memoryBudget,omitempty"`
+	DecodeLimits             *DecodeLimits      `json:"decodeLimits,omitempty"`
+	Catalog                  []string           `json:"catalog,omitempty"`
+	TrustedKeys              []string           `json:"trustedKeys,omitempty"`
+	RequireSignedPackages    bool               `json:"requireSignedPackages,omitempty"`
+	Logging                  LogSettings        `json:"logging"`
+	Hotkeys                  []HotkeyBinding    `json:"hotkeys,omitempty"`
+	Buttons                  []ButtonBinding    `json:"buttons,omitempty"`
+	DcsBios                  DcsBiosSettings    `json:"dcsBios"`
+	Aircraft                 AircraftSettings   `json:"aircraftDetection"`
+	StreamDeck               StreamDeckSettings `json:"streamDeck"`
+	Mqtt                     MqttSettings       `json:"mqtt"`
+	Metrics                  MetricsSettings    `json:"metrics"`
+	// memoryBudget is MemoryBudget in bytes
+	memoryBudget int64
 }
 
 // Define the interface
@@ -127,7 +259,7 @@ type ConfigurationProcessor interface {
 	GetDrawingCoordinate(newImage image.Image) image.Point
 	GetDrawingArea() image.Rectangle
 	GetSize() image.Point
-	CenterImageWithCropAndResize(subConfigIndex int) error
+	CenterImageWithCropAndResize(ctx context.Context, rc *RenderContext, subConfigIndex int) error
 }
 
 func (config Configuration) String() string {
@@ -205,14 +337,12 @@ func (config *Configuration) GetDrawingCoordinate(newImage image.Image) image.Po
 
 func (d *Display) ConfigureDisplay() error {
 	// Implementation for configuring the display
-	fmt.Printf("Configuring Display: %s\n", d.Name)
 	setInitialValues(d)
 	return nil
 }
 
 func (c *Configuration) ConfigureConfiguration() error {
 	// Implementation for configuring the display
-	fmt.Printf("Configuring Configuration: %s\n", c.Name)
 	setInitialValues(c)
 	return nil
 }
@@ -249,49 +379,232 @@ func (c *Configuration) GetImageProperties() *ImageProperties {
 	return &c.ImageProperties
 }
 
-// LoadConfig loads the configuration from a JSON file.
+// LoadConfiguration reads the settings from a JSON file once, later calls return the same settings or error until ReloadConfiguration
 func LoadConfiguration(filename string) (*MfdConfig, error) {
-	var err error
-	configOnce.Do(func() {
-		// Read the JSON file
-		data, err := os.ReadFile(filename)
-		if err != nil {
-			return
-		}
+	configMu.Lock()
+	defer configMu.Unlock()
+	if !configLoaded {
+		loadedConfiguration, loadedConfigurationErr = readConfiguration(filename)
+		configLoaded = true
+	}
+	return loadedConfiguration, loadedConfigurationErr
+}
 
-		// Unmarshal JSON into the configuration struct
-		var config MfdConfig
-		if err := json.Unmarshal(data, &config); err != nil {
-			return
+// ReloadConfiguration reads the settings again, when the file has become invalid the previous settings stay loaded and the error is returned
+func ReloadConfiguration(filename string) (*MfdConfig, error) {
+	config, err := readConfiguration(filename)
+	configMu.Lock()
+	defer configMu.Unlock()
+	if err != nil && loadedConfiguration != nil {
+		return loadedConfiguration, err
+	}
+	loadedConfiguration, loadedConfigurationErr = config, err
+	configLoaded = true
+	return config, err
+}
+
+func readConfiguration(filename string) (*MfdConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config MfdConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, jsonError(filename, data, err)
+	}
+	if config.MissingImages, err = parseMissingImagePolicy(string(config.MissingImages)); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := validateOutputName(config.OutputName); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if config.Dither, err = parseDitherMode(string(config.Dither)); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if config.Overlay != nil {
+		if err := config.Overlay.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
 		}
+	}
+	if config.Ruler != nil {
+		if err := config.Ruler.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	if err := config.CaptureRegions.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if config.memoryBudget, err = parseSize(config.MemoryBudget); err != nil {
+		return nil, fmt.Errorf("%s: memoryBudget: %w", filename, err)
+	}
+	if config.DecodeLimits != nil {
+		if err := config.DecodeLimits.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+	fixupConfigurationPaths(&config)
+	return &config, nil
+}
 
-		fixupConfigurationPaths(&config)
-		configurationInstance = &config
-	})
-	return configurationInstance, err
+// jsonError names the file of a JSON error and, when the decoder reports one, the line and column it stopped at
+func jsonError(filename string, data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	offset := int64(-1)
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	} else if errors.As(err, &typeErr) {
+		offset = typeErr.Offset
+	}
+	if offset < 0 {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	column := int(offset) - bytes.LastIndexByte(data[:offset], '\n')
+	return fmt.Errorf("%s:%d:%d (offset %d): %w", filename, line, column, offset, err)
+}
+
+// currentSettings is appsettings.json for the commands that also work without it, nil when it cannot be read
+func currentSettings() *MfdConfig {
+	config, err := LoadConfiguration(getConfigurationFilePath())
+	if err != nil {
+		return nil
+	}
+	return config
+}
+
+// nativePath uses the separator of the platform for both / and \, settings and module files written on Windows are read
+// on Linux and the other way around
+func nativePath(name string) string {
+	separator := string(filepath.Separator)
+	return strings.NewReplacer("/", separator, "\\", separator).Replace(name)
 }
 
 func fixupConfigurationPaths(config *MfdConfig) {
-	config.FilePath = strings.ReplaceAll(os.ExpandEnv(config.FilePath), "/", "\\")
-	config.DcsSavedGamesPath = strings.ReplaceAll(os.ExpandEnv(config.FilePath), "/", "\\")
-	config.DisplayConfigurationFile = strings.ReplaceAll(os.ExpandEnv(config.DisplayConfigurationFile), "/", "\\")
-	config.Modules = strings.ReplaceAll(os.ExpandEnv(config.Modules), "/", "\\")
+	config.FilePath = nativePath(os.ExpandEnv(config.FilePath))
+	for i := range config.FilePaths {
+		config.FilePaths[i] = nativePath(os.ExpandEnv(config.FilePaths[i]))
+	}
+	config.DcsSavedGamesPath = nativePath(os.ExpandEnv(config.DcsSavedGamesPath))
+	config.DisplayConfigurationFile = nativePath(os.ExpandEnv(config.DisplayConfigurationFile))
+	config.Modules = nativePath(os.ExpandEnv(config.Modules))
+	config.CachePath = nativePath(os.ExpandEnv(config.CachePath))
+	config.OverridesPath = nativePath(os.ExpandEnv(config.OverridesPath))
+	config.Metrics.File = nativePath(os.ExpandEnv(config.Metrics.File))
 }
 
 func (l *Logger) SetLogFile() {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	l.fileName = l.generateLogFileName()
-	if l.file != nil {
-		l.file.Close()
-	}
-	l.openLogFile()
+	l.rotate()
 }
 
+// generateLogFileName names the log file for the current hour, or the configured file, adding a counter when the earlier files reached the size limit
 func (l *Logger) generateLogFileName() string {
-	currentTime := time.Now()
-	return filepath.Join(getLogFolderPath(), "status_"+currentTime.Format("2006_01_02_15")+".log")
+	baseName := filepath.Join(l.logFolder(), logFilePrefix+l.period)
+	extension := ".log"
+	if l.fixedFile != "" {
+		extension = filepath.Ext(l.fixedFile)
+		baseName = strings.TrimSuffix(l.fixedFile, extension)
+	}
+	for index := 0; ; index++ {
+		fileName := baseName + extension
+		if index > 0 {
+			fileName = fmt.Sprintf("%s.%d%s", baseName, index, extension)
+		}
+		info, err := os.Stat(fileName)
+		if err != nil || l.maxSize <= 0 || info.Size() < l.maxSize {
+			return fileName
+		}
+	}
+}
+
+// needsRotation is true when the hour changed or the current file reached the size limit, callers hold the lock
+func (l *Logger) needsRotation() bool {
+	if l.file == nil {
+		return false
+	}
+	if l.fixedFile == "" && time.Now().Format(logPeriodFormat) != l.period {
+		return true
+	}
+	if l.maxSize > 0 {
+		if info, err := l.file.Stat(); err == nil && info.Size() >= l.maxSize {
+			return true
+		}
+	}
+	return false
+}
+
+// logFolder is the configured log directory or Saved Games\MFDMF\Logs
+func (l *Logger) logFolder() string {
+	if l.directory != "" {
+		return l.directory
+	}
+	return getLogFolderPath()
+}
+
+// ApplySettings sets the log destination and rotation size limit and removes log files older than the retention period
+func (l *Logger) ApplySettings(settings LogSettings) {
+	maxSizeMB := settings.MaxSizeMB
+	if maxSizeMB == 0 {
+		maxSizeMB = defaultLogMaxSizeMB
+	}
+	retentionDays := settings.RetentionDays
+	if retentionDays == 0 {
+		retentionDays = defaultLogRetentionDays
+	}
+
+	l.mu.Lock()
+	l.maxSize = int64(maxSizeMB) * 1024 * 1024
+	directory := filepath.FromSlash(os.ExpandEnv(settings.Directory))
+	fixedFile := filepath.FromSlash(os.ExpandEnv(settings.File))
+	if directory != l.directory || fixedFile != l.fixedFile || settings.Stderr != l.stderrOnly {
+		if l.file != nil {
+			l.file.Close()
+			l.file = nil
+		}
+		l.directory = directory
+		l.fixedFile = fixedFile
+		l.stderrOnly = settings.Stderr
+	}
+	logFolder := l.logFolder()
+	pruneFolder := !l.stderrOnly && l.fixedFile == ""
+	l.mu.Unlock()
+
+	if retentionDays > 0 && pruneFolder {
+		removed := pruneLogFiles(logFolder, time.Now().AddDate(0, 0, -retentionDays), l.fileName)
+		if removed > 0 {
+			l.Debugf("Removed %d log files older than %d days", removed, retentionDays)
+		}
+	}
+}
+
+// pruneLogFiles deletes the log files last written before cutoff, except the file in use, and returns how many were removed
+func pruneLogFiles(logFolder string, cutoff time.Time, current string) int {
+	entries, err := os.ReadDir(logFolder)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, logFilePrefix) || filepath.Ext(name) != ".log" {
+			continue
+		}
+		fileName := filepath.Join(logFolder, name)
+		info, err := entry.Info()
+		if err != nil || fileName == current || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if os.Remove(longPath(fileName)) == nil {
+			removed++
+		}
+	}
+	return removed
 }
 
 func getLogFolderPath() string {
@@ -299,12 +612,29 @@ func getLogFolderPath() string {
 	return logFolderPath
 }
 
-func getSavedGamesFolder() string {
+// savedGamesOverride replaces the Saved Games folder of the current user, a service runs as another account
+var savedGamesOverride string
+
+// savedGamesFolder is the Saved Games folder of the current user, found by locateSavedGamesFolder when gomfd starts
+var savedGamesFolder string
+
+// locateSavedGamesFolder finds the Saved Games folder of the current user unless -saved-games names one
+func locateSavedGamesFolder() error {
+	if savedGamesOverride != "" {
+		return nil
+	}
 	currentUser, err := user.Current()
 	if err != nil {
-		log.Fatalf("Failed to get current user: %v", err)
+		return fmt.Errorf("failed to get the current user: %w", err)
+	}
+	savedGamesFolder = filepath.Join(currentUser.HomeDir, "Saved Games")
+	return nil
+}
+
+func getSavedGamesFolder() string {
+	if savedGamesOverride != "" {
+		return savedGamesOverride
 	}
-	savedGamesFolder := filepath.Join(currentUser.HomeDir, "Saved Games")
 	return savedGamesFolder
 }
 
@@ -312,49 +642,268 @@ func (l *Logger) openLogFile() {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	l.rotate()
+}
+
+// rotate closes the current log file and opens the one for the current hour, falling back to stderr when it cannot be opened, callers hold the lock
+func (l *Logger) rotate() {
+	if l.file != nil {
+		l.file.Close()
+		l.file = nil
+	}
+	// Without the Saved Games folder messages only go to stderr, a log folder is never created in the current directory
+	if l.fixedFile == "" && l.directory == "" && getSavedGamesFolder() == "" {
+		l.stderrOnly = true
+		return
+	}
+	l.period = time.Now().Format(logPeriodFormat)
 	l.fileName = l.generateLogFileName()
 
 	logFolder := filepath.Dir(l.fileName)
-	err := os.MkdirAll(logFolder, 0755)
+	err := os.MkdirAll(longPath(logFolder), 0755)
 	if err != nil {
-		log.Fatalf("Failed to create log folder: %v", err)
+		l.useStderr(fmt.Errorf("failed to create log folder: %w", err))
+		return
 	}
 
-	file, err := os.OpenFile(l.fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	file, err := os.OpenFile(longPath(l.fileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Fatalf("Failed to open log file: %v", err)
+		l.useStderr(fmt.Errorf("failed to open log file: %w", err))
+		return
 	}
 	l.file = file
 
 	log.SetOutput(l.file)
 }
 
-func (l *Logger) Log(message string) {
+// useStderr switches logging to stderr only after the log file failed, callers hold the lock
+func (l *Logger) useStderr(reason error) {
+	l.stderrOnly = true
+	log.SetOutput(os.Stderr)
+	fmt.Fprintf(os.Stderr, "Logging to stderr only, %v\n", reason)
+}
+
+// SetVerbosity enables debug output with verbose, or limits the console to errors and the summary with quiet
+func (l *Logger) SetVerbosity(verbose bool, quiet bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.consoleLevel = LevelInfo
+	l.fileLevel = LevelInfo
+	if verbose {
+		l.consoleLevel = LevelDebug
+		l.fileLevel = LevelDebug
+	}
+	if quiet {
+		l.consoleLevel = LevelError
+	}
+}
+
+// SetServiceLog forwards the warnings, errors and summaries to the log of the service manager, nil stops forwarding
+func (l *Logger) SetServiceLog(serviceLog func(level LogLevel, message string)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.serviceLog = serviceLog
+}
+
+// Mute stops all console output while the terminal is owned by the browser, the log file is still written
+func (l *Logger) Mute(muted bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.muted = muted
+}
+
+// SetFormat selects text or json output for both the console and the log file
+func (l *Logger) SetFormat(format string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch format {
+	case "", "text":
+		l.jsonFormat = false
+	case "json":
+		l.jsonFormat = true
+	default:
+		return fmt.Errorf("unknown log format %q, use text or json", format)
+	}
+	return nil
+}
+
+func (l *Logger) write(level LogLevel, fields LogFields, message string, alwaysShow bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if level == LevelWarn {
+		l.warnings = append(l.warnings, message)
+	}
+	toFile := (level >= l.fileLevel || alwaysShow) && !l.stderrOnly
+	toConsole := (level >= l.consoleLevel || alwaysShow) && !l.muted
+	if l.serviceLog != nil && (level >= LevelWarn || alwaysShow) {
+		l.serviceLog(level, message)
+	}
+	if toFile && (l.file == nil || l.needsRotation()) {
+		l.rotate()
+		toFile = !l.stderrOnly
+	}
+	console := os.Stdout
+	if level == LevelError || l.stderrOnly {
+		console = os.Stderr
+	}
+
+	if l.jsonFormat {
+		entry := logEntry{
+			Timestamp:  time.Now().Format(time.RFC3339Nano),
+			Level:      level.String(),
+			Module:     fields.Module,
+			Config:     fields.Config,
+			Message:    message,
+			DurationMs: float64(fields.Duration.Microseconds()) / 1000,
+			StagesMs:   fields.Stages.Milliseconds(),
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		if toFile {
+			fmt.Fprintln(log.Writer(), string(data))
+		}
+		if toConsole {
+			fmt.Fprintln(console, string(data))
+		}
+		return
+	}
+
+	text := message
+	if fields.Module != "" || fields.Config != "" {
+		text = fmt.Sprintf("[%s] %s", strings.Trim(fields.Module+"/"+fields.Config, "/"), message)
+	}
+	if duration := fields.Duration.Round(time.Millisecond); duration > 0 && fields.Stages != (StageDurations{}) {
+		text = fmt.Sprintf("%s (%s: %s)", text, duration, fields.Stages)
+	} else if duration > 0 {
+		text = fmt.Sprintf("%s (%s)", text, duration)
+	}
+	if toFile {
+		log.Printf("%-5s %s", level, text)
+	}
+	if toConsole {
+		fmt.Fprintln(console, text)
+	}
+}
+
+// TakeWarnings returns the warnings logged since the last call and forgets them
+func (l *Logger) TakeWarnings() []string {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	log.Println(message)
-	fmt.Println(message)
+	warnings := l.warnings
+	l.warnings = nil
+	return warnings
+}
+
+// LogEvent writes a message with its module, configuration and duration details
+func (l *Logger) LogEvent(level LogLevel, fields LogFields, message string) {
+	l.write(level, fields, message, false)
+}
+
+func (l *Logger) Debug(message string) {
+	l.write(LevelDebug, LogFields{}, message, false)
+}
+
+func (l *Logger) Info(message string) {
+	l.write(LevelInfo, LogFields{}, message, false)
+}
+
+func (l *Logger) Warn(message string) {
+	l.write(LevelWarn, LogFields{}, message, false)
+}
+
+func (l *Logger) Error(message string) {
+	l.write(LevelError, LogFields{}, message, false)
+}
+
+// Debugf logs a formatted message at debug level
+func (l *Logger) Debugf(format string, args ...any) {
+	l.write(LevelDebug, LogFields{}, fmt.Sprintf(format, args...), false)
+}
+
+// Infof logs a formatted message at info level
+func (l *Logger) Infof(format string, args ...any) {
+	l.write(LevelInfo, LogFields{}, fmt.Sprintf(format, args...), false)
+}
+
+// Warnf logs a formatted warning, it is counted in the summary of the run
+func (l *Logger) Warnf(format string, args ...any) {
+	l.write(LevelWarn, LogFields{}, fmt.Sprintf(format, args...), false)
+}
+
+// Errorf logs a formatted error
+func (l *Logger) Errorf(format string, args ...any) {
+	l.write(LevelError, LogFields{}, fmt.Sprintf(format, args...), false)
+}
+
+// With returns a logger adding the module, configuration and duration of fields to every message
+func (l *Logger) With(fields LogFields) FieldLogger {
+	return FieldLogger{logger: l, fields: fields}
+}
+
+// FieldLogger logs the messages of one module or configuration, the fields prefix the console line and are separate JSON keys
+type FieldLogger struct {
+	logger *Logger
+	fields LogFields
+}
+
+// Debugf logs a formatted message at debug level
+func (f FieldLogger) Debugf(format string, args ...any) {
+	f.logger.write(LevelDebug, f.fields, fmt.Sprintf(format, args...), false)
+}
+
+// Infof logs a formatted message at info level
+func (f FieldLogger) Infof(format string, args ...any) {
+	f.logger.write(LevelInfo, f.fields, fmt.Sprintf(format, args...), false)
+}
+
+// Warnf logs a formatted warning, it is counted in the summary of the run
+func (f FieldLogger) Warnf(format string, args ...any) {
+	f.logger.write(LevelWarn, f.fields, fmt.Sprintf(format, args...), false)
+}
+
+// Errorf logs a formatted error
+func (f FieldLogger) Errorf(format string, args ...any) {
+	f.logger.write(LevelError, f.fields, fmt.Sprintf(format, args...), false)
+}
+
+// Summary logs at info level but is shown even when the console is quiet
+func (l *Logger) Summary(message string) {
+	l.write(LevelInfo, LogFields{}, message, true)
+}
+
+// Log writes an informational message
+func (l *Logger) Log(message string) {
+	l.Info(message)
 }
 
 var instance *Logger
 var once sync.Once
-var configurationInstance *MfdConfig
-var configOnce sync.Once
 
-func setDisplays(displays []Display) {
+// loadedConfiguration is the appsettings.json read by LoadConfiguration, commands pass it on through their Environment
+var loadedConfiguration *MfdConfig
+var loadedConfigurationErr error
+var configLoaded bool
+var configMu sync.Mutex
+
+func setDisplays(displays []Display, logger *Logger) {
 	for i := range displays {
+		logger.Debugf("Configuring Display: %s", displays[i].Name)
 		var configurator DisplayConfigurator = &displays[i] // Use a pointer to satisfy the interface
 		err := configurator.ConfigureDisplay()
 		if err != nil {
-			fmt.Printf("Error configuring display %s: %v\n", displays[i].Name, err)
+			logger.Errorf("Error configuring display %s: %v", displays[i].Name, err)
 		}
 	}
 }
 
 func GetLogger() *Logger {
 	once.Do(func() {
-		instance = &Logger{}
-		instance.openLogFile()
+		instance = &Logger{consoleLevel: LevelInfo, fileLevel: LevelInfo}
 	})
 	return instance
 }
@@ -369,14 +918,45 @@ func readDisplaysJSON(filename string) ([]Display, error) {
 	var displays []Display
 	err = json.Unmarshal(data, &displays)
 	if err != nil {
-		return nil, err
+		return nil, jsonError(filename, data, err)
+	}
+	if displays, err = expandDisplayPresets(displays); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
 	}
 	return displays, nil
 }
 
-// Reads all of the modules from the specified path and below
+// pathName is true for a module or configuration name that stays one folder or file below the folder it is joined to,
+// the cache and the trash use them as names
+func pathName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\:`) && filepath.VolumeName(name) == ""
+}
+
+// checkModuleNames returns an error for a module or configuration name that would reach outside the cache folder
+func checkModuleNames(module *Module) error {
+	if !pathName(module.Name) {
+		return fmt.Errorf("module name %q cannot be a folder name, it has a separator, .. or a volume", module.Name)
+	}
+	var check func(configs []Configuration) error
+	check = func(configs []Configuration) error {
+		for i := range configs {
+			if !pathName(configs[i].Name) {
+				return fmt.Errorf("module %s: configuration name %q cannot be a folder name, it has a separator, .. or a volume", module.Name, configs[i].Name)
+			}
+			if err := check(configs[i].Configurations); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(module.Configurations)
+}
+
+// Reads all of the modules from the specified path and below, the problems of every invalid module file are returned
+// together with the modules of the valid ones
 func readModuleFiles(startingPath string) ([]Module, error) {
 	var modules []Module
+	var problems []error
 
 	// Walk the directory tree starting from the specified path
 	err := filepath.Walk(startingPath, func(filePath string, fileInfo os.FileInfo, err error) error {
@@ -387,9 +967,10 @@ func readModuleFiles(startingPath string) ([]Module, error) {
 		// Check if the file is a JSON file
 		if filepath.Ext(filePath) == ".json" {
 			// Read the JSON file
-			data, err := os.ReadFile(filePath)
+			data, err := os.ReadFile(longPath(filePath))
 			if err != nil {
-				return err
+				problems = append(problems, err)
+				return nil
 			}
 
 			// Unmarshal the JSON data into a wrapper structure with the "Modules" array
@@ -398,7 +979,8 @@ func readModuleFiles(startingPath string) ([]Module, error) {
 			}
 			err = json.Unmarshal(data, &jsonData)
 			if err != nil {
-				return err
+				problems = append(problems, jsonError(filePath, data, err))
+				return nil
 			}
 
 			// Calculate the relative Category based on the starting path
@@ -407,13 +989,21 @@ func readModuleFiles(startingPath string) ([]Module, error) {
 				return err
 			}
 
-			// Set the Category for each module
+			// Set the Category and the originating file for each module
 			for i := range jsonData.Modules {
 				jsonData.Modules[i].Category = strings.Replace(relativePath, ".json", "", 1)
+				jsonData.Modules[i].SourceFile = filePath
+				if err := applyModuleScript(&jsonData.Modules[i]); err != nil {
+					problems = append(problems, fmt.Errorf("%s: %w", filePath, err))
+					continue
+				}
+				if err := checkModuleNames(&jsonData.Modules[i]); err != nil {
+					problems = append(problems, fmt.Errorf("%s: %w", filePath, err))
+					continue
+				}
+				// Append the module to the main modules slice
+				modules = append(modules, jsonData.Modules[i])
 			}
-
-			// Append the modules from the wrapper to the main modules slice
-			modules = append(modules, jsonData.Modules...)
 		}
 
 		return nil
@@ -423,10 +1013,10 @@ func readModuleFiles(startingPath string) ([]Module, error) {
 		return nil, err
 	}
 
-	return modules, nil
+	return modules, errors.Join(problems...)
 }
 
-func setFullPathToFile(config *Configuration) {
+func setFullPathToFile(config *Configuration, settings *MfdConfig, module string) {
 	// Ensure config is not nil
 	if config == nil {
 		config = &Configuration{}
@@ -443,20 +1033,80 @@ func setFullPathToFile(config *Configuration) {
 		userPath := config.FileName
 
 		if *config.NeedsThrottleType {
-			replaceToken := "WH"
-			if configurationInstance.UseCougar {
-				replaceToken = "HC"
-			}
-			userPath = strings.ReplaceAll(userPath, "THROTTLE", replaceToken)
+			userPath = strings.ReplaceAll(userPath, "THROTTLE", throttleToken(settings))
 		}
 
-		if !isPathInside(configurationInstance.FilePath, config.FileName) {
-			userPath = path.Join(configurationInstance.FilePath, userPath)
+		config.FileName = locateImage(settings, module, userPath)
+	}
+}
+
+// throttleToken is the value substituted for THROTTLE in image file names, HC for the Cougar and WH for the Warthog
+func throttleToken(settings *MfdConfig) string {
+	if settings.UseCougar {
+		return "HC"
+	}
+	return "WH"
+}
+
+// resolveImagePath returns the full path of an image file name the same way setFullPathToFile does
+func resolveImagePath(settings *MfdConfig, module string, fileName string) string {
+	if fileName == "" {
+		return ""
+	}
+	userPath := strings.ReplaceAll(fileName, "THROTTLE", throttleToken(settings))
+	return locateImage(settings, module, userPath)
+}
+
+// getOverridesFolder holds the images replacing the ones of the modules, the overridesPath setting or Saved Games\MFDMF\Overrides
+func getOverridesFolder(settings *MfdConfig) string {
+	if settings.OverridesPath != "" {
+		return settings.OverridesPath
+	}
+	return filepath.Join(getSavedGamesFolder(), "MFDMF", "Overrides")
+}
+
+// overrideFolders are searched before the image roots, the folder of the module and then the overrides folder itself
+func overrideFolders(settings *MfdConfig, module string) []string {
+	folders := []string{getOverridesFolder(settings)}
+	if module != "" {
+		folders = append([]string{filepath.Join(folders[0], module)}, folders...)
+	}
+	return folders
+}
+
+// imageRoots are the folders searched in order for the images of a module, the override folders, the filePaths setting and then filePath
+func imageRoots(settings *MfdConfig, module string) []string {
+	roots := append(overrideFolders(settings, module), settings.FilePaths...)
+	return append(roots, settings.FilePath)
+}
+
+// insideImageRoots is true for an image name that is already a path below one of the image roots
+func insideImageRoots(settings *MfdConfig, module string, fileName string) bool {
+	for _, root := range imageRoots(settings, module) {
+		if root != "" && isPathInside(root, fileName) {
+			return true
 		}
+	}
+	return false
+}
 
-		fullPathToImage := strings.ReplaceAll(userPath, "/", "\\")
-		config.FileName = fullPathToImage
+// locateImage finds an image name in the first image root of the module holding it, a name no root holds is placed below filePath
+func locateImage(settings *MfdConfig, module string, userPath string) string {
+	if hasScheme(userPath) {
+		return userPath
+	}
+	userPath = nativePath(userPath)
+	if insideImageRoots(settings, module, userPath) {
+		return resolveImageFile(userPath)
 	}
+	roots := imageRoots(settings, module)
+	for _, root := range roots[:len(roots)-1] {
+		candidate := resolveImageFile(filepath.Join(root, userPath))
+		if fileExists(candidate) {
+			return candidate
+		}
+	}
+	return resolveImageFile(filepath.Join(settings.FilePath, userPath))
 }
 
 // Sets a Configuration equal to some of the Display values handles centering if required
@@ -554,10 +1204,10 @@ func isPathInside(parentPath, childPath string) bool {
 
 func ensurePathExists(path string) error {
 	// Check if the path exists
-	_, err := os.Stat(path)
+	_, err := os.Stat(longPath(path))
 	if os.IsNotExist(err) {
 		// Create the directory and all necessary parents
-		err = os.MkdirAll(path, os.ModePerm)
+		err = os.MkdirAll(longPath(path), os.ModePerm)
 		if err != nil {
 			return fmt.Errorf("failed to create directory: %w", err)
 		}
@@ -567,35 +1217,30 @@ func ensurePathExists(path string) error {
 	return nil
 }
 
-func setModuleFileName(module *Module) {
-	var userPath = ""
+func setModuleFileName(module *Module, settings *MfdConfig) {
 	if module.FileName != "" {
-		if !isPathInside(configurationInstance.FilePath, module.FileName) {
-			userPath = path.Join(configurationInstance.FilePath, module.FileName)
-		} else {
-			userPath = module.FileName
-		}
-		module.FileName = strings.ReplaceAll(userPath, "/", "\\")
+		module.FileName = locateImage(settings, module.Name, module.FileName)
 	}
 }
 
-func setConfigurationFileNames(config *Configuration) {
-	setFullPathToFile(config)
+func setConfigurationFileNames(config *Configuration, settings *MfdConfig) {
+	module := moduleName(config)
+	setFullPathToFile(config, settings, module)
 	for i := range config.Configurations {
 		conf := &config.Configurations[i]
-		setFullPathToFile(conf)
-		setFileNamesRecursive(conf)
+		setFullPathToFile(conf, settings, module)
+		setFileNamesRecursive(conf, settings, module)
 	}
 }
 
-func setFileNamesRecursive(conf *Configuration) {
-	if !isPathInside(configurationInstance.FilePath, conf.FileName) {
-		setFullPathToFile(conf)
+func setFileNamesRecursive(conf *Configuration, settings *MfdConfig, module string) {
+	if !insideImageRoots(settings, module, conf.FileName) && !hasScheme(conf.FileName) {
+		setFullPathToFile(conf, settings, module)
 	}
 	for i := range conf.Configurations {
 		var subConfig = &conf.Configurations[i]
-		if !isPathInside(configurationInstance.FilePath, subConfig.FileName) {
-			setFileNamesRecursive(subConfig)
+		if !insideImageRoots(settings, module, subConfig.FileName) {
+			setFileNamesRecursive(subConfig, settings, module)
 		}
 	}
 }
@@ -663,7 +1308,7 @@ func setInitialValues(obj ConfigurationProvider) {
 	}
 }
 
-func enrichConfigurations(module *Module, displays *[]Display) {
+func enrichConfigurations(module *Module, displays *[]Display, settings *MfdConfig, logger *Logger) {
 
 	for i := range module.Configurations {
 		config := &module.Configurations[i]
@@ -672,23 +1317,21 @@ func enrichConfigurations(module *Module, displays *[]Display) {
 		if config.FileName == "" {
 			config.FileName = module.FileName
 		}
-		setConfigurationFileNames(config)
-		enrichedConfig := enrichSingleConfig(config, displays)
+		setConfigurationFileNames(config, settings)
+		enrichedConfig := enrichSingleConfig(config, displays, logger)
 		if strings.Contains(enrichedConfig.FileName, "THROTTLE") {
-			replaceToken := "WH"
-			if configurationInstance.UseCougar {
-				replaceToken = "HC"
-			}
-			enrichedConfig.FileName = strings.ReplaceAll(enrichedConfig.FileName, "THROTTLE", replaceToken)
+			enrichedConfig.FileName = strings.ReplaceAll(enrichedConfig.FileName, "THROTTLE", throttleToken(settings))
 		}
 		module.Configurations[i] = *enrichedConfig
+		enrichExpressions(config, logger)
 		// Enrich sub-configurations recursively.
-		enrichSubConfigs(config, displays)
+		enrichSubConfigs(config, displays, logger)
 	}
 }
 
-func enrichSingleConfig(config *Configuration, displays *[]Display) *Configuration {
+func enrichSingleConfig(config *Configuration, displays *[]Display, logger *Logger) *Configuration {
 	matched := false
+	log := logger.With(LogFields{Module: moduleName(config), Config: config.Name})
 
 	for _, display := range *displays {
 		if strings.HasPrefix(config.Name, display.Name) {
@@ -696,6 +1339,7 @@ func enrichSingleConfig(config *Configuration, displays *[]Display) *Configurati
 
 			// Copy properties from display to configuration.
 			setConfigToDisplay(config, display)
+			log.Debugf("Matched Display %s", display.Name)
 			matched = true
 			break
 		}
@@ -706,18 +1350,26 @@ func enrichSingleConfig(config *Configuration, displays *[]Display) *Configurati
 		var configurator ConfigurationProcessor = config // Use a pointer to satisfy the interface
 		err := configurator.ConfigureConfiguration()
 		if err != nil {
-			fmt.Printf("Error configuring Configuration %s: %v\n", config.Name, err)
+			log.Errorf("Error configuring Configuration: %v", err)
 		}
-		instance.Log(fmt.Sprintf("Configuration %s NOT matched", config.Name))
+		log.Debugf("NOT matched to a Display")
 	}
 
 	return config
 }
 
-func enrichSubConfigs(parentConfig *Configuration, displays *[]Display) {
+// enrichExpressions sets the geometry fields written as expressions once the display and parent values are known
+func enrichExpressions(config *Configuration, logger *Logger) {
+	if err := evaluateExpressions(config); err != nil {
+		logger.With(LogFields{Module: moduleName(config), Config: config.Name}).Errorf("Error evaluating the expressions: %v", err)
+	}
+}
+
+func enrichSubConfigs(parentConfig *Configuration, displays *[]Display, logger *Logger) {
 	for i := range parentConfig.Configurations {
 		subConfig := &parentConfig.Configurations[i]
 		subConfig.Parent = parentConfig
+		subConfig.Module = parentConfig.Module
 		if subConfig.FileName == "" {
 			subConfig.FileName = parentConfig.FileName
 		}
@@ -726,12 +1378,12 @@ func enrichSubConfigs(parentConfig *Configuration, displays *[]Display) {
 		setInitialValues(subConfig)
 
 		// Enrich sub-configuration with display properties.
-		enrichedSubConfig := enrichSingleConfig(subConfig, displays)
-		enrichedSubConfig.Module = parentConfig.Module
+		enrichedSubConfig := enrichSingleConfig(subConfig, displays, logger)
 		enrichedSubConfig.Display = parentConfig.Display
+		enrichExpressions(enrichedSubConfig, logger)
 
 		// Recursively handle nested sub-configurations.
-		enrichSubConfigs(enrichedSubConfig, displays)
+		enrichSubConfigs(enrichedSubConfig, displays, logger)
 		parentConfig.Configurations[i] = *enrichedSubConfig
 	}
 }
@@ -819,46 +1471,33 @@ func loadImageFile(fullPath string) (image.Image, error) {
 	return img, nil
 }
 
-func GetSaveDirectory(parentFileName string, moduleName string, rootConfigName string) string {
+func GetSaveDirectory(settings *MfdConfig, parentFileName string, moduleName string, rootConfigName string) string {
 	if parentFileName == "" {
-		return filepath.Join(getCacheBaseDirectory(), moduleName, rootConfigName)
+		return filepath.Join(getCacheBaseDirectory(settings), moduleName, rootConfigName)
 	} else {
 		return filepath.Dir(parentFileName)
 	}
 }
 
-func applyOpacity(img image.Image, opacity float32) *image.RGBA {
+func applyOpacity(img image.Image, opacity float32) draw.Image {
 	bounds := img.Bounds()
-	rgbaImage := image.NewRGBA(bounds)
+	faded := newCanvas(bounds, isDeepImage(img))
+	opacity = max(0, min(opacity, 1))
 
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// The 16 bit channels are premultiplied by alpha, scaling all of them by the opacity fades the pixel
 			r, g, b, a := img.At(x, y).RGBA()
-
-			// Convert from 16-bit to 8-bit
-			r8 := uint8(r >> 8)
-			g8 := uint8(g >> 8)
-			b8 := uint8(b >> 8)
-			a8 := uint8(a >> 8)
-
-			// Adjust alpha based on opacity
-			adjustedAlpha := uint8(float32(a8) * opacity)
-
-			// Premultiply color channels by adjusted alpha
-			rPremultiplied := uint8(float32(r8) * float32(adjustedAlpha) / 255)
-			gPremultiplied := uint8(float32(g8) * float32(adjustedAlpha) / 255)
-			bPremultiplied := uint8(float32(b8) * float32(adjustedAlpha) / 255)
-
-			rgbaImage.Set(x, y, color.RGBA{
-				R: rPremultiplied,
-				G: gPremultiplied,
-				B: bPremultiplied,
-				A: adjustedAlpha,
+			faded.Set(x, y, color.RGBA64{
+				R: uint16(float32(r) * opacity),
+				G: uint16(float32(g) * opacity),
+				B: uint16(float32(b) * opacity),
+				A: uint16(float32(a) * opacity),
 			})
 		}
 	}
 
-	return rgbaImage
+	return faded
 }
 
 // Function to convert any image.Image to *image.RGBA
@@ -876,7 +1515,7 @@ func convertToRGBA(src image.Image) *image.RGBA {
 	return rgba
 }
 
-func drawAxesWithTicks(img image.Image, xaxisColor color.Color, yaxisColor color.Color, drawTicks bool, tickLength int, tickInterval int, tickColor color.Color, textColor color.Color, numberLeftToRight bool) image.Image {
+func drawAxesWithTicks(img image.Image, xaxisColor color.Color, yaxisColor color.Color, drawTicks bool, tickLength int, tickInterval int, tickColor color.Color, textColor color.Color, numberLeftToRight bool, labelEvery int, xLabel func(int) string, yLabel func(int) string) image.Image {
 	bounds := img.Bounds()
 	width := bounds.Dx()
 	height := bounds.Dy()
@@ -904,7 +1543,17 @@ func drawAxesWithTicks(img image.Image, xaxisColor color.Color, yaxisColor color
 			Face: basicfont.Face7x13,
 		}
 
-		// Draw tick marks and labels along the X-axis
+		if labelEvery < 1 {
+			labelEvery = 1
+		}
+		if xLabel == nil {
+			xLabel = strconv.Itoa
+		}
+		if yLabel == nil {
+			yLabel = strconv.Itoa
+		}
+
+		// Draw tick marks and labels along the X-axis, every labelEvery tick counted from the center is labelled
 		for x := centerX; x < width; x += tickInterval {
 			for y := -tickLength / 2; y <= tickLength/2; y++ {
 				rgbaImg.Set(x, centerY+y, tickColor)
@@ -913,8 +1562,11 @@ func drawAxesWithTicks(img image.Image, xaxisColor color.Color, yaxisColor color
 			if numberLeftToRight {
 				label = x
 			}
+			if (x-centerX)/tickInterval%labelEvery != 0 {
+				continue
+			}
 			drawer.Dot = fixed.Point26_6{X: fixed.I(x), Y: fixed.I(centerY + tickLength + 10)}
-			drawer.DrawString(fmt.Sprintf("%d", label))
+			drawer.DrawString(xLabel(label))
 		}
 		for x := centerX - tickInterval; x >= 0; x -= tickInterval {
 			for y := -tickLength / 2; y <= tickLength/2; y++ {
@@ -924,8 +1576,11 @@ func drawAxesWithTicks(img image.Image, xaxisColor color.Color, yaxisColor color
 			if numberLeftToRight {
 				label = x
 			}
+			if (centerX-x)/tickInterval%labelEvery != 0 {
+				continue
+			}
 			drawer.Dot = fixed.Point26_6{X: fixed.I(x), Y: fixed.I(centerY + tickLength + 10)}
-			drawer.DrawString(fmt.Sprintf("%d", label))
+			drawer.DrawString(xLabel(label))
 		}
 
 		// Draw tick marks and labels along the Y-axis
@@ -937,8 +1592,11 @@ func drawAxesWithTicks(img image.Image, xaxisColor color.Color, yaxisColor color
 			if numberLeftToRight {
 				label = y
 			}
+			if (y-centerY)/tickInterval%labelEvery != 0 {
+				continue
+			}
 			drawer.Dot = fixed.Point26_6{X: fixed.I(centerX + tickLength + 5), Y: fixed.I(y + drawer.Face.Metrics().Ascent.Ceil()/2)}
-			drawer.DrawString(fmt.Sprintf("%d", label))
+			drawer.DrawString(yLabel(label))
 		}
 		for y := centerY - tickInterval; y >= 0; y -= tickInterval {
 			for x := -tickLength / 2; x <= tickLength/2; x++ {
@@ -948,9 +1606,13 @@ func drawAxesWithTicks(img image.Image, xaxisColor color.Color, yaxisColor color
 			if numberLeftToRight {
 				label = y
 			}
-			textWidth := drawer.MeasureString(fmt.Sprintf("%d", label)).Ceil()
+			if (centerY-y)/tickInterval%labelEvery != 0 {
+				continue
+			}
+			text := yLabel(label)
+			textWidth := drawer.MeasureString(text).Ceil()
 			drawer.Dot = fixed.Point26_6{X: fixed.I(centerX - textWidth - 5), Y: fixed.I(y + drawer.Face.Metrics().Ascent.Ceil()/2)}
-			drawer.DrawString(fmt.Sprintf("%d", label))
+			drawer.DrawString(text)
 		}
 	}
 
@@ -961,19 +1623,53 @@ func createRectangle(minX, minY, maxX, maxY int) image.Rectangle {
 	return image.Rect(minX, minY, maxX, maxY)
 }
 
-func getCacheBaseDirectory() string {
+// outputOverride is the -output directory that replaces the cachePath setting for this run
+var outputOverride string
+
+// getCacheBaseDirectory is the -output directory, the configured cachePath or Saved Games\MFDMF\Cache
+func getCacheBaseDirectory(settings *MfdConfig) string {
+	if outputOverride != "" {
+		return outputOverride
+	}
+	if settings != nil && settings.CachePath != "" {
+		return settings.CachePath
+	}
 	return filepath.Join(getSavedGamesFolder(), "MFDMF", "Cache")
 }
 
-func clearCacheFolder() {
-	cacheFolder := getCacheBaseDirectory()
-	removeContents(cacheFolder)
-	instance.Log(fmt.Sprintf("The cache has been cleared at %s", cacheFolder))
+// clearCacheFolder moves everything in the cache into the trash, purge deletes it instead
+func clearCacheFolder(settings *MfdConfig, purge bool) error {
+	cacheFolder := getCacheBaseDirectory(settings)
+	if purge {
+		if err := removeContents(cacheFolder); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to clear the cache at %s: %w", cacheFolder, err)
+		}
+		instance.Infof("The cache has been cleared at %s", cacheFolder)
+		return nil
+	}
+	entries, err := os.ReadDir(longPath(cacheFolder))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to clear the cache at %s: %w", cacheFolder, err)
+	}
+	if len(entries) == 0 {
+		instance.Infof("The cache at %s is already empty", cacheFolder)
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	trash, err := trashCacheEntries(cacheFolder, names)
+	if err != nil {
+		return fmt.Errorf("failed to clear the cache at %s: %w", cacheFolder, err)
+	}
+	instance.Infof("The cache at %s has been moved to %s, clear-cache -undo-last-clear restores it", cacheFolder, trash)
+	return nil
 }
 
 func removeContents(path string) error {
 	// Open the directory
-	dir, err := os.Open(path)
+	dir, err := os.Open(longPath(path))
 	if err != nil {
 		return err
 	}
@@ -989,78 +1685,115 @@ func removeContents(path string) error {
 	for _, entry := range entries {
 		entryPath := filepath.Join(path, entry.Name())
 		if entry.IsDir() {
-			// If it's a subdirectory, call removeContents recursively
+			// If it's a subdirectory, call removeContents recursively which also removes the emptied directory
 			err := removeContents(entryPath)
 			if err != nil {
 				return err
 			}
-			// Remove the empty directory
-			err = os.Remove(entryPath)
-			if err != nil {
-				return err
-			}
 		} else {
 			// If it's a file, remove the file
-			err := os.Remove(entryPath)
+			err := os.Remove(longPath(entryPath))
 			if err != nil {
 				return err
 			}
 		}
 	}
 
-	os.Remove(path)
+	os.Remove(longPath(path))
 	return nil
 }
 
+// saveImageAsJPGAndPNG writes img both as saveImagePath.jpg and saveImagePath.png
 func saveImageAsJPGAndPNG(saveImagePath string, img image.Image) error {
-	fileName := fmt.Sprintf("%s.jpg", saveImagePath)
-	instance.Log(fmt.Sprintf("Saving %s", fileName))
-	jpgFile, err := os.Create(fileName)
-	if err != nil {
-		return err
-	}
-	defer jpgFile.Close()
-	err = jpeg.Encode(jpgFile, img, &jpeg.Options{Quality: 80})
-	if err != nil {
-		return err
-	}
-	/*
-		pngFile, err := os.Create(fmt.Sprintf("%s.png", saveImagePath))
-		if err != nil {
+	for _, extension := range []string{".jpg", ".png"} {
+		instance.Debugf("Saving %s%s", saveImagePath, extension)
+		if err := encodeImageFile(saveImagePath+extension, img, 80); err != nil {
 			return err
 		}
-		defer pngFile.Close()
-	*/
-	//return png.Encode(pngFile, img)
-	return jpeg.Encode(jpgFile, img, &jpeg.Options{Quality: 80})
+	}
+	return nil
 }
 
-// buildConfigToFileMap recursively builds a dictionary mapping Configuration.Name to its file name
-func buildConfigToFileMap(config Configuration, rootPath string, configToFileMap map[string]string) {
-	// Generate the file path for this configuration
-	filePath := filepath.Join(getCacheBaseDirectory(), config.Module.Name, rootPath)
-	ensurePathExists(filePath)
-	filePath = filepath.Join(filePath, config.Name)
-	configToFileMap[config.Name] = filePath
+// cacheFilePath is the cache file, without extension, of a configuration in the folder of its parent configurations
+func cacheFilePath(settings *MfdConfig, moduleName string, folder string, fileName string) string {
+	return filepath.Join(getCacheBaseDirectory(settings), moduleName, folder, fileName)
+}
 
-	// Recursively process sub-configurations
-	for _, subConfig := range config.Configurations {
-		buildConfigToFileMap(subConfig, rootPath, configToFileMap)
+// configurationPath is the names from the top level configuration down to config joined by /, the key of its output file
+func configurationPath(config *Configuration) string {
+	if config.Parent == nil {
+		return config.Name
 	}
+	return configurationPath(config.Parent) + "/" + config.Name
 }
 
-// generateConfigToFileMap processes all configurations in a module and generates the dictionary
-func generateConfigToFileMap(module Module) map[string]string {
-	configToFileMap := make(map[string]string)
+// configurationPathName is the name of the configuration at the end of a configuration path
+func configurationPathName(configPath string) string {
+	return configPath[strings.LastIndex(configPath, "/")+1:]
+}
+
+// configurationOutput is the cache file, without extension, of the configuration at path
+type configurationOutput struct {
+	path string
+	file string
+}
+
+// buildConfigurationOutputs recursively lists the output of config and its sub-configurations, named by the outputName template.
+// A top level configuration and its sub-configurations share its folder, deeper ones go into a folder per parent so
+// configurations with the same name in different branches do not overwrite each other
+func buildConfigurationOutputs(settings *MfdConfig, module Module, root Configuration, config Configuration, configPath string, folder string, outputs *[]configurationOutput) {
+	fileName := expandOutputName(settings.OutputName, outputNameFields(module, root, config))
+	*outputs = append(*outputs, configurationOutput{path: configPath, file: cacheFilePath(settings, module.Name, folder, fileName)})
+
+	subFolder := folder
+	if configPath != root.Name {
+		subFolder = filepath.Join(folder, config.Name)
+	}
+	for _, subConfig := range config.Configurations {
+		buildConfigurationOutputs(settings, module, root, subConfig, configPath+"/"+subConfig.Name, subFolder, outputs)
+	}
+}
 
-	// Process each top-level configuration
+// configurationOutputs lists the output of every configuration of a module
+func configurationOutputs(settings *MfdConfig, module Module) []configurationOutput {
+	var outputs []configurationOutput
 	for _, config := range module.Configurations {
-		buildConfigToFileMap(config, config.Name, configToFileMap)
+		buildConfigurationOutputs(settings, module, config, config, config.Name, config.Name, &outputs)
 	}
+	return outputs
+}
 
+// generateConfigToFileMap maps the configuration path of every configuration of a module to its cache file and creates their folders
+func generateConfigToFileMap(settings *MfdConfig, module Module) map[string]string {
+	configToFileMap := make(map[string]string)
+	for _, output := range configurationOutputs(settings, module) {
+		ensurePathExists(filepath.Dir(output.file))
+		configToFileMap[output.path] = output.file
+	}
 	return configToFileMap
 }
 
+// outputCollisions describes the configurations of a module written to the same cache file, they overwrite each other
+func outputCollisions(settings *MfdConfig, module Module) []string {
+	owners := make(map[string][]string)
+	var files []string
+	for _, output := range configurationOutputs(settings, module) {
+		// Windows file names ignore case
+		key := strings.ToLower(output.file)
+		if len(owners[key]) == 0 {
+			files = append(files, key)
+		}
+		owners[key] = append(owners[key], output.path)
+	}
+	var collisions []string
+	for _, key := range files {
+		if paths := owners[key]; len(paths) > 1 {
+			collisions = append(collisions, fmt.Sprintf("%s are written to the same file and overwrite each other", strings.Join(paths, " and ")))
+		}
+	}
+	return collisions
+}
+
 func ConvertNRGBAToRGBAUsingDraw(src *image.NRGBA) *image.RGBA {
 	bounds := src.Bounds()
 	dst := image.NewRGBA(bounds)
@@ -1072,222 +1805,409 @@ func ConvertNRGBAToRGBAUsingDraw(src *image.NRGBA) *image.RGBA {
 }
 
 // centerImageWithCropAndResize centers a resized child image onto a resized parent image.
-// If childImgPath is blank or nil, only the parent image is cropped, resized, and saved.
-func (config *Configuration) CenterImageWithCropAndResize(subConfigIndex int) error {
-	var configurator ConfigurationProcessor = config // Use a pointer to satisfy the interface
-	parentImgPath := config.FileName
-	// Open the parent image
-	parentFile, err := os.Open(parentImgPath)
-	if err != nil {
-		return fmt.Errorf("failed to open parent image: %v", err)
+// If subConfigIndex is -1, only the parent image is cropped, resized, and saved.
+func (config *Configuration) CenterImageWithCropAndResize(ctx context.Context, rc *RenderContext, subConfigIndex int) error {
+	var child *Configuration
+	outputFileName := rc.Files[configurationPath(config)]
+	if subConfigIndex >= 0 {
+		child = &config.Configurations[subConfigIndex]
+		outputFileName = rc.Files[configurationPath(child)]
+	}
+	var keepLayer func(layer *Configuration, img image.Image)
+	if rc.Renderer.saveCropped && !rc.Report.Diff {
+		keepLayer = func(layer *Configuration, img image.Image) {
+			rc.Renderer.save(ctx, rc.Files[configurationPath(layer)]+"-crop", layer, img)
+		}
 	}
-	defer parentFile.Close()
-
-	parentImg, _, err := image.Decode(parentFile)
+	outputImg, err := rc.Renderer.compose(ctx, config, child, keepLayer)
 	if err != nil {
-		return fmt.Errorf("failed to decode parent image: %v", err)
+		return err
 	}
-	cropRectParent := configurator.GetCropRect()
-	parentSize := configurator.GetSize()
 
-	// Crop and resize the parent image
-	croppedParentImg := cropImage(parentImg, cropRectParent)
-	resizedParentImg := imaging.Resize(croppedParentImg, parentSize.X, parentSize.Y, imaging.Lanczos)
-	outputFileName := configToFiles[config.Name]
-	config.Image = (*image.RGBA)(resizedParentImg)
+	// Save the resulting composite image
+	target := config
+	if child != nil {
+		target = child
+	}
+	if rc.Report.Diff {
+		return rc.diffOutput(outputFileName, target, outputImg)
+	}
+	if err := rc.Renderer.save(ctx, outputFileName, target, outputImg); err != nil {
+		return err
+	}
+	return rc.Renderer.saveOverlay(outputFileName, target, outputImg)
+}
 
-	if configurationInstance.SaveCroppedImages {
-		saveImage(outputFileName+"-crop", resizedParentImg)
+// cropImage crops an input image to the specified rectangle.
+func cropImage(src image.Image, rect image.Rectangle) image.Image {
+	// imaging.Crop returns 8 bits per channel, a 16 bit image is cropped to a view of its pixels instead
+	if subImager, ok := src.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok && isDeepImage(src) {
+		return subImager.SubImage(rect.Intersect(src.Bounds()))
 	}
+	cropped := imaging.Crop(src, rect)
+	return cropped
+}
 
-	// If childImgPath is blank or nil, save only the resized parent image
-	if subConfigIndex == -1 {
-		outputImg := convertToRGBA(resizedParentImg)
-		if configurationInstance.ShowRulers {
-			outputImg = convertToRGBA(drawAxesWithTicks(outputImg, RedColor, RedColor, true, 10, configurationInstance.RulerSize, BlackColor, BlackColor, true))
+// RenderContext is the state of rendering one module, its settings, logger, renderer, run report and the cache file of every configuration
+type RenderContext struct {
+	Config   *MfdConfig
+	Logger   *Logger
+	Renderer *Renderer
+	Report   *RunReport
+	Files    map[string]string
+}
+
+// newRenderContext prepares the rendering of a module that went through prepareModule
+func newRenderContext(env *Environment, renderer *Renderer, module *Module, report *RunReport) *RenderContext {
+	return &RenderContext{Config: env.Config, Logger: env.Logger, Renderer: renderer.reportingMissing(report.MissingImage), Report: report, Files: generateConfigToFileMap(env.Config, *module)}
+}
+
+// newRunRenderer creates the Renderer of a run from the settings, the -workers flag and the options of the caller
+func newRunRenderer(env *Environment, options RunOptions) *Renderer {
+	rendererOptions := append(settingsRendererOptions(env.Config), WithWorkers(options.Workers), WithLogger(env.Logger))
+	rendererOptions = append(rendererOptions, registeredHookOptions()...)
+	if options.StrictCrop {
+		rendererOptions = append(rendererOptions, WithStrictCrop(true))
+	}
+	rendererOptions = append(rendererOptions, WithMissingImages(options.MissingImages))
+	return NewRenderer(append(rendererOptions, options.Render...)...)
+}
+
+// processSelectedSubConfigurations renders every sub-configuration of parent included in the selection, searching the tree depth first
+func (rc *RenderContext) processSelectedSubConfigurations(ctx context.Context, parent *Configuration, selection Selection) (int, error) {
+	rendered := 0
+	for i := range parent.Configurations {
+		subConfig := &parent.Configurations[i]
+		if selection.IncludesConfiguration(subConfig) {
+			if err := rc.renderConfiguration(ctx, parent, i); err != nil {
+				if ctx.Err() != nil {
+					return rendered, ctx.Err()
+				}
+				if err := rc.Report.Fail(moduleName(parent), subConfig.Name, err); err != nil {
+					return rendered, fmt.Errorf("error processing the configuration %s: %w", subConfig.Name, err)
+				}
+			}
+			rendered++
+		}
+		count, err := rc.processSelectedSubConfigurations(ctx, subConfig, selection)
+		rendered += count
+		if err != nil {
+			return rendered, err
 		}
-		return saveImage(outputFileName, outputImg)
 	}
+	return rendered, nil
+}
 
-	subConfig := &config.Configurations[subConfigIndex]
-	childImgPath := subConfig.FileName
-	// Open the child image
-	childFile, err := os.Open(childImgPath)
-	if err != nil {
-		return fmt.Errorf("failed to open child image: %v", err)
+// moduleName is the name of the Module a configuration belongs to
+func moduleName(config *Configuration) string {
+	if config.Module == nil {
+		return ""
 	}
-	defer childFile.Close()
+	return config.Module.Name
+}
 
-	childImg, _, err := image.Decode(childFile)
-	if err != nil {
-		return fmt.Errorf("failed to decode child image: %v", err)
+// renderConfiguration renders a configuration, or its sub-configuration at subIndex, unless its cached output is up to date or the run was cancelled and logs how long it took
+func (rc *RenderContext) renderConfiguration(ctx context.Context, config *Configuration, subIndex int) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-
-	var subConfigurator ConfigurationProcessor = subConfig
-	cropRectChild := subConfigurator.GetCropRect()
-	childSize := subConfigurator.GetSize()
-
-	// Crop and resize the child image
-	croppedChildImg := cropImage(childImg, cropRectChild)
-	resizedChildImg := imaging.Resize(croppedChildImg, childSize.X, childSize.Y, imaging.Lanczos)
-	outputFileName = configToFiles[subConfig.Name]
-	subConfig.Image = (*image.RGBA)(resizedChildImg)
-	if configurationInstance.SaveCroppedImages {
-		saveImage(outputFileName+"-crop", resizedChildImg)
+	start := time.Now()
+	target := config
+	if subIndex >= 0 {
+		target = &config.Configurations[subIndex]
+	}
+	fields := LogFields{Module: moduleName(config), Config: target.Name}
+	outputFile, extensions, upToDate := rc.outputStatus(config, target)
+	if upToDate {
+		rc.Logger.With(fields).Debugf("Up to date, skipped")
+		rc.Report.Skip(fields.Module, fields.Config, time.Since(start))
+		renderEvents.Publish(RenderEvent{Kind: RenderSkipped, Module: fields.Module, Configuration: fields.Config})
+		return nil
 	}
 
-	// Get dimensions of both resized images
-	parentBounds := resizedParentImg.Bounds()
-	childBounds := resizedChildImg.Bounds()
-
-	parentWidth := parentBounds.Dx()
-	parentHeight := parentBounds.Dy()
-	childWidth := childBounds.Dx()
-	childHeight := childBounds.Dy()
-
-	// Calculate the position to center the child image on the parent image
-	offsetX := (parentWidth - childWidth) / 2
-	offsetY := (parentHeight - childHeight) / 2
-
-	// Create a new RGBA canvas with the size of the resized parent image
-	outputImg := image.NewRGBA(parentBounds)
-
-	// Draw the resized parent image onto the canvas
-	draw.Draw(outputImg, parentBounds, resizedParentImg, image.Point{}, draw.Src)
-
-	// Draw the resized child image onto the canvas at the calculated position
-	draw.Draw(outputImg, childBounds.Add(image.Point{X: offsetX, Y: offsetY}), resizedChildImg, image.Point{}, draw.Over)
-
-	// Add axes and ticks using drawAxesWithTicks if ShowRulers is true
-	if configurationInstance.ShowRulers {
-		outputImg = convertToRGBA(drawAxesWithTicks(outputImg, RedColor, RedColor, true, 10, configurationInstance.RulerSize, BlackColor, BlackColor, true))
+	release, err := rc.Renderer.acquire(ctx, config, target)
+	if err != nil {
+		return err
 	}
+	timings := &StageTimings{}
+	err = rc.recoverRender(target, func() error {
+		var configurator ConfigurationProcessor = config
+		return configurator.CenterImageWithCropAndResize(withStageTimings(ctx, timings), rc, subIndex)
+	})
+	release()
 
-	// Save the resulting composite image
-	return saveImage(outputFileName, outputImg)
+	fields.Duration = time.Since(start)
+	fields.Stages = timings.Durations()
+	if errors.Is(err, errImageSkipped) {
+		renderEvents.Publish(RenderEvent{Kind: RenderSkipped, Module: fields.Module, Configuration: fields.Config})
+		return nil
+	}
+	if err != nil {
+		rc.Logger.With(fields).Errorf("%v", err)
+		renderEvents.Publish(RenderEvent{Kind: RenderFailed, Module: fields.Module, Configuration: fields.Config, Err: err, Duration: fields.Duration})
+	} else {
+		rc.Logger.With(fields).Infof("Rendered")
+		renderEvents.Publish(RenderEvent{Kind: RenderRendered, Module: fields.Module, Configuration: fields.Config, Duration: fields.Duration})
+		var size int64
+		for _, extension := range extensions {
+			if info, statErr := os.Stat(outputFile + extension); statErr == nil {
+				size += info.Size()
+			}
+		}
+		rc.Report.Succeed(fields.Module, fields.Config, fields.Duration, fields.Stages, size)
+	}
+	return err
 }
 
-// cropImage crops an input image to the specified rectangle.
-func cropImage(src image.Image, rect image.Rectangle) image.Image {
-	cropped := imaging.Crop(src, rect)
-	return cropped
+// outputStatus is the cache file of target rendered onto config, without extension, the extensions it is written with
+// and whether every one of them is newer than its inputs so the render can be skipped
+func (rc *RenderContext) outputStatus(config *Configuration, target *Configuration) (string, []string, bool) {
+	outputFile := rc.Files[configurationPath(target)]
+	// An invalid outputFormats list has no extensions and fails when the image is saved
+	extensions, _ := rc.Renderer.OutputExtensions(target)
+	inputs := rc.configurationInputs(config, target)
+	upToDate := !rc.Report.Force && !rc.Report.Diff && len(extensions) > 0
+	for _, extension := range extensions {
+		upToDate = upToDate && isUpToDate(outputFile+extension, inputs...)
+	}
+	return outputFile, extensions, upToDate
 }
 
-// saveImage saves an image to a file based on its extension (.png or .jpg).
-func saveImage(fileName string, img image.Image) error {
-	outputFile, err := os.Create(fileName + ".jpg")
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
+// configurationInputs lists every file the output of target depends on when it is rendered onto config
+func (rc *RenderContext) configurationInputs(config *Configuration, target *Configuration) []string {
+	inputs := []string{config.FileName, target.FileName, getConfigurationFilePath(), rc.Config.DisplayConfigurationFile}
+	// An image dropped into an earlier root replaces the one found before, the root changes with it
+	roots := imageRoots(rc.Config, moduleName(config))
+	for _, root := range roots[:len(roots)-1] {
+		if fileExists(root) {
+			inputs = append(inputs, root)
+		}
+	}
+	if config.Module != nil && config.Module.SourceFile != "" {
+		inputs = append(inputs, config.Module.SourceFile, moduleScriptPath(config.Module))
 	}
-	defer outputFile.Close()
+	return inputs
+}
 
-	err = jpeg.Encode(outputFile, img, &jpeg.Options{Quality: 90})
+// isUpToDate is true when the output file exists and is newer than every input, a missing input is never up to date
+func isUpToDate(outputFile string, inputs ...string) bool {
+	output, err := os.Stat(outputFile)
 	if err != nil {
-		return fmt.Errorf("failed to save output file: %v", err)
+		return false
 	}
-
-	return nil
+	for _, input := range inputs {
+		if input == "" {
+			continue
+		}
+		info, err := os.Stat(input)
+		if err != nil || info.ModTime().After(output.ModTime()) {
+			return false
+		}
+	}
+	return true
 }
 
-func processConfiguration(config *Configuration, subIndex int) error {
-	var configurator ConfigurationProcessor = config
-	configurator.CenterImageWithCropAndResize(subIndex)
+func (rc *RenderContext) processConfiguration(ctx context.Context, config *Configuration, subIndex int) error {
+	if err := rc.renderConfiguration(ctx, config, subIndex); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Without the parent image none of the sub-configurations can be composited
+		return rc.Report.Fail(moduleName(config), config.Name, err)
+	}
 
 	// Process sub-configurations recursively
 	for i := range config.Configurations {
-		configurator.CenterImageWithCropAndResize(i)
+		if err := rc.renderConfiguration(ctx, config, i); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := rc.Report.Fail(moduleName(config), config.Configurations[i].Name, err); err != nil {
+				return fmt.Errorf("error processing the configuration %s: %w", config.Configurations[i].Name, err)
+			}
+		}
 	}
 	return nil
 }
 
-var configToFiles map[string]string
-
-func processModule(module *Module, displays []Display) error {
-	instance.Log(fmt.Sprintf("Processing Module %s", module.DisplayName))
+// prepareModule resolves the image paths of a Module and enriches its Configurations with Display data
+func prepareModule(module *Module, env *Environment) {
+	if env.Config.ThrottleVariants {
+		expandThrottleVariants(module)
+	}
+	expandSeatVariants(module)
 	// Set the Filename to the fullpath if it's not in the module filePath
-	setModuleFileName(module)
+	setModuleFileName(module, env.Config)
 	// Enrich all the Configurations and Sub-Configurations with Display data
-	enrichConfigurations(module, &displays)
-	configToFiles = generateConfigToFileMap(*module)
-	// process each Configuration of the Module
-	for _, config := range module.Configurations {
+	displays := env.Displays
+	enrichConfigurations(module, &displays, env.Config, env.Logger)
+}
 
-		err := processConfiguration(&config, -1)
-		if err != nil {
-			return fmt.Errorf("error processing the configuration %s: %w", config.Name, err)
-		}
+// processTopLevelConfiguration renders a top level configuration with its sub-configurations, or only the ones included in the selection
+func (rc *RenderContext) processTopLevelConfiguration(ctx context.Context, config *Configuration, wholeModule bool, selection Selection) (int, error) {
+	if !wholeModule && !selection.IncludesConfiguration(config) {
+		return rc.processSelectedSubConfigurations(ctx, config, selection)
 	}
-	instance.Log(fmt.Sprintf("BEGIN ********** %s//%s *********", module.Category, module.Name))
+
+	err := rc.processConfiguration(ctx, config, -1)
+	if err != nil {
+		return 0, fmt.Errorf("error processing the configuration %s: %w", config.Name, err)
+	}
+	return 1, nil
+}
+
+// processModule renders the Configurations of a Module included in the selection and returns how many were rendered, cancelling ctx stops it after the images in progress
+func processModule(ctx context.Context, env *Environment, renderer *Renderer, module *Module, selection Selection, report *RunReport) (int, error) {
+	start := time.Now()
+	logger := env.Logger
+	logger.With(LogFields{Module: module.Name}).Infof("Processing Module %s", module.DisplayName)
+	defer func() { report.ModuleFinished(module.Name, time.Since(start)) }()
+	prepareModule(module, env)
+	for _, collision := range outputCollisions(env.Config, *module) {
+		logger.With(LogFields{Module: module.Name}).Warnf("%s", collision)
+	}
+	rc := newRenderContext(env, renderer, module, report)
+	// process each Configuration of the Module, every top level configuration owns its sub-configurations so they run in parallel
+	rendered := 0
+	wholeModule := selection.IncludesWholeModule(module)
+	var firstErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := range module.Configurations {
+		config := module.Configurations[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, err := rc.processTopLevelConfiguration(ctx, &config, wholeModule, selection)
+			mu.Lock()
+			defer mu.Unlock()
+			rendered += count
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return rendered, firstErr
+	}
+	if rendered == 0 {
+		return rendered, nil
+	}
+	logger.Debugf("BEGIN ********** %s//%s *********", module.Category, module.Name)
 	moduleInfo := formatModule(module)
-	instance.Log(moduleInfo)
-	instance.Log(fmt.Sprintf("END ********** %s//%s *********", module.Category, module.Name))
-	return nil
+	logger.Debug(moduleInfo)
+	logger.Debugf("END ********** %s//%s *********", module.Category, module.Name)
+	logger.With(LogFields{Module: module.Name, Duration: time.Since(start)}).Infof("Rendered %d configurations", rendered)
+	return rendered, nil
 }
 
-var (
-	module     string
-	subModule  string
-	clearCache bool
-)
-
-func init() {
-	flag.StringVar(&module, "mod", "", "Module to select")
-	flag.StringVar(&subModule, "sub", "", "Sub-Module to select")
-	flag.BoolVar(&clearCache, "clear", false, "Clears the cache")
+// filterModules returns the modules included in the selection
+func filterModules(modules []Module, selection Selection) []Module {
+	var selected []Module
+	for _, module := range modules {
+		if selection.IncludesModule(&module) {
+			selected = append(selected, module)
+		}
+	}
+	return selected
 }
 
-func main() {
-	flag.Parse()
-
-	logger := GetLogger()
-	logger.Log("Starting GOMFD!")
-
-	if clearCache {
-		clearCacheFolder()
-		return
-	}
+// Environment holds the settings, logger, displays and modules every command works from
+type Environment struct {
+	Config   *MfdConfig
+	Logger   *Logger
+	Displays []Display
+	Modules  []Module
+}
 
-	currentUser, err := user.Current()
-	if err != nil {
-		fmt.Println("Error getting the current User", err)
-		return
-	}
+func getConfigurationFilePath() string {
+	return filepath.Join(getSavedGamesFolder(), "MFDMF", "appsettings.json")
+}
 
-	configFilePath := currentUser.HomeDir + "\\Saved Games\\MFDMF\\appsettings.json"
-	currentConfig, err := LoadConfiguration(configFilePath)
+// loadEnvironment reads appsettings.json, the display definitions and every module file
+func loadEnvironment() (*Environment, error) {
+	currentConfig, err := LoadConfiguration(getConfigurationFilePath())
 	if err != nil {
-		fmt.Println("Error reading Configuration", err)
-		return
+		return nil, classify(ErrConfiguration, fmt.Errorf("error reading Configuration: %w", err))
 	}
 	displayJsonPath := currentConfig.DisplayConfigurationFile
 
 	// Read displays.json file
 	displays, err := readDisplaysJSON(displayJsonPath)
 	if err != nil {
-		fmt.Println("Error reading displays.json:", err)
-		return
+		return nil, classify(ErrConfiguration, fmt.Errorf("error reading displays.json: %w", err))
 	}
 
 	// Make sure all the values are set
-	setDisplays(displays)
+	logger := GetLogger()
+	setDisplays(displays, logger)
 
 	// Load the modules
-	modulesPath := currentConfig.Modules
-	modules, err := readModuleFiles(modulesPath)
+	modules, err := readModuleFiles(currentConfig.Modules)
 	if err != nil {
-		fmt.Println("Error reading JSON files:", err)
-		return
+		return nil, classify(ErrConfiguration, fmt.Errorf("error reading the module files:\n%w", err))
+	}
+
+	return &Environment{Config: currentConfig, Logger: logger, Displays: displays, Modules: modules}, nil
+}
+
+// generateModules renders every module in the selection and returns the number of modules and configurations processed
+func generateModules(ctx context.Context, env *Environment, selection Selection, report *RunReport) (int, int, error) {
+	// Only keep the selected module when -mod is used
+	modules := filterModules(env.Modules, selection)
+	if len(modules) == 0 {
+		return 0, 0, classify(ErrConfiguration, fmt.Errorf("%s was not found in %s", selection.describeModules(), env.Config.Modules))
 	}
 
-	// Process each module
+	// Process each module, the renderer is shared so -workers caps the whole run
+	renderer := newRunRenderer(env, report.RunOptions)
 	counter := 0
+	rendered := 0
 	for _, module := range modules {
-		err := processModule(&module, displays)
+		count, err := processModule(ctx, env, renderer, &module, selection, report)
+		rendered += count
+		if ctx.Err() != nil {
+			env.Logger.Warnf("Cancelled while processing module %s", module.Name)
+			report.Modules = counter
+			report.LogSummary()
+			return counter, rendered, classify(ErrPartialFailure, fmt.Errorf("cancelled after %d configurations: %w", rendered, ctx.Err()))
+		}
 		if err != nil {
-			fmt.Printf("Error processing module %s, Error %s", module.Name, err)
-			return
+			err = fmt.Errorf("error processing module %s: %w", module.Name, err)
+			if counter > 0 || rendered > 0 {
+				err = classify(ErrPartialFailure, err)
+			}
+			return counter, rendered, err
 		}
 		counter++
 	}
-	instance.Log(fmt.Sprintf("Finished processing %d modules", counter))
+	if rendered == 0 && !selection.IsEmpty() {
+		env.Logger.Warn("No configurations matched the selection")
+	}
+	env.Logger.Infof("Finished processing %d modules", counter)
+	report.Modules = counter
+	report.LogSummary()
+	report.LogFailures()
+	if env.Config.Metrics.Enabled {
+		if err := report.SaveMetrics(env.Config.Metrics); err != nil {
+			env.Logger.Warnf("Could not save the run metrics to %s: %v", getMetricsFilePath(env.Config.Metrics), err)
+		}
+	}
+	return counter, rendered, report.Err()
+}
+
+func main() {
+	logger := GetLogger()
+	// The Saved Games folder is found before anything can log, a bad flag or command is logged in its MFDMF\Logs
+	err := locateSavedGamesFolder()
+	if err == nil {
+		err = runCommand(os.Args[1:])
+	}
+	if err != nil {
+		logger.Errorf("Error: %v", err)
+	}
+	os.Exit(exitCode(err))
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"sync"
+)
+
+// memoryBudget limits the estimated memory of the renders in flight, a render larger than the whole budget waits
+// until nothing else is in flight and then runs alone
+type memoryBudget struct {
+	mu    sync.Mutex
+	limit int64
+	used  int64
+	// released is closed and replaced whenever memory is given back, waiting renders try again then
+	released chan struct{}
+}
+
+func newMemoryBudget(limit int64) *memoryBudget {
+	return &memoryBudget{limit: limit, released: make(chan struct{})}
+}
+
+// acquire blocks until bytes fit into the budget or ctx is cancelled, it returns the bytes to release
+func (b *memoryBudget) acquire(ctx context.Context, bytes int64) (int64, error) {
+	bytes = min(bytes, b.limit)
+	for {
+		b.mu.Lock()
+		if b.used == 0 || b.used+bytes <= b.limit {
+			b.used += bytes
+			b.mu.Unlock()
+			return bytes, nil
+		}
+		released := b.released
+		b.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+func (b *memoryBudget) release(bytes int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.used -= bytes
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+// decodedBytes estimates the memory of an image once decoded, 8 bytes a pixel at 16 bits per channel and 4 otherwise
+// since every decoded image is converted to RGBA before it is cropped
+func decodedBytes(header image.Config) int64 {
+	bytesPerPixel := int64(4)
+	switch header.ColorModel {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		bytesPerPixel = 8
+	}
+	return int64(header.Width) * int64(header.Height) * bytesPerPixel
+}
+
+// renderMemory estimates the memory of rendering target onto config, their source images read from the headers and
+// the layers and canvas at their supersampled size, a source whose header cannot be read counts only its layer
+func (r *Renderer) renderMemory(config *Configuration, target *Configuration) int64 {
+	layers := []*Configuration{config}
+	if target != config {
+		layers = append(layers, target)
+	}
+	scale := int64(r.supersampleFactor(target))
+	var total int64
+	for _, layer := range layers {
+		if headers, ok := r.images.(HeaderSource); ok {
+			if header, err := headers.Header(layer.FileName); err == nil {
+				total += decodedBytes(header)
+			}
+		}
+		size := layer.GetSize()
+		// The resized layer and the canvas it is drawn on, at up to 16 bits per channel
+		total += 2 * int64(size.X) * int64(size.Y) * scale * scale * 8
+	}
+	return total
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imageText is a keyword and its text, written as PNG text chunks or lines of the JPEG comment of an output
+type imageText struct {
+	Key   string
+	Value string
+}
+
+// outputMetadata traces an output back to its definition, the build that wrote it, the module and configuration and
+// the source images it was made from with their hashes
+func outputMetadata(config *Configuration) []imageText {
+	build := currentBuild()
+	texts := []imageText{
+		{"Software", "GOMFD " + build.Version + " (commit " + build.Commit + ")"},
+		{"Module", moduleName(config)},
+		{"Configuration", configurationPath(config)},
+	}
+	if config.Module != nil && config.Module.SourceFile != "" {
+		texts = append(texts, imageText{"Module file", config.Module.SourceFile})
+	}
+	var sources []*Configuration
+	for layer := config; layer != nil; layer = layer.Parent {
+		sources = append([]*Configuration{layer}, sources...)
+	}
+	for _, layer := range sources {
+		source := layer.FileName
+		if hash := sourceFileHash(layer.FileName); hash != "" {
+			source += " sha256:" + hash
+		}
+		texts = append(texts, imageText{"Source", source})
+	}
+	return texts
+}
+
+// sourceHash is the hash of a source image as of its modification time
+type sourceHash struct {
+	modTime time.Time
+	hash    string
+}
+
+// sourceHashes remembers the hash of every source image so an image shared by many configurations is read once
+var sourceHashes sync.Map
+
+// sourceFileHash is the SHA-256 of a source image file, empty for a URL, a builtin or an image that cannot be read
+func sourceFileHash(fileName string) string {
+	info, err := os.Stat(longPath(fileName))
+	if err != nil || info.IsDir() {
+		return ""
+	}
+	if cached, ok := sourceHashes.Load(fileName); ok && cached.(sourceHash).modTime.Equal(info.ModTime()) {
+		return cached.(sourceHash).hash
+	}
+	file, err := os.Open(longPath(fileName))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return ""
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	sourceHashes.Store(fileName, sourceHash{modTime: info.ModTime(), hash: sum})
+	return sum
+}
+
+// embedPNGText inserts a text chunk per entry after the IHDR chunk of an encoded PNG, tEXt for Latin-1 text and
+// iTXt for the rest such as a path with other characters
+func embedPNGText(data []byte, texts []imageText) []byte {
+	// The 8 byte signature is followed by the 25 bytes of the IHDR chunk
+	const headerEnd = 8 + 25
+	if len(texts) == 0 || len(data) < headerEnd {
+		return data
+	}
+	var out bytes.Buffer
+	out.Write(data[:headerEnd])
+	for _, text := range texts {
+		if isLatin1(text.Value) {
+			writePNGChunk(&out, "tEXt", append(append([]byte(text.Key), 0), latin1(text.Value)...))
+		} else {
+			// Not compressed, no language tag and no translated keyword
+			chunk := append([]byte(text.Key), 0, 0, 0, 0, 0)
+			writePNGChunk(&out, "iTXt", append(chunk, text.Value...))
+		}
+	}
+	out.Write(data[headerEnd:])
+	return out.Bytes()
+}
+
+func writePNGChunk(out *bytes.Buffer, chunkType string, data []byte) {
+	binary.Write(out, binary.BigEndian, uint32(len(data)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(data)
+	out.WriteString(chunkType)
+	out.Write(data)
+	binary.Write(out, binary.BigEndian, crc.Sum32())
+}
+
+func isLatin1(text string) bool {
+	for _, r := range text {
+		if r > 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+func latin1(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		encoded = append(encoded, byte(r))
+	}
+	return encoded
+}
+
+// embedJPEGComment inserts a COM segment with a "key: value" line per entry after the SOI marker of an encoded JPEG
+func embedJPEGComment(data []byte, texts []imageText) []byte {
+	if len(texts) == 0 || len(data) < 2 {
+		return data
+	}
+	var lines []string
+	for _, text := range texts {
+		lines = append(lines, text.Key+": "+text.Value)
+	}
+	comment := []byte(strings.Join(lines, "\n"))
+	// The segment length counts its own two bytes and cannot exceed 65535
+	if len(comment) > 0xffff-2 {
+		comment = comment[:0xffff-2]
+	}
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write([]byte{0xff, 0xfe})
+	binary.Write(&out, binary.BigEndian, uint16(len(comment)+2))
+	out.Write(comment)
+	out.Write(data[2:])
+	return out.Bytes()
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// MetricsSettings turn on the metrics file, every run appends the time spent per module and configuration to it
+type MetricsSettings struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	File    string `json:"file,omitempty"`
+	MaxRuns int    `json:"maxRuns,omitempty"`
+}
+
+const defaultMetricsMaxRuns = 200
+
+// ConfigurationMetrics is one configuration of a run, a cached configuration was up to date and not rendered
+type ConfigurationMetrics struct {
+	Name       string  `json:"name"`
+	DurationMs float64 `json:"durationMs"`
+	Cached     bool    `json:"cached,omitempty"`
+	Failed     bool    `json:"failed,omitempty"`
+	Bytes      int64   `json:"bytes,omitempty"`
+	// StagesMs splits the duration of a rendered configuration by stage, see Stage
+	StagesMs map[string]float64 `json:"stagesMs,omitempty"`
+}
+
+// ModuleMetrics totals the configurations of a module in a run
+type ModuleMetrics struct {
+	Name           string                 `json:"name"`
+	DurationMs     float64                `json:"durationMs"`
+	Rendered       int                    `json:"rendered"`
+	CacheHits      int                    `json:"cacheHits"`
+	Failed         int                    `json:"failed"`
+	CacheHitRate   float64                `json:"cacheHitRate"`
+	Bytes          int64                  `json:"bytes"`
+	Configurations []ConfigurationMetrics `json:"configurations"`
+}
+
+// RunMetrics is a run with the build and machine it ran on, so runs before and after a change can be compared
+type RunMetrics struct {
+	Started      time.Time       `json:"started"`
+	Version      string          `json:"version"`
+	Commit       string          `json:"commit,omitempty"`
+	Host         string          `json:"host"`
+	CPUs         int             `json:"cpus"`
+	Workers      int             `json:"workers"`
+	Force        bool            `json:"force,omitempty"`
+	WallTimeMs   float64         `json:"wallTimeMs"`
+	Rendered     int             `json:"rendered"`
+	CacheHits    int             `json:"cacheHits"`
+	Failed       int             `json:"failed"`
+	CacheHitRate float64         `json:"cacheHitRate"`
+	Bytes        int64           `json:"bytes"`
+	Modules      []ModuleMetrics `json:"modules"`
+}
+
+// metricsHistory is the content of the metrics file, the oldest runs are dropped past maxRuns
+type metricsHistory struct {
+	Runs []RunMetrics `json:"runs"`
+}
+
+// getMetricsFilePath is the configured metrics file or Saved Games\MFDMF\metrics.json
+func getMetricsFilePath(settings MetricsSettings) string {
+	if settings.File != "" {
+		return settings.File
+	}
+	return filepath.Join(getSavedGamesFolder(), "MFDMF", "metrics.json")
+}
+
+// milliseconds is a duration as fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// hitRate is the share of the configurations whose cached output was up to date
+func hitRate(hits int, rendered int) float64 {
+	if hits+rendered == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+rendered)
+}
+
+// moduleMetrics returns the metrics of a module, callers hold the lock of the report
+func (r *RunReport) moduleMetrics(module string) *ModuleMetrics {
+	if r.modules == nil {
+		r.modules = make(map[string]*ModuleMetrics)
+	}
+	metrics, ok := r.modules[module]
+	if !ok {
+		metrics = &ModuleMetrics{Name: module}
+		r.modules[module] = metrics
+	}
+	return metrics
+}
+
+// ModuleFinished records how long a module took
+func (r *RunReport) ModuleFinished(module string, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.moduleMetrics(module).DurationMs = milliseconds(duration)
+}
+
+// Metrics returns the metrics of the run so far
+func (r *RunReport) Metrics() RunMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	build := currentBuild()
+	host, _ := os.Hostname()
+	run := RunMetrics{
+		Started:    r.started,
+		Version:    build.Version,
+		Commit:     build.Commit,
+		Host:       host,
+		CPUs:       runtime.NumCPU(),
+		Workers:    r.Workers,
+		Force:      r.Force,
+		WallTimeMs: milliseconds(time.Since(r.started)),
+	}
+	for _, module := range r.modules {
+		metrics := *module
+		metrics.CacheHitRate = hitRate(metrics.CacheHits, metrics.Rendered)
+		sort.Slice(metrics.Configurations, func(i, j int) bool {
+			return metrics.Configurations[i].Name < metrics.Configurations[j].Name
+		})
+		run.Rendered += metrics.Rendered
+		run.CacheHits += metrics.CacheHits
+		run.Failed += metrics.Failed
+		run.Bytes += metrics.Bytes
+		run.Modules = append(run.Modules, metrics)
+	}
+	run.CacheHitRate = hitRate(run.CacheHits, run.Rendered)
+	sort.Slice(run.Modules, func(i, j int) bool { return run.Modules[i].Name < run.Modules[j].Name })
+	return run
+}
+
+// SaveMetrics appends the run to the metrics file and drops the oldest runs past the limit
+func (r *RunReport) SaveMetrics(settings MetricsSettings) error {
+	fileName := getMetricsFilePath(settings)
+	history, err := readMetricsHistory(fileName)
+	if err != nil {
+		return err
+	}
+	history.Runs = append(history.Runs, r.Metrics())
+	maxRuns := settings.MaxRuns
+	if maxRuns <= 0 {
+		maxRuns = defaultMetricsMaxRuns
+	}
+	if len(history.Runs) > maxRuns {
+		history.Runs = history.Runs[len(history.Runs)-maxRuns:]
+	}
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ensurePathExists(filepath.Dir(fileName)); err != nil {
+		return err
+	}
+	// Another gomfd may read the file while this one writes it
+	temporary := fileName + ".tmp"
+	if err := os.WriteFile(longPath(temporary), data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(longPath(temporary), longPath(fileName))
+}
+
+// readMetricsHistory reads the metrics file, a file that does not exist yet has no runs
+func readMetricsHistory(fileName string) (metricsHistory, error) {
+	var history metricsHistory
+	data, err := os.ReadFile(longPath(fileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return history, nil
+	}
+	if err != nil {
+		return history, err
+	}
+	if err := json.Unmarshal(data, &history); err != nil {
+		return history, jsonError(fileName, data, err)
+	}
+	return history, nil
+}
+
+// writeMetrics lists the last runs, or the time one module took in them, oldest first
+func writeMetrics(out io.Writer, runs []RunMetrics, module string) {
+	const timeFormat = "2006-01-02 15:04"
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Started\tVersion\tHost\tCPUs\tRendered\tCache hits\tFailed\tSize\tTime")
+	for _, run := range runs {
+		rendered, hits, failed, size, duration := run.Rendered, run.CacheHits, run.Failed, run.Bytes, run.WallTimeMs
+		if module != "" {
+			found := false
+			for _, metrics := range run.Modules {
+				if strings.EqualFold(metrics.Name, module) {
+					rendered, hits, failed, size, duration = metrics.Rendered, metrics.CacheHits, metrics.Failed, metrics.Bytes, metrics.DurationMs
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%d\t%d (%.0f%%)\t%d\t%s\t%s\n", run.Started.Local().Format(timeFormat), run.Version, run.Host, run.CPUs,
+			rendered, hits, 100*hitRate(hits, rendered), failed, formatBytes(size), time.Duration(duration*float64(time.Millisecond)).Round(time.Millisecond))
+	}
+	writer.Flush()
+}
+
+func newMetricsCommand() *Command {
+	cmd := newCommand("metrics", "", "List the recorded runs with their cache hits, output size and time, enable the metrics setting to record them")
+	moduleName := cmd.Flags.String("mod", "", "Only show the time this module took in each run")
+	last := cmd.Flags.Int("n", 20, "How many of the most recent runs are listed, 0 lists all of them")
+	cmd.Run = func(args []string) error {
+		settings, err := LoadConfiguration(getConfigurationFilePath())
+		if err != nil {
+			return classify(ErrConfiguration, fmt.Errorf("error reading Configuration: %w", err))
+		}
+		fileName := getMetricsFilePath(settings.Metrics)
+		history, err := readMetricsHistory(fileName)
+		if err != nil {
+			return err
+		}
+		if len(history.Runs) == 0 {
+			if !settings.Metrics.Enabled {
+				return classify(ErrConfiguration, errors.New("no runs were recorded, set \"metrics\": {\"enabled\": true} in appsettings.json"))
+			}
+			return fmt.Errorf("no runs were recorded in %s yet", fileName)
+		}
+		runs := history.Runs
+		if *last > 0 && len(runs) > *last {
+			runs = runs[len(runs)-*last:]
+		}
+		writeMetrics(os.Stdout, runs, *moduleName)
+		return nil
+	}
+	return cmd
+}
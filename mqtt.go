@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttDefaultTopic prefixes every topic GOMFD publishes and subscribes to
+const mqttDefaultTopic = "gomfd"
+
+// MqttSettings connect display mode to an MQTT broker, it stays disconnected without a broker
+type MqttSettings struct {
+	Broker   string `json:"broker,omitempty"`
+	ClientID string `json:"clientId,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Topic    string `json:"topic,omitempty"`
+}
+
+// displayState is the retained message describing the page a display shows
+type displayState struct {
+	Module        string `json:"module"`
+	Display       string `json:"display"`
+	Configuration string `json:"configuration"`
+}
+
+// MqttBridge publishes the page of every display to <topic>/displays/<display>/state and
+// runs the page actions received on <topic>/displays/<display>/select
+type MqttBridge struct {
+	client mqtt.Client
+	topic  string
+}
+
+// activeMqtt is the bridge of display mode, nil unless a broker is configured
+var activeMqtt *MqttBridge
+
+// connectMqtt connects to the broker, the broker marks GOMFD offline on <topic>/status when the connection drops
+func connectMqtt(settings MqttSettings) (*MqttBridge, error) {
+	bridge := &MqttBridge{topic: strings.TrimSuffix(settings.Topic, "/")}
+	if bridge.topic == "" {
+		bridge.topic = mqttDefaultTopic
+	}
+	clientID := settings.ClientID
+	if clientID == "" {
+		clientID = "gomfd"
+	}
+	options := mqtt.NewClientOptions().
+		AddBroker(settings.Broker).
+		SetClientID(clientID).
+		SetUsername(settings.Username).
+		SetPassword(settings.Password).
+		SetAutoReconnect(true).
+		SetWill(bridge.topic+"/status", "offline", 1, true).
+		SetOnConnectHandler(bridge.onConnect).
+		SetConnectionLostHandler(func(client mqtt.Client, err error) {
+			instance.Warnf("Lost the MQTT connection to %s: %v", settings.Broker, err)
+		})
+	bridge.client = mqtt.NewClient(options)
+	token := bridge.client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		return nil, fmt.Errorf("timed out connecting to the MQTT broker %s", settings.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to the MQTT broker %s: %w", settings.Broker, err)
+	}
+	instance.Infof("Connected to the MQTT broker %s, publishing under %s", settings.Broker, bridge.topic)
+	return bridge, nil
+}
+
+// onConnect subscribes again after every reconnect
+func (b *MqttBridge) onConnect(client mqtt.Client) {
+	client.Publish(b.topic+"/status", 1, true, "online")
+	token := client.Subscribe(b.topic+"/displays/+/select", 1, b.onSelect)
+	if token.WaitTimeout(10*time.Second) && token.Error() != nil {
+		instance.Warnf("Failed to subscribe to %s/displays/+/select: %v", b.topic, token.Error())
+	}
+}
+
+// onSelect runs a page action, the payload is a configuration name, next, previous or a JSON page action
+func (b *MqttBridge) onSelect(client mqtt.Client, message mqtt.Message) {
+	display := strings.TrimSuffix(strings.TrimPrefix(message.Topic(), b.topic+"/displays/"), "/select")
+	action, err := parseSelectPayload(message.Payload())
+	if err != nil {
+		instance.Warnf("Ignoring the MQTT message on %s: %v", message.Topic(), err)
+		return
+	}
+	action.Display = display
+	if err := shownDisplays.Select(action); err != nil {
+		instance.Warnf("MQTT select on %s: %v", display, err)
+	}
+}
+
+func parseSelectPayload(payload []byte) (PageAction, error) {
+	text := strings.TrimSpace(string(payload))
+	action := PageAction{}
+	switch {
+	case text == "":
+		return action, fmt.Errorf("the payload is empty")
+	case strings.HasPrefix(text, "{"):
+		if err := json.Unmarshal([]byte(text), &action); err != nil {
+			return action, err
+		}
+	case strings.EqualFold(text, "next"), strings.EqualFold(text, "previous"):
+		action.Action = text
+	default:
+		action.Configuration = text
+	}
+	return action, nil
+}
+
+// PageChanged publishes the retained state of a display, it does not wait for the broker so it is safe on the window thread
+func (b *MqttBridge) PageChanged(module string, display string, configuration string) {
+	payload, err := json.Marshal(displayState{Module: module, Display: display, Configuration: configuration})
+	if err != nil {
+		return
+	}
+	b.client.Publish(b.topic+"/displays/"+display+"/state", 1, true, payload)
+}
+
+// PublishDisplays publishes the state of every window
+func (b *MqttBridge) PublishDisplays(windows []*DisplayWindow) {
+	for _, window := range windows {
+		b.PageChanged(window.Module, window.Display, window.Page().Configuration)
+	}
+}
+
+// Close marks GOMFD offline and disconnects
+func (b *MqttBridge) Close() {
+	b.client.Publish(b.topic+"/status", 1, true, "offline").WaitTimeout(2 * time.Second)
+	b.client.Disconnect(250)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// maxOSBLabels is the number of option select buttons around an MFD, five along each side
+const maxOSBLabels = 20
+
+// osbButtonCenters are the centers of the five buttons along a side as fractions of its length
+var osbButtonCenters = [5]float64{0.2, 0.35, 0.5, 0.65, 0.8}
+
+// osbLabels are the OSB labels of config or its nearest parent with some, with their color
+func osbLabels(config *Configuration) ([]string, color.NRGBA, error) {
+	for ; config != nil; config = config.Parent {
+		if len(config.OSBLabels) == 0 {
+			continue
+		}
+		if len(config.OSBLabels) > maxOSBLabels {
+			return nil, color.NRGBA{}, classify(ErrConfiguration, fmt.Errorf("%s has %d osbLabels, an MFD has %d buttons", config.Name, len(config.OSBLabels), maxOSBLabels))
+		}
+		labelColor := namedColors["white"]
+		if config.OSBLabelColor != "" {
+			var err error
+			if labelColor, err = parseColor(config.OSBLabelColor); err != nil {
+				return nil, labelColor, classify(ErrConfiguration, fmt.Errorf("osbLabelColor of %s: %v", config.Name, err))
+			}
+		}
+		return config.OSBLabels, labelColor, nil
+	}
+	return nil, color.NRGBA{}, nil
+}
+
+// osbAnchor is where the label of button index, counted from 0, is placed on an image of size and which fraction of
+// the label goes before that point horizontally and vertically, buttons 1 to 5 are along the top from the left, 6 to 10
+// down the right side, 11 to 15 along the bottom from the right and 16 to 20 up the left side
+func osbAnchor(index int, size image.Point, margin int) (image.Point, float64, float64) {
+	side, along := index/5, osbButtonCenters[index%5]
+	switch side {
+	case 0:
+		return image.Pt(int(along*float64(size.X)), margin), 0.5, 0
+	case 1:
+		return image.Pt(size.X-margin, int(along*float64(size.Y))), 1, 0.5
+	case 2:
+		return image.Pt(int((1-along)*float64(size.X)), size.Y-margin), 0.5, 1
+	default:
+		return image.Pt(margin, int((1-along)*float64(size.Y))), 0, 0.5
+	}
+}
+
+// drawOSBLabels writes the osbLabels of config next to the buttons around the edges of img, inside a bezel inset pixels
+// wide, on a black box, the fixed 7x13 font is scaled up by whole pixels with the size of the image so the labels stay
+// crisp, an empty label is skipped
+func drawOSBLabels(img draw.Image, config *Configuration, inset int) error {
+	labels, labelColor, err := osbLabels(config)
+	if err != nil || len(labels) == 0 {
+		return err
+	}
+	bounds := img.Bounds()
+	face := basicfont.Face7x13
+	factor := max(1, min(bounds.Dx(), bounds.Dy())/200)
+	for i, label := range labels {
+		if label == "" {
+			continue
+		}
+		// Draw the label at the size of the font with a pixel of box around it, then scale it up
+		text := image.NewRGBA(image.Rect(0, 0, font.MeasureString(face, label).Ceil()+2, face.Height+2))
+		fillCanvas(text, color.Black)
+		drawer := &font.Drawer{Dst: text, Src: image.NewUniform(labelColor), Face: face, Dot: fixed.P(1, 1+face.Ascent)}
+		drawer.DrawString(label)
+		size := text.Bounds().Size().Mul(factor)
+		anchor, alignX, alignY := osbAnchor(i, bounds.Size(), inset+2*factor)
+		at := bounds.Min.Add(anchor).Sub(image.Pt(int(alignX*float64(size.X)), int(alignY*float64(size.Y))))
+		xdraw.NearestNeighbor.Scale(img, image.Rectangle{Min: at, Max: at.Add(size)}, text, text.Bounds(), xdraw.Over, nil)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultOutputName names the cache file of a configuration after the configuration alone
+const defaultOutputName = "{config}"
+
+// outputNamePlaceholder matches a {name} of an outputName template
+var outputNamePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// outputNameFields are the values a template can use, root is the top level configuration whose size the composite has
+func outputNameFields(module Module, root Configuration, config Configuration) map[string]string {
+	size := func(value *int) string {
+		if value == nil {
+			return "0"
+		}
+		return strconv.Itoa(*value)
+	}
+	display := ""
+	if config.Display != nil {
+		display = config.Display.Name
+	}
+	return map[string]string{
+		"module":   module.Name,
+		"category": module.Category,
+		"tag":      module.Tag,
+		"root":     root.Name,
+		"config":   config.Name,
+		"display":  display,
+		"width":    size(root.Width),
+		"height":   size(root.Height),
+	}
+}
+
+// validateOutputName checks that a template only uses the known placeholders and names a file
+func validateOutputName(template string) error {
+	if template == "" {
+		return nil
+	}
+	fields := outputNameFields(Module{}, Configuration{}, Configuration{})
+	for _, placeholder := range outputNamePlaceholder.FindAllString(template, -1) {
+		if _, ok := fields[strings.Trim(placeholder, "{}")]; !ok {
+			return fmt.Errorf("outputName %q: unknown placeholder %s, use %s", template, placeholder, "{module}, {category}, {tag}, {root}, {config}, {display}, {width} or {height}")
+		}
+	}
+	if strings.ContainsAny(outputNamePlaceholder.ReplaceAllString(template, ""), `/\`) {
+		return fmt.Errorf("outputName %q names a file, not a folder", template)
+	}
+	return nil
+}
+
+// expandOutputName fills in a template, characters a file name cannot hold are replaced in the values
+func expandOutputName(template string, fields map[string]string) string {
+	if template == "" {
+		template = defaultOutputName
+	}
+	return outputNamePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value := fields[strings.Trim(placeholder, "{}")]
+		return strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`<>:"/\|?*`, r) || r < 32 {
+				return '_'
+			}
+			return r
+		}, value)
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// defaultOverlayBackground is the chroma-key green an overlay is drawn on without a background
+const defaultOverlayBackground = "#00ff00"
+
+// overlaySuffix is added to the name of a composite for its overlay, which is always a PNG
+const overlaySuffix = "_overlay.png"
+
+// OverlaySettings write every composite a second time as a PNG for a streaming overlay, fitted into width by height on
+// the background, a chroma-key color or transparent for real alpha, without a size it keeps the size of the composite
+type OverlaySettings struct {
+	Background string `json:"background,omitempty"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+}
+
+// overlayBackground is the background color of the overlay
+func (o *OverlaySettings) overlayBackground() (color.NRGBA, error) {
+	if o.Background == "" {
+		return parseColor(defaultOverlayBackground)
+	}
+	return parseColor(o.Background)
+}
+
+// validate checks the background and the size of the overlay settings
+func (o *OverlaySettings) validate() error {
+	if _, err := o.overlayBackground(); err != nil {
+		return fmt.Errorf("overlay background: %v", err)
+	}
+	if o.Width < 0 || o.Height < 0 {
+		return fmt.Errorf("overlay size %dx%d is negative", o.Width, o.Height)
+	}
+	return nil
+}
+
+// overlayImage fits img into the overlay size, centered on the background
+func (r *Renderer) overlayImage(img image.Image) (image.Image, error) {
+	background, err := r.overlay.overlayBackground()
+	if err != nil {
+		return nil, classify(ErrConfiguration, err)
+	}
+	source := img.Bounds().Size()
+	size := source
+	if r.overlay.Width > 0 {
+		size.X = r.overlay.Width
+	}
+	if r.overlay.Height > 0 {
+		size.Y = r.overlay.Height
+	}
+	if size != source && source.X > 0 && source.Y > 0 {
+		factor := min(float64(size.X)/float64(source.X), float64(size.Y)/float64(source.Y))
+		fitted := image.Pt(max(1, int(float64(source.X)*factor+0.5)), max(1, int(float64(source.Y)*factor+0.5)))
+		img = resizeImage(img, fitted.X, fitted.Y, r.filter, isDeepImage(img))
+	}
+	canvas := newCanvas(image.Rectangle{Max: size}, isDeepImage(img))
+	fillCanvas(canvas, background)
+	offset := size.Sub(img.Bounds().Size()).Div(2)
+	draw.Draw(canvas, img.Bounds().Sub(img.Bounds().Min).Add(offset), img, img.Bounds().Min, draw.Over)
+	return canvas, nil
+}
+
+// saveOverlay writes the overlay of a composite next to it when the overlay setting is on
+func (r *Renderer) saveOverlay(fileName string, config *Configuration, img image.Image) error {
+	if r.overlay == nil {
+		return nil
+	}
+	overlay, err := r.overlayImage(img)
+	if err != nil {
+		return err
+	}
+	return encodeImageFile(fileName+overlaySuffix, overlay, r.quality, outputMetadata(config)...)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// packageManifestName is the manifest at the root of a module package, packageFormat its layout version
+const (
+	packageManifestName = "manifest.json"
+	packageFormat       = 1
+)
+
+// PackageManifest describes a module package, ModuleFile and Files are the paths of the module JSON, its script and
+// its images inside the archive, the images below images/ as the fileName of the module names them, Checksums holds
+// the SHA-256 of each of them
+type PackageManifest struct {
+	Format      int               `json:"format"`
+	Module      string            `json:"module"`
+	DisplayName string            `json:"displayName,omitempty"`
+	Category    string            `json:"category"`
+	Version     string            `json:"version,omitempty"`
+	Generator   string            `json:"generator"`
+	ModuleFile  string            `json:"moduleFile"`
+	Files       []string          `json:"files"`
+	Checksums   map[string]string `json:"checksums"`
+}
+
+// packagedImageName is the name an image is installed under, relative to filePath, an absolute path below an image
+// root is made relative to it and any other absolute path keeps only its file name
+func packagedImageName(settings *MfdConfig, module string, fileName string) string {
+	name := strings.ReplaceAll(fileName, "\\", "/")
+	if !filepath.IsAbs(fileName) && !path.IsAbs(name) && !strings.Contains(name, ":") {
+		return name
+	}
+	for _, root := range imageRoots(settings, module) {
+		if root != "" && isPathInside(root, fileName) {
+			if relative, err := filepath.Rel(root, fileName); err == nil {
+				return strings.ReplaceAll(relative, "\\", "/")
+			}
+		}
+	}
+	return path.Base(name)
+}
+
+// tokenNames are the image names a name with THROTTLE or SEAT stands for, the name itself without them
+func tokenNames(name string, seats []string) []string {
+	names := []string{name}
+	expand := func(token string, values []string) {
+		if !strings.Contains(name, token) {
+			return
+		}
+		var expanded []string
+		for _, name := range names {
+			for _, value := range values {
+				expanded = append(expanded, strings.ReplaceAll(name, token, value))
+			}
+		}
+		names = expanded
+	}
+	expand("THROTTLE", throttleTokens)
+	expand("SEAT", seats)
+	return names
+}
+
+// packageContents reads the module from its module file as written, with its fileNames made relative, and the images
+// and script it needs by their path in the archive
+func packageContents(settings *MfdConfig, module *Module) (map[string]any, map[string]string, error) {
+	data, err := os.ReadFile(longPath(module.SourceFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keep the numbers as they are written
+	decoder.UseNumber()
+	var file struct {
+		Modules []map[string]any `json:"modules"`
+	}
+	if err := decoder.Decode(&file); err != nil {
+		return nil, nil, jsonError(module.SourceFile, data, err)
+	}
+	var definition map[string]any
+	for _, candidate := range file.Modules {
+		if candidate["name"] == module.Name {
+			definition = candidate
+		}
+	}
+	if definition == nil {
+		return nil, nil, classify(ErrConfiguration, fmt.Errorf("module %s is not in %s", module.Name, module.SourceFile))
+	}
+
+	files := make(map[string]string)
+	var problems []error
+	var rewrite func(object map[string]any)
+	rewrite = func(object map[string]any) {
+		if fileName, ok := object["fileName"].(string); ok && fileName != "" && !hasScheme(fileName) {
+			name := packagedImageName(settings, module.Name, fileName)
+			if strings.HasPrefix(path.Clean(name), "../") {
+				problems = append(problems, fmt.Errorf("image %s is outside the image folders", fileName))
+			} else {
+				object["fileName"] = name
+				originals := tokenNames(fileName, module.Seats)
+				for i, packaged := range tokenNames(name, module.Seats) {
+					source := resolveImagePath(settings, module.Name, originals[i])
+					if !fileExists(source) {
+						problems = append(problems, fmt.Errorf("image %s was not found", source))
+						continue
+					}
+					files["images/"+path.Clean(packaged)] = source
+				}
+			}
+		}
+		for _, key := range []string{"configurations", "subConfigDef"} {
+			children, _ := object[key].([]any)
+			for _, child := range children {
+				if child, ok := child.(map[string]any); ok {
+					rewrite(child)
+				}
+			}
+		}
+	}
+	rewrite(definition)
+	if script := moduleScriptPath(module); script != "" {
+		definition["script"] = filepath.Base(script)
+		files["module/"+filepath.Base(script)] = script
+	}
+	if len(problems) > 0 {
+		return nil, nil, classify(ErrInputImage, fmt.Errorf("module %s cannot be packed: %w", module.Name, errors.Join(problems...)))
+	}
+	return definition, files, nil
+}
+
+// packModule writes the module as a zip with its manifest, its module JSON and the images and script it uses, a key
+// signs the manifest
+func packModule(settings *MfdConfig, module *Module, version string, key ed25519.PrivateKey, w io.Writer) (PackageManifest, error) {
+	manifest := PackageManifest{
+		Format:      packageFormat,
+		Module:      module.Name,
+		DisplayName: module.DisplayName,
+		Category:    filepath.ToSlash(module.Category),
+		Version:     version,
+		Generator:   "GOMFD " + currentBuild().Version,
+		ModuleFile:  "module/" + filepath.Base(module.SourceFile),
+		Checksums:   make(map[string]string),
+	}
+	definition, files, err := packageContents(settings, module)
+	if err != nil {
+		return manifest, err
+	}
+	moduleJSON, err := json.MarshalIndent(map[string]any{"modules": []any{definition}}, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	contents := map[string][]byte{manifest.ModuleFile: moduleJSON}
+	for name, source := range files {
+		if contents[name], err = os.ReadFile(longPath(source)); err != nil {
+			return manifest, err
+		}
+		manifest.Files = append(manifest.Files, name)
+	}
+	sort.Strings(manifest.Files)
+	for name, data := range contents {
+		manifest.Checksums[name] = sha256Hex(data)
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+
+	archive := zip.NewWriter(w)
+	add := func(name string, data []byte) error {
+		entry, err := archive.Create(name)
+		if err == nil {
+			_, err = entry.Write(data)
+		}
+		return err
+	}
+	if err := add(packageManifestName, manifestJSON); err != nil {
+		return manifest, err
+	}
+	if key != nil {
+		if err := add(packageSignatureName, []byte(signManifest(key, manifestJSON))); err != nil {
+			return manifest, err
+		}
+	}
+	for _, name := range append([]string{manifest.ModuleFile}, manifest.Files...) {
+		if err := add(name, contents[name]); err != nil {
+			return manifest, err
+		}
+	}
+	return manifest, archive.Close()
+}
+
+func newPackCommand() *Command {
+	cmd := newCommand("pack", "", "Pack -mod with its images and script into a zip that gomfd install sets up elsewhere")
+	moduleName := cmd.Flags.String("mod", "", "Module to pack")
+	fileName := cmd.Flags.String("o", "", "Package to write, defaults to <module>.zip")
+	version := cmd.Flags.String("version", "", "Version of the module written to the manifest, such as 1.2.0")
+	keyFile := cmd.Flags.String("sign", "", "Sign the package with the private key file gomfd keygen wrote")
+	cmd.Run = func(args []string) error {
+		if *moduleName == "" {
+			return errors.New("pack needs -mod")
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		modules := filterModules(env.Modules, Selection{ModuleName: *moduleName})
+		if len(modules) == 0 {
+			return classify(ErrConfiguration, fmt.Errorf("module %s was not found in %s", *moduleName, env.Config.Modules))
+		}
+		module := modules[0]
+		if *fileName == "" {
+			*fileName = module.Name + ".zip"
+		}
+		var key ed25519.PrivateKey
+		if *keyFile != "" {
+			if key, err = readSigningKey(*keyFile); err != nil {
+				return err
+			}
+		}
+		var archive bytes.Buffer
+		manifest, err := packModule(env.Config, &module, *version, key, &archive)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(longPath(*fileName), archive.Bytes(), 0644); err != nil {
+			return classify(ErrEncode, fmt.Errorf("failed to write %s: %w", *fileName, err))
+		}
+		instance.Infof("Packed %s with %d files into %s", module.Name, len(manifest.Files), *fileName)
+		return nil
+	}
+	return cmd
+}
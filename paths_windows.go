@@ -0,0 +1,27 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxDirectoryPath is the longest path Windows accepts without the \\?\ prefix, MAX_PATH minus room for an 8.3 file name
+const maxDirectoryPath = 248
+
+// longPath is the \\?\ extended-length form of a path reaching MAX_PATH, relative paths are made absolute first because
+// the prefix only works on clean absolute paths, older Go releases only extended absolute paths themselves
+func longPath(path string) string {
+	if path == "" || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	absolute, err := filepath.Abs(path)
+	// The length is counted in bytes, a UTF-8 path is never shorter than its UTF-16 form so non-ASCII paths are
+	// extended early rather than late
+	if err != nil || len(absolute) < maxDirectoryPath {
+		return path
+	}
+	if strings.HasPrefix(absolute, `\\`) {
+		return `\\?\UNC\` + absolute[2:]
+	}
+	return `\\?\` + absolute
+}
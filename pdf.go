@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pdfPageWidth and pdfPageHeight are an A4 page in points, pdfMargin surrounds the label and the image
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 36
+	pdfLabelSize  = 14
+)
+
+// pdfPage is a labeled composite, JPEG is the cached file embedded as it is
+type pdfPage struct {
+	Label  string
+	JPEG   []byte
+	Width  int
+	Height int
+	Gray   bool
+}
+
+// pdfWriter numbers the objects of a PDF and remembers where each starts for the cross-reference table
+type pdfWriter struct {
+	out     bytes.Buffer
+	offsets []int
+}
+
+// object starts the next object and returns its number, objects are numbered from 1
+func (p *pdfWriter) object() int {
+	p.offsets = append(p.offsets, p.out.Len())
+	number := len(p.offsets)
+	fmt.Fprintf(&p.out, "%d 0 obj\n", number)
+	return number
+}
+
+func (p *pdfWriter) stream(dictionary string, data []byte) {
+	fmt.Fprintf(&p.out, "<< %s >>\nstream\n", strings.TrimSpace(fmt.Sprintf("%s /Length %d", dictionary, len(data))))
+	p.out.Write(data)
+	p.out.WriteString("\nendstream\nendobj\n")
+}
+
+// pdfText escapes text for a PDF string shown in a standard font, characters outside printable ASCII become ?
+func pdfText(text string) string {
+	var escaped strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			escaped.WriteRune('\\')
+			escaped.WriteRune(r)
+		case r < 32 || r > 126:
+			escaped.WriteRune('?')
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+	return escaped.String()
+}
+
+// writePDF writes an A4 page per composite with its label above it, the image is fitted into the rest of the page
+func writePDF(w io.Writer, pages []pdfPage) error {
+	if len(pages) == 0 {
+		return errors.New("there are no pages")
+	}
+	p := &pdfWriter{}
+	p.out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// The catalog, the page tree and the font come first so the pages can refer to them by number
+	const catalog, tree, font = 1, 2, 3
+	p.object()
+	fmt.Fprintf(&p.out, "<< /Type /Catalog /Pages %d 0 R >>\nendobj\n", tree)
+	p.object()
+	var kids []string
+	for i := range pages {
+		// Every page is three objects, the page, its content and its image, following the font
+		kids = append(kids, fmt.Sprintf("%d 0 R", font+1+3*i))
+	}
+	fmt.Fprintf(&p.out, "<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(pages))
+	p.object()
+	p.out.WriteString("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>\nendobj\n")
+
+	for _, page := range pages {
+		pageObject := p.object()
+		fmt.Fprintf(&p.out, "<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R >> /XObject << /Im1 %d 0 R >> >> /Contents %d 0 R >>\nendobj\n",
+			tree, pdfPageWidth, pdfPageHeight, font, pageObject+2, pageObject+1)
+
+		// Fit the image below the label keeping its aspect ratio, centered horizontally
+		areaWidth := float64(pdfPageWidth - 2*pdfMargin)
+		areaHeight := float64(pdfPageHeight - 2*pdfMargin - 2*pdfLabelSize)
+		scale := min(areaWidth/float64(page.Width), areaHeight/float64(page.Height))
+		width, height := float64(page.Width)*scale, float64(page.Height)*scale
+		x := (pdfPageWidth - width) / 2
+		y := pdfPageHeight - pdfMargin - 2*pdfLabelSize - height
+		content := fmt.Sprintf("BT /F1 %d Tf %d %d Td (%s) Tj ET\nq %.2f 0 0 %.2f %.2f %.2f cm /Im1 Do Q\n",
+			pdfLabelSize, pdfMargin, pdfPageHeight-pdfMargin-pdfLabelSize, pdfText(page.Label), width, height, x, y)
+		p.object()
+		p.stream("", []byte(content))
+
+		colorSpace := "/DeviceRGB"
+		if page.Gray {
+			colorSpace = "/DeviceGray"
+		}
+		p.object()
+		p.stream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode", page.Width, page.Height, colorSpace), page.JPEG)
+	}
+
+	xref := p.out.Len()
+	fmt.Fprintf(&p.out, "xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, offset := range p.offsets {
+		fmt.Fprintf(&p.out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&p.out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, catalog, xref)
+	_, err := w.Write(p.out.Bytes())
+	return err
+}
+
+// readPDFPage reads a cached JPEG composite and its size for a page
+func readPDFPage(fileName string, label string) (pdfPage, error) {
+	data, err := os.ReadFile(longPath(fileName))
+	if err != nil {
+		return pdfPage{}, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return pdfPage{}, err
+	}
+	if format != "jpeg" {
+		return pdfPage{}, fmt.Errorf("%s is not a JPEG", fileName)
+	}
+	return pdfPage{Label: label, JPEG: data, Width: config.Width, Height: config.Height, Gray: config.ColorModel == color.GrayModel}, nil
+}
+
+// exportPDF writes the cached composites of the module into one PDF in tree order, a page per configuration labeled
+// with the module and the configuration path
+func exportPDF(env *Environment, module *Module, selection Selection, fileName string) (int, error) {
+	files := generateConfigToFileMap(env.Config, *module)
+	title := module.DisplayName
+	if title == "" {
+		title = module.Name
+	}
+	var pages []pdfPage
+	for _, config := range kneeboardConfigurations(module, selection) {
+		path := configurationPath(config)
+		page, err := readPDFPage(files[path]+".jpg", fmt.Sprintf("%s - %s (%dx%d)", title, path, *config.Width, *config.Height))
+		if err != nil {
+			instance.Warnf("Skipping %s, it has no composite: %v", config.Name, err)
+			continue
+		}
+		pages = append(pages, page)
+	}
+	if len(pages) == 0 {
+		return 0, fmt.Errorf("module %s has no composites to export", module.Name)
+	}
+	var document bytes.Buffer
+	if err := writePDF(&document, pages); err != nil {
+		return 0, err
+	}
+	if err := ensurePathExists(filepath.Dir(fileName)); err != nil {
+		return 0, classify(ErrEncode, err)
+	}
+	if err := os.WriteFile(longPath(fileName), document.Bytes(), 0644); err != nil {
+		return 0, classify(ErrEncode, fmt.Errorf("failed to write %s: %w", fileName, err))
+	}
+	instance.Infof("Exported %d pages of %s to %s", len(pages), module.Name, fileName)
+	return len(pages), nil
+}
+
+func newPDFCommand() *Command {
+	cmd := newCommand("pdf", "", "Export the selected composites of each module as a PDF with a labeled page per configuration, for printing or review")
+	selectionArgs := addSelectionFlags(cmd.Flags)
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	folder := cmd.Flags.String("dir", ".", "Folder the <module>.pdf files are written to")
+	cmd.Run = func(args []string) error {
+		selection, err := selectionArgs.Selection()
+		if err != nil {
+			return err
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		ctx, stop := interruptContext()
+		defer stop()
+		// Bring the cache up to date, the pages are made from the cached composites
+		if _, _, err := generateModules(ctx, env, selection, NewRunReport(*runOptions)); err != nil {
+			return err
+		}
+		var failed []string
+		for _, module := range filterModules(env.Modules, selection) {
+			prepareModule(&module, env)
+			if _, err := exportPDF(env, &module, selection, filepath.Join(*folder, module.Name+".pdf")); err != nil {
+				instance.Error(err.Error())
+				failed = append(failed, module.Name)
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("the PDF of %s could not be exported", strings.Join(failed, ", "))
+		}
+		return nil
+	}
+	return cmd
+}
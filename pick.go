@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// offsetKeys are the module file keys pick writes, in the order they are added to a configuration without them
+var offsetKeys = []string{"xOffsetStart", "xOffsetFinish", "yOffsetStart", "yOffsetFinish"}
+
+// jsonNode is a value of a JSON document with the span of its text, keyStarts and keyEnds are the spans of the keys of
+// an object so its members can be edited without rewriting the rest of the file
+type jsonNode struct {
+	start, end int
+	value      any
+	keys       []string
+	keyStarts  []int
+	keyEnds    []int
+	members    []*jsonNode
+	items      []*jsonNode
+}
+
+// parseJSONNode reads the next value of the decoder with the spans of its text in data
+func parseJSONNode(decoder *json.Decoder, data []byte) (*jsonNode, error) {
+	span := func() (any, int, int, error) {
+		before := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		// The separators before a token are read with it
+		end := int(decoder.InputOffset())
+		text := strings.TrimLeft(string(data[before:end]), " \t\r\n:,")
+		return token, end - len(text), end, nil
+	}
+	token, start, end, err := span()
+	if err != nil {
+		return nil, err
+	}
+	node := &jsonNode{start: start, end: end, value: token}
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return node, nil
+	}
+	for decoder.More() {
+		if delim == '{' {
+			key, keyStart, keyEnd, err := span()
+			if err != nil {
+				return nil, err
+			}
+			node.keys = append(node.keys, key.(string))
+			node.keyStarts = append(node.keyStarts, keyStart)
+			node.keyEnds = append(node.keyEnds, keyEnd)
+		}
+		child, err := parseJSONNode(decoder, data)
+		if err != nil {
+			return nil, err
+		}
+		if delim == '{' {
+			node.members = append(node.members, child)
+		} else {
+			node.items = append(node.items, child)
+		}
+	}
+	if _, _, node.end, err = span(); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// member is the value of key in an object, matched without case like encoding/json does
+func (n *jsonNode) member(key string) (*jsonNode, int) {
+	if n == nil {
+		return nil, -1
+	}
+	for i, name := range n.keys {
+		if strings.EqualFold(name, key) {
+			return n.members[i], i
+		}
+	}
+	return nil, -1
+}
+
+// stringValue is the string of a node, empty for any other value
+func (n *jsonNode) stringValue() string {
+	if n == nil {
+		return ""
+	}
+	value, _ := n.value.(string)
+	return value
+}
+
+// findConfigurationNode finds the object of the configuration in the module of a module file, depth first through
+// configurations and subConfigDef
+func findConfigurationNode(root *jsonNode, module string, name string) *jsonNode {
+	var find func(object *jsonNode) *jsonNode
+	find = func(object *jsonNode) *jsonNode {
+		for _, key := range []string{"configurations", "subConfigDef"} {
+			children, _ := object.member(key)
+			if children == nil {
+				continue
+			}
+			for _, child := range children.items {
+				nameNode, _ := child.member("name")
+				if strings.EqualFold(nameNode.stringValue(), name) {
+					return child
+				}
+				if found := find(child); found != nil {
+					return found
+				}
+			}
+		}
+		return nil
+	}
+	modules, _ := root.member("modules")
+	if modules == nil {
+		return nil
+	}
+	for _, candidate := range modules.items {
+		if nameNode, _ := candidate.member("name"); nameNode.stringValue() == module {
+			return find(candidate)
+		}
+	}
+	return nil
+}
+
+// setJSONNumbers replaces the values of the keys in the object, a missing key is added after the last member with the
+// separator and colon spacing the members are written with
+func setJSONNumbers(data []byte, object *jsonNode, keys []string, values []int) []byte {
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	var added strings.Builder
+	last := len(object.members) - 1
+	for i, key := range keys {
+		if value, _ := object.member(key); value != nil {
+			edits = append(edits, edit{value.start, value.end, strconv.Itoa(values[i])})
+			continue
+		}
+		separator, colon := ", ", ": "
+		if last >= 0 {
+			colon = string(data[object.keyEnds[last]:object.members[last].start])
+		}
+		if last >= 1 {
+			separator = string(data[object.members[last-1].end:object.keyStarts[last]])
+		}
+		fmt.Fprintf(&added, "%s%q%s%d", separator, key, colon, values[i])
+	}
+	if added.Len() > 0 && last >= 0 {
+		end := object.members[last].end
+		edits = append(edits, edit{end, end, added.String()})
+	}
+	// Edit from the end so the earlier spans stay where they are
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		data = slices.Replace(data, e.start, e.end, []byte(e.text)...)
+	}
+	return data
+}
+
+// writeModuleOffsets writes the crop of the configuration into its module file, only the four offsets change
+func writeModuleOffsets(module *Module, configuration string, crop image.Rectangle) error {
+	data, err := os.ReadFile(longPath(module.SourceFile))
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	root, err := parseJSONNode(decoder, data)
+	if err != nil {
+		return jsonError(module.SourceFile, data, err)
+	}
+	object := findConfigurationNode(root, module.Name, configuration)
+	if object == nil {
+		return classify(ErrConfiguration, fmt.Errorf("configuration %s of module %s is not written in %s", configuration, module.Name, module.SourceFile))
+	}
+	data = setJSONNumbers(data, object, offsetKeys, []int{crop.Min.X, crop.Max.X, crop.Min.Y, crop.Max.Y})
+	return os.WriteFile(longPath(module.SourceFile), data, 0644)
+}
+
+// findPreparedConfiguration finds a configuration of a prepared module by name, depth first
+func findPreparedConfiguration(configs []Configuration, name string) *Configuration {
+	for i := range configs {
+		if strings.EqualFold(configs[i].Name, name) {
+			return &configs[i]
+		}
+		if found := findPreparedConfiguration(configs[i].Configurations, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+var pickTemplate = template.Must(template.New("pick").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Configuration}} - GOMFD pick</title>
+<style>
+body { background: #111; color: #ddd; font-family: sans-serif; margin: 0; }
+#bar { padding: .5em 1em; }
+#bar input { width: 5em; }
+#stage { position: relative; display: inline-block; margin: 0 1em; }
+#stage img { display: block; max-width: calc(100vw - 2em); max-height: calc(100vh - 4em); }
+#stage canvas { position: absolute; left: 0; top: 0; cursor: crosshair; }
+small { color: #888; }
+</style>
+</head>
+<body>
+<div id="bar">
+{{.Module}} / {{.Configuration}} <small>{{.FileName}}, {{.ImageWidth}}x{{.ImageHeight}}, output {{.Width}}x{{.Height}}, drag a rectangle, Shift keeps the output aspect</small><br>
+x <input id="x0" type="number"> to <input id="x1" type="number">
+y <input id="y0" type="number"> to <input id="y1" type="number">
+<button id="save">Save</button> <span id="status"></span>
+</div>
+<div id="stage"><img id="source" src="/source" alt=""><canvas id="overlay"></canvas></div>
+<script>
+const output = {w: {{.Width}}, h: {{.Height}}};
+let crop = {x0: {{.X0}}, x1: {{.X1}}, y0: {{.Y0}}, y1: {{.Y1}}};
+const img = document.getElementById("source"), canvas = document.getElementById("overlay"), ctx = canvas.getContext("2d");
+const status = document.getElementById("status");
+const fields = ["x0", "x1", "y0", "y1"].map(id => document.getElementById(id));
+const scale = () => img.naturalWidth / img.clientWidth;
+const clamp = (v, max) => Math.max(0, Math.min(max, v));
+function draw() {
+  canvas.width = img.clientWidth;
+  canvas.height = img.clientHeight;
+  const s = scale(), x = crop.x0 / s, y = crop.y0 / s, w = (crop.x1 - crop.x0) / s, h = (crop.y1 - crop.y0) / s;
+  ctx.fillStyle = "rgba(0, 0, 0, .6)";
+  ctx.fillRect(0, 0, canvas.width, canvas.height);
+  ctx.clearRect(x, y, w, h);
+  ctx.strokeStyle = "#0f0";
+  ctx.strokeRect(x + .5, y + .5, w, h);
+  fields.forEach(f => f.value = crop[f.id]);
+}
+function point(e) {
+  const r = canvas.getBoundingClientRect(), s = scale();
+  return {x: clamp(Math.round((e.clientX - r.left) * s), img.naturalWidth), y: clamp(Math.round((e.clientY - r.top) * s), img.naturalHeight)};
+}
+let anchor = null;
+canvas.addEventListener("pointerdown", e => { anchor = point(e); canvas.setPointerCapture(e.pointerId); });
+canvas.addEventListener("pointermove", e => {
+  if (!anchor) return;
+  const p = point(e);
+  if (e.shiftKey && output.w > 0) {
+    const h = Math.round(Math.abs(p.x - anchor.x) * output.h / output.w);
+    p.y = clamp(anchor.y + (p.y < anchor.y ? -h : h), img.naturalHeight);
+  }
+  crop = {x0: Math.min(anchor.x, p.x), x1: Math.max(anchor.x, p.x), y0: Math.min(anchor.y, p.y), y1: Math.max(anchor.y, p.y)};
+  status.textContent = "";
+  draw();
+});
+canvas.addEventListener("pointerup", () => anchor = null);
+fields.forEach(f => f.addEventListener("change", () => { crop[f.id] = parseInt(f.value, 10) || 0; draw(); }));
+document.getElementById("save").addEventListener("click", async () => {
+  const response = await fetch("/offsets", {method: "POST", headers: {"Content-Type": "application/json"},
+    body: JSON.stringify({xOffsetStart: crop.x0, xOffsetFinish: crop.x1, yOffsetStart: crop.y0, yOffsetFinish: crop.y1})});
+  status.textContent = response.ok ? "Saved" : await response.text();
+});
+img.addEventListener("load", draw);
+window.addEventListener("resize", draw);
+</script>
+</body>
+</html>`))
+
+// pickServer serves the source image of the configuration with a rectangle tool that writes the crop into the module file
+func pickServer(module *Module, config *Configuration, source image.Image) http.Handler {
+	bounds := source.Bounds()
+	crop := config.GetCropRect()
+	size := config.GetSize()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := pickTemplate.Execute(w, map[string]any{
+			"Module": module.Name, "Configuration": config.Name, "FileName": config.FileName,
+			"ImageWidth": bounds.Dx(), "ImageHeight": bounds.Dy(), "Width": size.X, "Height": size.Y,
+			"X0": crop.Min.X, "X1": crop.Max.X, "Y0": crop.Min.Y, "Y1": crop.Max.Y,
+		})
+		if err != nil {
+			instance.Warnf("Failed to write the picker: %v", err)
+		}
+	})
+	mux.HandleFunc("/source", func(w http.ResponseWriter, r *http.Request) {
+		// Served as a PNG so the browser shows every format GOMFD reads
+		w.Header().Set("Content-Type", "image/png")
+		encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+		if err := encoder.Encode(w, source); err != nil {
+			instance.Warnf("Failed to send %s: %v", config.FileName, err)
+		}
+	})
+	mux.HandleFunc("/offsets", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST the offsets", http.StatusMethodNotAllowed)
+			return
+		}
+		var offsets Offsets
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&offsets); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if offsets.XOffsetStart == nil || offsets.XOffsetFinish == nil || offsets.YOffsetStart == nil || offsets.YOffsetFinish == nil {
+			http.Error(w, "all four offsets are needed", http.StatusBadRequest)
+			return
+		}
+		picked := image.Rect(*offsets.XOffsetStart, *offsets.YOffsetStart, *offsets.XOffsetFinish, *offsets.YOffsetFinish)
+		if picked.Empty() || !picked.In(bounds.Sub(bounds.Min)) {
+			http.Error(w, fmt.Sprintf("the crop %v is empty or outside the %dx%d image", picked, bounds.Dx(), bounds.Dy()), http.StatusBadRequest)
+			return
+		}
+		if err := writeModuleOffsets(module, config.Name, picked); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		instance.Infof("Wrote the crop %v of %s to %s", picked, config.Name, module.SourceFile)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func newPickCommand() *Command {
+	cmd := newCommand("pick", "", "Open the source image of -mod -sub in the browser, drag the crop and save its offsets into the module file")
+	moduleName := cmd.Flags.String("mod", "", "Module of the configuration")
+	configurationName := cmd.Flags.String("sub", "", "Configuration to pick the crop of")
+	address := cmd.Flags.String("addr", "localhost:8083", "Address the picker is served on")
+	cmd.Run = func(args []string) error {
+		if *moduleName == "" || *configurationName == "" {
+			return errors.New("pick needs both -mod and -sub")
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		modules := filterModules(env.Modules, Selection{ModuleName: *moduleName})
+		if len(modules) == 0 {
+			return classify(ErrConfiguration, fmt.Errorf("module %s was not found in %s", *moduleName, env.Config.Modules))
+		}
+		module := modules[0]
+		prepareModule(&module, env)
+		config := findPreparedConfiguration(module.Configurations, *configurationName)
+		if config == nil {
+			return classify(ErrConfiguration, fmt.Errorf("configuration %s was not found in module %s", *configurationName, module.Name))
+		}
+		source, err := loadImageFile(config.FileName)
+		if err != nil {
+			return classify(ErrInputImage, fmt.Errorf("failed to read the image of %s: %w", config.Name, err))
+		}
+		url := "http://" + *address + "/"
+		instance.Infof("Picking the crop of %s on %s, press Ctrl+C to stop", config.Name, url)
+		served := make(chan error, 1)
+		go func() {
+			served <- http.ListenAndServe(*address, pickServer(&module, config, source))
+		}()
+		if err := openInViewer(url); err != nil {
+			instance.Warnf("Open %s in a browser: %v", url, err)
+		}
+		return <-served
+	}
+	return cmd
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// placeholderSquare is the size of the squares of the placeholder checkerboard
+const placeholderSquare = 16
+
+var placeholderColors = [2]color.NRGBA{{R: 255, G: 0, B: 255, A: 255}, {R: 32, G: 32, B: 32, A: 255}}
+
+// placeholderImage stands in for a missing source image, a magenta checkerboard of the size of the configuration with lines
+// centered on it, the lines that do not fit are left out
+func placeholderImage(width int, height int, lines ...string) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y += placeholderSquare {
+		for x := 0; x < width; x += placeholderSquare {
+			square := image.Rect(x, y, x+placeholderSquare, y+placeholderSquare).Intersect(img.Bounds())
+			draw.Draw(img, square, &image.Uniform{C: placeholderColors[(x/placeholderSquare+y/placeholderSquare)%2]}, image.Point{}, draw.Src)
+		}
+	}
+
+	face := basicfont.Face7x13
+	lineHeight := face.Metrics().Height.Ceil() + 4
+	for len(lines) > 0 && len(lines)*lineHeight > height {
+		lines = lines[:len(lines)-1]
+	}
+	drawer := &font.Drawer{Dst: img, Src: image.NewUniform(WhiteColor), Face: face}
+	top := (height - len(lines)*lineHeight) / 2
+	for i, line := range lines {
+		textWidth := drawer.MeasureString(line).Ceil()
+		left := (width - textWidth) / 2
+		if left < 2 {
+			left = 2
+		}
+		// A dark band behind the text keeps it readable on both colors of the checkerboard
+		band := image.Rect(left-2, top+i*lineHeight, left+textWidth+2, top+(i+1)*lineHeight).Intersect(img.Bounds())
+		draw.Draw(img, band, &image.Uniform{C: BlackColor}, image.Point{}, draw.Src)
+		drawer.Dot = fixed.Point26_6{X: fixed.I(left), Y: fixed.I(top + i*lineHeight + 2 + face.Metrics().Ascent.Ceil())}
+		drawer.DrawString(line)
+	}
+	return img
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// PlanRect is a crop rectangle in pixels of the source image, named like the offsets of the module files
+type PlanRect struct {
+	XOffsetStart  int `json:"xOffsetStart"`
+	XOffsetFinish int `json:"xOffsetFinish"`
+	YOffsetStart  int `json:"yOffsetStart"`
+	YOffsetFinish int `json:"yOffsetFinish"`
+}
+
+// PlanEntry is one image a run writes, the source and crop it is read from, the size it is resized to and where it is
+// drawn, on the composite of its parent for a sub-configuration or on its display for a top level configuration
+type PlanEntry struct {
+	Module        string   `json:"module"`
+	Configuration string   `json:"configuration"`
+	DrawnOn       string   `json:"drawnOn,omitempty"`
+	Source        string   `json:"source"`
+	Crop          PlanRect `json:"crop"`
+	Width         int      `json:"width"`
+	Height        int      `json:"height"`
+	Left          int      `json:"left"`
+	Top           int      `json:"top"`
+	Outputs       []string `json:"outputs"`
+	UpToDate      bool     `json:"upToDate"`
+}
+
+// RunPlan is everything generate would render for a selection once the modules are enriched, see -plan-json
+type RunPlan struct {
+	Cache          string      `json:"cache"`
+	Configurations []PlanEntry `json:"configurations"`
+}
+
+// planEntry describes the render of config, or of its sub-configuration at subIndex drawn centered on it
+func (rc *RenderContext) planEntry(config *Configuration, subIndex int) PlanEntry {
+	target := config
+	position := config.GetDrawingArea().Min
+	drawnOn := ""
+	if config.Display != nil {
+		drawnOn = config.Display.Name
+	}
+	if subIndex >= 0 {
+		target = &config.Configurations[subIndex]
+		position = config.GetSize().Sub(target.GetSize()).Div(2)
+		drawnOn = configurationPath(config)
+	}
+	outputFile, extensions, upToDate := rc.outputStatus(config, target)
+	entry := PlanEntry{
+		Module:        moduleName(config),
+		Configuration: configurationPath(target),
+		DrawnOn:       drawnOn,
+		Source:        target.FileName,
+		Width:         target.GetSize().X,
+		Height:        target.GetSize().Y,
+		Left:          position.X,
+		Top:           position.Y,
+		UpToDate:      upToDate,
+	}
+	crop := target.GetCropRect()
+	entry.Crop = PlanRect{XOffsetStart: crop.Min.X, XOffsetFinish: crop.Max.X, YOffsetStart: crop.Min.Y, YOffsetFinish: crop.Max.Y}
+	for _, extension := range extensions {
+		entry.Outputs = append(entry.Outputs, outputFile+extension)
+	}
+	return entry
+}
+
+// planSelectedSubConfigurations follows processSelectedSubConfigurations without rendering
+func (rc *RenderContext) planSelectedSubConfigurations(parent *Configuration, selection Selection, entries []PlanEntry) []PlanEntry {
+	for i := range parent.Configurations {
+		if selection.IncludesConfiguration(&parent.Configurations[i]) {
+			entries = append(entries, rc.planEntry(parent, i))
+		}
+		entries = rc.planSelectedSubConfigurations(&parent.Configurations[i], selection, entries)
+	}
+	return entries
+}
+
+// planModule lists the renders processModule would do for the selection, in the same order
+func (rc *RenderContext) planModule(module *Module, selection Selection) []PlanEntry {
+	var entries []PlanEntry
+	wholeModule := selection.IncludesWholeModule(module)
+	for i := range module.Configurations {
+		config := &module.Configurations[i]
+		if !wholeModule && !selection.IncludesConfiguration(config) {
+			entries = rc.planSelectedSubConfigurations(config, selection, entries)
+			continue
+		}
+		entries = append(entries, rc.planEntry(config, -1))
+		for j := range config.Configurations {
+			entries = append(entries, rc.planEntry(config, j))
+		}
+	}
+	return entries
+}
+
+// buildRunPlan enriches the selected modules like generate does and lists every image it would write, nothing is
+// rendered and no cache folder is created
+func buildRunPlan(env *Environment, selection Selection, options RunOptions) (*RunPlan, error) {
+	modules := filterModules(env.Modules, selection)
+	if len(modules) == 0 {
+		return nil, classify(ErrConfiguration, fmt.Errorf("%s was not found in %s", selection.describeModules(), env.Config.Modules))
+	}
+	renderer := newRunRenderer(env, options)
+	plan := &RunPlan{Cache: getCacheBaseDirectory(env.Config), Configurations: []PlanEntry{}}
+	for i := range modules {
+		module := &modules[i]
+		prepareModule(module, env)
+		files := make(map[string]string)
+		for _, output := range configurationOutputs(env.Config, *module) {
+			files[output.path] = output.file
+		}
+		rc := &RenderContext{Config: env.Config, Logger: env.Logger, Renderer: renderer, Report: NewRunReport(options), Files: files}
+		plan.Configurations = append(plan.Configurations, rc.planModule(module, selection)...)
+	}
+	return plan, nil
+}
+
+// writeRunPlan writes the plan as indented JSON
+func writeRunPlan(w io.Writer, plan *RunPlan) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(plan)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// displayPresetsJSON are the displays of common MFD hardware a displays.json entry can name with "preset"
+//
+//go:embed presets/displays.json
+var displayPresetsJSON []byte
+
+// DisplayPreset is a piece of hardware with one or more screens, placed from the top left corner of the first
+type DisplayPreset struct {
+	Description string    `json:"description"`
+	Displays    []Display `json:"displays"`
+}
+
+// displayPresets reads the bundled presets by name
+func displayPresets() (map[string]DisplayPreset, error) {
+	var presets map[string]DisplayPreset
+	if err := json.Unmarshal(displayPresetsJSON, &presets); err != nil {
+		return nil, fmt.Errorf("the bundled display presets: %w", err)
+	}
+	return presets, nil
+}
+
+// expandDisplayPresets replaces every display naming a preset with the displays of the preset moved by its left and
+// top, a preset of one screen takes the name of the display and the fields it sets, one of several keeps its names
+func expandDisplayPresets(displays []Display) ([]Display, error) {
+	var presets map[string]DisplayPreset
+	var expanded []Display
+	for _, display := range displays {
+		if display.Preset == "" {
+			expanded = append(expanded, display)
+			continue
+		}
+		if presets == nil {
+			var err error
+			if presets, err = displayPresets(); err != nil {
+				return nil, err
+			}
+		}
+		preset, ok := presets[strings.ToLower(display.Preset)]
+		if !ok {
+			return nil, fmt.Errorf("unknown display preset %q, gomfd presets lists them", display.Preset)
+		}
+		if len(preset.Displays) > 1 && (display.Name != "" || display.Width != nil || display.Height != nil || display.Offsets != (Offsets{})) {
+			return nil, fmt.Errorf("the preset %s has %d displays, it only takes a monitor, left and top", display.Preset, len(preset.Displays))
+		}
+		for _, screen := range preset.Displays {
+			screen.Left = shiftedPosition(screen.Left, display.Left)
+			screen.Top = shiftedPosition(screen.Top, display.Top)
+			if display.Monitor != "" {
+				screen.Monitor = display.Monitor
+			}
+			if len(preset.Displays) == 1 {
+				overridePresetDisplay(&screen, display)
+			}
+			expanded = append(expanded, screen)
+		}
+	}
+	return expanded, nil
+}
+
+// shiftedPosition is the position of a preset screen moved by the left or top of the display naming the preset
+func shiftedPosition(position *int, shift *int) *int {
+	moved := 0
+	if position != nil {
+		moved = *position
+	}
+	if shift != nil {
+		moved += *shift
+	}
+	return &moved
+}
+
+// overridePresetDisplay gives the screen of a single screen preset the name and the fields the display sets
+func overridePresetDisplay(screen *Display, display Display) {
+	if display.Name != "" {
+		screen.Name = display.Name
+	}
+	if display.Width != nil {
+		screen.Width = display.Width
+	}
+	if display.Height != nil {
+		screen.Height = display.Height
+	}
+	screen.Offsets = display.Offsets
+	screen.ImageProperties = display.ImageProperties
+}
+
+// writeDisplayPresets lists the presets with the size and position of their screens
+func writeDisplayPresets(presets map[string]DisplayPreset) {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Preset\tDisplays\tDescription")
+	for _, name := range names {
+		var screens []string
+		for _, screen := range presets[name].Displays {
+			screens = append(screens, fmt.Sprintf("%s %dx%d at %d,%d", screen.Name, *screen.Width, *screen.Height, *screen.Left, *screen.Top))
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", name, strings.Join(screens, ", "), presets[name].Description)
+	}
+	writer.Flush()
+}
+
+func newPresetsCommand() *Command {
+	cmd := newCommand("presets", "", "List the display presets of common MFD hardware a displays.json entry can name with \"preset\"")
+	cmd.Run = func(args []string) error {
+		presets, err := displayPresets()
+		if err != nil {
+			return err
+		}
+		writeDisplayPresets(presets)
+		return nil
+	}
+	return cmd
+}
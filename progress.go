@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RenderEventKind is what happened to a configuration during a run
+type RenderEventKind int
+
+const (
+	RenderRendered RenderEventKind = iota
+	RenderSkipped
+	RenderFailed
+)
+
+// RenderEvent reports the outcome of one configuration
+type RenderEvent struct {
+	Kind          RenderEventKind
+	Module        string
+	Configuration string
+	Err           error
+	Duration      time.Duration
+}
+
+// renderFeed fans the render events out to every subscriber, one that falls behind misses events rather than stalling the render
+type renderFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan RenderEvent]bool
+}
+
+// renderEvents receives the outcome of every configuration rendered by this process
+var renderEvents = &renderFeed{subscribers: map[chan RenderEvent]bool{}}
+
+func (f *renderFeed) Publish(event RenderEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for subscriber := range f.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+func (f *renderFeed) Subscribe() chan RenderEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	subscriber := make(chan RenderEvent, 64)
+	f.subscribers[subscriber] = true
+	return subscriber
+}
+
+func (f *renderFeed) Unsubscribe(subscriber chan RenderEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subscribers, subscriber)
+}
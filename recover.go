@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// panicDump is the file a panic while rendering a configuration leaves in the log folder
+type panicDump struct {
+	Time          time.Time     `json:"time"`
+	Module        string        `json:"module"`
+	Configuration string        `json:"configuration"`
+	Parent        string        `json:"parent,omitempty"`
+	Panic         string        `json:"panic"`
+	Stack         string        `json:"stack"`
+	Enriched      Configuration `json:"enriched"`
+}
+
+// recoverRender runs render and turns a panic into the error of the configuration, the enriched configuration and
+// the stack are dumped to the log folder so the rest of the run carries on
+func (rc *RenderContext) recoverRender(config *Configuration, render func() error) (err error) {
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		dump := panicDump{
+			Time:          time.Now(),
+			Module:        moduleName(config),
+			Configuration: config.Name,
+			Panic:         fmt.Sprint(value),
+			Stack:         string(debug.Stack()),
+			Enriched:      detachedConfiguration(*config),
+		}
+		if config.Parent != nil {
+			dump.Parent = config.Parent.Name
+		}
+		path, dumpErr := writePanicDump(rc.Logger.logFolder(), dump)
+		if dumpErr != nil {
+			err = fmt.Errorf("panic: %v, the configuration could not be dumped: %v", value, dumpErr)
+			return
+		}
+		err = fmt.Errorf("panic: %v, the enriched configuration is dumped to %s", value, path)
+	}()
+	return render()
+}
+
+// detachedConfiguration copies config without its Module and Parent, they point back at it and cannot be encoded
+func detachedConfiguration(config Configuration) Configuration {
+	config.Module = nil
+	config.Parent = nil
+	subConfigs := make([]Configuration, len(config.Configurations))
+	for i, subConfig := range config.Configurations {
+		subConfigs[i] = detachedConfiguration(subConfig)
+	}
+	config.Configurations = subConfigs
+	return config
+}
+
+// writePanicDump writes dump to folder as panic-<time>-<module>-<configuration>.json and returns its path
+func writePanicDump(folder string, dump panicDump) (string, error) {
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := ensurePathExists(folder); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("panic-%s-%s-%s.json", dump.Time.Format("20060102-150405.000"), dumpFileName(dump.Module), dumpFileName(dump.Configuration))
+	path := filepath.Join(folder, name)
+	if err := os.WriteFile(longPath(path), data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// dumpFileName replaces the characters of a module or configuration name that cannot be part of a file name
+func dumpFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?* `, r) || r < 32 {
+			return '_'
+		}
+		return r
+	}, name)
+}
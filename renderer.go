@@ -0,0 +1,710 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// Renderer crops, resizes, composites and encodes configurations, it is built from options instead of reading the settings
+type Renderer struct {
+	format      string
+	quality     int
+	rulers      bool
+	rulerSize   int
+	ruler       *RulerSettings
+	saveCropped bool
+	strictCrop  bool
+	missing     MissingImagePolicy
+	onMissing   func(fileName string) bool
+	filter      imaging.ResampleFilter
+	supersample int
+	colorManage bool
+	dither      DitherMode
+	overlay     *OverlaySettings
+	images      ImageSource
+	logger      *Logger
+	preRender   []RenderHook
+	postRender  []RenderHook
+	workers     chan struct{}
+	memory      *memoryBudget
+}
+
+// MissingImagePolicy is what happens to a configuration whose source image does not exist
+type MissingImagePolicy string
+
+const (
+	MissingImageFail        MissingImagePolicy = "fail"
+	MissingImageSkip        MissingImagePolicy = "skip"
+	MissingImagePlaceholder MissingImagePolicy = "placeholder"
+)
+
+// parseMissingImagePolicy accepts fail, skip and placeholder, empty is fail
+func parseMissingImagePolicy(name string) (MissingImagePolicy, error) {
+	switch policy := MissingImagePolicy(strings.ToLower(name)); policy {
+	case "":
+		return MissingImageFail, nil
+	case MissingImageFail, MissingImageSkip, MissingImagePlaceholder:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown missing image policy %q, use fail, skip or placeholder", name)
+}
+
+// errImageSkipped is returned for a configuration that is skipped because a source image is missing
+var errImageSkipped = errors.New("skipped because the source image is missing")
+
+// RendererOption changes one setting of a Renderer
+type RendererOption func(*Renderer)
+
+// RenderHook runs before or after a configuration is rendered, the image is nil before and the composite after, an error fails the configuration
+type RenderHook func(ctx context.Context, config *Configuration, img image.Image) error
+
+// registeredHooks are added to the renderer of every run, a build adds its own hooks from an init function
+var registeredHooks struct {
+	mu   sync.Mutex
+	pre  []RenderHook
+	post []RenderHook
+}
+
+// RegisterPreRenderHook runs hook before every configuration any command renders
+func RegisterPreRenderHook(hook RenderHook) {
+	registeredHooks.mu.Lock()
+	defer registeredHooks.mu.Unlock()
+	registeredHooks.pre = append(registeredHooks.pre, hook)
+}
+
+// RegisterPostRenderHook runs hook on the composite of every configuration any command renders before it is written
+func RegisterPostRenderHook(hook RenderHook) {
+	registeredHooks.mu.Lock()
+	defer registeredHooks.mu.Unlock()
+	registeredHooks.post = append(registeredHooks.post, hook)
+}
+
+// registeredHookOptions are the options adding the registered hooks to a renderer
+func registeredHookOptions() []RendererOption {
+	registeredHooks.mu.Lock()
+	defer registeredHooks.mu.Unlock()
+	var options []RendererOption
+	for _, hook := range registeredHooks.pre {
+		options = append(options, WithPreRenderHook(hook))
+	}
+	for _, hook := range registeredHooks.post {
+		options = append(options, WithPostRenderHook(hook))
+	}
+	return options
+}
+
+// WithFormat encodes the outputs as jpg or png
+func WithFormat(format string) RendererOption {
+	return func(r *Renderer) {
+		r.format = format
+	}
+}
+
+// WithQuality sets the JPEG quality from 1 to 100
+func WithQuality(quality int) RendererOption {
+	return func(r *Renderer) {
+		r.quality = quality
+	}
+}
+
+// WithRulers draws axes with a tick every size pixels over the outputs
+func WithRulers(show bool, size int) RendererOption {
+	return func(r *Renderer) {
+		r.rulers = show
+		r.rulerSize = size
+	}
+}
+
+// WithRulerLabels sets the units, scale and interval of the ruler labels
+func WithRulerLabels(settings *RulerSettings) RendererOption {
+	return func(r *Renderer) {
+		r.ruler = settings
+	}
+}
+
+// WithWorkers caps how many images are decoded and encoded at the same time
+func WithWorkers(workers int) RendererOption {
+	return func(r *Renderer) {
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		r.workers = make(chan struct{}, workers)
+	}
+}
+
+// WithFilter picks the resampling filter used to resize the cropped images
+func WithFilter(filter imaging.ResampleFilter) RendererOption {
+	return func(r *Renderer) {
+		r.filter = filter
+	}
+}
+
+// maxSupersample caps the supersample factor, the memory of a composite grows with its square
+const maxSupersample = 8
+
+// WithSupersample renders the configurations without a supersample factor of their own at factor times their size
+func WithSupersample(factor int) RendererOption {
+	return func(r *Renderer) {
+		r.supersample = factor
+	}
+}
+
+// WithColorManagement converts the source images with an embedded ICC profile to sRGB before they are cropped
+func WithColorManagement(enabled bool) RendererOption {
+	return func(r *Renderer) {
+		r.colorManage = enabled
+	}
+}
+
+// WithDither keeps the layers at 16 bits per channel and dithers the composite when a JPEG reduces it to 8 bits
+func WithDither(mode DitherMode) RendererOption {
+	return func(r *Renderer) {
+		if mode != "" {
+			r.dither = mode
+		}
+	}
+}
+
+// WithOverlay also writes every composite as a PNG for a streaming overlay, nil writes none
+func WithOverlay(settings *OverlaySettings) RendererOption {
+	return func(r *Renderer) {
+		r.overlay = settings
+	}
+}
+
+// WithCroppedImages also writes every cropped and resized source image next to its output
+func WithCroppedImages(save bool) RendererOption {
+	return func(r *Renderer) {
+		r.saveCropped = save
+	}
+}
+
+// WithStrictCrop fails a configuration whose crop rectangle exceeds its image instead of clamping it with a warning
+func WithStrictCrop(strict bool) RendererOption {
+	return func(r *Renderer) {
+		r.strictCrop = strict
+	}
+}
+
+// WithMissingImages decides whether a missing source image fails its configuration, skips it or is drawn as a placeholder
+func WithMissingImages(policy MissingImagePolicy) RendererOption {
+	return func(r *Renderer) {
+		if policy != "" {
+			r.missing = policy
+		}
+	}
+}
+
+// WithCaptureRegions names the screen regions capture: images are grabbed from
+func WithCaptureRegions(regions CaptureRegions) RendererOption {
+	return func(r *Renderer) {
+		if schemes, ok := r.images.(*SchemeSource); ok {
+			schemes.Register("capture", CaptureSource{Regions: regions})
+		}
+	}
+}
+
+// WithDecodeLimits rejects or down-samples the source images over limits, nil does not limit them
+func WithDecodeLimits(limits *DecodeLimits) RendererOption {
+	return func(r *Renderer) {
+		if schemes, ok := r.images.(*SchemeSource); ok {
+			schemes.Limits = limits
+		}
+	}
+}
+
+// WithMemoryBudget limits the estimated memory of the images rendered at the same time to bytes, 0 does not limit it
+func WithMemoryBudget(bytes int64) RendererOption {
+	return func(r *Renderer) {
+		r.memory = nil
+		if bytes > 0 {
+			r.memory = newMemoryBudget(bytes)
+		}
+	}
+}
+
+// WithImageSource opens the source images from images instead of the files, URLs and builtin: images
+func WithImageSource(images ImageSource) RendererOption {
+	return func(r *Renderer) {
+		r.images = images
+	}
+}
+
+// WithLogger logs the geometry of every rendered configuration at debug level
+func WithLogger(logger *Logger) RendererOption {
+	return func(r *Renderer) {
+		r.logger = logger
+	}
+}
+
+// WithPreRenderHook runs hook before every configuration is rendered, after the hooks added before it
+func WithPreRenderHook(hook RenderHook) RendererOption {
+	return func(r *Renderer) {
+		r.preRender = append(r.preRender, hook)
+	}
+}
+
+// WithPostRenderHook runs hook on every composite before it is returned or written, a hook may draw on the draw.Image it
+// gets, an *image.RGBA or for a 16 bit source an *image.RGBA64
+func WithPostRenderHook(hook RenderHook) RendererOption {
+	return func(r *Renderer) {
+		r.postRender = append(r.postRender, hook)
+	}
+}
+
+// NewRenderer creates a Renderer writing 90% quality JPEGs resized with Lanczos on every CPU unless an option says otherwise
+func NewRenderer(options ...RendererOption) *Renderer {
+	r := &Renderer{format: "jpg", quality: 90, filter: imaging.Lanczos, images: newImageSource(), missing: MissingImageFail, dither: DitherNone}
+	WithWorkers(0)(r)
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// settingsRendererOptions are the options appsettings.json asks for
+func settingsRendererOptions(settings *MfdConfig) []RendererOption {
+	return []RendererOption{WithRulers(settings.ShowRulers, settings.RulerSize), WithRulerLabels(settings.Ruler), WithCroppedImages(settings.SaveCroppedImages), WithStrictCrop(settings.StrictCrop), WithMissingImages(settings.MissingImages), WithSupersample(settings.Supersample), WithColorManagement(settings.ColorManagement), WithDither(settings.Dither), WithOverlay(settings.Overlay), WithCaptureRegions(settings.CaptureRegions), WithMemoryBudget(settings.memoryBudget), WithDecodeLimits(settings.DecodeLimits)}
+}
+
+// Extension is the file extension of the outputs, with its dot
+func (r *Renderer) Extension() string {
+	return "." + r.format
+}
+
+// reportingMissing is a copy of the renderer passing the name of every missing source image to report, which is true the
+// first time it sees a name so the image is only warned about once, the copy shares the workers of r
+func (r *Renderer) reportingMissing(report func(fileName string) bool) *Renderer {
+	reporting := *r
+	reporting.onMissing = report
+	return &reporting
+}
+
+// acquire blocks until fewer than the allowed number of images are being decoded and encoded and, with a memory
+// budget, the estimated memory of rendering target onto config fits into it or ctx is cancelled, release gives both back
+func (r *Renderer) acquire(ctx context.Context, config *Configuration, target *Configuration) (func(), error) {
+	select {
+	case r.workers <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if r.memory == nil {
+		return func() { <-r.workers }, nil
+	}
+	estimate := r.renderMemory(config, target)
+	r.debugf(target, "Estimated to need %s of the %s memory budget", formatBytes(estimate), formatBytes(r.memory.limit))
+	reserved, err := r.memory.acquire(ctx, estimate)
+	if err != nil {
+		<-r.workers
+		return nil, err
+	}
+	return func() {
+		r.memory.release(reserved)
+		<-r.workers
+	}, nil
+}
+
+// Render returns the image of an enriched configuration without writing any files, a sub-configuration is centered on the image of its parent
+func (r *Renderer) Render(ctx context.Context, config *Configuration) (image.Image, error) {
+	if config.Parent != nil {
+		return r.compose(ctx, config.Parent, config, nil)
+	}
+	return r.compose(ctx, config, nil, nil)
+}
+
+// compose runs the hooks around composing the configuration, the child or else the parent
+func (r *Renderer) compose(ctx context.Context, parent *Configuration, child *Configuration, keepLayer func(layer *Configuration, img image.Image)) (draw.Image, error) {
+	target := parent
+	if child != nil {
+		target = child
+	}
+	for _, hook := range r.preRender {
+		if err := hook(ctx, target, nil); err != nil {
+			return nil, fmt.Errorf("pre-render hook: %w", err)
+		}
+	}
+	outputImg, err := r.composite(ctx, parent, child, keepLayer)
+	if err != nil {
+		return nil, err
+	}
+	for _, hook := range r.postRender {
+		if err := hook(ctx, target, outputImg); err != nil {
+			return nil, fmt.Errorf("post-render hook: %w", err)
+		}
+	}
+	return outputImg, nil
+}
+
+// composite crops and resizes the image of parent and centers the one of child on it, keepLayer receives every cropped and
+// resized layer, the composite has 16 bits per channel when a layer has
+func (r *Renderer) composite(ctx context.Context, parent *Configuration, child *Configuration, keepLayer func(layer *Configuration, img image.Image)) (draw.Image, error) {
+	target := parent
+	if child != nil {
+		target = child
+	}
+	scale := r.supersampleFactor(target)
+	if scale > 1 {
+		r.debugf(target, "Supersampled %dx", scale)
+	}
+	parentImg, err := r.layer(ctx, parent, "parent", scale)
+	if err != nil {
+		return nil, err
+	}
+	if keepLayer != nil {
+		keepLayer(parent, r.downsample(parentImg, parent.GetSize(), scale))
+	}
+	if child == nil {
+		stageStart := time.Now()
+		fill, filled, err := backgroundColor(parent)
+		if err != nil {
+			return nil, err
+		}
+		if filled {
+			// The background shows through the transparent parts of the image
+			canvas := newCanvas(parentImg.Bounds(), isDeepImage(parentImg))
+			fillCanvas(canvas, fill)
+			draw.Draw(canvas, canvas.Bounds(), parentImg, parentImg.Bounds().Min, draw.Over)
+			parentImg = canvas
+		}
+		outputImg := flattenImage(r.downsample(parentImg, parent.GetSize(), scale))
+		if err := drawOverlays(outputImg, parent); err != nil {
+			return nil, err
+		}
+		outputImg = r.decorate(outputImg, parent)
+		timeStage(ctx, StageComposite, stageStart)
+		return outputImg, nil
+	}
+
+	childImg, err := r.layer(ctx, child, "child", scale)
+	if err != nil {
+		return nil, err
+	}
+	if keepLayer != nil {
+		keepLayer(child, r.downsample(childImg, child.GetSize(), scale))
+	}
+
+	// Calculate the position to center the child image on the parent image
+	parentBounds := parentImg.Bounds()
+	childBounds := childImg.Bounds()
+	offset := image.Point{X: (parentBounds.Dx() - childBounds.Dx()) / 2, Y: (parentBounds.Dy() - childBounds.Dy()) / 2}
+	r.debugf(child, "Drawn at (%d, %d) on %s", offset.X/scale, offset.Y/scale, parent.Name)
+
+	stageStart := time.Now()
+	fill, filled, err := backgroundColor(child)
+	if err != nil {
+		return nil, err
+	}
+	outputImg := newCanvas(parentBounds, isDeepImage(parentImg) || isDeepImage(childImg))
+	if filled {
+		fillCanvas(outputImg, fill)
+	} else {
+		draw.Draw(outputImg, parentBounds, parentImg, image.Point{}, draw.Src)
+	}
+	draw.Draw(outputImg, childBounds.Add(offset), childImg, image.Point{}, draw.Over)
+	outputImg = flattenImage(r.downsample(outputImg, parent.GetSize(), scale))
+	if err := drawOverlays(outputImg, child); err != nil {
+		return nil, err
+	}
+	outputImg = r.decorate(outputImg, child)
+	timeStage(ctx, StageComposite, stageStart)
+	return outputImg, nil
+}
+
+// supersampleFactor is the supersample factor of config or its nearest parent with one, else the one of the renderer
+func (r *Renderer) supersampleFactor(config *Configuration) int {
+	factor := r.supersample
+	for ; config != nil; config = config.Parent {
+		if config.Supersample > 0 {
+			factor = config.Supersample
+			break
+		}
+	}
+	return max(1, min(factor, maxSupersample))
+}
+
+// downsample scales a supersampled image down to size, an image rendered at its size is returned as is
+func (r *Renderer) downsample(img image.Image, size image.Point, scale int) image.Image {
+	if scale <= 1 {
+		return img
+	}
+	return resizeImage(img, size.X, size.Y, r.filter, false)
+}
+
+// layer opens the image of a configuration, crops and resizes it to scale times the size of the configuration and runs
+// its filters, role names it in errors
+func (r *Renderer) layer(ctx context.Context, config *Configuration, role string, scale int) (image.Image, error) {
+	stageStart := time.Now()
+	img, err := r.images.Open(config.FileName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r.missingImage(config, role, scale, err)
+	}
+	if err != nil {
+		return nil, classify(ErrInputImage, fmt.Errorf("failed to open %s image: %v", role, err))
+	}
+	// The crop of a source down-sampled to the decode limits shrinks with it
+	var configurator ConfigurationProcessor = config
+	cropRect := configurator.GetCropRect()
+	if reduced, ok := img.(*reducedImage); ok {
+		r.debugf(config, "%s was down-sampled to %v by the decode limits", config.FileName, reduced.Bounds().Size())
+		img, cropRect = reduced.Image, scaleRect(cropRect, reduced.Scale)
+	}
+	if profiled, ok := img.(*profiledImage); ok {
+		img = r.colorManaged(config, profiled)
+	}
+	timeStage(ctx, StageDecode, stageStart)
+
+	cropRect, err = r.clampCrop(config, cropRect, img.Bounds())
+	if err != nil {
+		return nil, err
+	}
+	size := configurator.GetSize().Mul(scale)
+	area, err := paddedArea(config, size, scale)
+	if err != nil {
+		return nil, err
+	}
+	r.debugf(config, "%s %v cropped to %v and resized to %dx%d", config.FileName, img.Bounds().Size(), cropRect, area.Dx(), area.Dy())
+
+	stageStart = time.Now()
+	cropped := cropImage(img, cropRect)
+	if config.AutoTrim {
+		if trimmed := trimmedBounds(cropped); trimmed != cropped.Bounds() {
+			r.debugf(config, "Trimmed the borders of %v to %v", cropped.Bounds(), trimmed)
+			cropped = cropImage(cropped, trimmed)
+		}
+	}
+	// Dithering has nothing to spread unless the resampled pixels keep their fractions
+	resized, err := scaleImage(config, cropped, area.Size(), scale, r.filter, r.dither != DitherNone)
+	if err != nil {
+		return nil, err
+	}
+	timeStage(ctx, StageCropResize, stageStart)
+
+	for _, filter := range config.Filters {
+		r.debugf(config, "Filtered through %s", filter)
+		resized, err = runFilter(ctx, filter, resized)
+		if err != nil {
+			return nil, fmt.Errorf("filter %q of %s failed: %v", filter, config.Name, err)
+		}
+	}
+	if area.Size() != size {
+		padded := newCanvas(image.Rectangle{Max: size}, isDeepImage(resized))
+		draw.Draw(padded, area, resized, resized.Bounds().Min, draw.Src)
+		r.debugf(config, "Padded to %dx%d at (%d, %d)", size.X/scale, size.Y/scale, area.Min.X/scale, area.Min.Y/scale)
+		resized = padded
+	}
+	return resized, nil
+}
+
+// colorManaged is a source image converted from its ICC profile to sRGB with color management, without it or for a
+// profile that cannot be converted the image is used as is
+func (r *Renderer) colorManaged(config *Configuration, img *profiledImage) image.Image {
+	if !r.colorManage {
+		return img.Image
+	}
+	profile, err := parseMatrixProfile(img.Profile)
+	if err != nil {
+		r.warnf(config, "The ICC profile of %s is not applied: %v", config.FileName, err)
+		return img.Image
+	}
+	r.debugf(config, "Converted %s from its ICC profile to sRGB", config.FileName)
+	return convertToSRGB(img.Image, profile)
+}
+
+// missingImage applies the missing image policy to a configuration whose source image does not exist
+func (r *Renderer) missingImage(config *Configuration, role string, scale int, err error) (image.Image, error) {
+	first := r.onMissing == nil || r.onMissing(config.FileName)
+	switch r.missing {
+	case MissingImageSkip:
+		if first {
+			r.warnf(config, "The image %s is missing, the configurations using it are skipped", config.FileName)
+		}
+		return nil, fmt.Errorf("%s image %s: %w", role, config.FileName, errImageSkipped)
+	case MissingImagePlaceholder:
+		if first {
+			r.warnf(config, "The image %s is missing, it is drawn as a placeholder", config.FileName)
+		}
+		size := config.GetSize().Mul(scale)
+		return placeholderImage(size.X, size.Y, config.Name, "missing "+filepath.Base(config.FileName)), nil
+	}
+	return nil, classify(ErrInputImage, fmt.Errorf("failed to open %s image: %v", role, err))
+}
+
+// clampCrop limits a crop rectangle reaching past the image to the image, with a warning or in strict mode an error
+func (r *Renderer) clampCrop(config *Configuration, cropRect image.Rectangle, bounds image.Rectangle) (image.Rectangle, error) {
+	clamped := cropRect.Intersect(bounds)
+	if cropRect.Empty() || clamped == cropRect {
+		return cropRect, nil
+	}
+	size := bounds.Size()
+	if clamped.Empty() {
+		return image.Rectangle{}, classify(ErrConfiguration, fmt.Errorf("the crop rectangle %v of %s lies outside the %dx%d image %s", cropRect, config.Name, size.X, size.Y, config.FileName))
+	}
+	if r.strictCrop {
+		return image.Rectangle{}, classify(ErrConfiguration, fmt.Errorf("the crop rectangle %v of %s exceeds the %dx%d image %s", cropRect, config.Name, size.X, size.Y, config.FileName))
+	}
+	r.warnf(config, "The crop rectangle %v exceeds the %dx%d image %s, clamped to %v", cropRect, size.X, size.Y, config.FileName, clamped)
+	return clamped, nil
+}
+
+func (r *Renderer) debugf(config *Configuration, format string, args ...any) {
+	if r.logger != nil {
+		r.logger.With(LogFields{Module: moduleName(config), Config: config.Name}).Debugf(format, args...)
+	}
+}
+
+func (r *Renderer) warnf(config *Configuration, format string, args ...any) {
+	if r.logger != nil {
+		r.logger.With(LogFields{Module: moduleName(config), Config: config.Name}).Warnf(format, args...)
+	}
+}
+
+// decorate draws the rulers over the output of config when they are enabled, they are drawn with 8 bits per channel
+func (r *Renderer) decorate(img draw.Image, config *Configuration) draw.Image {
+	if !r.rulers {
+		return img
+	}
+	x, y := rulerAxes(r.ruler, config, img.Bounds().Size())
+	return convertToRGBA(drawAxesWithTicks(img, RedColor, RedColor, true, 10, r.rulerSize, BlackColor, BlackColor, true, r.ruler.labelInterval(), x.label, y.label))
+}
+
+// OutputExtensions are the extensions config is written with, the format of the run first and then the other
+// outputFormats of the configuration, a sub-configuration without outputFormats uses the ones of its parent
+func (r *Renderer) OutputExtensions(config *Configuration) ([]string, error) {
+	extensions := []string{r.Extension()}
+	for ; config != nil; config = config.Parent {
+		if len(config.OutputFormats) == 0 {
+			continue
+		}
+		for _, name := range config.OutputFormats {
+			format, err := parseImageFormat(name)
+			if err != nil {
+				return nil, classify(ErrConfiguration, fmt.Errorf("outputFormats of %s: %v", config.Name, err))
+			}
+			if !slices.Contains(extensions, "."+format) {
+				extensions = append(extensions, "."+format)
+			}
+		}
+		break
+	}
+	return extensions, nil
+}
+
+// save writes the image to fileName with the extension of every output format of config, each encoded once
+func (r *Renderer) save(ctx context.Context, fileName string, config *Configuration, img image.Image) error {
+	defer timeStage(ctx, StageEncode, time.Now())
+	extensions, err := r.OutputExtensions(config)
+	if err != nil {
+		return err
+	}
+	metadata := outputMetadata(config)
+	var dithered image.Image
+	for _, extension := range extensions {
+		output := img
+		if extension == ".jpg" {
+			if dithered == nil {
+				dithered = r.quantize(img)
+			}
+			output = dithered
+		}
+		if err := encodeImageFile(fileName+extension, output, r.quality, metadata...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeImageFile writes img as a PNG or a JPEG of the given quality, chosen by the extension of fileName, with the
+// texts in its PNG text chunks or JPEG comment
+func encodeImageFile(fileName string, img image.Image, quality int, texts ...imageText) error {
+	var encoded bytes.Buffer
+	isPNG := strings.EqualFold(filepath.Ext(fileName), ".png")
+	if err := encodeImage(&encoded, img, isPNG, quality); err != nil {
+		return err
+	}
+	data := encoded.Bytes()
+	if isPNG {
+		data = embedPNGText(data, texts)
+	} else {
+		data = embedJPEGComment(data, texts)
+	}
+	if err := os.WriteFile(longPath(fileName), data, 0644); err != nil {
+		return classify(ErrEncode, fmt.Errorf("failed to create output file: %v", err))
+	}
+	return nil
+}
+
+// encodeImage writes img to w as a PNG, or as a JPEG of the given quality
+func encodeImage(w io.Writer, img image.Image, asPNG bool, quality int) error {
+	var err error
+	if asPNG {
+		err = png.Encode(w, img)
+	} else {
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return classify(ErrEncode, fmt.Errorf("failed to save output file: %v", err))
+	}
+	return nil
+}
+
+// encode writes img to w in the output format of the run
+func (r *Renderer) encode(w io.Writer, img image.Image) error {
+	if r.format == "jpg" {
+		img = r.quantize(img)
+	}
+	return encodeImage(w, img, r.format == "png", r.quality)
+}
+
+// quantize dithers an image with 16 bits per channel to the 8 bits of a JPEG, without dithering the encoder rounds it
+func (r *Renderer) quantize(img image.Image) image.Image {
+	if r.dither == DitherNone || !isDeepImage(img) {
+		return img
+	}
+	return ditherImage(img, r.dither)
+}
+
+// parseImageFormat accepts jpg, jpeg and png
+func parseImageFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "jpg", "jpeg":
+		return "jpg", nil
+	case "png":
+		return "png", nil
+	}
+	return "", fmt.Errorf("unknown image format %q, use jpg or png", format)
+}
+
+// resampleFilters are the resampling filters by the name the flags use
+var resampleFilters = map[string]imaging.ResampleFilter{
+	"lanczos":    imaging.Lanczos,
+	"catmullrom": imaging.CatmullRom,
+	"linear":     imaging.Linear,
+	"box":        imaging.Box,
+	"nearest":    imaging.NearestNeighbor,
+}
+
+// parseResampleFilter finds a resampling filter by name
+func parseResampleFilter(name string) (imaging.ResampleFilter, error) {
+	filter, ok := resampleFilters[strings.ToLower(name)]
+	if !ok {
+		return imaging.ResampleFilter{}, fmt.Errorf("unknown filter %q, use lanczos, catmullrom, linear, box or nearest", name)
+	}
+	return filter, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Failure records a configuration that could not be rendered
+type Failure struct {
+	Module        string
+	Configuration string
+	Err           error
+}
+
+func (f Failure) String() string {
+	return fmt.Sprintf("%s/%s: %v", f.Module, f.Configuration, f.Err)
+}
+
+// RunOptions control how a run reacts to failures and up to date outputs and how its images are rendered
+type RunOptions struct {
+	ContinueOnError bool
+	Force           bool
+	Workers         int
+	StrictCrop      bool
+	MissingImages   MissingImagePolicy
+	// Diff compares every composite with the cached output instead of replacing it
+	Diff   bool
+	Render []RendererOption
+}
+
+// RunReport collects the outcome of a run and decides whether a failure stops it
+type RunReport struct {
+	RunOptions
+	Modules      int
+	Rendered     int
+	Skipped      int
+	BytesWritten int64
+	Failures     []Failure
+	Missing      []string
+	Diffs        []DiffResult
+	Stages       StageDurations
+	timings      []configurationTiming
+	started      time.Time
+	modules      map[string]*ModuleMetrics
+	mu           sync.Mutex
+}
+
+// NewRunReport starts a report, warnings logged from here on are listed in its summary
+func NewRunReport(options RunOptions) *RunReport {
+	instance.TakeWarnings()
+	return &RunReport{RunOptions: options, started: time.Now()}
+}
+
+// slowestShown is how many of the slowest configurations the summary lists with their stage times
+const slowestShown = 5
+
+// configurationTiming is how long a rendered configuration took and in which stages
+type configurationTiming struct {
+	Module        string
+	Configuration string
+	Duration      time.Duration
+	Stages        StageDurations
+}
+
+func (t configurationTiming) String() string {
+	return fmt.Sprintf("%s/%s %s (%s)", t.Module, t.Configuration, t.Duration.Round(time.Millisecond), t.Stages)
+}
+
+// Succeed counts a rendered configuration, how long it took in total and per stage and the size of its output
+func (r *RunReport) Succeed(module string, config string, duration time.Duration, stages StageDurations, bytesWritten int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Rendered++
+	r.BytesWritten += bytesWritten
+	for stage, stageDuration := range stages {
+		r.Stages[stage] += stageDuration
+	}
+	r.timings = append(r.timings, configurationTiming{Module: module, Configuration: config, Duration: duration, Stages: stages})
+	metrics := r.moduleMetrics(module)
+	metrics.Rendered++
+	metrics.Bytes += bytesWritten
+	metrics.Configurations = append(metrics.Configurations, ConfigurationMetrics{Name: config, DurationMs: milliseconds(duration), StagesMs: stages.Milliseconds(), Bytes: bytesWritten})
+}
+
+// slowest is the n rendered configurations that took longest, the slowest first, callers hold the lock
+func (r *RunReport) slowest(n int) []configurationTiming {
+	timings := append([]configurationTiming(nil), r.timings...)
+	sort.SliceStable(timings, func(i, j int) bool { return timings[i].Duration > timings[j].Duration })
+	return timings[:min(n, len(timings))]
+}
+
+// Skip counts a configuration whose cached output was up to date
+func (r *RunReport) Skip(module string, config string, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Skipped++
+	metrics := r.moduleMetrics(module)
+	metrics.CacheHits++
+	metrics.Configurations = append(metrics.Configurations, ConfigurationMetrics{Name: config, DurationMs: milliseconds(duration), Cached: true})
+}
+
+// MissingImage records a source image that does not exist once however many configurations use it, it is true the first time
+func (r *RunReport) MissingImage(fileName string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, missing := range r.Missing {
+		if missing == fileName {
+			return false
+		}
+	}
+	r.Missing = append(r.Missing, fileName)
+	return true
+}
+
+// RecordDiff records how the composite of a configuration compares to its cached output
+func (r *RunReport) RecordDiff(result DiffResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Diffs = append(r.Diffs, result)
+}
+
+// diffCounts counts the compared configurations by status, callers hold the lock
+func (r *RunReport) diffCounts() map[DiffStatus]int {
+	counts := make(map[DiffStatus]int)
+	for _, result := range r.Diffs {
+		counts[result.Status]++
+	}
+	return counts
+}
+
+// LogSummary writes the end of run summary, it is shown even when the console is quiet
+func (r *RunReport) LogSummary() {
+	warnings := instance.TakeWarnings()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	instance.Summary("Summary")
+	instance.Summary(fmt.Sprintf("  Modules processed        %d", r.Modules))
+	instance.Summary(fmt.Sprintf("  Configurations rendered  %d", r.Rendered))
+	instance.Summary(fmt.Sprintf("  Skipped (up to date)     %d", r.Skipped))
+	instance.Summary(fmt.Sprintf("  Failed                   %d", len(r.Failures)))
+	instance.Summary(fmt.Sprintf("  Bytes written            %s", formatBytes(r.BytesWritten)))
+	instance.Summary(fmt.Sprintf("  Wall time                %s", time.Since(r.started).Round(time.Millisecond)))
+	if r.Rendered > 0 {
+		// Summed across workers, so they add up to more than the wall time of a parallel run
+		instance.Summary(fmt.Sprintf("  Stage time               %s", r.Stages))
+		instance.Summary("  Slowest configurations")
+		for _, timing := range r.slowest(slowestShown) {
+			instance.Summary(fmt.Sprintf("    - %s", timing))
+		}
+	}
+	if len(r.Missing) > 0 {
+		instance.Summary(fmt.Sprintf("  Missing images           %d", len(r.Missing)))
+		for _, fileName := range r.Missing {
+			instance.Summary(fmt.Sprintf("    - %s", fileName))
+		}
+	}
+	if r.Diff {
+		counts := r.diffCounts()
+		instance.Summary(fmt.Sprintf("  Unchanged                %d", counts[DiffUnchanged]))
+		instance.Summary(fmt.Sprintf("  Changed                  %d", counts[DiffChanged]))
+		instance.Summary(fmt.Sprintf("  New                      %d", counts[DiffNew]))
+		sort.Slice(r.Diffs, func(i, j int) bool { return r.Diffs[i].String() < r.Diffs[j].String() })
+		for _, result := range r.Diffs {
+			if result.Status != DiffUnchanged {
+				instance.Summary(fmt.Sprintf("    - %s", result))
+			}
+		}
+	}
+	instance.Summary(fmt.Sprintf("  Warnings                 %d", len(warnings)))
+	for _, warning := range warnings {
+		instance.Summary(fmt.Sprintf("    - %s", warning))
+	}
+}
+
+// formatBytes renders a byte count using binary units
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Fail records a failed configuration, it returns nil when the run carries on and err when the run has to stop
+func (r *RunReport) Fail(module string, config string, err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	metrics := r.moduleMetrics(module)
+	metrics.Failed++
+	metrics.Configurations = append(metrics.Configurations, ConfigurationMetrics{Name: config, Failed: true})
+	if !r.ContinueOnError {
+		return err
+	}
+	r.Failures = append(r.Failures, Failure{Module: module, Configuration: config, Err: err})
+	return nil
+}
+
+// LogFailures writes the consolidated list of failures
+func (r *RunReport) LogFailures() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.Failures) == 0 {
+		return
+	}
+	instance.Errorf("%d configurations failed:", len(r.Failures))
+	for _, failure := range r.Failures {
+		instance.Errorf("  %s", failure)
+	}
+}
+
+// Err is the error the run returns for the recorded failures, a partial failure when some configurations were rendered
+func (r *RunReport) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.Failures) == 0 {
+		if changed := r.diffCounts()[DiffChanged]; changed > 0 {
+			return classify(ErrOutputChanged, fmt.Errorf("%d configurations look different from their cached output", changed))
+		}
+		return nil
+	}
+	if r.Rendered > 0 {
+		return classify(ErrPartialFailure, fmt.Errorf("%d configurations failed", len(r.Failures)))
+	}
+	return fmt.Errorf("%d configurations failed: %w", len(r.Failures), r.Failures[0].Err)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// imageExtensions are tried in turn for an image named without an extension
+var imageExtensions = []string{".png", ".jpg", ".jpeg"}
+
+// resolveImageFile finds the file an image name means when it does not exist as written, the folders and the file are matched
+// without case and a name without an extension matches the images with any of the imageExtensions, a name matching nothing is
+// returned unchanged so its error names what the module file says
+func resolveImageFile(fileName string) string {
+	if fileName == "" || hasScheme(fileName) || fileExists(fileName) {
+		return fileName
+	}
+	candidates := []string{fileName}
+	if filepath.Ext(fileName) == "" {
+		candidates = nil
+		for _, extension := range imageExtensions {
+			candidates = append(candidates, fileName+extension)
+		}
+	}
+	for _, candidate := range candidates {
+		if fileExists(candidate) {
+			return candidate
+		}
+		if resolved, ok := resolveWithoutCase(candidate); ok {
+			return resolved
+		}
+	}
+	return fileName
+}
+
+// resolveWithoutCase matches every element of a path below its deepest existing folder without case
+func resolveWithoutCase(fileName string) (string, bool) {
+	dir, name := filepath.Split(filepath.Clean(fileName))
+	dir = filepath.Clean(dir)
+	if !fileExists(dir) {
+		if dir == fileName || dir == filepath.Dir(dir) {
+			return "", false
+		}
+		resolved, ok := resolveWithoutCase(dir)
+		if !ok {
+			return "", false
+		}
+		dir = resolved
+	}
+	entries, err := os.ReadDir(longPath(dir))
+	if err != nil {
+		return "", false
+	}
+	// ReadDir sorts the entries, the first match is the same on every run when names only differ in case
+	for _, entry := range entries {
+		if strings.EqualFold(entry.Name(), name) {
+			return filepath.Join(dir, entry.Name()), true
+		}
+	}
+	return "", false
+}
+
+func fileExists(fileName string) bool {
+	_, err := os.Stat(longPath(fileName))
+	return err == nil
+}
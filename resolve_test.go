@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocateImage(t *testing.T) {
+	root := t.TempDir()
+	images := filepath.Join(root, "Images", "F16C")
+	if err := os.MkdirAll(images, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Lmfd.PNG", "rmfd.jpg"} {
+		if err := os.WriteFile(filepath.Join(images, name), []byte("image"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lmfd, rmfd := filepath.Join(images, "Lmfd.PNG"), filepath.Join(images, "rmfd.jpg")
+	// The settings name the folders with / like a file written on Linux, or with \ like one written on Windows
+	slashed := filepath.ToSlash(root)
+	settings := &MfdConfig{FilePath: slashed, OverridesPath: slashed + "/Overrides"}
+	backslashed := &MfdConfig{FilePath: strings.ReplaceAll(slashed, "/", `\`), OverridesPath: strings.ReplaceAll(slashed, "/", `\`) + `\Overrides`}
+	fixupConfigurationPaths(settings)
+	fixupConfigurationPaths(backslashed)
+	tests := []struct {
+		name     string
+		settings *MfdConfig
+		fileName string
+		want     string
+	}{
+		{"exact", settings, "Images/F16C/Lmfd.PNG", lmfd},
+		{"case", settings, "images/f16c/lmfd.png", lmfd},
+		{"no extension", settings, "images/f16c/LMFD", lmfd},
+		{"other extension", settings, "Images/F16C/RMFD", rmfd},
+		{"backslashes", settings, `images\f16c\lmfd.png`, lmfd},
+		{"backslashed settings", backslashed, "images/F16C/rmfd", rmfd},
+		{"inside the root", settings, slashed + "/images/f16c/lmfd", lmfd},
+		{"missing", settings, "Images/F16C/HUD.png", filepath.Join(root, "Images", "F16C", "HUD.png")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := locateImage(test.settings, "F16C", test.fileName); got != test.want {
+				t.Errorf("locateImage(%q) = %q, want %q", test.fileName, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RulerUnits is what the ruler labels count, pixels of the output, pixels of the source image the configuration is
+// cropped from or a percentage of the output
+type RulerUnits string
+
+const (
+	RulerPixels  RulerUnits = "pixels"
+	RulerSource  RulerUnits = "source"
+	RulerPercent RulerUnits = "percent"
+)
+
+func parseRulerUnits(value string) (RulerUnits, error) {
+	switch units := RulerUnits(strings.ToLower(value)); units {
+	case "":
+		return RulerPixels, nil
+	case RulerPixels, RulerSource, RulerPercent:
+		return units, nil
+	}
+	return "", fmt.Errorf("ruler units %q is not pixels, source or percent", value)
+}
+
+// RulerSettings label the ticks rulerSize pixels apart in units, multiplied by scale, and only every labelInterval
+// tick, source labels the ticks with the position in the source image so crop offsets can be read off them
+type RulerSettings struct {
+	Units         RulerUnits `json:"units,omitempty"`
+	Scale         float64    `json:"scale,omitempty"`
+	LabelInterval int        `json:"labelInterval,omitempty"`
+}
+
+// validate checks the units, scale and label interval of the ruler settings
+func (s *RulerSettings) validate() error {
+	units, err := parseRulerUnits(string(s.Units))
+	if err != nil {
+		return err
+	}
+	s.Units = units
+	if s.Scale < 0 {
+		return fmt.Errorf("ruler scale %g is negative", s.Scale)
+	}
+	if s.LabelInterval < 0 {
+		return fmt.Errorf("ruler labelInterval %d is negative", s.LabelInterval)
+	}
+	return nil
+}
+
+// rulerAxis turns a position along an axis of the output into the value of its label
+type rulerAxis struct {
+	origin float64
+	step   float64
+}
+
+func (a rulerAxis) label(position int) string {
+	value := math.Round((a.origin+float64(position)*a.step)*10) / 10
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// rulerAxes map the output of size to the labels of the settings, source units follow the crop of config into its
+// source image and its position centered on the output, a configuration without a crop counts output pixels
+func rulerAxes(settings *RulerSettings, config *Configuration, size image.Point) (rulerAxis, rulerAxis) {
+	x, y := rulerAxis{step: 1}, rulerAxis{step: 1}
+	if settings == nil {
+		return x, y
+	}
+	switch settings.Units {
+	case RulerSource:
+		if config != nil && config.XOffsetStart != nil && config.Width != nil && config.CanCrop() {
+			crop, own := config.GetCropRect(), config.GetSize()
+			if own.X > 0 && own.Y > 0 {
+				offset := size.Sub(own).Div(2)
+				x.step = float64(crop.Dx()) / float64(own.X)
+				y.step = float64(crop.Dy()) / float64(own.Y)
+				x.origin = float64(crop.Min.X) - float64(offset.X)*x.step
+				y.origin = float64(crop.Min.Y) - float64(offset.Y)*y.step
+			}
+		}
+	case RulerPercent:
+		if size.X > 0 && size.Y > 0 {
+			x.step, y.step = 100/float64(size.X), 100/float64(size.Y)
+		}
+	}
+	if settings.Scale > 0 {
+		x.origin, x.step = x.origin*settings.Scale, x.step*settings.Scale
+		y.origin, y.step = y.origin*settings.Scale, y.step*settings.Scale
+	}
+	return x, y
+}
+
+// labelInterval is every how many ticks a label is drawn
+func (s *RulerSettings) labelInterval() int {
+	if s == nil || s.LabelInterval < 1 {
+		return 1
+	}
+	return s.LabelInterval
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// scriptTimeout stops a module script that does not finish, for example one stuck in a loop
+const scriptTimeout = 5 * time.Second
+
+// resolveModuleScript is the Lua script of a module relative to its module file, a script that is absolute or leaves the
+// folder of the module file is refused so an installed module cannot run any Lua file on disk
+func resolveModuleScript(module *Module) (string, error) {
+	if module.Script == "" {
+		return "", nil
+	}
+	if module.SourceFile == "" {
+		return "", fmt.Errorf("script %s has no module file it is relative to", module.Script)
+	}
+	folder := filepath.Dir(module.SourceFile)
+	script := filepath.Join(folder, module.Script)
+	relative, err := filepath.Rel(folder, script)
+	if err != nil || filepath.IsAbs(module.Script) || filepath.VolumeName(module.Script) != "" || strings.HasPrefix(module.Script, "/") ||
+		strings.HasPrefix(module.Script, `\`) || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("script %s is not inside %s, the folder of the module file", module.Script, folder)
+	}
+	return script, nil
+}
+
+// moduleScriptPath is the Lua script of a module, "" when it has none or its script is refused
+func moduleScriptPath(module *Module) string {
+	script, _ := resolveModuleScript(module)
+	return script
+}
+
+// applyModuleScript runs the Lua function named by the script of every configuration of a module, the function
+// changes the fields of the configuration table it gets and the configurations it sets enabled = false on are removed
+func applyModuleScript(module *Module) error {
+	script, err := resolveModuleScript(module)
+	if err != nil {
+		return fmt.Errorf("module %s: %v", module.Name, err)
+	}
+	if script == "" {
+		return nil
+	}
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	for _, open := range []lua.LGFunction{lua.OpenBase, lua.OpenTable, lua.OpenString, lua.OpenMath} {
+		L.Push(L.NewFunction(open))
+		L.Call(0, 0)
+	}
+	// Scripts come with installed and fetched packages, they must not read or run other Lua files or compile code
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scriptTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+
+	moduleTable := L.NewTable()
+	moduleTable.RawSetString("name", lua.LString(module.Name))
+	moduleTable.RawSetString("tag", lua.LString(module.Tag))
+	moduleTable.RawSetString("displayName", lua.LString(module.DisplayName))
+	moduleTable.RawSetString("category", lua.LString(module.Category))
+	L.SetGlobal("module", moduleTable)
+
+	if err := L.DoFile(script); err != nil {
+		return fmt.Errorf("module %s script: %v", module.Name, err)
+	}
+	configurations, err := applyConfigurationScripts(L, module.Configurations, "")
+	if err != nil {
+		return fmt.Errorf("module %s script: %v", module.Name, err)
+	}
+	module.Configurations = configurations
+	return nil
+}
+
+// applyConfigurationScripts runs the scripts of configs and their sub-configurations and returns the ones still enabled
+func applyConfigurationScripts(L *lua.LState, configs []Configuration, parentName string) ([]Configuration, error) {
+	var kept []Configuration
+	for _, config := range configs {
+		if config.Script != "" {
+			function, ok := L.GetGlobal(config.Script).(*lua.LFunction)
+			if !ok {
+				return nil, fmt.Errorf("%s names the function %s, the script does not define it", config.Name, config.Script)
+			}
+			table := configurationTable(L, &config, parentName)
+			if err := L.CallByParam(lua.P{Fn: function, NRet: 1, Protect: true}, table); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.Name, err)
+			}
+			// A function may return a new table instead of changing the one it got
+			if returned, ok := L.Get(-1).(*lua.LTable); ok {
+				table = returned
+			}
+			L.Pop(1)
+			if err := readConfigurationTable(table, &config); err != nil {
+				return nil, fmt.Errorf("%s: %v", config.Name, err)
+			}
+			if config.Enabled != nil && !*config.Enabled {
+				continue
+			}
+		}
+		subConfigs, err := applyConfigurationScripts(L, config.Configurations, config.Name)
+		if err != nil {
+			return nil, err
+		}
+		config.Configurations = subConfigs
+		kept = append(kept, config)
+	}
+	return kept, nil
+}
+
+// configurationTable is the Lua table a script function gets, a field missing from the module file is nil
+func configurationTable(L *lua.LState, config *Configuration, parentName string) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("name", lua.LString(config.Name))
+	table.RawSetString("fileName", lua.LString(config.FileName))
+	if parentName != "" {
+		table.RawSetString("parent", lua.LString(parentName))
+	}
+	for name, field := range geometryFields(&config.Rectangle, &config.Offsets) {
+		if *field != nil {
+			table.RawSetString(name, lua.LNumber(**field))
+		}
+	}
+	for name, field := range configurationBoolFields(config) {
+		if *field != nil {
+			table.RawSetString(name, lua.LBool(**field))
+		}
+	}
+	if config.Opacity != nil {
+		table.RawSetString("opacity", lua.LNumber(*config.Opacity))
+	}
+	return table
+}
+
+// readConfigurationTable copies the fields of the table a script function changed back into config
+func readConfigurationTable(table *lua.LTable, config *Configuration) error {
+	if fileName, ok := table.RawGetString("fileName").(lua.LString); ok {
+		config.FileName = string(fileName)
+	}
+	for name, field := range geometryFields(&config.Rectangle, &config.Offsets) {
+		switch value := table.RawGetString(name).(type) {
+		case lua.LNumber:
+			number := int(value)
+			*field = &number
+			// The value the script computed replaces an expression of the module file
+			delete(config.Expressions, name)
+		case *lua.LNilType:
+			*field = nil
+		default:
+			return fmt.Errorf("%s must be a number, not a %s", name, value.Type())
+		}
+	}
+	for name, field := range configurationBoolFields(config) {
+		switch value := table.RawGetString(name).(type) {
+		case lua.LBool:
+			flag := bool(value)
+			*field = &flag
+		case *lua.LNilType:
+			*field = nil
+		default:
+			return fmt.Errorf("%s must be a boolean, not a %s", name, value.Type())
+		}
+	}
+	switch value := table.RawGetString("opacity").(type) {
+	case lua.LNumber:
+		opacity := float32(value)
+		config.Opacity = &opacity
+	case *lua.LNilType:
+		config.Opacity = nil
+	default:
+		return fmt.Errorf("opacity must be a number, not a %s", value.Type())
+	}
+	return nil
+}
+
+// configurationBoolFields are the switches a script may set by their module file name
+func configurationBoolFields(config *Configuration) map[string]**bool {
+	return map[string]**bool{
+		"center":            &config.Center,
+		"enabled":           &config.Enabled,
+		"useAsSwitch":       &config.UseAsSwitch,
+		"needsThrottleType": &config.NeedsThrottleType,
+	}
+}
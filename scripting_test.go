@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyModuleScriptRejectsPaths(t *testing.T) {
+	folder := t.TempDir()
+	modules := filepath.Join(folder, "Modules")
+	if err := os.Mkdir(modules, 0755); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(folder, "outside.lua")
+	if err := os.WriteFile(outside, []byte("function page(config) config.width = 1 end"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range []string{outside, "../outside.lua", "scripts/../../outside.lua", "..", "/outside.lua", `\outside.lua`} {
+		t.Run(script, func(t *testing.T) {
+			module := &Module{Name: "F16C", Script: script, SourceFile: filepath.Join(modules, "Aircraft.json"),
+				Configurations: []Configuration{{Name: "LMFD", Script: "page"}}}
+			err := applyModuleScript(module)
+			if err == nil || !strings.Contains(err.Error(), "is not inside") {
+				t.Errorf("applyModuleScript(%q) = %v, want the script refused", script, err)
+			}
+			if module.Configurations[0].Width != nil {
+				t.Errorf("applyModuleScript(%q) ran the script", script)
+			}
+		})
+	}
+}
+
+func TestApplyModuleScript(t *testing.T) {
+	folder := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(folder, "scripts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := "function page(config) config.width = 320 end\nfunction hide(config) config.enabled = false end"
+	if err := os.WriteFile(filepath.Join(folder, "scripts", "F16C.lua"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	module := &Module{Name: "F16C", Script: "scripts/F16C.lua", SourceFile: filepath.Join(folder, "Aircraft.json"),
+		Configurations: []Configuration{{Name: "LMFD", Script: "page"}, {Name: "RMFD", Script: "hide"}}}
+	if err := applyModuleScript(module); err != nil {
+		t.Fatalf("applyModuleScript: %v", err)
+	}
+	if len(module.Configurations) != 1 || module.Configurations[0].Width == nil || *module.Configurations[0].Width != 320 {
+		t.Errorf("applyModuleScript left %+v", module.Configurations)
+	}
+}
+
+func TestModuleScriptsCannotLoadFiles(t *testing.T) {
+	folder := t.TempDir()
+	script := `function page(config) dofile("other.lua") end`
+	if err := os.WriteFile(filepath.Join(folder, "F16C.lua"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	module := &Module{Name: "F16C", Script: "F16C.lua", SourceFile: filepath.Join(folder, "Aircraft.json"),
+		Configurations: []Configuration{{Name: "LMFD", Script: "page"}}}
+	if err := applyModuleScript(module); err == nil {
+		t.Error("a module script called dofile")
+	}
+}
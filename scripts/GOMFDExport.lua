@@ -0,0 +1,57 @@
+-- GOMFD aircraft detection
+-- Sends the name of the flown aircraft to GOMFD over UDP, add this line to Saved Games\DCS\Scripts\Export.lua:
+--   dofile(lfs.writedir() .. [[Scripts\GOMFDExport.lua]])
+
+package.path = package.path .. ";.\\LuaSocket\\?.lua"
+package.cpath = package.cpath .. ";.\\LuaSocket\\?.dll"
+local socket = require("socket")
+
+local gomfd = {
+	host = "127.0.0.1",
+	port = 5011,
+	-- seconds between repeats, so GOMFD started mid-mission still learns the aircraft
+	interval = 2,
+	nextSend = 0,
+	previous = {
+		start = LuaExportStart,
+		afterNextFrame = LuaExportAfterNextFrame,
+		stop = LuaExportStop,
+	},
+}
+
+local function send(name)
+	if gomfd.udp then
+		gomfd.udp:sendto("aircraft=" .. name, gomfd.host, gomfd.port)
+	end
+end
+
+function LuaExportStart()
+	gomfd.udp = socket.udp()
+	gomfd.udp:settimeout(0)
+	if gomfd.previous.start then
+		gomfd.previous.start()
+	end
+end
+
+function LuaExportAfterNextFrame()
+	local now = LoGetModelTime()
+	if now >= gomfd.nextSend then
+		local self = LoGetSelfData()
+		send(self and self.Name or "")
+		gomfd.nextSend = now + gomfd.interval
+	end
+	if gomfd.previous.afterNextFrame then
+		gomfd.previous.afterNextFrame()
+	end
+end
+
+function LuaExportStop()
+	send("")
+	if gomfd.udp then
+		gomfd.udp:close()
+		gomfd.udp = nil
+	end
+	if gomfd.previous.stop then
+		gomfd.previous.stop()
+	end
+end
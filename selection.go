@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// regexPrefix marks a --match pattern as a regular expression instead of a glob
+const regexPrefix = "re:"
+
+// NameMatcher matches Module and Configuration names against a glob or a regular expression
+type NameMatcher struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+// NewNameMatcher builds a case-insensitive matcher, patterns starting with re: are regular expressions, anything else is a glob using * ? and [...]
+func NewNameMatcher(pattern string) (*NameMatcher, error) {
+	expression := ""
+	if strings.HasPrefix(pattern, regexPrefix) {
+		expression = strings.TrimPrefix(pattern, regexPrefix)
+	} else {
+		glob, err := globToRegex(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match pattern %q: %w", pattern, err)
+		}
+		expression = "^" + glob + "$"
+	}
+	regex, err := regexp.Compile("(?i)" + expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid match pattern %q: %w", pattern, err)
+	}
+	return &NameMatcher{pattern: pattern, regex: regex}, nil
+}
+
+func (m *NameMatcher) Match(name string) bool {
+	return m.regex.MatchString(name)
+}
+
+func (m *NameMatcher) String() string {
+	return m.pattern
+}
+
+// globToRegex converts a glob into the equivalent regular expression body, [!...] matches the characters not listed
+// and a [ without its ] is an error
+func globToRegex(glob string) (string, error) {
+	var builder strings.Builder
+	inClass := false
+	// classStart is true right after the [ or [! of a class
+	classStart, negatable := false, false
+	for _, r := range glob {
+		switch {
+		case inClass:
+			if negatable && r == '!' {
+				negatable = false
+				builder.WriteRune('^')
+				continue
+			}
+			// A ] right after the [ or [! is one of the characters and does not close the class
+			if r == ']' && !classStart {
+				inClass = false
+			}
+			classStart, negatable = false, false
+			if r == '\\' {
+				builder.WriteString(`\\`)
+				continue
+			}
+			builder.WriteRune(r)
+		case r == '*':
+			builder.WriteString(".*")
+		case r == '?':
+			builder.WriteString(".")
+		case r == '[':
+			inClass = true
+			classStart, negatable = true, true
+			builder.WriteRune(r)
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if inClass {
+		return "", errors.New("the [ is never closed by a ]")
+	}
+	return builder.String(), nil
+}
+
+// Selection describes which modules and configurations a run should render
+type Selection struct {
+	ModuleName        string
+	ConfigurationName string
+	Pattern           *NameMatcher
+	// Aircraft limits the modules to the ones made for this DCS aircraft
+	Aircraft string
+}
+
+// IsEmpty is true when nothing was selected and everything is rendered
+func (s Selection) IsEmpty() bool {
+	return s.ModuleName == "" && s.ConfigurationName == "" && s.Pattern == nil && s.Aircraft == ""
+}
+
+// IncludesModule is true when the module passes the -mod and -aircraft filters
+func (s Selection) IncludesModule(module *Module) bool {
+	if s.Aircraft != "" && !moduleFlies(module, s.Aircraft) {
+		return false
+	}
+	return s.ModuleName == "" || strings.EqualFold(module.Name, s.ModuleName)
+}
+
+// describeModules names the selected modules for messages
+func (s Selection) describeModules() string {
+	switch {
+	case s.ModuleName != "":
+		return "module " + s.ModuleName
+	case s.Aircraft != "":
+		return "a module for aircraft " + s.Aircraft
+	}
+	return "any module"
+}
+
+// IncludesWholeModule is true when every configuration of the module should be rendered
+func (s Selection) IncludesWholeModule(module *Module) bool {
+	if s.ConfigurationName != "" {
+		return false
+	}
+	return s.Pattern == nil || s.Pattern.Match(module.Name)
+}
+
+// IncludesConfiguration is true when the configuration passes the -sub and --match filters
+func (s Selection) IncludesConfiguration(config *Configuration) bool {
+	if s.ConfigurationName != "" && !strings.EqualFold(config.Name, s.ConfigurationName) {
+		return false
+	}
+	return s.Pattern == nil || s.Pattern.Match(config.Name)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGlobToRegex(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{"F16C", "F16C"},
+		{"F16*", "F16.*"},
+		{"F1?C", "F1.C"},
+		{"A-10C.2", `A-10C\.2`},
+		{"[AF]*", "[AF].*"},
+		{"[!AF]*", "[^AF].*"},
+		{"[]A]", "[]A]"},
+		{"[!]A]", "[^]A]"},
+		{"[a!]", "[a!]"},
+		{`[\]`, `[\\]`},
+		{"(x)+", `\(x\)\+`},
+	}
+	for _, test := range tests {
+		t.Run(test.glob, func(t *testing.T) {
+			got, err := globToRegex(test.glob)
+			if err != nil {
+				t.Fatalf("globToRegex(%q): %v", test.glob, err)
+			}
+			if got != test.want {
+				t.Errorf("globToRegex(%q) = %q, want %q", test.glob, got, test.want)
+			}
+		})
+	}
+}
+
+func TestGlobToRegexUnterminated(t *testing.T) {
+	for _, glob := range []string{"[", "F16[", "[AF", "[!", "[]", "[!]"} {
+		if _, err := globToRegex(glob); err == nil {
+			t.Errorf("globToRegex(%q) succeeded, want an error", glob)
+		}
+	}
+}
+
+func TestNameMatcher(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"F16C", "F16C", true},
+		{"F16C", "f16c", true},
+		{"F16C", "F16C_LMFD", false},
+		{"F16*", "F16C_LMFD", true},
+		{"*LMFD", "F16C_LMFD", true},
+		{"*LMFD", "F16C_RMFD", false},
+		{"F1?C", "F15C", true},
+		{"F1?C", "F1C", false},
+		{"[AF]*", "A10C", true},
+		{"[AF]*", "f18", true},
+		{"[AF]*", "M2000", false},
+		{"[!AF]*", "M2000", true},
+		{"[!AF]*", "A10C", false},
+		{"A-10C.2", "A-10C.2", true},
+		{"A-10C.2", "A-10CX2", false},
+		{"re:^F1[56]", "F15E", true},
+		{"re:^F1[56]", "F18C", false},
+		{"re:lmfd$", "F16C_LMFD", true},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.name, func(t *testing.T) {
+			matcher, err := NewNameMatcher(test.pattern)
+			if err != nil {
+				t.Fatalf("NewNameMatcher(%q): %v", test.pattern, err)
+			}
+			if got := matcher.Match(test.name); got != test.want {
+				t.Errorf("NewNameMatcher(%q).Match(%q) = %v, want %v", test.pattern, test.name, got, test.want)
+			}
+			if matcher.String() != test.pattern {
+				t.Errorf("String() = %q, want %q", matcher.String(), test.pattern)
+			}
+		})
+	}
+}
+
+func TestNameMatcherErrors(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"F16[", `invalid match pattern "F16[": the [ is never closed by a ]`},
+		{"[!AF", `invalid match pattern "[!AF": the [ is never closed by a ]`},
+		{"re:F16(", `invalid match pattern "re:F16(": `},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern, func(t *testing.T) {
+			_, err := NewNameMatcher(test.pattern)
+			if err == nil {
+				t.Fatalf("NewNameMatcher(%q) succeeded, want %s", test.pattern, test.want)
+			}
+			if !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("NewNameMatcher(%q) = %s, want %s", test.pattern, err, test.want)
+			}
+		})
+	}
+}
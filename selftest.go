@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"image"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// selftestFiles are the module, displays and source images the self test renders and the golden images it expects
+//
+//go:embed selftest
+var selftestFiles embed.FS
+
+// defaultGoldenFolder is where -update writes the golden images, relative to a checkout of the repository
+const defaultGoldenFolder = "selftest/golden"
+
+// GoldenResult is how the render of a self test configuration compares to its golden image
+type GoldenResult struct {
+	Name          string
+	ChangedPixels int
+	Missing       bool
+	Artifacts     string
+}
+
+// runSelftest renders every configuration of the embedded fixtures and compares them with the golden images, a
+// channel may differ by tolerance. With update the renders are written to goldenFolder instead, failed renders and
+// their difference images go to outputFolder
+func runSelftest(ctx context.Context, tolerance int, update bool, goldenFolder string, outputFolder string) ([]GoldenResult, error) {
+	fixtures, err := os.MkdirTemp("", "gomfd-selftest-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(fixtures)
+	if err := extractSelftestFixtures(fixtures); err != nil {
+		return nil, err
+	}
+
+	// Only the fixtures are used, the settings and overrides of the user must not change the output
+	settings := &MfdConfig{
+		FilePath:                 filepath.Join(fixtures, "images"),
+		Modules:                  filepath.Join(fixtures, "modules"),
+		DisplayConfigurationFile: filepath.Join(fixtures, "displays.json"),
+		OverridesPath:            filepath.Join(fixtures, "overrides"),
+	}
+	displays, err := readDisplaysJSON(settings.DisplayConfigurationFile)
+	if err != nil {
+		return nil, err
+	}
+	instance.Mute(true)
+	defer instance.Mute(false)
+	setDisplays(displays, instance)
+	modules, err := readModuleFiles(settings.Modules)
+	if err != nil {
+		return nil, err
+	}
+	env := &Environment{Config: settings, Logger: instance, Displays: displays, Modules: modules}
+
+	// Registered hooks and the rendering settings are left out, the golden images are made with the defaults
+	renderer := NewRenderer(WithFormat("png"))
+	var results []GoldenResult
+	for i := range env.Modules {
+		module := &env.Modules[i]
+		prepareModule(module, env)
+		var configs []*Configuration
+		for j := range module.Configurations {
+			config := &module.Configurations[j]
+			configs = append(configs, config)
+			for k := range config.Configurations {
+				configs = append(configs, &config.Configurations[k])
+			}
+		}
+		for _, config := range configs {
+			name := module.Name + "/" + configurationPath(config)
+			img, err := renderer.Render(ctx, config)
+			if err != nil {
+				return results, fmt.Errorf("%s: %w", name, err)
+			}
+			// The golden images are PNG files, the render is compared as it would be read back from one
+			var encoded bytes.Buffer
+			if err := renderer.encode(&encoded, img); err != nil {
+				return results, err
+			}
+			if update {
+				if err := writeGoldenImage(filepath.Join(goldenFolder, filepath.FromSlash(name)+".png"), encoded.Bytes()); err != nil {
+					return results, err
+				}
+				results = append(results, GoldenResult{Name: name})
+				continue
+			}
+			rendered, _, err := image.Decode(bytes.NewReader(encoded.Bytes()))
+			if err != nil {
+				return results, err
+			}
+			results = append(results, compareWithGolden(name, rendered, tolerance, outputFolder))
+		}
+	}
+	return results, nil
+}
+
+// extractSelftestFixtures copies the embedded module, displays and images into folder, the pipeline reads them from disk
+func extractSelftestFixtures(folder string) error {
+	return fs.WalkDir(selftestFiles, "selftest", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative := name[len("selftest"):]
+		if relative == "/golden" {
+			return fs.SkipDir
+		}
+		target := filepath.Join(folder, filepath.FromSlash(relative))
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := selftestFiles.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
+
+// compareWithGolden compares a render with the embedded golden image of the same name, a failed render and its
+// difference image are written to outputFolder
+func compareWithGolden(name string, rendered image.Image, tolerance int, outputFolder string) GoldenResult {
+	result := GoldenResult{Name: name}
+	data, err := selftestFiles.ReadFile(path.Join("selftest/golden", name+".png"))
+	var golden image.Image
+	if err == nil {
+		golden, _, err = image.Decode(bytes.NewReader(data))
+	}
+	switch {
+	case err != nil:
+		result.Missing = true
+	case golden.Bounds().Size() != rendered.Bounds().Size():
+		result.ChangedPixels = rendered.Bounds().Dx() * rendered.Bounds().Dy()
+	default:
+		changed, highlighted := compareImages(golden, rendered, tolerance)
+		result.ChangedPixels = changed
+		if changed > 0 {
+			fileName := filepath.Join(outputFolder, filepath.FromSlash(name))
+			if ensurePathExists(filepath.Dir(fileName)) == nil && encodeImageFile(fileName+".diff.png", highlighted, 0) == nil {
+				result.Artifacts = fileName + ".diff.png"
+			}
+		}
+	}
+	if result.Missing || result.ChangedPixels > 0 {
+		fileName := filepath.Join(outputFolder, filepath.FromSlash(name)) + ".png"
+		if ensurePathExists(filepath.Dir(fileName)) == nil && encodeImageFile(fileName, rendered, 0) == nil && result.Artifacts == "" {
+			result.Artifacts = fileName
+		}
+	}
+	return result
+}
+
+func writeGoldenImage(fileName string, data []byte) error {
+	if err := ensurePathExists(filepath.Dir(fileName)); err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, data, 0644)
+}
+
+func newSelftestCommand() *Command {
+	cmd := newCommand("selftest", "", "Render the built-in test module and compare it with the golden images, so a pipeline change cannot alter the output unnoticed")
+	tolerance := cmd.Flags.Int("tolerance", 2, "How far an 8 bit channel of a pixel may differ from the golden image")
+	update := cmd.Flags.Bool("update", false, "Write the renders as the new golden images instead of comparing them, run it from the repository and rebuild")
+	golden := cmd.Flags.String("golden", defaultGoldenFolder, "Folder -update writes the golden images to")
+	output := cmd.Flags.String("output", filepath.Join(os.TempDir(), "gomfd-selftest"), "Folder the failed renders and their difference images are written to")
+	cmd.Run = func(args []string) error {
+		ctx, stop := interruptContext()
+		defer stop()
+		results, err := runSelftest(ctx, *tolerance, *update, *golden, *output)
+		if err != nil {
+			return err
+		}
+		if *update {
+			fmt.Printf("Wrote %d golden images to %s\n", len(results), *golden)
+			return nil
+		}
+		failed := 0
+		for _, result := range results {
+			switch {
+			case result.Missing:
+				failed++
+				fmt.Printf("FAIL %s: no golden image, see %s\n", result.Name, result.Artifacts)
+			case result.ChangedPixels > 0:
+				failed++
+				fmt.Printf("FAIL %s: %d pixels differ by more than %d, see %s\n", result.Name, result.ChangedPixels, *tolerance, result.Artifacts)
+			default:
+				fmt.Printf("ok   %s\n", result.Name)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d configurations differ from their golden image", failed, len(results))
+		}
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// TestSelftest is gomfd selftest, every configuration of the embedded fixtures must match its golden image
+func TestSelftest(t *testing.T) {
+	useSavedGames(t, t.TempDir())
+	output := t.TempDir()
+	results, err := runSelftest(context.Background(), 2, false, defaultGoldenFolder, output)
+	if err != nil {
+		t.Fatalf("runSelftest: %v", err)
+	}
+	if len(results) == 0 {
+		t.Fatal("runSelftest rendered no configurations")
+	}
+	for _, result := range results {
+		switch {
+		case result.Missing:
+			t.Errorf("%s has no golden image, see %s", result.Name, result.Artifacts)
+		case result.ChangedPixels > 0:
+			t.Errorf("%s: %d pixels differ by more than 2, see %s", result.Name, result.ChangedPixels, result.Artifacts)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// renderMu serializes the renders of the server and its watcher so two renders never write the same cache file at once
+var renderMu sync.Mutex
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>GOMFD</title>
+<style>
+body { background: #111; color: #ddd; font-family: sans-serif; margin: 1em; }
+a { color: #6c6; text-decoration: none; }
+ul { list-style: none; padding-left: 1.2em; }
+li { margin: .4em 0; }
+img { height: 96px; vertical-align: middle; margin-right: .6em; background: #000; }
+h2 small { color: #888; font-weight: normal; }
+</style>
+</head>
+<body>
+<h1>GOMFD</h1>
+{{range .}}<h2>{{.Name}} <small>{{.DisplayName}}</small></h2>
+{{template "configurations" .}}
+{{end}}
+<script src="/reload.js"></script>
+</body>
+</html>
+{{define "configurations"}}<ul>{{$module := .Module}}{{range .Configurations}}
+<li><a href="/view/{{$module}}/{{.Name}}"><img loading="lazy" src="/image/{{$module}}/{{.Name}}" data-module="{{$module}}" data-configuration="{{.Name}}" alt="">{{.Name}}</a>{{if .Configurations}}{{template "configurations" .}}{{end}}</li>{{end}}
+</ul>{{end}}`))
+
+var viewTemplate = template.Must(template.New("view").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Configuration}} - GOMFD</title>
+<style>
+html, body { margin: 0; height: 100%; background: #000; }
+img { display: block; width: 100%; height: 100%; object-fit: contain; }
+</style>
+</head>
+<body>
+<img src="/image/{{.Module}}/{{.Configuration}}" data-module="{{.Module}}" data-configuration="{{.Configuration}}" alt="{{.Configuration}}">
+<script src="/reload.js"></script>
+</body>
+</html>`))
+
+// indexNode is a module or configuration on the index page, Module is the module name the links use
+type indexNode struct {
+	Name           string
+	DisplayName    string
+	Module         string
+	Configurations []indexNode
+}
+
+func configurationNodes(module string, configs []Configuration) []indexNode {
+	var nodes []indexNode
+	for _, config := range configs {
+		nodes = append(nodes, indexNode{Name: config.Name, Module: module, Configurations: configurationNodes(module, config.Configurations)})
+	}
+	return nodes
+}
+
+// imagePath splits /image/<module>/<configuration> and /view/<module>/<configuration> into the names
+func imagePath(path string, prefix string) (string, string, bool) {
+	module, configuration, ok := strings.Cut(strings.TrimPrefix(path, prefix), "/")
+	return module, configuration, ok && module != "" && configuration != "" && !strings.Contains(configuration, "/")
+}
+
+// cachedComposite returns the cached composite of the configuration, rendering it first when it is not cached
+func cachedComposite(ctx context.Context, moduleName string, configurationName string) (string, error) {
+	renderMu.Lock()
+	defer renderMu.Unlock()
+	env, err := loadEnvironment()
+	if err != nil {
+		return "", err
+	}
+	modules := filterModules(env.Modules, Selection{ModuleName: moduleName})
+	if len(modules) == 0 {
+		return "", classify(ErrConfiguration, fmt.Errorf("module %s was not found", moduleName))
+	}
+	module := modules[0]
+	prepareModule(&module, env)
+	config := findPreparedConfiguration(module.Configurations, configurationName)
+	if config == nil {
+		return "", classify(ErrConfiguration, fmt.Errorf("configuration %s was not found in module %s", configurationName, moduleName))
+	}
+	file := generateConfigToFileMap(env.Config, module)[configurationPath(config)]
+	// The composite is written with these extensions by Renderer.save, the first one cached is served
+	extensions, err := newRunRenderer(env, RunOptions{}).OutputExtensions(config)
+	if err != nil {
+		return "", err
+	}
+	for _, extension := range extensions {
+		if _, err := os.Stat(file + extension); err == nil {
+			return file + extension, nil
+		}
+	}
+	selection := Selection{ModuleName: moduleName, ConfigurationName: configurationName}
+	if _, _, err := generateModules(ctx, env, selection, NewRunReport(RunOptions{ContinueOnError: true})); err != nil {
+		return "", err
+	}
+	return file + extensions[0], nil
+}
+
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	env, err := loadEnvironment()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var nodes []indexNode
+	for _, module := range env.Modules {
+		nodes = append(nodes, indexNode{Name: module.Name, DisplayName: module.DisplayName, Module: module.Name, Configurations: configurationNodes(module.Name, module.Configurations)})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, nodes); err != nil {
+		instance.Warnf("Failed to write the index: %v", err)
+	}
+}
+
+func serveView(w http.ResponseWriter, r *http.Request) {
+	module, configuration, ok := imagePath(r.URL.Path, "/view/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := viewTemplate.Execute(w, map[string]string{"Module": module, "Configuration": configuration}); err != nil {
+		instance.Warnf("Failed to write the view of %s: %v", configuration, err)
+	}
+}
+
+func serveImage(w http.ResponseWriter, r *http.Request) {
+	module, configuration, ok := imagePath(r.URL.Path, "/image/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	fileName, err := cachedComposite(r.Context(), module, configuration)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrConfiguration) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	// The composite changes whenever it is regenerated
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, fileName)
+}
+
+// previewServer routes the index, the full screen views, the composites, the live reload channel and the control API
+func previewServer() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveIndex)
+	mux.HandleFunc("/view/", serveView)
+	mux.HandleFunc("/image/", serveImage)
+	mux.HandleFunc("/reload.js", serveReloadScript)
+	mux.HandleFunc("/ws", serveLiveReload)
+	addControlAPI(mux)
+	return mux
+}
+
+func newServeCommand() *Command {
+	cmd := newCommand("serve", "", "Serve an index of the modules and their composites over HTTP, rendering the ones that are not cached")
+	address := cmd.Flags.String("addr", "localhost:8080", "Address to listen on, use :8080 to reach it from a tablet on the network")
+	output := addOutputFlag(cmd.Flags)
+	watch := cmd.Flags.Bool("watch", false, "Regenerate the modules whenever their files change and refresh the open pages")
+	interval := cmd.Flags.Duration("interval", 2*time.Second, "How often the files are checked for changes with -watch")
+	grpcAddress := cmd.Flags.String("grpc", "", "Also serve the gRPC control API on this address, for example localhost:8082")
+	cmd.Run = func(args []string) error {
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		if listener := startIPCListener(); listener != nil {
+			defer listener.Close()
+		}
+		if *grpcAddress != "" {
+			if err := startControlGRPC(*grpcAddress); err != nil {
+				return err
+			}
+		}
+		if *watch {
+			go watchModules(context.Background(), env, Selection{}, *interval, runtime.NumCPU())
+		}
+		instance.Infof("Serving the previews on http://%s/, press Ctrl+C to stop", *address)
+		return http.ListenAndServe(*address, previewServer())
+	}
+	return cmd
+}
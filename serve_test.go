@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCachedCompositeOutputFormats(t *testing.T) {
+	folder := t.TempDir()
+	useSavedGames(t, folder)
+	settings, err := writeFixtures(folder)
+	if err != nil {
+		t.Fatalf("writeFixtures: %v", err)
+	}
+	// LMFD is also written as a PNG, with only the PNG cached the server must not look for the JPEG
+	moduleFile := filepath.Join(settings.Modules, "Sample.json")
+	data, err := os.ReadFile(moduleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), `"name": "LMFD",`, `"name": "LMFD", "outputFormats": ["png"],`, 1))
+	if err := os.WriteFile(moduleFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReloadConfiguration(getConfigurationFilePath()); err != nil {
+		t.Fatalf("ReloadConfiguration: %v", err)
+	}
+	if _, err := renderFixtures(settings); err != nil {
+		t.Fatalf("renderFixtures: %v", err)
+	}
+	jpegs, _ := filepath.Glob(filepath.Join(settings.CachePath, "Sample", "LMFD", "LMFD.jpg"))
+	if len(jpegs) != 1 {
+		t.Fatalf("the JPEG of LMFD was not rendered into %s", settings.CachePath)
+	}
+	if err := os.Remove(jpegs[0]); err != nil {
+		t.Fatal(err)
+	}
+	fileName, err := cachedComposite(context.Background(), "Sample", "LMFD")
+	if err != nil {
+		t.Fatalf("cachedComposite: %v", err)
+	}
+	if filepath.Ext(fileName) != ".png" {
+		t.Errorf("cachedComposite = %s, want the cached PNG", fileName)
+	}
+	if _, err := os.Stat(jpegs[0]); err == nil {
+		t.Errorf("cachedComposite rendered %s again", jpegs[0])
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+// serviceName is the name GOMFD is registered under with the service manager
+const serviceName = "GOMFD"
+
+// daemonOptions are the flags service install records for service run
+type daemonOptions struct {
+	address    string
+	interval   time.Duration
+	savedGames string
+}
+
+func addDaemonFlags(fs *flag.FlagSet) *daemonOptions {
+	options := &daemonOptions{}
+	fs.StringVar(&options.address, "addr", "localhost:8080", "Address the previews and the control API are served on")
+	fs.DurationVar(&options.interval, "interval", 2*time.Second, "How often the files are checked for changes")
+	// Applied while parsing so the settings and the log are read from the right folder
+	fs.Func("saved-games", "Saved Games folder with the MFDMF settings, install records the folder of the installing user", func(value string) error {
+		options.savedGames, savedGamesOverride = value, value
+		return nil
+	})
+	return options
+}
+
+// arguments are the command line the service manager starts GOMFD with
+func (o *daemonOptions) arguments() []string {
+	return []string{"service", "run", "-addr", o.address, "-interval", o.interval.String(), "-saved-games", o.savedGames}
+}
+
+// runDaemon regenerates the modules that change and serves the previews and the control API until stop is closed
+func runDaemon(options *daemonOptions, stop <-chan struct{}) error {
+	env, err := loadEnvironment()
+	if err != nil {
+		return err
+	}
+	if listener := startIPCListener(); listener != nil {
+		defer listener.Close()
+	}
+	server := &http.Server{Addr: options.address, Handler: previewServer()}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+	watched := make(chan struct{})
+	watchContext, stopWatching := context.WithCancel(context.Background())
+	go func() {
+		defer close(watched)
+		watchModules(watchContext, env, Selection{}, options.interval, runtime.NumCPU())
+	}()
+	instance.Summary(fmt.Sprintf("%s started, serving on http://%s/", currentBuild(), options.address))
+
+	var result error
+	select {
+	case <-stop:
+	case err := <-served:
+		result = fmt.Errorf("failed to serve on %s: %w", options.address, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		instance.Warnf("Failed to stop serving: %v", err)
+	}
+	// The watcher finishes the images it is rendering before it stops
+	stopWatching()
+	<-watched
+	instance.Summary("GOMFD stopped")
+	return result
+}
+
+func newServiceInstallCommand() *Command {
+	cmd := newCommand("service install", "", "Install GOMFD as a Windows service or systemd user unit that regenerates changed modules and serves the control API")
+	options := addDaemonFlags(cmd.Flags)
+	cmd.Run = func(args []string) error {
+		if options.savedGames == "" {
+			options.savedGames = getSavedGamesFolder()
+		}
+		return installService(options)
+	}
+	return cmd
+}
+
+func newServiceUninstallCommand() *Command {
+	cmd := newCommand("service uninstall", "", "Stop and remove the GOMFD service")
+	cmd.Run = func(args []string) error {
+		return uninstallService()
+	}
+	return cmd
+}
+
+func newServiceRunCommand() *Command {
+	cmd := newCommand("service run", "", "Run as the service, the service manager starts GOMFD with this command")
+	options := addDaemonFlags(cmd.Flags)
+	cmd.Run = func(args []string) error {
+		return runService(options)
+	}
+	return cmd
+}
@@ -0,0 +1,90 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// systemdUnitFile is the user unit service install writes, it runs as the installing user
+func systemdUnitFile() (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(config, "systemd", "user", "gomfd.service"), nil
+}
+
+// installService writes a systemd user unit starting GOMFD with the daemon flags
+func installService(options *daemonOptions) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("service install is only supported on Windows and Linux with systemd")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	unitFile, err := systemdUnitFile()
+	if err != nil {
+		return err
+	}
+	command := []string{strconv.Quote(executable)}
+	for _, arg := range options.arguments() {
+		command = append(command, strconv.Quote(arg))
+	}
+	unit := fmt.Sprintf(`[Unit]
+Description=GOMFD regenerating the MFD images and serving the control API
+After=network.target
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+
+[Install]
+WantedBy=default.target
+`, strings.Join(command, " "))
+	if err := os.MkdirAll(filepath.Dir(unitFile), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(unitFile, []byte(unit), 0644); err != nil {
+		return err
+	}
+	instance.Infof("Wrote %s, start it with: systemctl --user daemon-reload && systemctl --user enable --now gomfd", unitFile)
+	return nil
+}
+
+func uninstallService() error {
+	unitFile, err := systemdUnitFile()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(unitFile); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("the GOMFD unit is not installed")
+		}
+		return err
+	}
+	instance.Infof("Removed %s, stop it with: systemctl --user disable --now gomfd", unitFile)
+	return nil
+}
+
+// runService runs until systemd or Ctrl+C stops it, the journal collects the console output
+func runService(options *daemonOptions) error {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+	return runDaemon(options, stop)
+}
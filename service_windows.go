@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// installService registers GOMFD with the service control manager to start automatically, and as an event log source
+func installService(options *daemonOptions) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager, run as administrator: %w", err)
+	}
+	defer manager.Disconnect()
+	if existing, err := manager.OpenService(serviceName); err == nil {
+		existing.Close()
+		return fmt.Errorf("the %s service is already installed, uninstall it first", serviceName)
+	}
+	config := mgr.Config{
+		DisplayName: "GOMFD",
+		Description: "Regenerates the MFD images when the modules change and serves the previews and the control API",
+		StartType:   mgr.StartAutomatic,
+	}
+	service, err := manager.CreateService(serviceName, executable, config, options.arguments()...)
+	if err != nil {
+		return fmt.Errorf("failed to create the %s service: %w", serviceName, err)
+	}
+	defer service.Close()
+	if err := eventlog.InstallAsEventCreate(serviceName, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		service.Delete()
+		return fmt.Errorf("failed to register the %s event log source: %w", serviceName, err)
+	}
+	instance.Infof("Installed the %s service for %s, start it with: sc start %s", serviceName, options.savedGames, serviceName)
+	return nil
+}
+
+// uninstallService stops the service when it runs and removes it with its event log source
+func uninstallService() error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager, run as administrator: %w", err)
+	}
+	defer manager.Disconnect()
+	service, err := manager.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("the %s service is not installed", serviceName)
+	}
+	defer service.Close()
+	if status, err := service.Control(svc.Stop); err == nil {
+		for deadline := time.Now().Add(30 * time.Second); status.State != svc.Stopped && time.Now().Before(deadline); {
+			time.Sleep(500 * time.Millisecond)
+			if status, err = service.Query(); err != nil {
+				break
+			}
+		}
+	}
+	if err := service.Delete(); err != nil {
+		return fmt.Errorf("failed to remove the %s service: %w", serviceName, err)
+	}
+	eventlog.Remove(serviceName)
+	instance.Infof("Removed the %s service", serviceName)
+	return nil
+}
+
+// serviceHandler answers the service control manager
+type serviceHandler struct {
+	options *daemonOptions
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- runDaemon(h.options, stop)
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for {
+		select {
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				changes <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				close(stop)
+				<-done
+				return false, 0
+			}
+		case err := <-done:
+			if err != nil {
+				instance.Error(err.Error())
+				return false, 1
+			}
+			return false, 0
+		}
+	}
+}
+
+// runService runs under the service control manager, or in the console with Ctrl+C to stop when started by hand
+func runService(options *daemonOptions) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		stop := make(chan struct{})
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		defer signal.Stop(interrupt)
+		go func() {
+			<-interrupt
+			close(stop)
+		}()
+		return runDaemon(options, stop)
+	}
+
+	events, err := eventlog.Open(serviceName)
+	if err == nil {
+		defer events.Close()
+		instance.SetServiceLog(func(level LogLevel, message string) {
+			switch level {
+			case LevelError:
+				events.Error(1, message)
+			case LevelWarn:
+				events.Warning(1, message)
+			default:
+				events.Info(1, message)
+			}
+		})
+		defer instance.SetServiceLog(nil)
+	}
+	return svc.Run(serviceName, &serviceHandler{options: options})
+}
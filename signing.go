@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// packageSignatureName holds the base64 Ed25519 signature of manifest.json, the manifest carries the checksum of every
+// other file so the signature covers the whole package
+const packageSignatureName = "manifest.sig"
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// signManifest is the base64 signature of the manifest
+func signManifest(key ed25519.PrivateKey, manifest []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest))
+}
+
+// readSigningKey reads a private key file of keygen, the base64 Ed25519 private key
+func readSigningKey(fileName string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(longPath(fileName))
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%s is not a private key written by gomfd keygen", fileName)
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+// parsePublicKey reads a base64 Ed25519 public key as keygen prints it
+func parsePublicKey(value string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%q is not a public key printed by gomfd keygen", value)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifyManifestSignature checks a signature against the trustedKeys setting, a package without a signature is only
+// refused with requireSignedPackages
+func verifyManifestSignature(settings *MfdConfig, manifest []byte, signature []byte) error {
+	if signature == nil {
+		if settings.RequireSignedPackages {
+			return errors.New("the package is not signed and requireSignedPackages is set")
+		}
+		return nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("%s is not a signature: %w", packageSignatureName, err)
+	}
+	if len(settings.TrustedKeys) == 0 {
+		return errors.New("the package is signed but trustedKeys in appsettings.json has no key to check it with")
+	}
+	for _, trusted := range settings.TrustedKeys {
+		key, err := parsePublicKey(trusted)
+		if err != nil {
+			return fmt.Errorf("trustedKeys: %w", err)
+		}
+		if ed25519.Verify(key, manifest, decoded) {
+			return nil
+		}
+	}
+	return errors.New("the signature of the package matches none of the trustedKeys, it was changed or signed by someone else")
+}
+
+func newKeygenCommand() *Command {
+	cmd := newCommand("keygen", "", "Write a private key for signing packages with gomfd pack -sign and print its public key for trustedKeys")
+	fileName := cmd.Flags.String("o", "gomfd-signing.key", "Private key file to write, keep it to yourself")
+	cmd.Run = func(args []string) error {
+		if fileExists(*fileName) {
+			return fmt.Errorf("%s exists, a new key would replace the one your packages are signed with", *fileName)
+		}
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(longPath(*fileName), []byte(base64.StdEncoding.EncodeToString(private)+"\n"), 0600); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote the private key to %s, add the public key to trustedKeys:\n%s\n", *fileName, base64.StdEncoding.EncodeToString(public))
+		return nil
+	}
+	return cmd
+}
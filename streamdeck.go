@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/disintegration/imaging"
+	"github.com/gorilla/websocket"
+)
+
+// streamDeckPluginUUID names the plugin folder the Stream Deck app loads GOMFD from
+const streamDeckPluginUUID = "com.scottymac52.gomfd"
+
+// streamDeckIconSize is the key image size of the XL, the app scales it down for the smaller keys
+const streamDeckIconSize = 144
+
+//go:embed streamdeck/manifest.json
+var streamDeckManifest []byte
+
+// StreamDeckKey runs a PageAction when the key at column and row is pressed, its icon is the page it shows or, for next and previous, the page its switch is on
+type StreamDeckKey struct {
+	Column int `json:"column"`
+	Row    int `json:"row"`
+	PageAction
+}
+
+func (k StreamDeckKey) String() string {
+	return fmt.Sprintf("Stream Deck key %d,%d", k.Column, k.Row)
+}
+
+// StreamDeckSettings are the Stream Deck keys of appsettings.json
+type StreamDeckSettings struct {
+	Keys []StreamDeckKey `json:"keys,omitempty"`
+}
+
+// keyPosition is the column and row of a key
+type keyPosition struct {
+	Column int `json:"column"`
+	Row    int `json:"row"`
+}
+
+// streamDeckEvent is a message of the Stream Deck WebSocket SDK, only with the fields GOMFD uses
+type streamDeckEvent struct {
+	Event   string `json:"event"`
+	Context string `json:"context"`
+	Payload struct {
+		Coordinates keyPosition `json:"coordinates"`
+	} `json:"payload"`
+}
+
+// StreamDeck is the connection to the Stream Deck app, it sets the key icons and reports the pressed keys
+type StreamDeck struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	done    chan struct{}
+
+	mu       sync.Mutex
+	contexts map[keyPosition]string
+	keys     []StreamDeckKey
+	icons    map[string]string
+	current  map[string]string
+	onKey    func(index int)
+}
+
+// activeStreamDeck is the Stream Deck the displays are bound to, nil unless GOMFD runs as the Stream Deck plugin
+var activeStreamDeck *StreamDeck
+
+// connectStreamDeck registers the plugin with the Stream Deck app using the arguments the app started it with
+func connectStreamDeck(port int, pluginUUID string, registerEvent string) (*StreamDeck, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws://127.0.0.1:%d", port), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the Stream Deck app on port %d: %w", port, err)
+	}
+	deck := &StreamDeck{conn: conn, done: make(chan struct{}), contexts: map[keyPosition]string{}, icons: map[string]string{}, current: map[string]string{}}
+	if err := deck.send(map[string]string{"event": registerEvent, "uuid": pluginUUID}); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to register with the Stream Deck app: %w", err)
+	}
+	go deck.receive()
+	return deck, nil
+}
+
+func (d *StreamDeck) send(message any) error {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	return d.conn.WriteJSON(message)
+}
+
+func (d *StreamDeck) receive() {
+	defer close(d.done)
+	for {
+		var event streamDeckEvent
+		if err := d.conn.ReadJSON(&event); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && !errors.Is(err, io.EOF) {
+				instance.Warnf("Lost the Stream Deck connection: %v", err)
+			}
+			return
+		}
+		position := event.Payload.Coordinates
+		switch event.Event {
+		case "willAppear":
+			d.mu.Lock()
+			d.contexts[position] = event.Context
+			d.refreshKey(position)
+			d.mu.Unlock()
+		case "willDisappear":
+			d.mu.Lock()
+			delete(d.contexts, position)
+			d.mu.Unlock()
+		case "keyDown":
+			d.mu.Lock()
+			index, onKey := d.keyAt(position), d.onKey
+			d.mu.Unlock()
+			if index < 0 {
+				instance.Debugf("Stream Deck key %d,%d is not bound", position.Column, position.Row)
+			} else if onKey != nil {
+				onKey(index)
+			}
+		}
+	}
+}
+
+// Done is closed when the Stream Deck app closes the connection
+func (d *StreamDeck) Done() <-chan struct{} {
+	return d.done
+}
+
+func (d *StreamDeck) Close() error {
+	return d.conn.Close()
+}
+
+// Bind sets the keys and the icons of the pages the windows show, every visible key is redrawn
+func (d *StreamDeck) Bind(keys []StreamDeckKey, windows []*DisplayWindow) error {
+	icons := map[string]string{}
+	for _, window := range windows {
+		for _, page := range window.Pages {
+			icon, err := keyIcon(page.Image)
+			if err != nil {
+				return fmt.Errorf("failed to make the Stream Deck icon of %s: %w", page.Configuration, err)
+			}
+			icons[iconName(window.Display, page.Configuration)] = icon
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys, d.icons = keys, icons
+	d.current = map[string]string{}
+	for _, window := range windows {
+		d.current[strings.ToLower(window.Display)] = window.Page().Configuration
+	}
+	for position := range d.contexts {
+		d.refreshKey(position)
+	}
+	return nil
+}
+
+// OnKey sets the function called with the index of the bound key that was pressed, it is called from the connection goroutine
+func (d *StreamDeck) OnKey(onKey func(index int)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onKey = onKey
+}
+
+// PageChanged redraws the next and previous keys of a display after it turned to another page
+func (d *StreamDeck) PageChanged(display string, configuration string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.current[strings.ToLower(display)] = configuration
+	for _, key := range d.keys {
+		if key.Step() != 0 && strings.EqualFold(key.Display, display) {
+			d.refreshKey(keyPosition{Column: key.Column, Row: key.Row})
+		}
+	}
+}
+
+// keyAt is the index of the key bound to the position, or -1
+func (d *StreamDeck) keyAt(position keyPosition) int {
+	for i, key := range d.keys {
+		if key.Column == position.Column && key.Row == position.Row {
+			return i
+		}
+	}
+	return -1
+}
+
+// refreshKey sends the icon of the key at the position when it is visible and bound, d.mu must be held
+func (d *StreamDeck) refreshKey(position keyPosition) {
+	context, visible := d.contexts[position]
+	index := d.keyAt(position)
+	if !visible || index < 0 {
+		return
+	}
+	key := d.keys[index]
+	configuration := key.Configuration
+	if key.Step() != 0 {
+		configuration = d.current[strings.ToLower(key.Display)]
+	}
+	icon, ok := d.icons[iconName(key.Display, configuration)]
+	if !ok {
+		return
+	}
+	message := map[string]any{"event": "setImage", "context": context, "payload": map[string]any{"image": icon, "target": 0}}
+	if err := d.send(message); err != nil {
+		instance.Warnf("Failed to set the icon of %s: %v", key, err)
+	}
+}
+
+func iconName(display string, configuration string) string {
+	return strings.ToLower(display + "/" + configuration)
+}
+
+// keyIcon is the page as the PNG data URL setImage expects
+func keyIcon(img image.Image) (string, error) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, letterbox(img, streamDeckIconSize, streamDeckIconSize)); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes()), nil
+}
+
+// validateStreamDeckKeys checks the Stream Deck keys of the settings, any invalid one is a configuration error
+func validateStreamDeckKeys(keys []StreamDeckKey) error {
+	seen := map[keyPosition]bool{}
+	for _, key := range keys {
+		position := keyPosition{Column: key.Column, Row: key.Row}
+		if key.Column < 0 || key.Row < 0 {
+			return classify(ErrConfiguration, fmt.Errorf("%s is out of range, columns and rows are numbered from 0", key))
+		}
+		if seen[position] {
+			return classify(ErrConfiguration, fmt.Errorf("%s is bound twice", key))
+		}
+		seen[position] = true
+		if err := key.validate(key.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamDeckPluginFolder is the folder the Stream Deck app loads the GOMFD plugin from
+func streamDeckPluginFolder() (string, error) {
+	appData, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appData, "Elgato", "StreamDeck", "Plugins", streamDeckPluginUUID+".sdPlugin"), nil
+}
+
+// installStreamDeckPlugin copies the running executable into the plugin folder with the manifest and its icons
+func installStreamDeckPlugin(folder string) error {
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(folder, "manifest.json"), streamDeckManifest, 0644); err != nil {
+		return err
+	}
+	for name, size := range map[string]int{"icon.png": 72, "icon@2x.png": 144} {
+		if err := writePNG(filepath.Join(folder, name), pluginIcon(size)); err != nil {
+			return err
+		}
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	source, err := os.Open(executable)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.Create(filepath.Join(folder, "gomfd.exe"))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
+
+// pluginIcon is the icon of the plugin and its action, a green MFD frame on black
+func pluginIcon(size int) image.Image {
+	icon := imaging.New(size, size, color.Black)
+	green := color.NRGBA{R: 0x30, G: 0xd0, B: 0x40, A: 0xff}
+	border, inset := size/12, size/6
+	for y := inset; y < size-inset; y++ {
+		for x := inset; x < size-inset; x++ {
+			if x < inset+border || x >= size-inset-border || y < inset+border || y >= size-inset-border {
+				icon.Set(x, y, green)
+			}
+		}
+	}
+	return icon
+}
+
+func newStreamDeckCommand() *Command {
+	cmd := newCommand("streamdeck", "", "Run as the Stream Deck plugin, showing the displays and switching their pages from the streamDeck keys")
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	install := cmd.Flags.Bool("install", false, "Install the plugin into the Stream Deck app instead of running it")
+	moduleName := cmd.Flags.String("mod", "", "Module to show, defaults to the defaultConfiguration")
+	port := cmd.Flags.Int("port", 0, "WebSocket port of the Stream Deck app, passed by the app")
+	pluginUUID := cmd.Flags.String("pluginUUID", "", "Plugin id, passed by the Stream Deck app")
+	registerEvent := cmd.Flags.String("registerEvent", "", "Registration event, passed by the Stream Deck app")
+	cmd.Flags.String("info", "", "Application and device information, passed by the Stream Deck app")
+	cmd.Run = func(args []string) error {
+		if *install {
+			folder, err := streamDeckPluginFolder()
+			if err == nil {
+				err = installStreamDeckPlugin(folder)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to install the Stream Deck plugin: %w", err)
+			}
+			instance.Infof("Installed the Stream Deck plugin into %s, restart the Stream Deck app to load it", folder)
+			return nil
+		}
+		if *port == 0 || *pluginUUID == "" || *registerEvent == "" {
+			return errors.New("streamdeck is started by the Stream Deck app, install the plugin with -install")
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		if *moduleName == "" {
+			*moduleName = env.Config.DefaultConfiguration
+		}
+		if *moduleName == "" {
+			return errors.New("streamdeck needs -mod or a defaultConfiguration in the settings")
+		}
+		deck, err := connectStreamDeck(*port, *pluginUUID, *registerEvent)
+		if err != nil {
+			return err
+		}
+		defer deck.Close()
+		activeStreamDeck = deck
+		defer func() { activeStreamDeck = nil }()
+		if listener := startIPCListener(); listener != nil {
+			defer listener.Close()
+		}
+		return runDisplays(*moduleName, "", *runOptions, deck.Done())
+	}
+	return cmd
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// touchPortalPage is a Touch Portal page with a row of buttons per display, one per page and a next button for a switch
+type touchPortalPage struct {
+	Name    string              `json:"name"`
+	Columns int                 `json:"columns"`
+	Rows    int                 `json:"rows"`
+	Buttons []touchPortalButton `json:"buttons"`
+}
+
+// touchPortalButton shows a composite as its background and sends a select request to the control API when pressed
+type touchPortalButton struct {
+	Column     int               `json:"column"`
+	Row        int               `json:"row"`
+	Title      string            `json:"title"`
+	Background string            `json:"background,omitempty"`
+	Action     touchPortalAction `json:"action"`
+}
+
+// touchPortalAction is the HTTP Post action of Touch Portal with the request of the control API
+type touchPortalAction struct {
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	Body        string `json:"body"`
+	ContentType string `json:"contentType"`
+}
+
+// touchPortalPageOf lays out the displays of the module, api is the address of the control API the buttons post to
+func touchPortalPageOf(env *Environment, module *Module, api string) (touchPortalPage, error) {
+	files := generateConfigToFileMap(env.Config, *module)
+	page := touchPortalPage{Name: "GOMFD " + module.Name}
+	selectAction := func(display string, action PageAction) touchPortalAction {
+		action.Display = display
+		body, _ := json.Marshal(action)
+		return touchPortalAction{
+			Type:        "HTTP Post",
+			URL:         strings.TrimSuffix(api, "/") + "/displays/" + url.PathEscape(display) + "/select",
+			Body:        string(body),
+			ContentType: "application/json",
+		}
+	}
+	for i := range module.Configurations {
+		config := &module.Configurations[i]
+		if config.Display == nil || (config.Enabled != nil && !*config.Enabled) {
+			continue
+		}
+		row := page.Rows
+		pages := []*Configuration{config}
+		for j := range config.Configurations {
+			pages = append(pages, &config.Configurations[j])
+		}
+		for column, shown := range pages {
+			background, err := filepath.Abs(files[configurationPath(shown)] + ".jpg")
+			if err != nil {
+				return page, err
+			}
+			page.Buttons = append(page.Buttons, touchPortalButton{
+				Column:     column,
+				Row:        row,
+				Title:      shown.Name,
+				Background: background,
+				Action:     selectAction(config.Display.Name, PageAction{Configuration: shown.Name}),
+			})
+		}
+		columns := len(pages)
+		if config.UseAsSwitch != nil && *config.UseAsSwitch {
+			page.Buttons = append(page.Buttons, touchPortalButton{
+				Column: columns,
+				Row:    row,
+				Title:  config.Display.Name + " next",
+				Action: selectAction(config.Display.Name, PageAction{Action: "next"}),
+			})
+			columns++
+		}
+		page.Columns = max(page.Columns, columns)
+		page.Rows++
+	}
+	if page.Rows == 0 {
+		return page, classify(ErrConfiguration, fmt.Errorf("module %s has no configurations assigned to a display", module.Name))
+	}
+	return page, nil
+}
+
+// exportTouchPortal writes the Touch Portal page of the module to fileName
+func exportTouchPortal(env *Environment, module *Module, api string, fileName string) error {
+	page, err := touchPortalPageOf(env, module, api)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(page, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ensurePathExists(filepath.Dir(fileName)); err != nil {
+		return classify(ErrEncode, err)
+	}
+	if err := os.WriteFile(longPath(fileName), append(data, '\n'), 0644); err != nil {
+		return classify(ErrEncode, fmt.Errorf("failed to write %s: %w", fileName, err))
+	}
+	instance.Infof("Exported %d Touch Portal buttons of %s to %s", len(page.Buttons), module.Name, fileName)
+	return nil
+}
+
+func newTouchPortalCommand() *Command {
+	cmd := newCommand("touchportal", "", "Export a Touch Portal page per module with the composites as buttons selecting the pages through the control API")
+	selectionArgs := addSelectionFlags(cmd.Flags)
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	folder := cmd.Flags.String("dir", ".", "Folder the <module>.touchportal.json files are written to")
+	api := cmd.Flags.String("api", "http://localhost:8081", "Address of the control API of gomfd display -api, as the PC running Touch Portal reaches it")
+	cmd.Run = func(args []string) error {
+		if _, err := url.ParseRequestURI(*api); err != nil {
+			return fmt.Errorf("-api %s is not a URL: %w", *api, err)
+		}
+		selection, err := selectionArgs.Selection()
+		if err != nil {
+			return err
+		}
+		env, err := loadEnvironment()
+		if err != nil {
+			return err
+		}
+		useOutputDirectory(*output)
+		ctx, stop := interruptContext()
+		defer stop()
+		// The buttons show the cached composites, bring them up to date
+		if _, _, err := generateModules(ctx, env, selection, NewRunReport(*runOptions)); err != nil {
+			return err
+		}
+		var failed []string
+		for _, module := range filterModules(env.Modules, selection) {
+			prepareModule(&module, env)
+			if err := exportTouchPortal(env, &module, *api, filepath.Join(*folder, module.Name+".touchportal.json")); err != nil {
+				instance.Error(err.Error())
+				failed = append(failed, module.Name)
+			}
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("the Touch Portal page of %s could not be exported", strings.Join(failed, ", "))
+		}
+		return nil
+	}
+	return cmd
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// trashKeep is how many clears the trash keeps for clear-cache -undo-last-clear, older ones are deleted
+const trashKeep = 5
+
+// trashManifestName records in each trash folder which cache it came from and what was moved out of it
+const trashManifestName = "trash.json"
+
+// trashManifest lists the entries of the cache folder a clear moved into its trash folder
+type trashManifest struct {
+	Cache   string    `json:"cache"`
+	Cleared time.Time `json:"cleared"`
+	Entries []string  `json:"entries"`
+}
+
+// getTrashFolder holds a folder per clear of the cache, Saved Games\MFDMF\Trash
+func getTrashFolder() string {
+	return filepath.Join(getSavedGamesFolder(), "MFDMF", "Trash")
+}
+
+// moveTree renames a file or folder, across volumes it is copied and then removed
+func moveTree(source string, target string) error {
+	if err := os.Rename(longPath(source), longPath(target)); err == nil {
+		return nil
+	}
+	err := filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		destination := filepath.Join(target, relative)
+		if entry.IsDir() {
+			return ensurePathExists(destination)
+		}
+		return copyFile(path, destination)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(longPath(source))
+}
+
+func copyFile(source string, target string) error {
+	in, err := os.Open(longPath(source))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(longPath(target))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// trashCacheEntries moves the named files and folders of the cache folder into a new trash folder and returns it,
+// the manifest lists what was moved even when a later entry fails so an undo restores it
+func trashCacheEntries(cacheDirectory string, names []string) (string, error) {
+	cleared := time.Now()
+	folder := filepath.Join(getTrashFolder(), cleared.Format("20060102-150405.000"))
+	if err := ensurePathExists(folder); err != nil {
+		return "", err
+	}
+	manifest := trashManifest{Cache: cacheDirectory, Cleared: cleared}
+	var moveErr error
+	for _, name := range names {
+		if moveErr = moveTree(filepath.Join(cacheDirectory, name), filepath.Join(folder, name)); moveErr != nil {
+			break
+		}
+		manifest.Entries = append(manifest.Entries, name)
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		err = os.WriteFile(longPath(filepath.Join(folder, trashManifestName)), data, 0644)
+	}
+	if err := errors.Join(moveErr, err); err != nil {
+		return folder, err
+	}
+	pruneTrash(trashKeep)
+	return folder, nil
+}
+
+// trashFolders lists the folders of the trash, the newest first
+func trashFolders() []string {
+	entries, err := os.ReadDir(longPath(getTrashFolder()))
+	if err != nil {
+		return nil
+	}
+	var folders []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			folders = append(folders, filepath.Join(getTrashFolder(), entry.Name()))
+		}
+	}
+	// The names are the time of the clear, so they sort by it
+	sort.Sort(sort.Reverse(sort.StringSlice(folders)))
+	return folders
+}
+
+// pruneTrash deletes all but the newest keep clears
+func pruneTrash(keep int) {
+	folders := trashFolders()
+	for i := keep; i < len(folders); i++ {
+		if err := os.RemoveAll(longPath(folders[i])); err != nil {
+			instance.Warnf("Failed to empty the trash folder %s: %v", folders[i], err)
+		}
+	}
+}
+
+// undoLastClear moves the entries of the newest clear back into the cache it came from, an entry the cache has again
+// since, because it was regenerated, is left in the trash
+func undoLastClear() (int, error) {
+	folders := trashFolders()
+	if len(folders) == 0 {
+		return 0, errors.New("there is no cleared cache to restore")
+	}
+	folder := folders[0]
+	data, err := os.ReadFile(longPath(filepath.Join(folder, trashManifestName)))
+	if err != nil {
+		return 0, fmt.Errorf("the trash folder %s cannot be restored: %w", folder, err)
+	}
+	var manifest trashManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return 0, jsonError(filepath.Join(folder, trashManifestName), data, err)
+	}
+	if err := ensurePathExists(manifest.Cache); err != nil {
+		return 0, err
+	}
+	restored, kept := 0, 0
+	for _, name := range manifest.Entries {
+		target := filepath.Join(manifest.Cache, name)
+		if fileExists(target) {
+			instance.Warnf("%s exists again, its cleared copy stays in %s", target, folder)
+			kept++
+			continue
+		}
+		if err := moveTree(filepath.Join(folder, name), target); err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	if kept == 0 {
+		if err := os.RemoveAll(longPath(folder)); err != nil {
+			instance.Warnf("Failed to remove the restored trash folder %s: %v", folder, err)
+		}
+	}
+	instance.Infof("Restored %d entries of the clear of %s into %s", restored, manifest.Cleared.Format(time.DateTime), manifest.Cache)
+	return restored, nil
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// runTray is only available on Windows
+func runTray(options RunOptions) error {
+	return errors.New("tray mode is only supported on Windows")
+}
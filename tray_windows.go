@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	trayClassName       = "GOMFDTray"
+	trayCallbackMessage = wmApp + 1
+	trayIconID          = 1
+
+	trayRegenerateAll = 1
+	trayClearCache    = 2
+	trayOpenLogs      = 3
+	trayExit          = 4
+	trayModuleBase    = 100
+)
+
+// tray keeps gomfd resident in the notification area with a menu of the common actions
+type tray struct {
+	hwnd    uintptr
+	options RunOptions
+	busy    atomic.Bool
+	modules []string
+}
+
+// activeTray is the tray the window procedure dispatches to
+var activeTray *tray
+
+// runTray shows the tray icon and processes its menu until Exit is chosen
+func runTray(options RunOptions) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	t := &tray{options: options}
+	activeTray = t
+	if err := registerWindowClass(trayClassName, trayWndProc, 0); err != nil {
+		return fmt.Errorf("failed to register the tray window: %w", err)
+	}
+	hwnd, _, err := procCreateWindowExW.Call(0, uintptr(unsafe.Pointer(utf16Ptr(trayClassName))), uintptr(unsafe.Pointer(utf16Ptr("GOMFD"))), 0, 0, 0, 0, 0, hwndMessage, 0, moduleHandle(), 0)
+	if hwnd == 0 {
+		return fmt.Errorf("failed to create the tray window: %w", err)
+	}
+	t.hwnd = hwnd
+
+	icon, _, _ := procLoadIconW.Call(0, idiApplication)
+	data := t.iconData()
+	data.Flags = nifMessage | nifIcon | nifTip
+	data.CallbackMessage = trayCallbackMessage
+	data.Icon = icon
+	copyUTF16(data.Tip[:], "GOMFD")
+	if ok, _, err := procShellNotifyIconW.Call(nimAdd, uintptr(unsafe.Pointer(&data))); ok == 0 {
+		return fmt.Errorf("failed to add the tray icon: %w", err)
+	}
+	defer func() {
+		data := t.iconData()
+		procShellNotifyIconW.Call(nimDelete, uintptr(unsafe.Pointer(&data)))
+	}()
+
+	instance.Log("GOMFD is running in the system tray")
+	runMessageLoop()
+	return nil
+}
+
+func (t *tray) iconData() notifyIconData {
+	data := notifyIconData{HWnd: t.hwnd, ID: trayIconID}
+	data.Size = uint32(unsafe.Sizeof(data))
+	return data
+}
+
+func trayWndProc(hwnd uintptr, message uint32, wParam uintptr, lParam uintptr) uintptr {
+	switch message {
+	case trayCallbackMessage:
+		switch lParam & 0xFFFF {
+		case wmLButtonUp, wmRButtonUp:
+			activeTray.showMenu()
+		}
+		return 0
+	case wmDestroy:
+		procPostQuitMessage.Call(0)
+		return 0
+	}
+	return defWindowProc(hwnd, message, wParam, lParam)
+}
+
+// showMenu pops up the tray menu at the cursor and runs the chosen action
+func (t *tray) showMenu() {
+	menu, _, _ := procCreatePopupMenu.Call()
+	defer procDestroyMenu.Call(menu)
+
+	generateFlags := uintptr(mfString)
+	if t.busy.Load() {
+		generateFlags |= mfGrayed
+	}
+
+	modulesMenu, _, _ := procCreatePopupMenu.Call()
+	t.modules = nil
+	if settings := currentSettings(); settings != nil {
+		if modules, err := readModuleFiles(settings.Modules); err == nil {
+			for i, module := range modules {
+				t.modules = append(t.modules, module.Name)
+				procAppendMenuW.Call(modulesMenu, generateFlags, uintptr(trayModuleBase+i), uintptr(unsafe.Pointer(utf16Ptr(module.DisplayName))))
+			}
+		}
+	}
+
+	procAppendMenuW.Call(menu, generateFlags, trayRegenerateAll, uintptr(unsafe.Pointer(utf16Ptr("Regenerate all"))))
+	procAppendMenuW.Call(menu, mfPopup, modulesMenu, uintptr(unsafe.Pointer(utf16Ptr("Regenerate module…"))))
+	procAppendMenuW.Call(menu, generateFlags, trayClearCache, uintptr(unsafe.Pointer(utf16Ptr("Clear cache"))))
+	procAppendMenuW.Call(menu, mfString, trayOpenLogs, uintptr(unsafe.Pointer(utf16Ptr("Open logs"))))
+	procAppendMenuW.Call(menu, mfSeparator, 0, 0)
+	procAppendMenuW.Call(menu, mfString, trayExit, uintptr(unsafe.Pointer(utf16Ptr("Exit"))))
+
+	var cursor point
+	procGetCursorPos.Call(uintptr(unsafe.Pointer(&cursor)))
+	procSetForegroundWindow.Call(t.hwnd)
+	command, _, _ := procTrackPopupMenu.Call(menu, tpmReturnCmd|tpmNoNotify|tpmRightButton, uintptr(cursor.X), uintptr(cursor.Y), 0, t.hwnd, 0)
+	procPostMessageW.Call(t.hwnd, wmNull, 0, 0)
+
+	switch {
+	case command == trayRegenerateAll:
+		t.regenerate(Selection{}, "all modules")
+	case command == trayClearCache:
+		t.clearCache()
+	case command == trayOpenLogs:
+		if err := openInViewer(instance.logFolder()); err != nil {
+			instance.Errorf("Failed to open the logs: %v", err)
+		}
+	case command == trayExit:
+		procDestroyWindow.Call(t.hwnd)
+	case command >= trayModuleBase && int(command-trayModuleBase) < len(t.modules):
+		name := t.modules[command-trayModuleBase]
+		t.regenerate(Selection{ModuleName: name}, name)
+	}
+}
+
+// regenerate renders the selection in the background and shows the outcome as a notification
+func (t *tray) regenerate(selection Selection, description string) {
+	if !t.busy.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer t.busy.Store(false)
+		env, err := loadEnvironment()
+		if err != nil {
+			t.notify("GOMFD", err.Error(), true)
+			return
+		}
+		options := t.options
+		options.Force = true
+		report := NewRunReport(options)
+		_, _, err = generateModules(context.Background(), env, selection, report)
+		if err != nil {
+			t.notify("GOMFD", fmt.Sprintf("Regenerating %s failed: %v", description, err), true)
+			return
+		}
+		t.notify("GOMFD", fmt.Sprintf("Regenerated %d configurations of %s", report.Rendered, description), false)
+	}()
+}
+
+func (t *tray) clearCache() {
+	if !t.busy.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer t.busy.Store(false)
+		if err := clearCacheFolder(currentSettings(), false); err != nil {
+			t.notify("GOMFD", err.Error(), true)
+			return
+		}
+		t.notify("GOMFD", "The cache has been moved to the trash, clear-cache -undo-last-clear restores it", false)
+	}()
+}
+
+// notify shows a balloon notification from the tray icon
+func (t *tray) notify(title string, text string, isError bool) {
+	data := t.iconData()
+	data.Flags = nifInfo
+	data.InfoFlags = niifInfo
+	if isError {
+		data.InfoFlags = niifError
+	}
+	copyUTF16(data.InfoTitle[:], title)
+	copyUTF16(data.Info[:], text)
+	procShellNotifyIconW.Call(nimModify, uintptr(unsafe.Pointer(&data)))
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// browserNode is a module or a configuration in the browser tree
+type browserNode struct {
+	module   *Module
+	config   *Configuration
+	output   string
+	depth    int
+	expanded bool
+	children []*browserNode
+}
+
+func (n *browserNode) label() string {
+	if n.config == nil {
+		return fmt.Sprintf("%s (%s)", n.module.Name, n.module.DisplayName)
+	}
+	return n.config.Name
+}
+
+// selection is what regenerating or previewing the node renders
+func (n *browserNode) selection() Selection {
+	selection := Selection{ModuleName: n.module.Name}
+	if n.config != nil {
+		selection.ConfigurationName = n.config.Name
+	}
+	return selection
+}
+
+// browserDoneMsg reports the outcome of a regeneration or preview started from the browser
+type browserDoneMsg struct {
+	status string
+}
+
+// browserModel is the bubbletea model of the module browser
+type browserModel struct {
+	options RunOptions
+	roots   []*browserNode
+	visible []*browserNode
+	cursor  int
+	offset  int
+	width   int
+	height  int
+	busy    bool
+	status  string
+}
+
+// newBrowserModel loads the modules with their resolved geometry into a collapsed tree
+func newBrowserModel(options RunOptions) (*browserModel, error) {
+	env, err := loadEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	m := &browserModel{options: options, width: 80, height: 24}
+	for i := range env.Modules {
+		module := &env.Modules[i]
+		prepareModule(module, env)
+		outputs := generateConfigToFileMap(env.Config, *module)
+		root := &browserNode{module: module}
+		for j := range module.Configurations {
+			root.children = append(root.children, newConfigurationNode(module, &module.Configurations[j], outputs, 1))
+		}
+		m.roots = append(m.roots, root)
+	}
+	m.status = fmt.Sprintf("Loaded %d modules from %s", len(m.roots), env.Config.Modules)
+	m.refresh()
+	return m, nil
+}
+
+func newConfigurationNode(module *Module, config *Configuration, outputs map[string]string, depth int) *browserNode {
+	node := &browserNode{module: module, config: config, output: outputs[configurationPath(config)], depth: depth}
+	for i := range config.Configurations {
+		node.children = append(node.children, newConfigurationNode(module, &config.Configurations[i], outputs, depth+1))
+	}
+	return node
+}
+
+// refresh rebuilds the list of visible nodes after a node was expanded or collapsed
+func (m *browserModel) refresh() {
+	m.visible = m.visible[:0]
+	var walk func(nodes []*browserNode)
+	walk = func(nodes []*browserNode) {
+		for _, node := range nodes {
+			m.visible = append(m.visible, node)
+			if node.expanded {
+				walk(node.children)
+			}
+		}
+	}
+	walk(m.roots)
+	if m.cursor >= len(m.visible) {
+		m.cursor = len(m.visible) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+func (m *browserModel) selected() *browserNode {
+	if len(m.visible) == 0 {
+		return nil
+	}
+	return m.visible[m.cursor]
+}
+
+func (m *browserModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *browserModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
+	switch message := message.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = message.Width, message.Height
+	case browserDoneMsg:
+		m.busy = false
+		m.status = message.status
+	case tea.KeyMsg:
+		return m, m.handleKey(message.String())
+	}
+	return m, nil
+}
+
+func (m *browserModel) handleKey(key string) tea.Cmd {
+	node := m.selected()
+	switch key {
+	case "q", "ctrl+c", "esc":
+		return tea.Quit
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.visible)-1 {
+			m.cursor++
+		}
+	case "home":
+		m.cursor = 0
+	case "end":
+		m.cursor = len(m.visible) - 1
+	case "right", "l", "enter", " ":
+		if node != nil && len(node.children) > 0 {
+			node.expanded = !node.expanded || key == "right" || key == "l"
+			m.refresh()
+		}
+	case "left", "h":
+		if node != nil {
+			m.collapse(node)
+		}
+	case "g":
+		if node != nil {
+			return m.start(fmt.Sprintf("Regenerating %s", node.label()), regenerateNode(node, m.options))
+		}
+	case "p":
+		if node == nil || node.config == nil {
+			m.status = "Select a configuration to preview"
+			return nil
+		}
+		return m.start(fmt.Sprintf("Rendering %s for preview", node.label()), previewNode(node, m.options))
+	}
+	return nil
+}
+
+// collapse closes an expanded node, or moves to the parent of a collapsed one
+func (m *browserModel) collapse(node *browserNode) {
+	if node.expanded {
+		node.expanded = false
+		m.refresh()
+		return
+	}
+	for i := m.cursor - 1; i >= 0; i-- {
+		if m.visible[i].depth < node.depth {
+			m.cursor = i
+			return
+		}
+	}
+}
+
+// start runs a regeneration or preview in the background, only one runs at a time
+func (m *browserModel) start(status string, action tea.Cmd) tea.Cmd {
+	if m.busy {
+		m.status = "Still busy, wait for the current render to finish"
+		return nil
+	}
+	m.busy = true
+	m.status = status + "..."
+	return action
+}
+
+func regenerateNode(node *browserNode, options RunOptions) tea.Cmd {
+	return func() tea.Msg {
+		env, err := loadEnvironment()
+		if err != nil {
+			return browserDoneMsg{status: err.Error()}
+		}
+		options.Force = true
+		report := NewRunReport(options)
+		start := time.Now()
+		if _, _, err := generateModules(context.Background(), env, node.selection(), report); err != nil {
+			return browserDoneMsg{status: fmt.Sprintf("Regenerating %s failed: %v", node.label(), err)}
+		}
+		return browserDoneMsg{status: fmt.Sprintf("Regenerated %d configurations of %s in %s", report.Rendered, node.label(), time.Since(start).Round(time.Millisecond))}
+	}
+}
+
+func previewNode(node *browserNode, options RunOptions) tea.Cmd {
+	return func() tea.Msg {
+		env, err := loadEnvironment()
+		if err != nil {
+			return browserDoneMsg{status: err.Error()}
+		}
+		if err := previewConfiguration(env, node.selection(), options); err != nil {
+			return browserDoneMsg{status: fmt.Sprintf("Preview of %s failed: %v", node.label(), err)}
+		}
+		return browserDoneMsg{status: fmt.Sprintf("Opened the preview of %s", node.label())}
+	}
+}
+
+func (m *browserModel) View() string {
+	listWidth := m.width / 2
+	rows := m.height - 3
+	if rows < 1 {
+		rows = 1
+	}
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+
+	details := nodeDetails(m.selected())
+	var view strings.Builder
+	view.WriteString("GOMFD modules  ↑/↓ move  →/← expand  g regenerate  p preview  q quit\n")
+	for row := 0; row < rows; row++ {
+		left := ""
+		if i := m.offset + row; i < len(m.visible) {
+			node := m.visible[i]
+			marker := "  "
+			if len(node.children) > 0 && node.expanded {
+				marker = "▾ "
+			} else if len(node.children) > 0 {
+				marker = "▸ "
+			}
+			left = fitWidth(strings.Repeat("  ", node.depth)+marker+node.label(), listWidth-1)
+			if i == m.cursor {
+				left = "\x1b[7m" + left + "\x1b[0m"
+			}
+		} else {
+			left = fitWidth("", listWidth-1)
+		}
+		right := ""
+		if row < len(details) {
+			right = strings.TrimRight(fitWidth(details[row], m.width-listWidth-2), " ")
+		}
+		view.WriteString(left + " │ " + right + "\n")
+	}
+	view.WriteString("\n" + m.status)
+	return view.String()
+}
+
+// fitWidth pads or truncates text to exactly width runes
+func fitWidth(text string, width int) string {
+	if width < 1 {
+		return ""
+	}
+	runes := []rune(text)
+	if len(runes) > width {
+		return string(runes[:width-1]) + "…"
+	}
+	return text + strings.Repeat(" ", width-len(runes))
+}
+
+// nodeDetails describes the selected module or the resolved geometry of the selected configuration
+func nodeDetails(node *browserNode) []string {
+	if node == nil {
+		return []string{"No modules found"}
+	}
+	module := node.module
+	if node.config == nil {
+		return []string{
+			"Module:         " + module.Name,
+			"Display name:   " + module.DisplayName,
+			"Category:       " + module.Category,
+			"Image:          " + module.FileName,
+			"Module file:    " + module.SourceFile,
+			fmt.Sprintf("Configurations: %d", len(module.Configurations)),
+		}
+	}
+
+	config := node.config
+	display := ""
+	if config.Display != nil {
+		display = config.Display.Name
+	}
+	lines := []string{
+		"Configuration:  " + config.Name,
+		"Module:         " + module.Name,
+		"Display:        " + display,
+		fmt.Sprintf("Position:       %s, %s", intText(config.Left), intText(config.Top)),
+		fmt.Sprintf("Size:           %s x %s", intText(config.Width), intText(config.Height)),
+		fmt.Sprintf("Crop X:         %s - %s", intText(config.XOffsetStart), intText(config.XOffsetFinish)),
+		fmt.Sprintf("Crop Y:         %s - %s", intText(config.YOffsetStart), intText(config.YOffsetFinish)),
+		fmt.Sprintf("Center:         %s", boolText(config.Center)),
+		fmt.Sprintf("Opacity:        %s", opacityText(config.Opacity)),
+		fmt.Sprintf("Enabled:        %s", boolText(config.Enabled)),
+		fmt.Sprintf("UseAsSwitch:    %s", boolText(config.UseAsSwitch)),
+		fmt.Sprintf("Image:          %s%s", config.FileName, existsText(config.FileName)),
+	}
+	if node.output != "" {
+		output := node.output + ".jpg"
+		cached := "not generated"
+		if info, err := os.Stat(output); err == nil {
+			cached = "generated " + info.ModTime().Format("2006-01-02 15:04:05")
+		}
+		lines = append(lines, "Output:         "+output, "Cache:          "+cached)
+	}
+	if len(config.Configurations) > 0 {
+		lines = append(lines, fmt.Sprintf("Sub-configs:    %d", len(config.Configurations)))
+	}
+	return lines
+}
+
+func intText(value *int) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprint(*value)
+}
+
+func boolText(value *bool) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprint(*value)
+}
+
+func opacityText(value *float32) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *value)
+}
+
+func existsText(fileName string) string {
+	if _, err := os.Stat(fileName); err != nil {
+		return " (missing)"
+	}
+	return ""
+}
+
+func newBrowseCommand() *Command {
+	cmd := newCommand("browse", "", "Browse the modules and their resolved configurations, regenerate or preview the selected one")
+	runOptions := addRunFlags(cmd.Flags)
+	output := addOutputFlag(cmd.Flags)
+	cmd.Run = func(args []string) error {
+		useOutputDirectory(*output)
+		model, err := newBrowserModel(*runOptions)
+		if err != nil {
+			return err
+		}
+		instance.Mute(true)
+		defer instance.Mute(false)
+		_, err = tea.NewProgram(model, tea.WithAltScreen()).Run()
+		return err
+	}
+	return cmd
+}
@@ -0,0 +1,46 @@
+package main
+
+import "strings"
+
+// throttleTokens are the values THROTTLE takes when throttleVariants renders both throttles in one run
+var throttleTokens = []string{"WH", "HC"}
+
+// expandThrottleVariants replaces every configuration whose image has THROTTLE in its name by one configuration per
+// throttle named <name>_WH and <name>_HC, a configuration without a fileName takes the one of the module
+func expandThrottleVariants(module *Module) {
+	module.Configurations = tokenVariants(module.Configurations, module.FileName, "THROTTLE", throttleTokens)
+}
+
+// expandSeatVariants replaces every configuration whose image has SEAT in its name by one configuration per seat of
+// the module named <name>_<seat>, so a multicrew module renders a set of outputs for each crew position
+func expandSeatVariants(module *Module) {
+	if len(module.Seats) > 0 {
+		module.Configurations = tokenVariants(module.Configurations, module.FileName, "SEAT", module.Seats)
+	}
+}
+
+// tokenVariants expands the configurations of one level whose image has token in its name into a configuration per
+// value, inherited is the image a configuration without a fileName uses and a sub-configuration of a variant inherits
+// the image of its variant
+func tokenVariants(configs []Configuration, inherited string, token string, values []string) []Configuration {
+	var expanded []Configuration
+	for _, config := range configs {
+		fileName := config.FileName
+		if fileName == "" {
+			fileName = inherited
+		}
+		if !strings.Contains(fileName, token) {
+			config.Configurations = tokenVariants(config.Configurations, fileName, token, values)
+			expanded = append(expanded, config)
+			continue
+		}
+		for _, value := range values {
+			variant := config
+			variant.Name = config.Name + "_" + value
+			variant.FileName = strings.ReplaceAll(fileName, token, value)
+			variant.Configurations = tokenVariants(config.Configurations, variant.FileName, token, values)
+			expanded = append(expanded, variant)
+		}
+	}
+	return expanded
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, set at build time with
+// -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// BuildInfo describes the exact build of gomfd
+type BuildInfo struct {
+	Version   string
+	Commit    string
+	BuildDate string
+	GoVersion string
+}
+
+// currentBuild returns the ldflags metadata, falling back to the VCS details Go embeds when they were not set
+func currentBuild() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range embedded.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+				if len(info.Commit) > 12 {
+					info.Commit = info.Commit[:12]
+				}
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+func (b BuildInfo) String() string {
+	return fmt.Sprintf("GOMFD %s (commit %s, built %s, %s %s/%s)", b.Version, b.Commit, b.BuildDate, b.GoVersion, runtime.GOOS, runtime.GOARCH)
+}
+
+func newVersionCommand() *Command {
+	cmd := newCommand("version", "", "Print the version, commit, build date and Go version")
+	cmd.standalone = true
+	cmd.Run = func(args []string) error {
+		fmt.Println(currentBuild())
+		return nil
+	}
+	return cmd
+}
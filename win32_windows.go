@@ -0,0 +1,296 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Win32 bindings shared by the tray and the display windows
+var (
+	user32   = syscall.NewLazyDLL("user32.dll")
+	shell32  = syscall.NewLazyDLL("shell32.dll")
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+	gdi32    = syscall.NewLazyDLL("gdi32.dll")
+	winmm    = syscall.NewLazyDLL("winmm.dll")
+
+	procRegisterClassExW    = user32.NewProc("RegisterClassExW")
+	procCreateWindowExW     = user32.NewProc("CreateWindowExW")
+	procDestroyWindow       = user32.NewProc("DestroyWindow")
+	procDefWindowProcW      = user32.NewProc("DefWindowProcW")
+	procGetMessageW         = user32.NewProc("GetMessageW")
+	procTranslateMessage    = user32.NewProc("TranslateMessage")
+	procDispatchMessageW    = user32.NewProc("DispatchMessageW")
+	procPostMessageW        = user32.NewProc("PostMessageW")
+	procPostQuitMessage     = user32.NewProc("PostQuitMessage")
+	procLoadIconW           = user32.NewProc("LoadIconW")
+	procCreatePopupMenu     = user32.NewProc("CreatePopupMenu")
+	procAppendMenuW         = user32.NewProc("AppendMenuW")
+	procTrackPopupMenu      = user32.NewProc("TrackPopupMenu")
+	procDestroyMenu         = user32.NewProc("DestroyMenu")
+	procGetCursorPos        = user32.NewProc("GetCursorPos")
+	procSetForegroundWindow = user32.NewProc("SetForegroundWindow")
+	procBeginPaint          = user32.NewProc("BeginPaint")
+	procEndPaint            = user32.NewProc("EndPaint")
+	procLoadCursorW         = user32.NewProc("LoadCursorW")
+	procEnumDisplayMonitors = user32.NewProc("EnumDisplayMonitors")
+	procGetMonitorInfoW     = user32.NewProc("GetMonitorInfoW")
+	procSetProcessDPIAware  = user32.NewProc("SetProcessDPIAware")
+	procRegisterHotKey      = user32.NewProc("RegisterHotKey")
+	procUnregisterHotKey    = user32.NewProc("UnregisterHotKey")
+	procInvalidateRect      = user32.NewProc("InvalidateRect")
+	procShellNotifyIconW    = shell32.NewProc("Shell_NotifyIconW")
+	procStretchDIBits       = gdi32.NewProc("StretchDIBits")
+	procGetStockObject      = gdi32.NewProc("GetStockObject")
+	procJoyGetNumDevs       = winmm.NewProc("joyGetNumDevs")
+	procJoyGetDevCapsW      = winmm.NewProc("joyGetDevCapsW")
+	procJoyGetPosEx         = winmm.NewProc("joyGetPosEx")
+	procGetModuleHandleW    = kernel32.NewProc("GetModuleHandleW")
+)
+
+const (
+	wmNull         = 0x0000
+	wmDestroy      = 0x0002
+	wmPaint        = 0x000F
+	wmClose        = 0x0010
+	wmKeyDown      = 0x0100
+	wmCommand      = 0x0111
+	wmHotkey       = 0x0312
+	wmLButtonUp    = 0x0202
+	wmRButtonUp    = 0x0205
+	wmApp          = 0x8000
+	hwndMessage    = ^uintptr(2) // (HWND)-3
+	idiApplication = 32512
+	idcArrow       = 32512
+	vkEscape       = 0x1B
+
+	wsPopup        = 0x80000000
+	wsVisible      = 0x10000000
+	wsExTopmost    = 0x00000008
+	wsExToolWindow = 0x00000080
+	blackBrush     = 4
+	srcCopy        = 0x00CC0020
+	dibRGBColors   = 0
+
+	monitorInfoPrimary = 0x1
+
+	joyReturnButtons = 0x80
+	joyNoError       = 0
+
+	mfString    = 0x0000
+	mfPopup     = 0x0010
+	mfSeparator = 0x0800
+	mfGrayed    = 0x0001
+
+	tpmRightButton = 0x0002
+	tpmNoNotify    = 0x0080
+	tpmReturnCmd   = 0x0100
+
+	nimAdd     = 0x0
+	nimModify  = 0x1
+	nimDelete  = 0x2
+	nifMessage = 0x1
+	nifIcon    = 0x2
+	nifTip     = 0x4
+	nifInfo    = 0x10
+	niifInfo   = 0x1
+	niifError  = 0x3
+)
+
+type wndClassEx struct {
+	Size       uint32
+	Style      uint32
+	WndProc    uintptr
+	ClsExtra   int32
+	WndExtra   int32
+	Instance   uintptr
+	Icon       uintptr
+	Cursor     uintptr
+	Background uintptr
+	MenuName   *uint16
+	ClassName  *uint16
+	IconSm     uintptr
+}
+
+type point struct {
+	X int32
+	Y int32
+}
+
+type msg struct {
+	HWnd    uintptr
+	Message uint32
+	WParam  uintptr
+	LParam  uintptr
+	Time    uint32
+	Pt      point
+	Private uint32
+}
+
+type rect struct {
+	Left   int32
+	Top    int32
+	Right  int32
+	Bottom int32
+}
+
+type paintStruct struct {
+	HDC       uintptr
+	Erase     int32
+	Paint     rect
+	Restore   int32
+	IncUpdate int32
+	Reserved  [32]byte
+}
+
+type monitorInfoEx struct {
+	Size    uint32
+	Monitor rect
+	Work    rect
+	Flags   uint32
+	Device  [32]uint16
+}
+
+type joyCaps struct {
+	Mid        uint16
+	Pid        uint16
+	Name       [32]uint16
+	XMin       uint32
+	XMax       uint32
+	YMin       uint32
+	YMax       uint32
+	ZMin       uint32
+	ZMax       uint32
+	NumButtons uint32
+	PeriodMin  uint32
+	PeriodMax  uint32
+	RMin       uint32
+	RMax       uint32
+	UMin       uint32
+	UMax       uint32
+	VMin       uint32
+	VMax       uint32
+	Caps       uint32
+	MaxAxes    uint32
+	NumAxes    uint32
+	MaxButtons uint32
+	RegKey     [32]uint16
+	OEMVxD     [260]uint16
+}
+
+type joyInfoEx struct {
+	Size         uint32
+	Flags        uint32
+	XPos         uint32
+	YPos         uint32
+	ZPos         uint32
+	RPos         uint32
+	UPos         uint32
+	VPos         uint32
+	Buttons      uint32
+	ButtonNumber uint32
+	POV          uint32
+	Reserved1    uint32
+	Reserved2    uint32
+}
+
+type bitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   uint32
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+type guid struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
+
+type notifyIconData struct {
+	Size            uint32
+	HWnd            uintptr
+	ID              uint32
+	Flags           uint32
+	CallbackMessage uint32
+	Icon            uintptr
+	Tip             [128]uint16
+	State           uint32
+	StateMask       uint32
+	Info            [256]uint16
+	Version         uint32
+	InfoTitle       [64]uint16
+	InfoFlags       uint32
+	GuidItem        guid
+	BalloonIcon     uintptr
+}
+
+// utf16Ptr converts s for a Win32 call, s never contains NUL characters here
+func utf16Ptr(s string) *uint16 {
+	p, _ := syscall.UTF16PtrFromString(s)
+	return p
+}
+
+// copyUTF16 fills a fixed size Win32 string buffer, truncating s when needed
+func copyUTF16(dst []uint16, s string) {
+	encoded, _ := syscall.UTF16FromString(s)
+	if len(encoded) > len(dst) {
+		encoded = encoded[:len(dst)]
+		encoded[len(encoded)-1] = 0
+	}
+	copy(dst, encoded)
+}
+
+func moduleHandle() uintptr {
+	handle, _, _ := procGetModuleHandleW.Call(0)
+	return handle
+}
+
+// registeredClasses are the window classes registered so far, a class is registered once however often its windows are opened
+var registeredClasses = map[string]bool{}
+
+// registerWindowClass registers a window class with a Go window procedure
+func registerWindowClass(className string, wndProc func(hwnd uintptr, message uint32, wParam uintptr, lParam uintptr) uintptr, background uintptr) error {
+	if registeredClasses[className] {
+		return nil
+	}
+	cursor, _, _ := procLoadCursorW.Call(0, idcArrow)
+	class := wndClassEx{
+		WndProc:    syscall.NewCallback(wndProc),
+		Instance:   moduleHandle(),
+		Cursor:     cursor,
+		Background: background,
+		ClassName:  utf16Ptr(className),
+	}
+	class.Size = uint32(unsafe.Sizeof(class))
+	if atom, _, err := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&class))); atom == 0 {
+		return err
+	}
+	registeredClasses[className] = true
+	return nil
+}
+
+func defWindowProc(hwnd uintptr, message uint32, wParam uintptr, lParam uintptr) uintptr {
+	result, _, _ := procDefWindowProcW.Call(hwnd, uintptr(message), wParam, lParam)
+	return result
+}
+
+// runMessageLoop dispatches window messages until WM_QUIT, it must run on the thread that created the windows
+func runMessageLoop() {
+	var m msg
+	for {
+		result, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+		if int32(result) <= 0 {
+			return
+		}
+		procTranslateMessage.Call(uintptr(unsafe.Pointer(&m)))
+		procDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+	}
+}